@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Account statuses
+const (
+	AccountActive    = "active"    // Normal operation
+	AccountFrozen    = "frozen"    // Can sign in and receive money, but cannot send or spend
+	AccountSuspended = "suspended" // Cannot sign in or send money; can still receive
+	AccountClosed    = "closed"    // Permanently closed; cannot sign in, send or receive
+)
+
+// isValidAccountStatus reports whether status is a known account status
+func isValidAccountStatus(status string) bool {
+	switch status {
+	case AccountActive, AccountFrozen, AccountSuspended, AccountClosed:
+		return true
+	}
+	return false
+}
+
+// accountCanSignIn reports whether a user in the given status may authenticate
+func accountCanSignIn(status string) bool {
+	return status == AccountActive || status == AccountFrozen
+}
+
+// checkAccountCanSend returns an error unless the account may move money out
+func checkAccountCanSend(tx *sql.Tx, userID int) error {
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM users WHERE id = ?`, userID).Scan(&status); err != nil {
+		return err
+	}
+
+	if status != AccountActive {
+		return fmt.Errorf("account is %s and cannot send money", status)
+	}
+
+	return nil
+}
+
+// checkAccountCanReceive returns an error if the account may not receive money
+func checkAccountCanReceive(tx *sql.Tx, userID int) error {
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM users WHERE id = ?`, userID).Scan(&status); err != nil {
+		return err
+	}
+
+	if status == AccountClosed {
+		return fmt.Errorf("recipient account is closed")
+	}
+
+	return nil
+}
+
+// setAccountStatusInTx changes a user's status and records the change in the status history
+func setAccountStatusInTx(tx *sql.Tx, userID int, newStatus, reason, actor string) (string, error) {
+	var oldStatus, username string
+	err := tx.QueryRow(`SELECT status, username FROM users WHERE id = ?`, userID).Scan(&oldStatus, &username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", err
+	}
+
+	if username == "PokéBank" {
+		return "", fmt.Errorf("the PokéBank system account status cannot be changed")
+	}
+
+	if oldStatus == AccountClosed {
+		return "", fmt.Errorf("account is closed")
+	}
+
+	if oldStatus == newStatus {
+		return "", fmt.Errorf("account is already %s", newStatus)
+	}
+
+	if _, err = tx.Exec(`UPDATE users SET status = ? WHERE id = ?`, newStatus, userID); err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO account_status_history (user_id, old_status, new_status, reason, actor, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, oldStatus, newStatus, reason, actor, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	// Signed-out states end every session
+	if !accountCanSignIn(newStatus) {
+		if _, err = tx.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, userID); err != nil {
+			return "", err
+		}
+		if _, err = tx.Exec(`UPDATE oauth_access_tokens SET revoked = TRUE WHERE user_id = ?`, userID); err != nil {
+			return "", err
+		}
+	}
+
+	return oldStatus, nil
+}
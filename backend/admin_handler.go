@@ -2,23 +2,31 @@ package main
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AdminHandler handles administrative operations
 type AdminHandler struct {
-	bankingService *BankingService
-	userService    *UserService
-	webhookService *WebhookService
+	bankingService    *BankingService
+	userService       *UserService
+	webhookService    *WebhookService
+	credentialService *AdminCredentialService
+	auditService      *AuditService
+	merchantService   *MerchantService
 }
 
 // NewAdminHandler creates a new AdminHandler
-func NewAdminHandler(bankingService *BankingService, userService *UserService, webhookService *WebhookService) *AdminHandler {
+func NewAdminHandler(bankingService *BankingService, userService *UserService, webhookService *WebhookService, credentialService *AdminCredentialService, auditService *AuditService, merchantService *MerchantService) *AdminHandler {
 	return &AdminHandler{
-		bankingService: bankingService,
-		userService:    userService,
-		webhookService: webhookService,
+		bankingService:    bankingService,
+		userService:       userService,
+		webhookService:    webhookService,
+		credentialService: credentialService,
+		auditService:      auditService,
+		merchantService:   merchantService,
 	}
 }
 
@@ -68,6 +76,7 @@ func (h *AdminHandler) AdjustBalanceHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated balance"})
 		return
 	}
+	setAuditBalances(c, req.UserID, user.Balance, newBalance)
 
 	// Send webhook notification
 	go h.webhookService.SendAdminTransactionWebhook(transaction.ID, req.UserID, user.Username, req.Amount, req.Description, req.MerchantName)
@@ -80,6 +89,49 @@ func (h *AdminHandler) AdjustBalanceHandler(c *gin.Context) {
 	})
 }
 
+// ReverseTransactionHandler handles POST /api/admin/transactions/:id/reverse, moving a transaction's funds back
+// from its recipient to its sender
+func (h *AdminHandler) ReverseTransactionHandler(c *gin.Context) {
+	transactionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	var req ReverseTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	original, err := h.bankingService.GetTransactionByID(transactionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	recipient, err := h.userService.GetUserByID(original.ToUserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	reversal, err := h.bankingService.ReverseTransaction(transactionID, req.Amount, req.Reason)
+	if err != nil {
+		respondReversalError(c, "Reversal failed", err)
+		return
+	}
+	setAuditBalances(c, recipient.ID, recipient.Balance, roundCents(recipient.Balance-reversal.Amount))
+
+	// Send webhook notification
+	go h.webhookService.SendTransactionReversedWebhook(reversal, c.GetString("adminActor"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Transaction reversed successfully",
+		"transaction": reversal,
+	})
+}
+
 // GetAllUsersHandler returns all users with their balances (admin only)
 func (h *AdminHandler) GetAllUsersHandler(c *gin.Context) {
 	users, err := h.userService.GetAllUsers()
@@ -114,12 +166,14 @@ func (h *AdminHandler) GetUserByAccountHandler(c *gin.Context) {
 	})
 }
 
-// CreateMerchantTransactionRequest represents a merchant transaction request
+// CreateMerchantTransactionRequest represents a merchant transaction request. The merchant is given by ID or
+// by name; names that aren't registered are recorded against PokéBank.
 type CreateMerchantTransactionRequest struct {
 	UserID      int     `json:"user_id" binding:"required"`
 	Amount      float64 `json:"amount" binding:"required"`
 	Description string  `json:"description" binding:"required"`
-	MerchantName string `json:"merchant_name" binding:"required"`
+	MerchantID  *int    `json:"merchant_id"`
+	MerchantName string `json:"merchant_name"`
 }
 
 // BankTransferRequest represents a transfer from PokéBank to a user
@@ -170,6 +224,10 @@ func (h *AdminHandler) BankTransferHandler(c *gin.Context) {
 		return
 	}
 
+	if newBalance, err := h.bankingService.GetUserBalance(recipient.ID); err == nil {
+		setAuditBalances(c, recipient.ID, recipient.Balance, newBalance)
+	}
+
 	// Send webhook notification
 	go h.webhookService.SendTransferWebhook(transaction)
 
@@ -195,8 +253,33 @@ func (h *AdminHandler) CreateMerchantTransactionHandler(c *gin.Context) {
 		return
 	}
 
+	// Find the registered merchant
+	var merchant *Merchant
+	if req.MerchantID != nil {
+		merchant, err = h.merchantService.GetMerchantByID(*req.MerchantID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+			return
+		}
+	} else if req.MerchantName != "" {
+		merchant, err = h.merchantService.GetMerchantByName(req.MerchantName)
+		if err != nil && err != errMerchantNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up merchant"})
+			return
+		}
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id or merchant_name is required"})
+		return
+	}
+
 	// Create merchant transaction
-	transaction, err := h.bankingService.CreateMerchantTransaction(req.UserID, req.Amount, req.Description, req.MerchantName)
+	var transaction *Transaction
+	if merchant != nil {
+		transaction, err = h.bankingService.CreateMerchantTransaction(req.UserID, req.Amount, req.Description, merchant)
+		req.MerchantName = merchant.Name
+	} else {
+		transaction, err = h.bankingService.CreateAdminTransaction(req.UserID, req.Amount, req.Description, req.MerchantName)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create merchant transaction", "details": err.Error()})
 		return
@@ -208,9 +291,10 @@ func (h *AdminHandler) CreateMerchantTransactionHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated balance"})
 		return
 	}
+	setAuditBalances(c, req.UserID, user.Balance, newBalance)
 
 	// Send webhook notification
-	go h.webhookService.SendMerchantTransactionWebhook(transaction.ID, req.UserID, user.Username, req.Amount, req.Description, req.MerchantName)
+	go h.webhookService.SendMerchantTransactionWebhook(transaction.ID, req.UserID, user.Username, req.Amount, req.Description, req.MerchantName, transaction.MerchantID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":     true,
@@ -219,3 +303,323 @@ func (h *AdminHandler) CreateMerchantTransactionHandler(c *gin.Context) {
 		"new_balance": newBalance,
 	})
 }
+
+// CreateCredentialRequest represents a request to issue a named admin credential
+type CreateCredentialRequest struct {
+	Name string `json:"name" binding:"required"`
+	Role string `json:"role" binding:"required,oneof=support treasurer admin"`
+}
+
+// UpdateRoleRequest represents a request to change a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=player support treasurer admin"`
+}
+
+// SetPokeBankPasswordRequest represents a request to set the PokéBank login password
+type SetPokeBankPasswordRequest struct {
+	Password string `json:"password" binding:"required,min=12"`
+}
+
+// CreateCredentialHandler issues a new named admin credential
+func (h *AdminHandler) CreateCredentialHandler(c *gin.Context) {
+	var req CreateCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	credential, key, err := h.credentialService.CreateCredential(req.Name, req.Role, c.GetString("adminActor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The key is only ever shown once
+	c.JSON(http.StatusCreated, gin.H{
+		"success":    true,
+		"message":    "Admin credential created successfully",
+		"credential": credential,
+		"key":        key,
+	})
+}
+
+// GetCredentialsHandler lists all named admin credentials
+func (h *AdminHandler) GetCredentialsHandler(c *gin.Context) {
+	credentials, err := h.credentialService.GetAllCredentials()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get credentials"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"credentials": credentials,
+	})
+}
+
+// RevokeCredentialHandler revokes a named admin credential
+func (h *AdminHandler) RevokeCredentialHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential ID"})
+		return
+	}
+
+	if err := h.credentialService.RevokeCredential(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Admin credential revoked",
+	})
+}
+
+// UpdateUserRoleHandler changes a user's role
+func (h *AdminHandler) UpdateUserRoleHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.Username == "PokéBank" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The PokéBank system account cannot be given a role"})
+		return
+	}
+
+	if err := h.userService.UpdateRole(userID, req.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Force re-login so the new role applies to fresh sessions only
+	h.userService.DeleteAllUserSessions(userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Role updated successfully",
+		"username": user.Username,
+		"role":     req.Role,
+	})
+}
+
+// SetPokeBankPasswordHandler sets the PokéBank account login password
+func (h *AdminHandler) SetPokeBankPasswordHandler(c *gin.Context) {
+	var req SetPokeBankPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	if err := h.userService.ConfigurePokeBankLogin(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set PokéBank password", "details": err.Error()})
+		return
+	}
+
+	// Sign out existing PokéBank sessions
+	if pokeBank, err := h.userService.GetUserByUsername("PokéBank"); err == nil {
+		h.userService.DeleteAllUserSessions(pokeBank.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "PokéBank password updated",
+	})
+}
+
+// GetAuditLogHandler returns admin audit log entries, filtered by actor, route, target user and time range
+func (h *AdminHandler) GetAuditLogHandler(c *gin.Context) {
+	filter := AuditLogFilter{
+		Actor: c.Query("actor"),
+		Route: c.Query("route"),
+	}
+
+	if targetUserID := c.Query("target_user_id"); targetUserID != "" {
+		id, err := strconv.Atoi(targetUserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target_user_id"})
+			return
+		}
+		filter.TargetUserID = id
+	}
+
+	for param, dest := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " timestamp, expected RFC 3339"})
+			return
+		}
+		*dest = parsed
+	}
+
+	// Parse pagination parameters (default 50, max 500)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	filter.Limit = limit
+	filter.Offset = offset
+
+	entries, total, err := h.auditService.GetEntries(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// UpdateAccountStatusRequest represents a request to freeze, suspend or reactivate an account
+type UpdateAccountStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active frozen suspended"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+// CloseAccountRequest represents a request to close an account
+type CloseAccountRequest struct {
+	SweepTo string `json:"sweep_to"` // Username or account number receiving the remaining balance
+	Reason  string `json:"reason" binding:"required"`
+}
+
+// UpdateAccountStatusHandler freezes, suspends or reactivates an account
+func (h *AdminHandler) UpdateAccountStatusHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateAccountStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	actor := c.GetString("adminActor")
+	oldStatus, err := h.userService.SetAccountStatus(userID, req.Status, req.Reason, actor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendAccountStatusWebhook(user.ID, user.Username, oldStatus, req.Status, req.Reason, actor)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "Account status updated",
+		"username":   user.Username,
+		"old_status": oldStatus,
+		"status":     req.Status,
+	})
+}
+
+// CloseAccountHandler closes an account, sweeping its balance to another account
+func (h *AdminHandler) CloseAccountHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req CloseAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Sweep to PokéBank unless another account is chosen
+	sweepTo := req.SweepTo
+	if sweepTo == "" {
+		sweepTo = "PokéBank"
+	}
+	sweepAccount, err := h.userService.GetUserByUsernameOrAccountNumber(sweepTo)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sweep account not found"})
+		return
+	}
+
+	actor := c.GetString("adminActor")
+	transaction, err := h.bankingService.CloseAccount(userID, sweepAccount.AccountNumber, req.Reason, actor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditBalances(c, userID, user.Balance, 0)
+
+	// Send webhook notifications
+	go h.webhookService.SendAccountStatusWebhook(user.ID, user.Username, user.Status, AccountClosed, req.Reason, actor)
+	if transaction != nil {
+		go h.webhookService.SendTransferWebhook(transaction)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Account closed",
+		"username":    user.Username,
+		"transaction": transaction,
+	})
+}
+
+// GetAccountStatusHistoryHandler returns a user's account status history
+func (h *AdminHandler) GetAccountStatusHistoryHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	history, err := h.userService.GetAccountStatusHistory(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get status history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"history": history,
+	})
+}
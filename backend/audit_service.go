@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditGenesisHash is the previous-hash value of the first audit log entry
+const auditGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// auditTimeLayout is a fixed-width UTC timestamp format, so stored timestamps sort and compare as text
+const auditTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// auditRedactedFields are request body fields never written to the audit log
+var auditRedactedFields = map[string]bool{
+	"password":      true,
+	"client_secret": true,
+	"key":           true,
+	"pin":           true,
+	"cvv":           true,
+}
+
+// AuditService records and verifies the hash-chained admin audit log
+type AuditService struct {
+	db *sql.DB
+	mu sync.Mutex // Serializes appends so each entry chains to the latest one
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService(db *sql.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// AuditLogFilter narrows down audit log queries
+type AuditLogFilter struct {
+	Actor        string
+	Route        string
+	TargetUserID int
+	From         time.Time
+	To           time.Time
+	Limit        int
+	Offset       int
+}
+
+// Record appends an entry to the audit log, chaining it to the previous entry
+func (s *AuditService) Record(entry *AuditLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Get the hash of the latest entry
+	prevHash := auditGenesisHash
+	err = tx.QueryRow(`SELECT hash FROM admin_audit_log ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	entry.CreatedAt = time.Now().UTC().Format(auditTimeLayout)
+	entry.PrevHash = prevHash
+	entry.Hash = computeAuditHash(entry)
+
+	result, err := tx.Exec(`
+		INSERT INTO admin_audit_log (actor, role, method, route, path, request_body, status_code, target_user_id,
+		                             balance_before, balance_after, ip_address, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Actor, entry.Role, entry.Method, entry.Route, entry.Path, entry.RequestBody, entry.StatusCode,
+		entry.TargetUserID, entry.BalanceBefore, entry.BalanceAfter, entry.IPAddress, entry.CreatedAt,
+		entry.PrevHash, entry.Hash)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = int(id)
+
+	return tx.Commit()
+}
+
+// GetEntries returns audit log entries matching the filter, newest first, with the total match count
+func (s *AuditService) GetEntries(filter AuditLogFilter) ([]AuditLogEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Route != "" {
+		conditions = append(conditions, "route = ?")
+		args = append(args, filter.Route)
+	}
+	if filter.TargetUserID != 0 {
+		conditions = append(conditions, "target_user_id = ?")
+		args = append(args, filter.TargetUserID)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From.UTC().Format(auditTimeLayout))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.To.UTC().Format(auditTimeLayout))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM admin_audit_log `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := auditLogSelect + where + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	rows, err := s.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []AuditLogEntry
+	for rows.Next() {
+		entry, err := scanAuditLogEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, total, nil
+}
+
+// Verify walks the whole audit log and checks every entry's hash and link to its predecessor.
+// It returns the number of entries checked, or an error describing the first broken entry.
+func (s *AuditService) Verify() (int, error) {
+	rows, err := s.db.Query(auditLogSelect + ` ORDER BY id ASC`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	checked := 0
+	prevHash := auditGenesisHash
+	for rows.Next() {
+		entry, err := scanAuditLogEntry(rows)
+		if err != nil {
+			return checked, err
+		}
+
+		if entry.PrevHash != prevHash {
+			return checked, fmt.Errorf("entry %d does not link to the previous entry", entry.ID)
+		}
+		if computeAuditHash(entry) != entry.Hash {
+			return checked, fmt.Errorf("entry %d has been modified", entry.ID)
+		}
+
+		prevHash = entry.Hash
+		checked++
+	}
+
+	return checked, rows.Err()
+}
+
+// auditLogSelect selects every audit log column
+const auditLogSelect = `
+	SELECT id, actor, role, method, route, path, request_body, status_code, target_user_id,
+	       balance_before, balance_after, ip_address, created_at, prev_hash, hash
+	FROM admin_audit_log `
+
+// scanAuditLogEntry scans an audit log row into an AuditLogEntry
+func scanAuditLogEntry(row rowScanner) (*AuditLogEntry, error) {
+	entry := &AuditLogEntry{}
+	var requestBody, ipAddress sql.NullString
+	var targetUserID sql.NullInt64
+	var balanceBefore, balanceAfter sql.NullFloat64
+
+	err := row.Scan(
+		&entry.ID, &entry.Actor, &entry.Role, &entry.Method, &entry.Route, &entry.Path,
+		&requestBody, &entry.StatusCode, &targetUserID, &balanceBefore, &balanceAfter,
+		&ipAddress, &entry.CreatedAt, &entry.PrevHash, &entry.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.RequestBody = requestBody.String
+	entry.IPAddress = ipAddress.String
+	if targetUserID.Valid {
+		id := int(targetUserID.Int64)
+		entry.TargetUserID = &id
+	}
+	if balanceBefore.Valid {
+		entry.BalanceBefore = &balanceBefore.Float64
+	}
+	if balanceAfter.Valid {
+		entry.BalanceAfter = &balanceAfter.Float64
+	}
+
+	return entry, nil
+}
+
+// computeAuditHash hashes an entry's contents together with the previous entry's hash
+func computeAuditHash(entry *AuditLogEntry) string {
+	optionalInt := func(v *int) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+	optionalFloat := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+
+	// JSON-encode the fields so values containing separators can't be shifted between fields
+	content, _ := json.Marshal([]string{
+		entry.PrevHash, entry.CreatedAt, entry.Actor, entry.Role, entry.Method, entry.Route, entry.Path,
+		entry.RequestBody, strconv.Itoa(entry.StatusCode), optionalInt(entry.TargetUserID),
+		optionalFloat(entry.BalanceBefore), optionalFloat(entry.BalanceAfter), entry.IPAddress,
+	})
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// redactAuditBody removes secrets from a JSON request body before it is logged
+func redactAuditBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		// Not a JSON object; keep it as-is
+		return string(body)
+	}
+
+	for name := range fields {
+		if auditRedactedFields[strings.ToLower(name)] {
+			fields[name] = "[REDACTED]"
+		}
+	}
+
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+// setAuditBalances records the balance of the user affected by an admin action
+func setAuditBalances(c *gin.Context, userID int, before, after float64) {
+	c.Set("auditTargetUserID", userID)
+	c.Set("auditBalanceBefore", before)
+	c.Set("auditBalanceAfter", after)
+}
+
+// auditMiddleware records every authenticated admin request in the audit log
+func auditMiddleware(auditService *AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Read the body and put it back for the handler
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+
+		c.Next()
+
+		entry := &AuditLogEntry{
+			Actor:       c.GetString("adminActor"),
+			Role:        c.GetString("adminRole"),
+			Method:      c.Request.Method,
+			Route:       c.FullPath(),
+			Path:        c.Request.URL.Path,
+			RequestBody: redactAuditBody(body),
+			StatusCode:  c.Writer.Status(),
+			IPAddress:   c.ClientIP(),
+		}
+
+		if userID, ok := c.Get("auditTargetUserID"); ok {
+			id := userID.(int)
+			entry.TargetUserID = &id
+		}
+		if before, ok := c.Get("auditBalanceBefore"); ok {
+			value := before.(float64)
+			entry.BalanceBefore = &value
+		}
+		if after, ok := c.Get("auditBalanceAfter"); ok {
+			value := after.(float64)
+			entry.BalanceAfter = &value
+		}
+
+		if err := auditService.Record(entry); err != nil {
+			fmt.Printf("Error recording audit log entry: %v\n", err)
+		}
+	}
+}
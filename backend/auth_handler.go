@@ -16,16 +16,27 @@ import (
 type AuthHandler struct {
 	userService    *UserService
 	webhookService *WebhookService
+	mailer         Mailer
 }
 
 // NewAuthHandler creates a new AuthHandler
-func NewAuthHandler(userService *UserService, webhookService *WebhookService) *AuthHandler {
+func NewAuthHandler(userService *UserService, webhookService *WebhookService, mailer Mailer) *AuthHandler {
 	return &AuthHandler{
 		userService:    userService,
 		webhookService: webhookService,
+		mailer:         mailer,
 	}
 }
 
+// One-time token purposes and lifetimes
+const (
+	tokenPurposeEmailVerification = "email_verification"
+	tokenPurposePasswordReset     = "password_reset"
+
+	emailVerificationTokenTTL = 48 * time.Hour
+	passwordResetTokenTTL     = 1 * time.Hour
+)
+
 // LoginRequest represents a login request
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
@@ -55,6 +66,23 @@ type ChangePasswordRequest struct {
 	ConfirmNewPassword string `json:"confirmNewPassword" binding:"required"`
 }
 
+// PasswordResetRequest represents a request to email a password reset token
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordResetConfirmRequest represents a password reset using an emailed token
+type PasswordResetConfirmRequest struct {
+	Token              string `json:"token" binding:"required"`
+	NewPassword        string `json:"newPassword" binding:"required"`
+	ConfirmNewPassword string `json:"confirmNewPassword" binding:"required"`
+}
+
+// VerifyEmailRequest represents an email verification request
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
 // Login handles user login
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
@@ -74,26 +102,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Verify password
-	var passwordValid bool
-	
-	// Special case for PokéBank account - use admin key as password
-	if user.Username == "PokéBank" {
-		adminKey := getEnv("ADMIN_KEY", "")
-		if adminKey == "" {
-			c.JSON(http.StatusServiceUnavailable, LoginResponse{
-				Success: false,
-				Message: "PokéBank login not available",
-			})
-			return
-		}
-		
-		passwordValid = (req.Password == adminKey)
-	} else {
-		// Regular user authentication
-		passwordValid = h.userService.VerifyPassword(user, req.Password)
-	}
-	
-	if !passwordValid {
+	if !h.userService.VerifyPassword(user, req.Password) {
 		c.JSON(http.StatusUnauthorized, LoginResponse{
 			Success: false,
 			Message: "Invalid username or password",
@@ -101,6 +110,15 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Suspended and closed accounts can't sign in
+	if !accountCanSignIn(user.Status) {
+		c.JSON(http.StatusForbidden, LoginResponse{
+			Success: false,
+			Message: "This account is " + user.Status + ". Please contact support.",
+		})
+		return
+	}
+
 	// Generate session token
 	token, err := generateSessionToken()
 	if err != nil {
@@ -156,6 +174,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Send verification email
+	go h.sendVerificationEmail(user)
+
 	// Send webhook notification
 	go h.webhookService.SendUserAuthWebhook(user.ID, user.Username, user.Email, "register")
 
@@ -189,32 +210,11 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	}
 
 	// Verify current password
-	var currentPasswordValid bool
-	
-	// Special case for PokéBank account - use admin key for current password verification
-	if user.Username == "PokéBank" {
-		adminKey := getEnv("ADMIN_KEY", "")
-		if adminKey == "" {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "PokéBank password change not available"})
-			return
-		}
-		currentPasswordValid = (req.CurrentPassword == adminKey)
-	} else {
-		// Regular user authentication
-		currentPasswordValid = h.userService.VerifyPassword(user, req.CurrentPassword)
-	}
-	
-	if !currentPasswordValid {
+	if !h.userService.VerifyPassword(user, req.CurrentPassword) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
 		return
 	}
 
-	// Prevent password changes for PokéBank account
-	if user.Username == "PokéBank" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "PokéBank password cannot be changed. It is tied to the admin key."})
-		return
-	}
-
 	// Validate new password
 	if err := h.validatePassword(req.NewPassword); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -270,6 +270,175 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	})
 }
 
+// RequestPasswordReset handles POST /api/password-reset/request
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	// Always respond the same way so the endpoint can't be used to discover accounts
+	response := gin.H{
+		"success": true,
+		"message": "If an account exists for that email, a password reset link has been sent.",
+	}
+
+	user, err := h.userService.GetUserByEmail(req.Email)
+	if err != nil || user.Username == "PokéBank" {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := h.userService.CreateUserToken(user.ID, tokenPurposePasswordReset, passwordResetTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	body := fmt.Sprintf(
+		"Hi %s,\n\nSomeone asked to reset the password for your Viridian City Bank account.\n\n"+
+			"Your reset token is:\n\n    %s\n\nIt expires in %d minutes. If you didn't ask for this, you can ignore this email.\n",
+		user.Username, token, int(passwordResetTokenTTL.Minutes()),
+	)
+
+	go func() {
+		if err := h.mailer.SendMail(user.Email, "Reset your Viridian City Bank password", body); err != nil {
+			fmt.Printf("Error sending password reset email: %v\n", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ConfirmPasswordReset handles POST /api/password-reset/confirm
+func (h *AuthHandler) ConfirmPasswordReset(c *gin.Context) {
+	var req PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	// Validate new password before spending the token
+	if err := h.validatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.NewPassword != req.ConfirmNewPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New passwords do not match"})
+		return
+	}
+
+	userID, err := h.userService.ConsumeUserToken(req.Token, tokenPurposePasswordReset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.userService.UpdatePassword(user.ID, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Invalidate all user sessions and third-party access (force re-login)
+	if err := h.userService.RevokeAllUserAccess(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out existing sessions"})
+		return
+	}
+
+	// Receiving the reset email proves the address works
+	if !user.EmailVerified {
+		h.userService.MarkEmailVerified(user.ID)
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendUserAuthWebhook(user.ID, user.Username, user.Email, "password_reset")
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password reset successfully. Please log in with your new password.",
+	})
+}
+
+// VerifyEmail handles GET and POST /api/verify-email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	// Links in emails carry the token in the query string
+	token := c.Query("token")
+	if token == "" {
+		var req VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+			return
+		}
+		token = req.Token
+	}
+
+	userID, err := h.userService.ConsumeUserToken(token, tokenPurposeEmailVerification)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	if err := h.userService.MarkEmailVerified(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(userID)
+	if err == nil {
+		go h.webhookService.SendUserAuthWebhook(user.ID, user.Username, user.Email, "email_verified")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Email address verified",
+	})
+}
+
+// ResendVerificationEmail handles POST /api/verify-email/resend
+func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email address is already verified"})
+		return
+	}
+
+	go h.sendVerificationEmail(user)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Verification email sent",
+	})
+}
+
+// sendVerificationEmail creates a verification token and emails it to the user
+func (h *AuthHandler) sendVerificationEmail(user *User) {
+	token, err := h.userService.CreateUserToken(user.ID, tokenPurposeEmailVerification, emailVerificationTokenTTL)
+	if err != nil {
+		fmt.Printf("Error creating verification token: %v\n", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/api/verify-email?token=%s", strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/"), token)
+	body := fmt.Sprintf(
+		"Hi %s,\n\nWelcome to Viridian City Bank! Please confirm your email address by opening this link:\n\n    %s\n\n"+
+			"The link expires in %d hours.\n",
+		user.Username, link, int(emailVerificationTokenTTL.Hours()),
+	)
+
+	if err := h.mailer.SendMail(user.Email, "Verify your Viridian City Bank email", body); err != nil {
+		fmt.Printf("Error sending verification email: %v\n", err)
+	}
+}
+
 // validateRegistration validates registration input
 func (h *AuthHandler) validateRegistration(req *RegisterRequest) error {
 	// Validate username
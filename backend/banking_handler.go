@@ -1,27 +1,31 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // BankingHandler handles banking-related HTTP requests
 type BankingHandler struct {
-	service        *BankingService
-	userService    *UserService
-	webhookService *WebhookService
-	cardService    *CardService
+	service              *BankingService
+	userService          *UserService
+	webhookService       *WebhookService
+	cardService          *CardService
+	sharedAccountService *SharedAccountService
 }
 
 // NewBankingHandler creates a new BankingHandler
-func NewBankingHandler(service *BankingService, userService *UserService, webhookService *WebhookService, cardService *CardService) *BankingHandler {
+func NewBankingHandler(service *BankingService, userService *UserService, webhookService *WebhookService, cardService *CardService, sharedAccountService *SharedAccountService) *BankingHandler {
 	return &BankingHandler{
-		service:        service,
-		userService:    userService,
-		webhookService: webhookService,
-		cardService:    cardService,
+		service:              service,
+		userService:          userService,
+		webhookService:       webhookService,
+		cardService:          cardService,
+		sharedAccountService: sharedAccountService,
 	}
 }
 
@@ -35,7 +39,27 @@ func (h *BankingHandler) GetBalanceHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"balance": balance})
+	available, err := h.service.GetUserAvailableBalance(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	savings, err := h.service.GetUserPotsBalance(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	// "balance" is the ledger balance; "available_balance" excludes funds held by card authorizations.
+	// "savings_balance" is held in savings pots, apart from the main balance.
+	c.JSON(http.StatusOK, gin.H{
+		"balance":           balance,
+		"ledger_balance":    balance,
+		"available_balance": available,
+		"held":              balance - available,
+		"savings_balance":   savings,
+	})
 }
 
 // TransferRequest represents the request body for transfers
@@ -62,6 +86,12 @@ func (h *BankingHandler) TransferHandler(c *gin.Context) {
 		return
 	}
 
+	// Members sending from a shared account may need other members' approval
+	if member, ok := c.Get("accountMember"); ok {
+		h.sharedTransfer(c, member.(*AccountMember), targetUser, &req)
+		return
+	}
+
 	transaction, err := h.service.Transfer(userID, targetUser.AccountNumber, req.Amount, req.Description)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -77,12 +107,43 @@ func (h *BankingHandler) TransferHandler(c *gin.Context) {
 	})
 }
 
+// sharedTransfer sends a transfer from a shared account, or leaves it pending if it needs more approvals
+func (h *BankingHandler) sharedTransfer(c *gin.Context, member *AccountMember, targetUser *User, req *TransferRequest) {
+	transfer, transaction, err := h.sharedAccountService.InitiateTransfer(member.AccountID, member.UserID, targetUser.ID, req.Amount, req.Description)
+	if err != nil {
+		respondSharedAccountError(c, "Transfer failed", err)
+		return
+	}
+
+	if transaction == nil {
+		// Send webhook notification
+		go h.webhookService.SendSharedTransferWebhook("shared_transfer_pending", transfer)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  fmt.Sprintf("Transfer is waiting for %d more approvals", transfer.ApprovalsRequired-len(transfer.ApprovedBy)),
+			"transfer": transfer,
+		})
+		return
+	}
+
+	// Send webhook notifications
+	go h.webhookService.SendSharedTransferWebhook("shared_transfer_executed", transfer)
+	go h.webhookService.SendTransferWebhook(transaction)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Transfer completed successfully",
+		"transaction": transaction,
+		"transfer":    transfer,
+	})
+}
+
 // PaymentRequestRequest represents the request body for payment requests
 type PaymentRequestRequest struct {
-	To      string  `json:"to" binding:"required"`      // Can be username or account number
-	Amount  float64 `json:"amount" binding:"required,gt=0"`
-	Reason  string  `json:"reason" binding:"required"`
-	Message string  `json:"message"`
+	To        string     `json:"to" binding:"required"` // Can be username or account number
+	Amount    float64    `json:"amount" binding:"required,gt=0"`
+	Reason    string     `json:"reason" binding:"required"`
+	Message   string     `json:"message"`
+	ExpiresAt *time.Time `json:"expires_at"` // Optional; the request expires if it isn't paid by then
 }
 
 // CreatePaymentRequestHandler handles POST /api/payment-requests
@@ -102,7 +163,7 @@ func (h *BankingHandler) CreatePaymentRequestHandler(c *gin.Context) {
 		return
 	}
 
-	paymentRequest, err := h.service.CreatePaymentRequest(userID, targetUser.AccountNumber, req.Amount, req.Reason, req.Message)
+	paymentRequest, err := h.service.CreatePaymentRequest(userID, targetUser.AccountNumber, req.Amount, req.Reason, req.Message, req.ExpiresAt)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -140,6 +201,56 @@ func (h *BankingHandler) GetTransactionsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
 }
 
+// ReverseTransactionRequest represents the request body for refunding or reversing a transaction
+type ReverseTransactionRequest struct {
+	Amount float64 `json:"amount" binding:"gte=0"` // Omit or 0 to return everything not yet refunded or reversed
+	Reason string  `json:"reason"`
+}
+
+// RefundTransactionHandler handles POST /api/transactions/:id/refund, returning a transfer the user received
+func (h *BankingHandler) RefundTransactionHandler(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+
+	transactionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	var req ReverseTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	refund, err := h.service.RefundTransaction(transactionID, user.ID, req.Amount, req.Reason)
+	if err != nil {
+		respondReversalError(c, "Refund failed", err)
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendTransactionReversedWebhook(refund, "user:"+user.Username)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Refund sent to " + refund.ToUsername,
+		"transaction": refund,
+	})
+}
+
+// respondReversalError responds 404 for unknown transactions, 409 once nothing is left to return, otherwise 400
+func respondReversalError(c *gin.Context, message string, err error) {
+	switch err {
+	case errTransactionNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+	case errAlreadyRefunded, errRefundExceedsPayment:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+	}
+}
+
 // GetPaymentRequestsHandler handles GET /api/payment-requests
 func (h *BankingHandler) GetPaymentRequestsHandler(c *gin.Context) {
 	userID := c.GetInt("userID")
@@ -156,9 +267,35 @@ func (h *BankingHandler) GetPaymentRequestsHandler(c *gin.Context) {
 	})
 }
 
+// GetPaymentRequestHandler handles GET /api/payment-requests/:id, including the payments made towards it
+func (h *BankingHandler) GetPaymentRequestHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	requestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	request, err := h.service.GetPaymentRequestByID(requestID)
+	if err != nil || (request.FromUserID != userID && request.ToUserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment request not found"})
+		return
+	}
+
+	request.Payments, err = h.service.GetPaymentRequestPayments(requestID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"paymentRequest": request})
+}
+
 // PaymentRequestActionRequest represents the request body for payment request actions
 type PaymentRequestActionRequest struct {
-	Action string `json:"action" binding:"required,oneof=approve reject cancel"`
+	Action string  `json:"action" binding:"required,oneof=approve reject cancel"`
+	Amount float64 `json:"amount" binding:"gte=0"` // Approve only part of the request; omit or 0 to pay everything due
 }
 
 // HandlePaymentRequestHandler handles PUT /api/payment-requests/:id
@@ -180,16 +317,45 @@ func (h *BankingHandler) HandlePaymentRequestHandler(c *gin.Context) {
 
 	switch req.Action {
 	case "approve":
-		err = h.service.ApprovePaymentRequest(requestID, userID)
+		paymentRequest, transaction, groupSettled, err := h.service.ApprovePaymentRequest(requestID, userID, req.Amount)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		if paymentRequest.Status == "pending" {
+			// Send webhook notification for the partial payment
+			go h.webhookService.SendPaymentRequestEventWebhook("payment_request_partially_paid", paymentRequest, transaction)
+
+			c.JSON(http.StatusOK, gin.H{
+				"message":        fmt.Sprintf("Paid %.2f; %.2f is still outstanding", transaction.Amount, paymentRequest.AmountDue),
+				"paymentRequest": paymentRequest,
+				"transaction":    transaction,
+			})
+			return
+		}
+
 		// Send webhook notification for approval
 		go h.webhookService.SendPaymentRequestApprovalWebhook(requestID, userID)
 
-		c.JSON(http.StatusOK, gin.H{"message": "Payment request approved and transfer completed"})
+		response := gin.H{
+			"message":        "Payment request approved and transfer completed",
+			"paymentRequest": paymentRequest,
+			"transaction":    transaction,
+		}
+
+		// Paying the last share of a split bill settles it
+		if paymentRequest.GroupID != nil {
+			if group, err := h.service.GetPaymentRequestGroup(*paymentRequest.GroupID); err == nil {
+				if groupSettled {
+					go h.webhookService.SendPaymentRequestGroupWebhook("payment_request_group_settled", group)
+				}
+				group.Shares = nil
+				response["group"] = group
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
 
 	case "reject":
 		err = h.service.RejectPaymentRequest(requestID, userID)
@@ -257,15 +423,8 @@ func (h *BankingHandler) getUserByID(userID int) (*User, error) {
 func (h *BankingHandler) GetCardHandler(c *gin.Context) {
 	userID := c.GetInt("userID")
 
-	// Get user info to access account number
-	user, err := h.getUserByID(userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
-		return
-	}
-
 	// Get or create user card
-	card, err := h.cardService.GetUserCard(userID, user.AccountNumber)
+	card, err := h.cardService.GetUserCard(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card"})
 		return
@@ -282,10 +441,17 @@ func (h *BankingHandler) GetCardHandler(c *gin.Context) {
 		}
 	}
 
+	spentToday, err := h.cardService.GetCardSpentToday(card.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card spending"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"card":             card,
 		"canRefresh":       h.cardService.GetTimeUntilNextRefresh(card) == nil,
 		"timeUntilRefresh": timeUntilRefresh,
+		"spentToday":       spentToday,
 	})
 }
 
@@ -293,7 +459,7 @@ func (h *BankingHandler) GetCardHandler(c *gin.Context) {
 func (h *BankingHandler) RefreshCardHandler(c *gin.Context) {
 	userID := c.GetInt("userID")
 
-	// Get user info to access account number
+	// Get user info for the notification
 	user, err := h.getUserByID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
@@ -301,7 +467,7 @@ func (h *BankingHandler) RefreshCardHandler(c *gin.Context) {
 	}
 
 	// Refresh the card
-	newCard, err := h.cardService.RefreshCard(userID, user.AccountNumber)
+	newCard, err := h.cardService.RefreshCard(userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -316,3 +482,70 @@ func (h *BankingHandler) RefreshCardHandler(c *gin.Context) {
 		"canRefresh": false,
 	})
 }
+
+// CloseOwnAccountRequest represents a user's request to close their own account
+type CloseOwnAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+	SweepTo  string `json:"sweep_to"` // Username or account number receiving the remaining balance
+}
+
+// CloseAccountHandler handles POST /api/account/close
+func (h *BankingHandler) CloseAccountHandler(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+
+	var req CloseOwnAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if !verifyRequestPassword(c, h.userService, req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	// Frozen accounts must be reactivated by support before they can be closed
+	if user.Status != AccountActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is " + user.Status + " and cannot be closed"})
+		return
+	}
+
+	// Savings pots are emptied into the balance being swept
+	savings, err := h.service.GetUserPotsBalance(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	if user.Balance+savings > 0 && req.SweepTo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose an account to receive your remaining balance"})
+		return
+	}
+
+	sweepAccountNumber := ""
+	if req.SweepTo != "" {
+		sweepAccount, err := h.userService.GetUserByUsernameOrAccountNumber(req.SweepTo)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sweep account not found"})
+			return
+		}
+		sweepAccountNumber = sweepAccount.AccountNumber
+	}
+
+	transaction, err := h.service.CloseAccount(user.ID, sweepAccountNumber, "Closed by account holder", "user:"+user.Username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send webhook notifications
+	go h.webhookService.SendAccountStatusWebhook(user.ID, user.Username, user.Status, AccountClosed, "Closed by account holder", "user:"+user.Username)
+	if transaction != nil {
+		go h.webhookService.SendTransferWebhook(transaction)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Account closed",
+		"transaction": transaction,
+	})
+}
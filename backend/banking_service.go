@@ -3,17 +3,36 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 )
 
 // BankingService handles banking-related database operations
 type BankingService struct {
 	db *sql.DB
+
+	paymentRequestReminderEvery time.Duration // Remind payers about pending requests this often; 0 disables it
+	maxPaymentRequestReminders  int
 }
 
 // NewBankingService creates a new BankingService
 func NewBankingService(db *sql.DB) *BankingService {
-	return &BankingService{db: db}
+	reminderHours, err := strconv.Atoi(getEnv("PAYMENT_REQUEST_REMINDER_HOURS", "24"))
+	if err != nil || reminderHours < 0 {
+		reminderHours = 24
+	}
+
+	maxReminders, err := strconv.Atoi(getEnv("PAYMENT_REQUEST_MAX_REMINDERS", "3"))
+	if err != nil || maxReminders < 0 {
+		maxReminders = 3
+	}
+
+	return &BankingService{
+		db:                          db,
+		paymentRequestReminderEvery: time.Duration(reminderHours) * time.Hour,
+		maxPaymentRequestReminders:  maxReminders,
+	}
 }
 
 // GetUserBalance gets the current balance for a user
@@ -24,6 +43,11 @@ func (s *BankingService) GetUserBalance(userID int) (float64, error) {
 	return balance, err
 }
 
+// GetUserAvailableBalance gets a user's balance minus funds held by card authorizations
+func (s *BankingService) GetUserAvailableBalance(userID int) (float64, error) {
+	return availableBalance(s.db, userID)
+}
+
 // Transfer transfers money between users
 func (s *BankingService) Transfer(fromUserID int, toAccountNumber string, amount float64, description string) (*Transaction, error) {
 	// Start transaction
@@ -33,16 +57,37 @@ func (s *BankingService) Transfer(fromUserID int, toAccountNumber string, amount
 	}
 	defer tx.Rollback()
 
-	// Get sender details
-	var fromBalance float64
-	err = tx.QueryRow(`SELECT balance FROM users WHERE id = ?`, fromUserID).Scan(&fromBalance)
+	transactionID, err := s.transferInTx(tx, fromUserID, toAccountNumber, amount, "transfer", description)
 	if err != nil {
 		return nil, err
 	}
 
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Get the created transaction with user details
+	return s.GetTransactionByID(transactionID)
+}
+
+// transferInTx moves money to the given account within tx, recording it with the given transaction type,
+// and returns the new transaction's ID
+func (s *BankingService) transferInTx(tx *sql.Tx, fromUserID int, toAccountNumber string, amount float64, transactionType, description string) (int, error) {
+	// Get sender's available balance, excluding held funds
+	fromBalance, err := availableBalance(tx, fromUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check sender is allowed to send money
+	if err = checkAccountCanSend(tx, fromUserID); err != nil {
+		return 0, err
+	}
+
 	// Check sufficient balance
 	if fromBalance < amount {
-		return nil, fmt.Errorf("insufficient balance")
+		return 0, fmt.Errorf("insufficient balance")
 	}
 
 	// Get recipient details
@@ -50,59 +95,71 @@ func (s *BankingService) Transfer(fromUserID int, toAccountNumber string, amount
 	err = tx.QueryRow(`SELECT id FROM users WHERE account_number = ?`, toAccountNumber).Scan(&toUserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("recipient account not found")
+			return 0, fmt.Errorf("recipient account not found")
 		}
-		return nil, err
+		return 0, err
 	}
 
 	// Check not transferring to self
 	if fromUserID == toUserID {
-		return nil, fmt.Errorf("cannot transfer to yourself")
+		return 0, fmt.Errorf("cannot transfer to yourself")
+	}
+
+	// Check recipient can receive money
+	if err = checkAccountCanReceive(tx, toUserID); err != nil {
+		return 0, err
 	}
 
 	// Update sender balance
 	_, err = tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, fromUserID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	// Update recipient balance
 	_, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, toUserID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	// Create transaction record
 	var transactionID int
 	err = tx.QueryRow(`
 		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, created_at)
-		VALUES (?, ?, ?, 'transfer', ?, 'completed', ?)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?)
 		RETURNING id
-	`, fromUserID, toUserID, amount, description, time.Now()).Scan(&transactionID)
+	`, fromUserID, toUserID, amount, transactionType, description, time.Now()).Scan(&transactionID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	// Reset PokéBank balance if involved in transaction
-	err = s.resetPokeBankBalanceInTx(tx, fromUserID, toUserID)
-	if err != nil {
-		return nil, err
+	if err = s.resetPokeBankBalanceInTx(tx, fromUserID, toUserID); err != nil {
+		return 0, err
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return nil, err
-	}
+	return transactionID, nil
+}
 
-	// Get the created transaction with user details
-	return s.GetTransactionByID(transactionID)
+// CreatePaymentRequest creates a new payment request, optionally expiring at expiresAt
+func (s *BankingService) CreatePaymentRequest(fromUserID int, toAccountNumber string, amount float64, reason, message string, expiresAt *time.Time) (*PaymentRequest, error) {
+	return s.createPaymentRequest(fromUserID, toAccountNumber, amount, reason, message, expiresAt, nil)
 }
 
-// CreatePaymentRequest creates a new payment request
-func (s *BankingService) CreatePaymentRequest(fromUserID int, toAccountNumber string, amount float64, reason, message string) (*PaymentRequest, error) {
+// createPaymentRequest creates a payment request, optionally on behalf of a registered merchant
+func (s *BankingService) createPaymentRequest(fromUserID int, toAccountNumber string, amount float64, reason, message string, expiresAt *time.Time, merchantID *int) (*PaymentRequest, error) {
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("expiry time must be in the future")
+		}
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
 	// Get recipient user ID
 	var toUserID int
-	err := s.db.QueryRow(`SELECT id FROM users WHERE account_number = ?`, toAccountNumber).Scan(&toUserID)
+	var toStatus string
+	err := s.db.QueryRow(`SELECT id, status FROM users WHERE account_number = ?`, toAccountNumber).Scan(&toUserID, &toStatus)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user not found")
@@ -110,6 +167,11 @@ func (s *BankingService) CreatePaymentRequest(fromUserID int, toAccountNumber st
 		return nil, err
 	}
 
+	// Closed accounts can't be asked to pay
+	if toStatus == AccountClosed {
+		return nil, fmt.Errorf("account is closed")
+	}
+
 	// Check not requesting from self
 	if fromUserID == toUserID {
 		return nil, fmt.Errorf("cannot request money from yourself")
@@ -117,13 +179,13 @@ func (s *BankingService) CreatePaymentRequest(fromUserID int, toAccountNumber st
 
 	// Create payment request
 	query := `
-		INSERT INTO payment_requests (from_user_id, to_user_id, amount, reason, message, status)
-		VALUES (?, ?, ?, ?, ?, 'pending')
+		INSERT INTO payment_requests (from_user_id, to_user_id, amount, reason, message, status, merchant_id, expires_at)
+		VALUES (?, ?, ?, ?, ?, 'pending', ?, ?)
 		RETURNING id, from_user_id, to_user_id, amount, reason, message, status, created_at
 	`
 
-	request := &PaymentRequest{}
-	err = s.db.QueryRow(query, fromUserID, toUserID, amount, reason, message).Scan(
+	request := &PaymentRequest{MerchantID: merchantID, ExpiresAt: expiresAt, AmountDue: amount}
+	err = s.db.QueryRow(query, fromUserID, toUserID, amount, reason, message, merchantID, expiresAt).Scan(
 		&request.ID, &request.FromUserID, &request.ToUserID, &request.Amount,
 		&request.Reason, &request.Message, &request.Status, &request.CreatedAt,
 	)
@@ -144,14 +206,10 @@ func (s *BankingService) GetUserTransactions(userID int, limit int) ([]Transacti
 	query := `
 		SELECT t.id, t.from_user_id, t.to_user_id, 
 		       CASE 
+		           WHEN t.transaction_type = 'pot_transfer' AND t.to_pot_id IS NULL THEN t.amount
 		           WHEN t.from_user_id = ? THEN -t.amount 
 		           ELSE t.amount 
-		       END as amount,
-		       t.transaction_type, t.description, t.status, t.created_at,
-		       u1.username as from_username, u2.username as to_username
-		FROM transactions t
-		LEFT JOIN users u1 ON t.from_user_id = u1.id
-		LEFT JOIN users u2 ON t.to_user_id = u2.id
+		       END as amount,` + transactionColumns + `
 		WHERE t.from_user_id = ? OR t.to_user_id = ?
 		ORDER BY t.created_at DESC, t.id DESC
 		LIMIT ?
@@ -163,20 +221,133 @@ func (s *BankingService) GetUserTransactions(userID int, limit int) ([]Transacti
 	}
 	defer rows.Close()
 
+	return scanTransactions(rows)
+}
+
+// GetCardTransactions retrieves a page of the user's transactions made with one card, newest first,
+// along with the total number of them
+func (s *BankingService) GetCardTransactions(userID, cardID, limit, offset int) ([]Transaction, int, error) {
+	var total int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM transactions
+		WHERE card_id = ? AND (from_user_id = ? OR to_user_id = ?)
+	`, cardID, userID, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT t.id, t.from_user_id, t.to_user_id, 
+		       CASE 
+		           WHEN t.from_user_id = ? THEN -t.amount 
+		           ELSE t.amount 
+		       END as amount,` + transactionColumns + `
+		WHERE t.card_id = ? AND (t.from_user_id = ? OR t.to_user_id = ?)
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.db.Query(query, userID, cardID, userID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	transactions, err := scanTransactions(rows)
+	return transactions, total, err
+}
+
+// scanTransactions scans transaction rows selected with their card details and usernames
+func scanTransactions(rows *sql.Rows) ([]Transaction, error) {
 	var transactions []Transaction
 	for rows.Next() {
-		var t Transaction
-		err := rows.Scan(
-			&t.ID, &t.FromUserID, &t.ToUserID, &t.Amount, &t.TransactionType,
-			&t.Description, &t.Status, &t.CreatedAt, &t.FromUsername, &t.ToUsername,
-		)
+		t, err := scanTransaction(rows)
 		if err != nil {
 			return nil, err
 		}
-		transactions = append(transactions, t)
+		transactions = append(transactions, *t)
 	}
 
-	return transactions, nil
+	return transactions, rows.Err()
+}
+
+// transactionColumns are the columns scanTransaction reads after a transaction's amount, with the joins they need.
+// Queries choose the amount column themselves, since some sign it for one side of the transfer.
+const transactionColumns = `
+	       t.transaction_type, t.description, t.status, t.created_at, t.card_id, t.merchant_id, t.merchant_name,
+	       t.merchant_category, m.logo_url, t.original_transaction_id, t.payment_link_id, t.invoice_id,
+	       t.payment_request_id, t.escrow_id, t.from_pot_id, t.to_pot_id, t.loan_id,
+	       u1.username as from_username, u2.username as to_username
+	FROM transactions t
+	LEFT JOIN users u1 ON t.from_user_id = u1.id
+	LEFT JOIN users u2 ON t.to_user_id = u2.id
+	LEFT JOIN merchants m ON t.merchant_id = m.id `
+
+// transactionSelect selects transactions as they were made, for scanTransaction
+const transactionSelect = `
+	SELECT t.id, t.from_user_id, t.to_user_id, t.amount,` + transactionColumns
+
+// scanTransaction scans one transaction selected with its card and merchant details and usernames
+func scanTransaction(row rowScanner) (*Transaction, error) {
+	t := &Transaction{}
+	var cardID, merchantID, originalID, paymentLinkID, invoiceID, paymentRequestID, escrowID sql.NullInt64
+	var fromPotID, toPotID, loanID sql.NullInt64
+	var merchantName, merchantCategory, merchantLogoURL sql.NullString
+	err := row.Scan(
+		&t.ID, &t.FromUserID, &t.ToUserID, &t.Amount, &t.TransactionType,
+		&t.Description, &t.Status, &t.CreatedAt, &cardID, &merchantID, &merchantName, &merchantCategory,
+		&merchantLogoURL, &originalID, &paymentLinkID, &invoiceID, &paymentRequestID, &escrowID, &fromPotID, &toPotID,
+		&loanID, &t.FromUsername, &t.ToUsername,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if cardID.Valid {
+		id := int(cardID.Int64)
+		t.CardID = &id
+	}
+	if merchantID.Valid {
+		id := int(merchantID.Int64)
+		t.MerchantID = &id
+	}
+	if originalID.Valid {
+		id := int(originalID.Int64)
+		t.OriginalTransactionID = &id
+	}
+	if paymentLinkID.Valid {
+		id := int(paymentLinkID.Int64)
+		t.PaymentLinkID = &id
+	}
+	if invoiceID.Valid {
+		id := int(invoiceID.Int64)
+		t.InvoiceID = &id
+	}
+	if paymentRequestID.Valid {
+		id := int(paymentRequestID.Int64)
+		t.PaymentRequestID = &id
+	}
+	if escrowID.Valid {
+		id := int(escrowID.Int64)
+		t.EscrowID = &id
+	}
+	if fromPotID.Valid {
+		id := int(fromPotID.Int64)
+		t.FromPotID = &id
+	}
+	if toPotID.Valid {
+		id := int(toPotID.Int64)
+		t.ToPotID = &id
+	}
+	if loanID.Valid {
+		id := int(loanID.Int64)
+		t.LoanID = &id
+	}
+	t.MerchantName = merchantName.String
+	t.MerchantCategory = merchantCategory.String
+	t.MerchantLogoURL = merchantLogoURL.String
+
+	return t, nil
 }
 
 // CreateAdminTransaction creates an administrative transaction for balance adjustment
@@ -195,6 +366,16 @@ func (s *BankingService) CreateAdminTransaction(userID int, amount float64, desc
 		return nil, err
 	}
 
+	// Closed accounts can't be credited or debited
+	var accountStatus string
+	err = tx.QueryRow(`SELECT status FROM users WHERE id = ?`, userID).Scan(&accountStatus)
+	if err != nil {
+		return nil, err
+	}
+	if accountStatus == AccountClosed {
+		return nil, fmt.Errorf("account is closed")
+	}
+
 	// Get current balance to check if withdrawal is possible
 	if amount < 0 {
 		var currentBalance float64
@@ -230,11 +411,12 @@ func (s *BankingService) CreateAdminTransaction(userID int, amount float64, desc
 	status := "completed"
 
 	query := `
-		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, merchant_name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := tx.Exec(query, fromUserID, toUserID, amount, transactionType, description, status, time.Now())
+	// The direction is given by from/to, so the amount is stored unsigned like every other transaction
+	result, err := tx.Exec(query, fromUserID, toUserID, math.Abs(amount), transactionType, description, status, merchantName, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -260,9 +442,81 @@ func (s *BankingService) CreateAdminTransaction(userID int, amount float64, desc
 	return s.GetTransactionByID(int(transactionID))
 }
 
-// CreateMerchantTransaction creates a transaction to/from a virtual merchant
-func (s *BankingService) CreateMerchantTransaction(userID int, amount float64, description, merchantName string) (*Transaction, error) {
-	return s.CreateAdminTransaction(userID, amount, description, merchantName)
+// CreateMerchantTransaction charges a user (negative amount) or refunds them (positive amount) on behalf of
+// a registered merchant, settling against the merchant's settlement account
+func (s *BankingService) CreateMerchantTransaction(userID int, amount float64, description string, merchant *Merchant) (*Transaction, error) {
+	if amount == 0 {
+		return nil, fmt.Errorf("amount must not be zero")
+	}
+	if !merchant.IsActive {
+		return nil, fmt.Errorf("merchant is inactive")
+	}
+	if merchant.SettlementUserID == userID {
+		return nil, fmt.Errorf("cannot transact with your own merchant")
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Charges move money to the merchant, refunds move it back
+	fromUserID, toUserID, transactionType := userID, merchant.SettlementUserID, "merchant_payment"
+	if amount > 0 {
+		fromUserID, toUserID, transactionType = merchant.SettlementUserID, userID, "merchant_refund"
+	} else {
+		amount = -amount
+	}
+
+	if err = checkAccountCanSend(tx, fromUserID); err != nil {
+		return nil, err
+	}
+	if err = checkAccountCanReceive(tx, toUserID); err != nil {
+		return nil, err
+	}
+
+	// Check sufficient funds, excluding those held for card payments
+	available, err := availableBalance(tx, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	if available < amount {
+		return nil, errInsufficientBalance
+	}
+
+	if _, err = tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, fromUserID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, toUserID); err != nil {
+		return nil, err
+	}
+
+	// Create transaction record
+	var transactionID int
+	err = tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status,
+		                          merchant_id, merchant_name, merchant_category, created_at)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?, ?, ?, ?)
+		RETURNING id
+	`, fromUserID, toUserID, amount, transactionType, description, merchant.ID, merchant.Name, merchant.CategoryCode,
+		time.Now()).Scan(&transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reset PokéBank balance in case it settles for the merchant
+	if err = s.resetPokeBankBalanceInTx(tx, fromUserID, toUserID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetTransactionByID(transactionID)
 }
 
 // EnsurePokeBankBalance ensures PokéBank always has the fixed balance
@@ -286,9 +540,11 @@ func (s *BankingService) GetUserPaymentRequests(userID int) ([]PaymentRequest, [
 	// Get incoming requests (where user is the recipient)
 	incomingQuery := `
 		SELECT pr.id, pr.from_user_id, pr.to_user_id, pr.amount, pr.reason, 
-		       pr.message, pr.status, pr.created_at, u.username as from_username
+		       pr.message, pr.status, pr.created_at, u.username as from_username, pr.merchant_id, m.name,
+		       pr.amount_paid, pr.expires_at, pr.last_reminder_at, pr.reminder_count, pr.group_id
 		FROM payment_requests pr
 		JOIN users u ON pr.from_user_id = u.id
+		LEFT JOIN merchants m ON pr.merchant_id = m.id
 		WHERE pr.to_user_id = ?
 		ORDER BY pr.created_at DESC
 	`
@@ -302,22 +558,31 @@ func (s *BankingService) GetUserPaymentRequests(userID int) ([]PaymentRequest, [
 	var incoming []PaymentRequest
 	for rows.Next() {
 		var pr PaymentRequest
+		var merchantID sql.NullInt64
+		var expiresAt, lastReminderAt sql.NullTime
+		var groupID sql.NullInt64
+		var merchantName sql.NullString
 		err := rows.Scan(
 			&pr.ID, &pr.FromUserID, &pr.ToUserID, &pr.Amount, &pr.Reason,
-			&pr.Message, &pr.Status, &pr.CreatedAt, &pr.FromUsername,
+			&pr.Message, &pr.Status, &pr.CreatedAt, &pr.FromUsername, &merchantID, &merchantName,
+			&pr.AmountPaid, &expiresAt, &lastReminderAt, &pr.ReminderCount, &groupID,
 		)
 		if err != nil {
 			return nil, nil, err
 		}
+		pr.setMerchant(merchantID, merchantName)
+		pr.setProgress(expiresAt, lastReminderAt, groupID)
 		incoming = append(incoming, pr)
 	}
 
 	// Get outgoing requests (where user is the sender)
 	outgoingQuery := `
 		SELECT pr.id, pr.from_user_id, pr.to_user_id, pr.amount, pr.reason, 
-		       pr.message, pr.status, pr.created_at, u.username as to_username
+		       pr.message, pr.status, pr.created_at, u.username as to_username, pr.merchant_id, m.name,
+		       pr.amount_paid, pr.expires_at, pr.last_reminder_at, pr.reminder_count, pr.group_id
 		FROM payment_requests pr
 		JOIN users u ON pr.to_user_id = u.id
+		LEFT JOIN merchants m ON pr.merchant_id = m.id
 		WHERE pr.from_user_id = ?
 		ORDER BY pr.created_at DESC
 	`
@@ -331,86 +596,246 @@ func (s *BankingService) GetUserPaymentRequests(userID int) ([]PaymentRequest, [
 	var outgoing []PaymentRequest
 	for rows.Next() {
 		var pr PaymentRequest
+		var merchantID sql.NullInt64
+		var expiresAt, lastReminderAt sql.NullTime
+		var groupID sql.NullInt64
+		var merchantName sql.NullString
 		err := rows.Scan(
 			&pr.ID, &pr.FromUserID, &pr.ToUserID, &pr.Amount, &pr.Reason,
-			&pr.Message, &pr.Status, &pr.CreatedAt, &pr.ToUsername,
+			&pr.Message, &pr.Status, &pr.CreatedAt, &pr.ToUsername, &merchantID, &merchantName,
+			&pr.AmountPaid, &expiresAt, &lastReminderAt, &pr.ReminderCount, &groupID,
 		)
 		if err != nil {
 			return nil, nil, err
 		}
+		pr.setMerchant(merchantID, merchantName)
+		pr.setProgress(expiresAt, lastReminderAt, groupID)
 		outgoing = append(outgoing, pr)
 	}
 
 	return incoming, outgoing, nil
 }
 
-// ApprovePaymentRequest approves a payment request and processes the transfer
-func (s *BankingService) ApprovePaymentRequest(requestID, userID int) error {
+// GetPaymentRequestByID retrieves a payment request with both usernames
+func (s *BankingService) GetPaymentRequestByID(id int) (*PaymentRequest, error) {
+	query := `
+		SELECT pr.id, pr.from_user_id, pr.to_user_id, pr.amount, pr.reason,
+		       pr.message, pr.status, pr.created_at, u1.username, u2.username, pr.merchant_id, m.name,
+		       pr.amount_paid, pr.expires_at, pr.last_reminder_at, pr.reminder_count, pr.group_id
+		FROM payment_requests pr
+		JOIN users u1 ON pr.from_user_id = u1.id
+		JOIN users u2 ON pr.to_user_id = u2.id
+		LEFT JOIN merchants m ON pr.merchant_id = m.id
+		WHERE pr.id = ?
+	`
+
+	var pr PaymentRequest
+	var message, merchantName sql.NullString
+	var merchantID sql.NullInt64
+	var expiresAt, lastReminderAt sql.NullTime
+	var groupID sql.NullInt64
+	err := s.db.QueryRow(query, id).Scan(
+		&pr.ID, &pr.FromUserID, &pr.ToUserID, &pr.Amount, &pr.Reason,
+		&message, &pr.Status, &pr.CreatedAt, &pr.FromUsername, &pr.ToUsername, &merchantID, &merchantName,
+		&pr.AmountPaid, &expiresAt, &lastReminderAt, &pr.ReminderCount, &groupID,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("payment request not found")
+		}
+		return nil, err
+	}
+	pr.Message = message.String
+	pr.setMerchant(merchantID, merchantName)
+	pr.setProgress(expiresAt, lastReminderAt, groupID)
+
+	return &pr, nil
+}
+
+// setMerchant fills in the registered merchant behind a payment request, if any
+func (pr *PaymentRequest) setMerchant(merchantID sql.NullInt64, merchantName sql.NullString) {
+	if merchantID.Valid {
+		id := int(merchantID.Int64)
+		pr.MerchantID = &id
+	}
+	pr.MerchantName = merchantName.String
+}
+
+// setProgress fills in a payment request's expiry, reminders and split bill, and the amount still due
+func (pr *PaymentRequest) setProgress(expiresAt, lastReminderAt sql.NullTime, groupID sql.NullInt64) {
+	if groupID.Valid {
+		id := int(groupID.Int64)
+		pr.GroupID = &id
+	}
+	if expiresAt.Valid {
+		pr.ExpiresAt = &expiresAt.Time
+	}
+	if lastReminderAt.Valid {
+		pr.LastReminderAt = &lastReminderAt.Time
+	}
+	pr.AmountDue = roundCents(pr.Amount - pr.AmountPaid)
+}
+
+// ApprovePaymentRequest pays all or part of a payment request. An amount of zero pays whatever is still due;
+// the request stays pending until the whole amount has been paid. Paying the last share of a split bill settles
+// the bill in the same transaction, and reports that it did.
+func (s *BankingService) ApprovePaymentRequest(requestID, userID int, amount float64) (*PaymentRequest, *Transaction, bool, error) {
 	// Start transaction
 	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return nil, nil, false, err
 	}
 	defer tx.Rollback()
 
 	// Get payment request details
 	var pr PaymentRequest
+	var merchantID, groupID sql.NullInt64
+	var expiresAt sql.NullTime
 	err = tx.QueryRow(`
-		SELECT id, from_user_id, to_user_id, amount, reason, status
+		SELECT id, from_user_id, to_user_id, amount, reason, status, merchant_id, amount_paid, expires_at, group_id
 		FROM payment_requests 
 		WHERE id = ? AND to_user_id = ? AND status = 'pending'
-	`, requestID, userID).Scan(&pr.ID, &pr.FromUserID, &pr.ToUserID, &pr.Amount, &pr.Reason, &pr.Status)
+	`, requestID, userID).Scan(&pr.ID, &pr.FromUserID, &pr.ToUserID, &pr.Amount, &pr.Reason, &pr.Status, &merchantID,
+		&pr.AmountPaid, &expiresAt, &groupID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("payment request not found or already processed")
+			return nil, nil, false, fmt.Errorf("payment request not found or already processed")
 		}
-		return err
+		return nil, nil, false, err
 	}
 
-	// Check user has sufficient balance
-	var balance float64
-	err = tx.QueryRow(`SELECT balance FROM users WHERE id = ?`, userID).Scan(&balance)
+	// The expiry job may not have caught up with the request yet
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return nil, nil, false, fmt.Errorf("payment request has expired")
+	}
+
+	amountDue := roundCents(pr.Amount - pr.AmountPaid)
+	if amount == 0 {
+		amount = amountDue
+	}
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return nil, nil, false, fmt.Errorf("amount must be at least 0.01")
+	}
+	if amount > amountDue {
+		return nil, nil, false, fmt.Errorf("amount is more than the %.2f still due", amountDue)
+	}
+
+	// Check payer can send and requester can receive
+	if err = checkAccountCanSend(tx, userID); err != nil {
+		return nil, nil, false, err
+	}
+	if err = checkAccountCanReceive(tx, pr.FromUserID); err != nil {
+		return nil, nil, false, err
+	}
+
+	// Check user has sufficient balance, excluding held funds
+	balance, err := availableBalance(tx, userID)
 	if err != nil {
-		return err
+		return nil, nil, false, err
 	}
 
-	if balance < pr.Amount {
-		return fmt.Errorf("insufficient balance")
+	if balance < amount {
+		return nil, nil, false, fmt.Errorf("insufficient balance")
 	}
 
 	// Process transfer (userID pays to fromUserID)
-	_, err = tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, pr.Amount, userID)
+	_, err = tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, userID)
 	if err != nil {
-		return err
+		return nil, nil, false, err
 	}
 
-	_, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, pr.Amount, pr.FromUserID)
+	_, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, pr.FromUserID)
 	if err != nil {
-		return err
+		return nil, nil, false, err
+	}
+
+	// Requests from registered merchants are recorded as merchant payments
+	transactionType := "transfer"
+	var merchantName, merchantCategory sql.NullString
+	if merchantID.Valid {
+		var merchantActive bool
+		err = tx.QueryRow(`SELECT name, category_code, is_active FROM merchants WHERE id = ?`, merchantID.Int64).Scan(
+			&merchantName, &merchantCategory, &merchantActive,
+		)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if !merchantActive {
+			return nil, nil, false, fmt.Errorf("merchant is inactive")
+		}
+		transactionType = "merchant_payment"
 	}
 
 	// Create transaction record
-	_, err = tx.Exec(`
-		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, created_at)
-		VALUES (?, ?, ?, 'transfer', ?, 'completed', ?)
-	`, userID, pr.FromUserID, pr.Amount, "Payment for: "+pr.Reason, time.Now())
+	var transactionID int
+	err = tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status,
+		                          merchant_id, merchant_name, merchant_category, payment_request_id, created_at)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, pr.FromUserID, amount, transactionType, "Payment for: "+pr.Reason, merchantID, merchantName, merchantCategory,
+		requestID, time.Now()).Scan(&transactionID)
 	if err != nil {
-		return err
+		return nil, nil, false, err
 	}
 
-	// Update payment request status
-	_, err = tx.Exec(`UPDATE payment_requests SET status = 'approved' WHERE id = ?`, requestID)
+	// Update payment request status, approving it once it's paid in full
+	status := "pending"
+	if amount == amountDue {
+		status = "approved"
+	}
+	_, err = tx.Exec(`UPDATE payment_requests SET amount_paid = ?, status = ? WHERE id = ?`,
+		roundCents(pr.AmountPaid+amount), status, requestID)
 	if err != nil {
-		return err
+		return nil, nil, false, err
 	}
 
 	// Reset PokéBank balance if involved in transaction
 	err = s.resetPokeBankBalanceInTx(tx, userID, pr.FromUserID)
 	if err != nil {
-		return err
+		return nil, nil, false, err
+	}
+
+	// Paying the last share of a split bill settles it
+	groupSettled := false
+	if status == "approved" && groupID.Valid {
+		if groupSettled, err = settlePaymentRequestGroupInTx(tx, int(groupID.Int64)); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, false, err
+	}
+
+	request, err := s.GetPaymentRequestByID(requestID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	transaction, err := s.GetTransactionByID(transactionID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return request, transaction, groupSettled, nil
+}
+
+// GetPaymentRequestPayments retrieves the payments made towards a payment request, oldest first
+func (s *BankingService) GetPaymentRequestPayments(requestID int) ([]Transaction, error) {
+	query := transactionSelect + `
+		WHERE t.payment_request_id = ?
+		ORDER BY t.created_at, t.id
+	`
+
+	rows, err := s.db.Query(query, requestID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return tx.Commit()
+	return scanTransactions(rows)
 }
 
 // RejectPaymentRequest rejects a payment request
@@ -461,30 +886,121 @@ func (s *BankingService) CancelPaymentRequest(requestID, userID int) error {
 	return nil
 }
 
-// GetTransactionByID gets a transaction by ID
-func (s *BankingService) GetTransactionByID(id int) (*Transaction, error) {
-	query := `
-		SELECT t.id, t.from_user_id, t.to_user_id, t.amount, t.transaction_type, 
-		       t.description, t.status, t.created_at,
-		       u1.username as from_username, u2.username as to_username
-		FROM transactions t
-		LEFT JOIN users u1 ON t.from_user_id = u1.id
-		LEFT JOIN users u2 ON t.to_user_id = u2.id
-		WHERE t.id = ?
-	`
+// CloseAccount closes a user's account, sweeping any remaining balance to another account.
+// Returns the sweep transaction, or nil if there was nothing to sweep.
+func (s *BankingService) CloseAccount(userID int, sweepToAccountNumber, reason, actor string) (*Transaction, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
-	transaction := &Transaction{}
-	err := s.db.QueryRow(query, id).Scan(
-		&transaction.ID, &transaction.FromUserID, &transaction.ToUserID, &transaction.Amount,
-		&transaction.TransactionType, &transaction.Description, &transaction.Status, &transaction.CreatedAt,
-		&transaction.FromUsername, &transaction.ToUsername,
-	)
+	// Empty the user's savings pots into the balance being swept
+	if err = closeUserPotsInTx(tx, userID); err != nil {
+		return nil, err
+	}
+
+	// Withdraw pending loan applications; loans still being repaid block closure
+	if err = closeUserLoansInTx(tx, userID); err != nil {
+		return nil, err
+	}
+
+	var balance float64
+	err = tx.QueryRow(`SELECT balance FROM users WHERE id = ?`, userID).Scan(&balance)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+
+	// Close the account first; this rejects PokéBank and already-closed accounts
+	if _, err = setAccountStatusInTx(tx, userID, AccountClosed, reason, actor); err != nil {
+		return nil, err
+	}
+
+	var transactionID int64
+	if balance > 0 {
+		// Get sweep destination
+		var toUserID int
+		err = tx.QueryRow(`SELECT id FROM users WHERE account_number = ?`, sweepToAccountNumber).Scan(&toUserID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("sweep account not found")
+			}
+			return nil, err
+		}
+
+		if toUserID == userID {
+			return nil, fmt.Errorf("cannot sweep balance to the account being closed")
+		}
+
+		if err = checkAccountCanReceive(tx, toUserID); err != nil {
+			return nil, err
+		}
+
+		// Move the remaining balance
+		_, err = tx.Exec(`UPDATE users SET balance = 0 WHERE id = ?`, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, balance, toUserID)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, created_at)
+			VALUES (?, ?, ?, 'account_closure', ?, 'completed', ?)
+		`, userID, toUserID, balance, "Account closure balance sweep", time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		transactionID, err = result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		// Reset PokéBank balance if it received the sweep
+		if err = s.resetPokeBankBalanceInTx(tx, userID, toUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Cancel outstanding payment requests, release card holds and deactivate cards
+	_, err = tx.Exec(`UPDATE payment_requests SET status = 'cancelled' WHERE (from_user_id = ? OR to_user_id = ?) AND status = 'pending'`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
 
+	_, err = tx.Exec(`UPDATE card_authorizations SET status = 'voided' WHERE (cardholder_user_id = ? OR merchant_user_id = ?) AND status = 'held'`, userID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return transaction, nil
+	_, err = tx.Exec(`UPDATE cards SET is_active = FALSE, deactivated_at = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND is_active = TRUE`, time.Now().UTC(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if transactionID == 0 {
+		return nil, nil
+	}
+
+	return s.GetTransactionByID(int(transactionID))
+}
+
+// GetTransactionByID gets a transaction by ID
+func (s *BankingService) GetTransactionByID(id int) (*Transaction, error) {
+	return scanTransaction(s.db.QueryRow(transactionSelect+`WHERE t.id = ?`, id))
 }
 
 // getUsernameByID helper function to get username by user ID
@@ -494,6 +1010,11 @@ func (s *BankingService) getUsernameByID(userID int) (string, error) {
 	return username, err
 }
 
+// roundCents rounds an amount to whole cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
 // resetPokeBankBalanceInTx resets PokéBank account balance to 999999999.99 if involved in transaction
 func (s *BankingService) resetPokeBankBalanceInTx(tx *sql.Tx, fromUserID, toUserID int) error {
 	const pokeBankBalance = 999999999.99
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CardControls are the cardholder-set spending controls on a card
+type CardControls struct {
+	DailyLimit        *float64 `json:"daily_limit" binding:"omitempty,gt=0"`
+	TransactionLimit  *float64 `json:"transaction_limit" binding:"omitempty,gt=0"`
+	AllowedCategories []string `json:"allowed_categories"`
+	BlockedCategories []string `json:"blocked_categories"`
+}
+
+// SetCardFrozen freezes or unfreezes one of the user's active cards
+func (cs *CardService) SetCardFrozen(userID, cardID int, frozen bool) (*Card, error) {
+	result, err := cs.db.Exec(`
+		UPDATE cards SET is_frozen = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND is_active = TRUE
+	`, frozen, cardID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireCardUpdated(result); err != nil {
+		return nil, err
+	}
+
+	return cs.GetCard(userID, cardID)
+}
+
+// UpdateCardControls replaces the spending controls on one of the user's active cards
+func (cs *CardService) UpdateCardControls(userID, cardID int, controls CardControls) (*Card, error) {
+	allowed := normalizeCategories(controls.AllowedCategories)
+	blocked := normalizeCategories(controls.BlockedCategories)
+
+	result, err := cs.db.Exec(`
+		UPDATE cards
+		SET daily_limit = ?, transaction_limit = ?, allowed_categories = ?, blocked_categories = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND is_active = TRUE
+	`, controls.DailyLimit, controls.TransactionLimit, strings.Join(allowed, " "), strings.Join(blocked, " "), cardID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireCardUpdated(result); err != nil {
+		return nil, err
+	}
+
+	return cs.GetCard(userID, cardID)
+}
+
+// GetCardSpentToday returns how much has been charged or held on a card since midnight UTC
+func (cs *CardService) GetCardSpentToday(cardID int) (float64, error) {
+	return cardSpentToday(cs.db, cardID)
+}
+
+// Spending control errors that callers can tell apart
+var (
+	errCardFrozen               = fmt.Errorf("card is frozen")
+	errTransactionLimitExceeded = fmt.Errorf("amount exceeds the card's per-transaction limit")
+	errDailyLimitExceeded       = fmt.Errorf("amount exceeds the card's daily limit")
+)
+
+// checkCardControlsInTx returns an error if a payment would break the card's freeze or spending controls
+func checkCardControlsInTx(tx *sql.Tx, cardID int, amount float64, merchantCategory string) error {
+	card, err := scanCard(tx.QueryRow(cardSelect+`WHERE id = ?`, cardID))
+	if err != nil {
+		return err
+	}
+
+	if card.IsFrozen {
+		return errCardFrozen
+	}
+
+	if card.TransactionLimit != nil && amount > *card.TransactionLimit {
+		return errTransactionLimitExceeded
+	}
+
+	category := normalizeCategory(merchantCategory)
+	for _, blocked := range card.BlockedCategories {
+		if category == blocked {
+			return fmt.Errorf("card is blocked for %s merchants", category)
+		}
+	}
+	if len(card.AllowedCategories) > 0 {
+		allowed := false
+		for _, c := range card.AllowedCategories {
+			if category == c {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("card is not allowed for %s merchants", category)
+		}
+	}
+
+	if card.DailyLimit != nil {
+		spent, err := cardSpentToday(tx, cardID)
+		if err != nil {
+			return err
+		}
+		if spent+amount > *card.DailyLimit {
+			return errDailyLimitExceeded
+		}
+	}
+
+	return nil
+}
+
+// cardSpentToday sums today's immediate charges, captures and outstanding holds on a card
+func cardSpentToday(q queryRower, cardID int) (float64, error) {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var spent float64
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN status = 'held' THEN amount ELSE captured_amount END), 0)
+		FROM card_authorizations
+		WHERE card_id = ? AND status IN ('approved', 'held', 'captured') AND created_at >= ?
+	`, cardID, midnight).Scan(&spent)
+	return spent, err
+}
+
+// copyCardSettingsInTx copies the name, PIN, freeze state and spending controls from one card to another
+func copyCardSettingsInTx(tx *sql.Tx, fromCardID, toCardID int) error {
+	_, err := tx.Exec(`
+		UPDATE cards
+		SET (name, pin_hash, pin_failed_attempts, is_frozen, daily_limit, transaction_limit, allowed_categories, blocked_categories) =
+		    (SELECT name, pin_hash, pin_failed_attempts, is_frozen, daily_limit, transaction_limit, allowed_categories, blocked_categories
+		     FROM cards WHERE id = ?)
+		WHERE id = ?
+	`, fromCardID, toCardID)
+	return err
+}
+
+// normalizeCategory lower-cases a merchant category; uncategorized merchants are "other"
+func normalizeCategory(category string) string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	category = strings.Join(strings.Fields(category), "_")
+	if category == "" {
+		return "other"
+	}
+	return category
+}
+
+// normalizeCategories normalizes and de-duplicates a list of merchant categories
+func normalizeCategories(categories []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, category := range categories {
+		category = normalizeCategory(category)
+		if !seen[category] {
+			seen[category] = true
+			normalized = append(normalized, category)
+		}
+	}
+	return normalized
+}
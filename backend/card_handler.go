@@ -0,0 +1,299 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CardHandler handles card management endpoints
+type CardHandler struct {
+	cardService    *CardService
+	bankingService *BankingService
+	userService    *UserService
+	webhookService *WebhookService
+}
+
+// NewCardHandler creates a new CardHandler
+func NewCardHandler(cardService *CardService, bankingService *BankingService, userService *UserService, webhookService *WebhookService) *CardHandler {
+	return &CardHandler{
+		cardService:    cardService,
+		bankingService: bankingService,
+		userService:    userService,
+		webhookService: webhookService,
+	}
+}
+
+// CreateCardRequest represents a request to issue an additional card
+type CreateCardRequest struct {
+	Name          string `json:"name" binding:"required,max=50"`
+	SingleUse     bool   `json:"single_use"`
+	LifetimeHours int    `json:"lifetime_hours" binding:"gte=0"` // 0 means the card lasts until its expiry date
+}
+
+// RenameCardRequest represents a request to rename a card
+type RenameCardRequest struct {
+	Name string `json:"name" binding:"required,max=50"`
+}
+
+// SetCardPINRequest represents the request body for setting a card PIN
+type SetCardPINRequest struct {
+	Password string `json:"password" binding:"required"`
+	PIN      string `json:"pin" binding:"required,len=4,numeric"`
+}
+
+// GetCardsHandler handles GET /api/cards
+func (h *CardHandler) GetCardsHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	// Make sure the primary card exists
+	if _, err := h.cardService.GetUserCard(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cards"})
+		return
+	}
+
+	cards, err := h.cardService.GetUserCards(userID, c.Query("include_inactive") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cards": cards})
+}
+
+// CreateCardHandler handles POST /api/cards
+func (h *CardHandler) CreateCardHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req CreateCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	cardType := CardTypeStandard
+	if req.SingleUse {
+		cardType = CardTypeSingleUse
+	}
+
+	card, err := h.cardService.CreateVirtualCard(userID, req.Name, cardType, time.Duration(req.LifetimeHours)*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Card created",
+		"card":    card,
+	})
+}
+
+// GetCardByIDHandler handles GET /api/cards/:id
+func (h *CardHandler) GetCardByIDHandler(c *gin.Context) {
+	cardID, ok := h.resolveCardID(c)
+	if !ok {
+		return
+	}
+
+	card, err := h.cardService.GetCard(c.GetInt("userID"), cardID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"card": card})
+}
+
+// GetCardTransactionsHandler handles GET /api/cards/:id/transactions.
+// Works for replaced and deactivated cards too, so their history stays visible.
+func (h *CardHandler) GetCardTransactionsHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	cardID, ok := h.resolveCardID(c)
+	if !ok {
+		return
+	}
+
+	card, err := h.cardService.GetCard(userID, cardID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse pagination parameters (default 50, max 100)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	transactions, total, err := h.bankingService.GetCardTransactions(userID, card.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"card_id":      card.ID,
+		"card_last4":   cardLast4(card.CardNumber),
+		"transactions": transactions,
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// RenameCardHandler handles PATCH /api/cards/:id
+func (h *CardHandler) RenameCardHandler(c *gin.Context) {
+	cardID, ok := h.resolveCardID(c)
+	if !ok {
+		return
+	}
+
+	var req RenameCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	card, err := h.cardService.RenameCard(c.GetInt("userID"), cardID, req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Card renamed",
+		"card":    card,
+	})
+}
+
+// DeleteCardHandler handles DELETE /api/cards/:id
+func (h *CardHandler) DeleteCardHandler(c *gin.Context) {
+	cardID, ok := h.resolveCardID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.cardService.DeactivateCard(c.GetInt("userID"), cardID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Card not found, already deactivated, or is your main card"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Card deactivated"})
+}
+
+// FreezeCardHandler handles POST /api/card/freeze and /api/cards/:id/freeze
+func (h *CardHandler) FreezeCardHandler(c *gin.Context) {
+	h.setCardFrozen(c, true)
+}
+
+// UnfreezeCardHandler handles POST /api/card/unfreeze and /api/cards/:id/unfreeze
+func (h *CardHandler) UnfreezeCardHandler(c *gin.Context) {
+	h.setCardFrozen(c, false)
+}
+
+// setCardFrozen freezes or unfreezes a card
+func (h *CardHandler) setCardFrozen(c *gin.Context, frozen bool) {
+	cardID, ok := h.resolveCardID(c)
+	if !ok {
+		return
+	}
+
+	card, err := h.cardService.SetCardFrozen(c.GetInt("userID"), cardID, frozen)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "Card unfrozen"
+	if frozen {
+		message = "Card frozen"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"card":    card,
+	})
+}
+
+// UpdateCardControlsHandler handles PUT /api/card/controls and /api/cards/:id/controls
+func (h *CardHandler) UpdateCardControlsHandler(c *gin.Context) {
+	cardID, ok := h.resolveCardID(c)
+	if !ok {
+		return
+	}
+
+	var controls CardControls
+	if err := c.ShouldBindJSON(&controls); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	card, err := h.cardService.UpdateCardControls(c.GetInt("userID"), cardID, controls)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Card controls updated",
+		"card":    card,
+	})
+}
+
+// SetCardPINHandler handles POST /api/card/pin and /api/cards/:id/pin
+func (h *CardHandler) SetCardPINHandler(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+
+	var req SetCardPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PIN must be exactly 4 digits"})
+		return
+	}
+
+	if !verifyRequestPassword(c, h.userService, req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	cardID, ok := h.resolveCardID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.cardService.SetPIN(user.ID, cardID, req.PIN); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Card PIN updated"})
+}
+
+// resolveCardID returns the card named by the :id route parameter, or the user's
+// primary card on /api/card routes. It writes an error response and returns false on failure.
+func (h *CardHandler) resolveCardID(c *gin.Context) (int, bool) {
+	if param := c.Param("id"); param != "" {
+		cardID, err := strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card ID"})
+			return 0, false
+		}
+		return cardID, true
+	}
+
+	card, err := h.cardService.GetUserCard(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card"})
+		return 0, false
+	}
+	return card.ID, true
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CardLifecycleEvent describes something the card expiry job did to a card
+type CardLifecycleEvent struct {
+	Event       string // "card_expiring", "card_reissued" or "card_expired"
+	Card        Card
+	Username    string
+	Replacement *Card // The newly issued card, for "card_reissued"
+}
+
+// ProcessCardExpiry runs one pass of the card expiry lifecycle:
+// cards with guessable legacy numbers are replaced straight away, cards past their expiry (or fixed lifetime)
+// are deactivated, cards entering the reissue window are flagged as expiring, and standard cards in that
+// window get a replacement with the same settings.
+func (cs *CardService) ProcessCardExpiry() ([]CardLifecycleEvent, error) {
+	if err := cs.backfillCardExpiry(); err != nil {
+		return nil, fmt.Errorf("failed to backfill card expiry dates: %v", err)
+	}
+
+	events, err := cs.reissueLegacyCards()
+	if err != nil {
+		return events, err
+	}
+
+	now := time.Now().UTC()
+
+	expired, err := cs.expireCards(now)
+	events = append(events, expired...)
+	if err != nil {
+		return events, err
+	}
+
+	if cs.reissueLeadTime == 0 {
+		return events, nil
+	}
+	windowStart := now.Add(cs.reissueLeadTime)
+
+	expiring, err := cs.notifyExpiringCards(windowStart)
+	events = append(events, expiring...)
+	if err != nil {
+		return events, err
+	}
+
+	reissued, err := cs.reissueExpiringCards(windowStart)
+	events = append(events, reissued...)
+
+	return events, err
+}
+
+// backfillCardExpiry fills in expires_at for cards issued before it was stored
+func (cs *CardService) backfillCardExpiry() error {
+	rows, err := cs.db.Query(`SELECT id, expiry_date FROM cards WHERE expires_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	expiresAt := make(map[int]time.Time)
+	for rows.Next() {
+		var id int
+		var expiryDate string
+		if err := rows.Scan(&id, &expiryDate); err != nil {
+			return err
+		}
+		parsed, err := parseCardExpiry(expiryDate)
+		if err != nil {
+			return fmt.Errorf("card %d: %v", id, err)
+		}
+		expiresAt[id] = parsed
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, parsed := range expiresAt {
+		if _, err := cs.db.Exec(`UPDATE cards SET expires_at = ? WHERE id = ?`, parsed, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// legacyCardNumberLength is the length of card numbers derived from the account number before numbers were
+// random. They are 13 digits long, so they can be told apart from random 16-digit numbers.
+const legacyCardNumberLength = 13
+
+// reissueLegacyCards replaces active cards that still have a legacy number, deactivating the old card at once
+// because its number can be guessed. Legacy cards that were already reissued are just deactivated.
+func (cs *CardService) reissueLegacyCards() ([]CardLifecycleEvent, error) {
+	cards, err := cs.listCards(`WHERE is_active = TRUE AND LENGTH(card_number) <= ?`, legacyCardNumberLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CardLifecycleEvent
+	for _, card := range cards {
+		if card.ReplacedByCardID != nil {
+			_, err := cs.db.Exec(`
+				UPDATE cards SET is_active = FALSE, deactivated_at = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ?
+			`, time.Now().UTC(), card.ID)
+			if err != nil {
+				return events, err
+			}
+			continue
+		}
+
+		replacement, err := cs.reissueCard(&card, true)
+		if err != nil {
+			return events, fmt.Errorf("failed to reissue legacy card %d: %v", card.ID, err)
+		}
+		if replacement == nil {
+			continue // Replaced or deactivated since it was listed
+		}
+
+		card.IsPrimary = false
+		card.IsActive = false
+		card.ReplacedByCardID = &replacement.ID
+		events = append(events, cs.lifecycleEvent("card_reissued", card, replacement))
+	}
+
+	return events, nil
+}
+
+// expireCards deactivates active cards whose expiry date or fixed lifetime has passed
+func (cs *CardService) expireCards(now time.Time) ([]CardLifecycleEvent, error) {
+	cards, err := cs.listCards(`
+		WHERE is_active = TRUE AND (expires_at <= ? OR valid_until <= ?)
+	`, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CardLifecycleEvent
+	for _, card := range cards {
+		result, err := cs.db.Exec(`
+			UPDATE cards SET is_active = FALSE, deactivated_at = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND is_active = TRUE
+		`, now, card.ID)
+		if err != nil {
+			return events, err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			continue // Deactivated since it was listed
+		}
+
+		card.IsActive = false
+		card.DeactivatedAt = &now
+		events = append(events, cs.lifecycleEvent("card_expired", card, nil))
+	}
+
+	return events, nil
+}
+
+// notifyExpiringCards flags active cards that expire before windowStart, once per card
+func (cs *CardService) notifyExpiringCards(windowStart time.Time) ([]CardLifecycleEvent, error) {
+	cards, err := cs.listCards(`
+		WHERE is_active = TRUE AND expiry_notified_at IS NULL AND expires_at <= ?
+	`, windowStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CardLifecycleEvent
+	for _, card := range cards {
+		if _, err := cs.db.Exec(`UPDATE cards SET expiry_notified_at = ? WHERE id = ?`, time.Now().UTC(), card.ID); err != nil {
+			return events, err
+		}
+		events = append(events, cs.lifecycleEvent("card_expiring", card, nil))
+	}
+
+	return events, nil
+}
+
+// reissueExpiringCards issues replacements for standard cards that expire before windowStart.
+// Single-use and fixed-lifetime cards are not replaced.
+func (cs *CardService) reissueExpiringCards(windowStart time.Time) ([]CardLifecycleEvent, error) {
+	cards, err := cs.listCards(`
+		WHERE is_active = TRUE AND card_type = ? AND valid_until IS NULL
+		  AND replaced_by_card_id IS NULL AND expires_at <= ?
+	`, CardTypeStandard, windowStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CardLifecycleEvent
+	for _, card := range cards {
+		replacement, err := cs.reissueCard(&card, false)
+		if err != nil {
+			return events, fmt.Errorf("failed to reissue card %d: %v", card.ID, err)
+		}
+		if replacement == nil {
+			continue // Replaced or deactivated since it was listed
+		}
+
+		card.IsPrimary = false
+		card.ReplacedByCardID = &replacement.ID
+		events = append(events, cs.lifecycleEvent("card_reissued", card, replacement))
+	}
+
+	return events, nil
+}
+
+// reissueCard issues a replacement for a card. The replacement takes over the card's name,
+// PIN, controls and primary status; the old card keeps working until it expires unless it is retired.
+// It returns nil if the card no longer needs replacing.
+func (cs *CardService) reissueCard(card *Card, retire bool) (*Card, error) {
+	cardNumber, err := cs.generateCardNumber()
+	if err != nil {
+		return nil, err
+	}
+	expiryDate, expiresAt := cs.generateExpiryDate()
+
+	// Start transaction
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO cards (user_id, card_type, is_primary, card_number, expiry_date, expires_at, refresh_seed, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, card.UserID, card.CardType, card.IsPrimary, cardNumber, expiryDate, expiresAt, card.RefreshSeed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replacement card: %v", err)
+	}
+
+	newCardID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := copyCardSettingsInTx(tx, card.ID, int(newCardID)); err != nil {
+		return nil, fmt.Errorf("failed to copy card settings: %v", err)
+	}
+
+	result, err = tx.Exec(`
+		UPDATE cards SET is_primary = FALSE, replaced_by_card_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND is_active = TRUE AND replaced_by_card_id IS NULL
+	`, newCardID, card.ID)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, nil
+	}
+
+	if retire {
+		_, err = tx.Exec(`UPDATE cards SET is_active = FALSE, deactivated_at = ? WHERE id = ?`, time.Now().UTC(), card.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return cs.GetCard(card.UserID, int(newCardID))
+}
+
+// listCards lists cards matching a WHERE clause, oldest first
+func (cs *CardService) listCards(where string, args ...interface{}) ([]Card, error) {
+	rows, err := cs.db.Query(cardSelect+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []Card
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, *card)
+	}
+
+	return cards, rows.Err()
+}
+
+// lifecycleEvent builds a lifecycle event, looking up the cardholder's username
+func (cs *CardService) lifecycleEvent(event string, card Card, replacement *Card) CardLifecycleEvent {
+	var username sql.NullString
+	cs.db.QueryRow(`SELECT username FROM users WHERE id = ?`, card.UserID).Scan(&username)
+
+	return CardLifecycleEvent{
+		Event:       event,
+		Card:        card,
+		Username:    username.String,
+		Replacement: replacement,
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CardPaymentHandler handles merchant-facing card payment endpoints, authenticated with merchant API keys
+type CardPaymentHandler struct {
+	service        *CardPaymentService
+	bankingService *BankingService
+	webhookService *WebhookService
+}
+
+// NewCardPaymentHandler creates a new CardPaymentHandler
+func NewCardPaymentHandler(service *CardPaymentService, bankingService *BankingService, webhookService *WebhookService) *CardPaymentHandler {
+	return &CardPaymentHandler{
+		service:        service,
+		bankingService: bankingService,
+		webhookService: webhookService,
+	}
+}
+
+// CardAuthorizationRequest represents a merchant's request to charge a card
+type CardAuthorizationRequest struct {
+	CardNumber  string  `json:"card_number" binding:"required"`
+	ExpiryDate  string  `json:"expiry_date" binding:"required"`     // MM/YY
+	CVV         string  `json:"cvv" binding:"required_without=PIN"` // Card-not-present payments
+	PIN         string  `json:"pin"`                                // Card-present payments
+	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	Description string  `json:"description"`
+	Capture     *bool   `json:"capture"` // false places a hold to capture later; defaults to true
+}
+
+// CardCaptureRequest represents a merchant's request to capture a hold
+type CardCaptureRequest struct {
+	Amount float64 `json:"amount" binding:"gte=0"` // Omit or 0 to capture the full hold
+}
+
+// AuthorizeHandler handles POST /api/card-payments/authorize
+func (h *CardPaymentHandler) AuthorizeHandler(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*Merchant)
+
+	var req CardAuthorizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	holdOnly := req.Capture != nil && !*req.Capture
+	authorization, err := h.service.Authorize(CardPaymentDetails{
+		CardNumber:            req.CardNumber,
+		ExpiryDate:            req.ExpiryDate,
+		CVV:                   req.CVV,
+		PIN:                   req.PIN,
+		Amount:                req.Amount,
+		MerchantAccountNumber: merchant.SettlementAccountNumber,
+		MerchantID:            &merchant.ID,
+		Description:           req.Description,
+		HoldOnly:              holdOnly,
+	})
+	if err != nil {
+		c.JSON(http.StatusPaymentRequired, gin.H{"approved": false, "error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"approved":           true,
+		"authorization_code": authorization.AuthorizationCode,
+		"authorization":      authorization,
+	}
+
+	if holdOnly {
+		go h.webhookService.SendCardAuthorizationWebhook("card_hold_created", authorization)
+	} else {
+		go h.webhookService.SendCardAuthorizationWebhook("card_payment", authorization)
+		if transaction, err := h.bankingService.GetTransactionByID(*authorization.TransactionID); err == nil {
+			response["transaction"] = transaction
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CaptureHandler handles POST /api/card-payments/:code/capture
+func (h *CardPaymentHandler) CaptureHandler(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*Merchant)
+
+	// The amount is optional, so the body can be empty
+	var req CardCaptureRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	authorization, err := h.service.Capture(c.Param("code"), merchant.SettlementAccountNumber, req.Amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendCardAuthorizationWebhook("card_hold_captured", authorization)
+
+	response := gin.H{
+		"success":       true,
+		"authorization": authorization,
+	}
+	if transaction, err := h.bankingService.GetTransactionByID(*authorization.TransactionID); err == nil {
+		response["transaction"] = transaction
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// VoidHandler handles POST /api/card-payments/:code/void
+func (h *CardPaymentHandler) VoidHandler(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*Merchant)
+
+	authorization, err := h.service.Void(c.Param("code"), merchant.SettlementAccountNumber)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendCardAuthorizationWebhook("card_hold_voided", authorization)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"authorization": authorization,
+	})
+}
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// authorizationCodeAlphabet is used for card authorization codes
+const authorizationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Card payment errors that callers can tell apart
+var (
+	// errCardDeclined is returned for any card detail mismatch, so callers can't probe which detail was wrong
+	errCardDeclined          = fmt.Errorf("card declined")
+	errInsufficientBalance   = fmt.Errorf("insufficient balance")
+	errHoldNotFound          = fmt.Errorf("hold not found or already settled")
+	errHoldExpired           = fmt.Errorf("hold has expired")
+	errAuthorizationNotFound = fmt.Errorf("authorization not found")
+)
+
+// CardPaymentService handles merchant charges against PokéBank cards
+type CardPaymentService struct {
+	db          *sql.DB
+	cardService *CardService
+	banking     *BankingService
+	holdTTL     time.Duration
+}
+
+// NewCardPaymentService creates a new CardPaymentService
+func NewCardPaymentService(db *sql.DB, cardService *CardService, banking *BankingService) *CardPaymentService {
+	holdHours, err := strconv.Atoi(getEnv("CARD_HOLD_EXPIRY_HOURS", "168"))
+	if err != nil || holdHours <= 0 {
+		holdHours = 168
+	}
+
+	return &CardPaymentService{
+		db:          db,
+		cardService: cardService,
+		banking:     banking,
+		holdTTL:     time.Duration(holdHours) * time.Hour,
+	}
+}
+
+// CardPaymentDetails holds the card and charge details presented by a merchant
+type CardPaymentDetails struct {
+	CardNumber            string
+	ExpiryDate            string
+	CVV                   string // Card-not-present payments
+	PIN                   string // Card-present payments
+	Amount                float64
+	MerchantAccountNumber string
+	MerchantID            *int // Set when a registered merchant charges with its API key
+	Description           string
+	HoldOnly              bool // Reserve the funds for a later capture instead of charging now
+}
+
+// Authorize validates a card and either charges it immediately or places a hold on the cardholder's funds
+func (s *CardPaymentService) Authorize(details CardPaymentDetails) (*CardAuthorization, error) {
+	if details.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	// Check the card details before touching any balances
+	card, err := s.cardService.VerifyCard(details.CardNumber, details.ExpiryDate, details.CVV, details.PIN)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Make sure the card wasn't replaced in the meantime
+	var isActive bool
+	if err = tx.QueryRow(`SELECT is_active FROM cards WHERE id = ?`, card.ID).Scan(&isActive); err != nil {
+		return nil, err
+	}
+	if !isActive {
+		return nil, errCardDeclined
+	}
+
+	// Find the merchant account
+	var merchantUserID int
+	var merchantUsername string
+	err = tx.QueryRow(`SELECT id, username FROM users WHERE account_number = ?`, details.MerchantAccountNumber).Scan(&merchantUserID, &merchantUsername)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("merchant account not found")
+		}
+		return nil, err
+	}
+
+	merchant, err := registeredMerchantInTx(tx, details.MerchantID, merchantUserID, merchantUsername)
+	if err != nil {
+		return nil, err
+	}
+	merchant.CardID = card.ID
+
+	// Enforce the cardholder's freeze and spending controls
+	if err = checkCardControlsInTx(tx, card.ID, details.Amount, merchant.MerchantCategory); err != nil {
+		return nil, err
+	}
+
+	if merchantUserID == card.UserID {
+		return nil, fmt.Errorf("cannot pay yourself by card")
+	}
+
+	// Check both accounts can take part
+	if err = checkAccountCanSend(tx, card.UserID); err != nil {
+		return nil, err
+	}
+	if err = checkAccountCanReceive(tx, merchantUserID); err != nil {
+		return nil, err
+	}
+
+	// Check sufficient funds, excluding those already held
+	available, err := availableBalance(tx, card.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if available < details.Amount {
+		return nil, errInsufficientBalance
+	}
+
+	description := details.Description
+	if description == "" {
+		description = "Card payment"
+	}
+
+	code, err := generateAuthorizationCode()
+	if err != nil {
+		return nil, err
+	}
+
+	if card.CardType == CardTypeSingleUse {
+		// A single-use card with an open hold is waiting for that hold to be captured or released
+		var openHolds int
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM card_authorizations WHERE card_id = ? AND status = 'held' AND expires_at > ?
+		`, card.ID, time.Now().UTC()).Scan(&openHolds)
+		if err != nil {
+			return nil, err
+		}
+		if openHolds > 0 {
+			return nil, errCardDeclined
+		}
+
+		// Single-use cards are spent by their first payment; a hold only spends the card once it is captured
+		if !details.HoldOnly {
+			if err = deactivateCardInTx(tx, card.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var authorizationID int64
+	if details.HoldOnly {
+		// Reserve the funds; the ledger balance is untouched until capture
+		result, err := tx.Exec(`
+			INSERT INTO card_authorizations (card_id, cardholder_user_id, merchant_user_id, amount, merchant_id, merchant_category,
+			                                 merchant_name, authorization_code, description, status, expires_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'held', ?, ?)
+		`, card.ID, card.UserID, merchantUserID, details.Amount, merchant.MerchantID, merchant.MerchantCategory, merchant.MerchantName,
+			code, description, time.Now().UTC().Add(s.holdTTL), time.Now().UTC())
+		if err != nil {
+			return nil, err
+		}
+
+		authorizationID, err = result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		transactionID, err := s.chargeInTx(tx, card.UserID, merchantUserID, details.Amount, description, merchant)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO card_authorizations (card_id, cardholder_user_id, merchant_user_id, transaction_id, amount, captured_amount,
+			                                 merchant_id, merchant_category, merchant_name, authorization_code, description, status, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'approved', ?)
+		`, card.ID, card.UserID, merchantUserID, transactionID, details.Amount, details.Amount, merchant.MerchantID,
+			merchant.MerchantCategory, merchant.MerchantName, code, description, time.Now().UTC())
+		if err != nil {
+			return nil, err
+		}
+
+		authorizationID, err = result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getAuthorization(`WHERE a.id = ?`, authorizationID)
+}
+
+// Capture charges all or part of a held authorization; any uncaptured remainder is released.
+// An amount of zero captures the full hold.
+func (s *CardPaymentService) Capture(code, merchantAccountNumber string, amount float64) (*CardAuthorization, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hold, err := s.getHeldAuthorizationInTx(tx, code, merchantAccountNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if amount == 0 {
+		amount = hold.Amount
+	}
+	if amount < 0 || amount > hold.Amount {
+		return nil, fmt.Errorf("capture amount must be between 0 and the held amount of %.2f", hold.Amount)
+	}
+
+	if err = checkAccountCanReceive(tx, hold.MerchantUserID); err != nil {
+		return nil, err
+	}
+
+	// Capturing a hold spends a single-use card
+	var cardType string
+	if err = tx.QueryRow(`SELECT card_type FROM cards WHERE id = ?`, hold.CardID).Scan(&cardType); err != nil {
+		return nil, err
+	}
+	if cardType == CardTypeSingleUse {
+		if err = deactivateCardInTx(tx, hold.CardID); err != nil {
+			return nil, err
+		}
+	}
+
+	transactionID, err := s.chargeInTx(tx, hold.CardholderUserID, hold.MerchantUserID, amount, hold.Description, cardTransactionDetails{
+		CardID:           hold.CardID,
+		MerchantID:       hold.MerchantID,
+		MerchantName:     hold.MerchantName,
+		MerchantCategory: hold.MerchantCategory,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE card_authorizations SET status = 'captured', captured_amount = ?, transaction_id = ?
+		WHERE id = ?
+	`, amount, transactionID, hold.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getAuthorization(`WHERE a.id = ?`, hold.ID)
+}
+
+// Void releases a held authorization without charging the card
+func (s *CardPaymentService) Void(code, merchantAccountNumber string) (*CardAuthorization, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hold, err := s.getHeldAuthorizationInTx(tx, code, merchantAccountNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(`UPDATE card_authorizations SET status = 'voided' WHERE id = ?`, hold.ID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getAuthorization(`WHERE a.id = ?`, hold.ID)
+}
+
+// Reverse undoes an authorization for the merchant that made it. Holds are released as with Void;
+// completed payments are returned to the cardholder in full, less anything already refunded.
+func (s *CardPaymentService) Reverse(code, merchantAccountNumber string) (*CardAuthorization, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var authorizationID, cardholderUserID, merchantUserID int
+	var capturedAmount float64
+	var status string
+	var description, merchantName, merchantCategory sql.NullString
+	var transactionID, registeredMerchantID sql.NullInt64
+	var card cardTransactionDetails
+	err = tx.QueryRow(`
+		SELECT a.id, a.card_id, a.cardholder_user_id, a.merchant_user_id, a.transaction_id, a.captured_amount, a.status,
+		       a.description, a.merchant_id, COALESCE(a.merchant_name, m.username), a.merchant_category
+		FROM card_authorizations a
+		JOIN users m ON a.merchant_user_id = m.id
+		WHERE a.authorization_code = ? AND m.account_number = ?
+	`, code, merchantAccountNumber).Scan(
+		&authorizationID, &card.CardID, &cardholderUserID, &merchantUserID, &transactionID, &capturedAmount, &status,
+		&description, &registeredMerchantID, &merchantName, &merchantCategory,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errAuthorizationNotFound
+		}
+		return nil, err
+	}
+
+	var newStatus string
+	switch status {
+	case "held":
+		newStatus = "voided"
+	case "approved", "captured":
+		// The merchant pays back what it was charged and hasn't already refunded
+		originalID := int(transactionID.Int64)
+		amount, err := refundableAmountInTx(tx, originalID)
+		if err != nil {
+			return nil, err
+		}
+		if amount <= 0 {
+			return nil, errAlreadyRefunded
+		}
+
+		available, err := availableBalance(tx, merchantUserID)
+		if err != nil {
+			return nil, err
+		}
+		if available < amount {
+			return nil, fmt.Errorf("merchant has insufficient balance to reverse this payment")
+		}
+		if err := checkAccountCanReceive(tx, cardholderUserID); err != nil {
+			return nil, err
+		}
+
+		card.MerchantName, card.MerchantCategory = merchantName.String, merchantCategory.String
+		card.OriginalTransactionID = &originalID
+		if registeredMerchantID.Valid {
+			id := int(registeredMerchantID.Int64)
+			card.MerchantID = &id
+		}
+		_, err = s.moveFundsInTx(tx, merchantUserID, cardholderUserID, amount, "card_reversal", "Reversal: "+description.String, card)
+		if err != nil {
+			return nil, err
+		}
+		newStatus = "reversed"
+	default:
+		return nil, fmt.Errorf("authorization is already %s", status)
+	}
+
+	if _, err = tx.Exec(`UPDATE card_authorizations SET status = ? WHERE id = ?`, newStatus, authorizationID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getAuthorization(`WHERE a.id = ?`, authorizationID)
+}
+
+// ExpireHolds marks lapsed holds as expired, releasing their funds, and returns them
+func (s *CardPaymentService) ExpireHolds() ([]CardAuthorization, error) {
+	expired, err := s.getAuthorizations(`WHERE a.status = 'held' AND a.expires_at <= ?`, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	var released []CardAuthorization
+	for _, hold := range expired {
+		// Skip holds captured or voided since they were read
+		result, err := s.db.Exec(`UPDATE card_authorizations SET status = 'expired' WHERE id = ? AND status = 'held'`, hold.ID)
+		if err != nil {
+			return released, err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 1 {
+			hold.Status = "expired"
+			released = append(released, hold)
+		}
+	}
+
+	return released, nil
+}
+
+// registeredMerchantInTx finds the name and category a card payment into an account is recorded under.
+// They come from the merchant's registration, never from whoever presents the payment: the given merchant,
+// or else the first active merchant settling into the account. Other payees are "other", under their username.
+func registeredMerchantInTx(tx *sql.Tx, merchantID *int, merchantUserID int, merchantUsername string) (cardTransactionDetails, error) {
+	details := cardTransactionDetails{MerchantName: merchantUsername, MerchantCategory: normalizeCategory("")}
+
+	var id int
+	var name, category string
+	var err error
+	if merchantID != nil {
+		err = tx.QueryRow(`SELECT id, name, category_code FROM merchants WHERE id = ?`, *merchantID).Scan(&id, &name, &category)
+	} else {
+		err = tx.QueryRow(`
+			SELECT id, name, category_code FROM merchants
+			WHERE settlement_user_id = ? AND is_active = TRUE
+			ORDER BY id
+			LIMIT 1
+		`, merchantUserID).Scan(&id, &name, &category)
+	}
+	if err == sql.ErrNoRows && merchantID == nil {
+		return details, nil
+	}
+	if err != nil {
+		return details, err
+	}
+
+	details.MerchantID = &id
+	details.MerchantName = name
+	details.MerchantCategory = normalizeCategory(category)
+	return details, nil
+}
+
+// deactivateCardInTx deactivates a spent single-use card
+func deactivateCardInTx(tx *sql.Tx, cardID int) error {
+	_, err := tx.Exec(`UPDATE cards SET is_active = FALSE, deactivated_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, time.Now().UTC(), cardID)
+	return err
+}
+
+// cardTransactionDetails records which card a transaction was made with and where
+type cardTransactionDetails struct {
+	CardID                int
+	MerchantID            *int
+	MerchantName          string
+	MerchantCategory      string
+	OriginalTransactionID *int // Set for reversals
+}
+
+// chargeInTx moves a card payment from the cardholder to the merchant and returns the transaction ID
+func (s *CardPaymentService) chargeInTx(tx *sql.Tx, cardholderUserID, merchantUserID int, amount float64, description string, card cardTransactionDetails) (int, error) {
+	return s.moveFundsInTx(tx, cardholderUserID, merchantUserID, amount, "card_payment", description, card)
+}
+
+// moveFundsInTx moves money between two users, records the card transaction and returns its ID
+func (s *CardPaymentService) moveFundsInTx(tx *sql.Tx, fromUserID, toUserID int, amount float64, transactionType, description string, card cardTransactionDetails) (int, error) {
+	var balance float64
+	if err := tx.QueryRow(`SELECT balance FROM users WHERE id = ?`, fromUserID).Scan(&balance); err != nil {
+		return 0, err
+	}
+	if balance < amount {
+		return 0, errInsufficientBalance
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, fromUserID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, toUserID); err != nil {
+		return 0, err
+	}
+
+	// Create transaction record
+	var transactionID int
+	err := tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, card_id,
+		                          merchant_id, merchant_name, merchant_category, original_transaction_id, created_at)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, fromUserID, toUserID, amount, transactionType, description, card.CardID, card.MerchantID, card.MerchantName,
+		card.MerchantCategory, card.OriginalTransactionID, time.Now()).Scan(&transactionID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Reset PokéBank balance if involved in transaction
+	if err = s.banking.resetPokeBankBalanceInTx(tx, fromUserID, toUserID); err != nil {
+		return 0, err
+	}
+
+	return transactionID, nil
+}
+
+// getHeldAuthorizationInTx finds an unexpired hold placed by the given merchant
+func (s *CardPaymentService) getHeldAuthorizationInTx(tx *sql.Tx, code, merchantAccountNumber string) (*CardAuthorization, error) {
+	hold := &CardAuthorization{}
+	var expiresAt time.Time
+	var merchantCategory sql.NullString
+	var merchantID sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT a.id, a.card_id, a.cardholder_user_id, a.merchant_user_id, a.amount, a.description, a.expires_at,
+		       a.merchant_id, COALESCE(a.merchant_name, m.username), a.merchant_category
+		FROM card_authorizations a
+		JOIN users m ON a.merchant_user_id = m.id
+		WHERE a.authorization_code = ? AND m.account_number = ? AND a.status = 'held'
+	`, code, merchantAccountNumber).Scan(
+		&hold.ID, &hold.CardID, &hold.CardholderUserID, &hold.MerchantUserID, &hold.Amount, &hold.Description, &expiresAt,
+		&merchantID, &hold.MerchantName, &merchantCategory,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errHoldNotFound
+		}
+		return nil, err
+	}
+
+	if !time.Now().Before(expiresAt) {
+		return nil, errHoldExpired
+	}
+	hold.MerchantCategory = merchantCategory.String
+	if merchantID.Valid {
+		id := int(merchantID.Int64)
+		hold.MerchantID = &id
+	}
+
+	return hold, nil
+}
+
+// cardAuthorizationSelect selects card authorizations with display fields
+const cardAuthorizationSelect = `
+	SELECT a.id, a.card_id, a.cardholder_user_id, a.merchant_user_id, a.transaction_id, a.amount,
+	       a.captured_amount, a.merchant_id, a.merchant_category, a.merchant_name, a.authorization_code, a.description, a.status, a.expires_at, a.created_at,
+	       c.card_number, u1.username, u2.username
+	FROM card_authorizations a
+	JOIN cards c ON a.card_id = c.id
+	LEFT JOIN users u1 ON a.cardholder_user_id = u1.id
+	LEFT JOIN users u2 ON a.merchant_user_id = u2.id `
+
+// getAuthorization retrieves a single authorization matching the given WHERE clause
+func (s *CardPaymentService) getAuthorization(where string, args ...interface{}) (*CardAuthorization, error) {
+	return scanCardAuthorization(s.db.QueryRow(cardAuthorizationSelect+where, args...))
+}
+
+// getAuthorizations retrieves every authorization matching the given WHERE clause
+func (s *CardPaymentService) getAuthorizations(where string, args ...interface{}) ([]CardAuthorization, error) {
+	rows, err := s.db.Query(cardAuthorizationSelect+where+` ORDER BY a.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authorizations []CardAuthorization
+	for rows.Next() {
+		authorization, err := scanCardAuthorization(rows)
+		if err != nil {
+			return nil, err
+		}
+		authorizations = append(authorizations, *authorization)
+	}
+
+	return authorizations, rows.Err()
+}
+
+// scanCardAuthorization scans an authorization row into a CardAuthorization
+func scanCardAuthorization(row rowScanner) (*CardAuthorization, error) {
+	authorization := &CardAuthorization{}
+	var transactionID, merchantID sql.NullInt64
+	var merchantCategory, merchantName, description sql.NullString
+	var expiresAt sql.NullTime
+	var cardNumber string
+
+	err := row.Scan(
+		&authorization.ID, &authorization.CardID, &authorization.CardholderUserID, &authorization.MerchantUserID,
+		&transactionID, &authorization.Amount, &authorization.CapturedAmount, &merchantID, &merchantCategory, &merchantName,
+		&authorization.AuthorizationCode,
+		&description, &authorization.Status, &expiresAt, &authorization.CreatedAt,
+		&cardNumber, &authorization.CardholderUsername, &authorization.MerchantUsername,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	authorization.Description = description.String
+	authorization.MerchantCategory = merchantCategory.String
+	authorization.MerchantName = merchantName.String
+	if transactionID.Valid {
+		id := int(transactionID.Int64)
+		authorization.TransactionID = &id
+	}
+	if merchantID.Valid {
+		id := int(merchantID.Int64)
+		authorization.MerchantID = &id
+	}
+	if expiresAt.Valid {
+		authorization.ExpiresAt = &expiresAt.Time
+	}
+	authorization.CardLast4 = cardLast4(cardNumber)
+
+	return authorization, nil
+}
+
+// availableBalance returns a user's balance minus funds held by unexpired card authorizations
+func availableBalance(q queryRower, userID int) (float64, error) {
+	var balance, held float64
+	err := q.QueryRow(`SELECT balance FROM users WHERE id = ?`, userID).Scan(&balance)
+	if err != nil {
+		return 0, err
+	}
+
+	err = q.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM card_authorizations
+		WHERE cardholder_user_id = ? AND status = 'held' AND expires_at > ?
+	`, userID, time.Now().UTC()).Scan(&held)
+	if err != nil {
+		return 0, err
+	}
+
+	return balance - held, nil
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// generateAuthorizationCode returns a random 6-character authorization code
+func generateAuthorizationCode() (string, error) {
+	code := make([]byte, 6)
+	max := big.NewInt(int64(len(authorizationCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = authorizationCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
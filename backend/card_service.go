@@ -1,51 +1,165 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/binary"
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// maxPINAttempts is the number of consecutive wrong PINs after which card-present payments are blocked
+const maxPINAttempts = 3
+
+// maxCVVAttempts is the number of consecutive wrong CVVs after which card-not-present payments are blocked
+const maxCVVAttempts = 5
+
 // CardService handles card-related operations
 type CardService struct {
-	db *sql.DB
+	db              *sql.DB
+	maxActiveCards  int
+	reissueLeadTime time.Duration // How long before expiry cards are replaced; 0 disables reissue
+
+	secretOnce sync.Once
+	secret     []byte
+	secretErr  error
 }
 
 // NewCardService creates a new card service
 func NewCardService(db *sql.DB) *CardService {
-	return &CardService{db: db}
+	maxActiveCards, err := strconv.Atoi(getEnv("MAX_ACTIVE_CARDS", "10"))
+	if err != nil || maxActiveCards <= 0 {
+		maxActiveCards = 10
+	}
+	
+	reissueDays, err := strconv.Atoi(getEnv("CARD_REISSUE_DAYS_BEFORE_EXPIRY", "30"))
+	if err != nil || reissueDays < 0 {
+		reissueDays = 30
+	}
+	
+	return &CardService{
+		db:              db,
+		maxActiveCards:  maxActiveCards,
+		reissueLeadTime: time.Duration(reissueDays) * 24 * time.Hour,
+	}
+}
+
+// Card types
+const (
+	CardTypeStandard  = "standard"
+	CardTypeSingleUse = "single_use" // Deactivates itself after one successful payment
+)
+
+// GetUserCard retrieves the user's primary card, creating one if it doesn't exist
+func (cs *CardService) GetUserCard(userID int) (*Card, error) {
+	// First try to get existing primary card
+	card, err := cs.getPrimaryCard(userID)
+	if err != nil {
+		// If no primary card exists, create a new one
+		card, err = cs.createCard(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	return cs.withCVV(card)
+}
+
+// GetCard retrieves one of the user's cards, active or not
+func (cs *CardService) GetCard(userID, cardID int) (*Card, error) {
+	card, err := scanCard(cs.db.QueryRow(cardSelect+`WHERE id = ? AND user_id = ?`, cardID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("card not found")
+		}
+		return nil, err
+	}
+	
+	return cs.withCVV(card)
+}
+
+// GetUserCards lists the user's cards, newest first, optionally including deactivated ones
+func (cs *CardService) GetUserCards(userID int, includeInactive bool) ([]Card, error) {
+	where := `WHERE user_id = ? AND is_active = TRUE`
+	if includeInactive {
+		where = `WHERE user_id = ?`
+	}
+	
+	rows, err := cs.db.Query(cardSelect+where+` ORDER BY is_primary DESC, created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var cards []Card
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		if card, err = cs.withCVV(card); err != nil {
+			return nil, err
+		}
+		cards = append(cards, *card)
+	}
+	
+	return cards, rows.Err()
 }
 
-// GetUserCard retrieves the active card for a user, creating one if it doesn't exist
-func (cs *CardService) GetUserCard(userID int, accountNumber string) (*Card, error) {
-	// First try to get existing active card
-	card, err := cs.getActiveCard(userID)
-	if err == nil {
+// withCVV fills in the CVV of an active card
+func (cs *CardService) withCVV(card *Card) (*Card, error) {
+	if !card.IsActive {
 		return card, nil
 	}
 	
-	// If no active card exists, create a new one
-	return cs.createCard(userID, accountNumber)
+	cvv, err := cs.cardCVV(card.CardNumber, card.ExpiryDate)
+	if err != nil {
+		return nil, err
+	}
+	card.CVV = cvv
+	
+	return card, nil
 }
 
-// getActiveCard retrieves the user's active card
-func (cs *CardService) getActiveCard(userID int) (*Card, error) {
-	query := `
-		SELECT id, user_id, card_number, expiry_date, refresh_seed, 
-		       last_refresh_date, is_active, created_at, updated_at
-		FROM cards 
-		WHERE user_id = ? AND is_active = TRUE
-		ORDER BY created_at DESC
+// getPrimaryCard retrieves the user's active primary card
+func (cs *CardService) getPrimaryCard(userID int) (*Card, error) {
+	return scanCard(cs.db.QueryRow(cardSelect+`
+		WHERE user_id = ? AND is_active = TRUE AND is_primary = TRUE
+		ORDER BY created_at DESC, id DESC
 		LIMIT 1
-	`
-	
+	`, userID))
+}
+
+// cardSelect selects every card column
+const cardSelect = `
+	SELECT id, user_id, name, card_type, is_primary, card_number, expiry_date, refresh_seed, 
+	       last_refresh_date, is_active, pin_hash, is_frozen, daily_limit, transaction_limit,
+	       allowed_categories, blocked_categories, valid_until, deactivated_at, expires_at,
+	       replaced_by_card_id, pin_failed_attempts, cvv_failed_attempts, created_at, updated_at
+	FROM cards `
+
+// scanCard scans a card row into a Card
+func scanCard(row rowScanner) (*Card, error) {
 	var card Card
-	var lastRefreshDate sql.NullTime
-	
-	err := cs.db.QueryRow(query, userID).Scan(
-		&card.ID, &card.UserID, &card.CardNumber, &card.ExpiryDate,
-		&card.RefreshSeed, &lastRefreshDate, &card.IsActive,
+	var lastRefreshDate, validUntil, deactivatedAt, expiresAt sql.NullTime
+	var pinHash, allowedCategories, blockedCategories sql.NullString
+	var dailyLimit, transactionLimit sql.NullFloat64
+	var replacedByCardID sql.NullInt64
+	var pinFailedAttempts, cvvFailedAttempts int
+	
+	err := row.Scan(
+		&card.ID, &card.UserID, &card.Name, &card.CardType, &card.IsPrimary, &card.CardNumber, &card.ExpiryDate,
+		&card.RefreshSeed, &lastRefreshDate, &card.IsActive, &pinHash,
+		&card.IsFrozen, &dailyLimit, &transactionLimit, &allowedCategories, &blockedCategories,
+		&validUntil, &deactivatedAt, &expiresAt, &replacedByCardID, &pinFailedAttempts, &cvvFailedAttempts,
 		&card.CreatedAt, &card.UpdatedAt,
 	)
 	
@@ -56,21 +170,49 @@ func (cs *CardService) getActiveCard(userID int) (*Card, error) {
 	if lastRefreshDate.Valid {
 		card.LastRefreshDate = &lastRefreshDate.Time
 	}
+	card.PINHash = pinHash.String
+	card.PINSet = pinHash.String != ""
+	card.PINLocked = pinFailedAttempts >= maxPINAttempts
+	card.CVVLocked = cvvFailedAttempts >= maxCVVAttempts
+	if dailyLimit.Valid {
+		card.DailyLimit = &dailyLimit.Float64
+	}
+	if transactionLimit.Valid {
+		card.TransactionLimit = &transactionLimit.Float64
+	}
+	card.AllowedCategories = strings.Fields(allowedCategories.String)
+	card.BlockedCategories = strings.Fields(blockedCategories.String)
+	if validUntil.Valid {
+		card.ValidUntil = &validUntil.Time
+	}
+	if deactivatedAt.Valid {
+		card.DeactivatedAt = &deactivatedAt.Time
+	}
+	if expiresAt.Valid {
+		card.ExpiresAt = &expiresAt.Time
+	}
+	if replacedByCardID.Valid {
+		id := int(replacedByCardID.Int64)
+		card.ReplacedByCardID = &id
+	}
 	
 	return &card, nil
 }
 
-// createCard creates a new card for a user
-func (cs *CardService) createCard(userID int, accountNumber string) (*Card, error) {
-	cardNumber := cs.generateCardNumber(accountNumber, 0)
-	expiryDate := cs.generateExpiryDate()
+// createCard creates a new primary card for a user
+func (cs *CardService) createCard(userID int) (*Card, error) {
+	cardNumber, err := cs.generateCardNumber()
+	if err != nil {
+		return nil, err
+	}
+	expiryDate, expiresAt := cs.generateExpiryDate()
 	
 	query := `
-		INSERT INTO cards (user_id, card_number, expiry_date, refresh_seed, is_active, created_at, updated_at)
-		VALUES (?, ?, ?, ?, TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		INSERT INTO cards (user_id, name, card_type, is_primary, card_number, expiry_date, expires_at, refresh_seed, is_active, created_at, updated_at)
+		VALUES (?, 'Main card', ?, TRUE, ?, ?, ?, ?, TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
 	
-	result, err := cs.db.Exec(query, userID, cardNumber, expiryDate, 0)
+	result, err := cs.db.Exec(query, userID, CardTypeStandard, cardNumber, expiryDate, expiresAt, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create card: %v", err)
 	}
@@ -80,23 +222,116 @@ func (cs *CardService) createCard(userID int, accountNumber string) (*Card, erro
 		return nil, fmt.Errorf("failed to get card ID: %v", err)
 	}
 	
-	return &Card{
-		ID:              int(cardID),
-		UserID:          userID,
-		CardNumber:      cardNumber,
-		ExpiryDate:      expiryDate,
-		RefreshSeed:     0,
-		LastRefreshDate: nil,
-		IsActive:        true,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-	}, nil
+	return scanCard(cs.db.QueryRow(cardSelect+`WHERE id = ?`, cardID))
+}
+
+// CreateVirtualCard issues an additional named card. Single-use cards deactivate after one payment;
+// a non-zero lifetime makes the card stop working once it has passed.
+func (cs *CardService) CreateVirtualCard(userID int, name, cardType string, lifetime time.Duration) (*Card, error) {
+	if cardType == "" {
+		cardType = CardTypeStandard
+	}
+	if cardType != CardTypeStandard && cardType != CardTypeSingleUse {
+		return nil, fmt.Errorf("invalid card type: %s", cardType)
+	}
+	
+	// Start transaction
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	
+	// Frozen accounts can't issue new cards
+	if err := checkAccountCanSend(tx, userID); err != nil {
+		return nil, err
+	}
+	
+	var activeCards int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM cards WHERE user_id = ? AND is_active = TRUE`, userID).Scan(&activeCards); err != nil {
+		return nil, err
+	}
+	if activeCards >= cs.maxActiveCards {
+		return nil, fmt.Errorf("you can have at most %d active cards", cs.maxActiveCards)
+	}
+	
+	cardNumber, err := cs.generateCardNumber()
+	if err != nil {
+		return nil, err
+	}
+	expiryDate, expiresAt := cs.generateExpiryDate()
+	
+	var validUntil interface{}
+	if lifetime > 0 {
+		validUntil = time.Now().UTC().Add(lifetime)
+	}
+	
+	result, err := tx.Exec(`
+		INSERT INTO cards (user_id, name, card_type, is_primary, card_number, expiry_date, expires_at, refresh_seed, is_active,
+		                   valid_until, created_at, updated_at)
+		VALUES (?, ?, ?, FALSE, ?, ?, ?, 0, TRUE, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, userID, name, cardType, cardNumber, expiryDate, expiresAt, validUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create card: %v", err)
+	}
+	
+	cardID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	
+	return cs.GetCard(userID, int(cardID))
+}
+
+// RenameCard changes a card's name
+func (cs *CardService) RenameCard(userID, cardID int, name string) (*Card, error) {
+	result, err := cs.db.Exec(`UPDATE cards SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?`, name, cardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	if err := requireCardUpdated(result); err != nil {
+		return nil, err
+	}
+	
+	return cs.GetCard(userID, cardID)
+}
+
+// DeactivateCard permanently deactivates an additional card; it stays in the card history.
+// The primary card can only be replaced with RefreshCard.
+func (cs *CardService) DeactivateCard(userID, cardID int) error {
+	result, err := cs.db.Exec(`
+		UPDATE cards SET is_active = FALSE, deactivated_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND is_active = TRUE AND is_primary = FALSE
+	`, time.Now().UTC(), cardID, userID)
+	if err != nil {
+		return err
+	}
+	
+	return requireCardUpdated(result)
+}
+
+// requireCardUpdated returns an error if an update matched no card
+func requireCardUpdated(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("card not found or not active")
+	}
+	return nil
 }
 
 // RefreshCard generates a new card for the user if allowed
-func (cs *CardService) RefreshCard(userID int, accountNumber string) (*Card, error) {
-	// Get current active card
-	currentCard, err := cs.getActiveCard(userID)
+func (cs *CardService) RefreshCard(userID int) (*Card, error) {
+	// Get current primary card
+	currentCard, err := cs.getPrimaryCard(userID)
 	if err != nil {
 		return nil, fmt.Errorf("no active card found: %v", err)
 	}
@@ -113,24 +348,32 @@ func (cs *CardService) RefreshCard(userID int, accountNumber string) (*Card, err
 	}
 	defer tx.Rollback()
 	
+	// Frozen accounts can't change their cards
+	if err := checkAccountCanSend(tx, userID); err != nil {
+		return nil, err
+	}
+	
 	// Deactivate current card
-	_, err = tx.Exec("UPDATE cards SET is_active = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = ?", currentCard.ID)
+	now := time.Now()
+	_, err = tx.Exec("UPDATE cards SET is_active = FALSE, deactivated_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", now, currentCard.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to deactivate current card: %v", err)
 	}
 	
-	// Create new card with incremented refresh seed
+	// Create new card with incremented refresh count
 	newRefreshSeed := currentCard.RefreshSeed + 1
-	newCardNumber := cs.generateCardNumber(accountNumber, newRefreshSeed)
-	newExpiryDate := cs.generateExpiryDate()
-	now := time.Now()
+	newCardNumber, err := cs.generateCardNumber()
+	if err != nil {
+		return nil, err
+	}
+	newExpiryDate, newExpiresAt := cs.generateExpiryDate()
 	
 	query := `
-		INSERT INTO cards (user_id, card_number, expiry_date, refresh_seed, last_refresh_date, is_active, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		INSERT INTO cards (user_id, card_type, is_primary, card_number, expiry_date, expires_at, refresh_seed, last_refresh_date, is_active, created_at, updated_at)
+		VALUES (?, ?, TRUE, ?, ?, ?, ?, ?, TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
 	
-	result, err := tx.Exec(query, userID, newCardNumber, newExpiryDate, newRefreshSeed, now)
+	result, err := tx.Exec(query, userID, CardTypeStandard, newCardNumber, newExpiryDate, newExpiresAt, newRefreshSeed, now)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new card: %v", err)
 	}
@@ -140,22 +383,21 @@ func (cs *CardService) RefreshCard(userID int, accountNumber string) (*Card, err
 		return nil, fmt.Errorf("failed to get new card ID: %v", err)
 	}
 	
+	// The name, PIN and spending controls carry over to the new card
+	if err := copyCardSettingsInTx(tx, currentCard.ID, int(newCardID)); err != nil {
+		return nil, fmt.Errorf("failed to copy card settings: %v", err)
+	}
+	
+	if _, err := tx.Exec("UPDATE cards SET replaced_by_card_id = ? WHERE id = ?", newCardID, currentCard.ID); err != nil {
+		return nil, fmt.Errorf("failed to link replacement card: %v", err)
+	}
+	
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %v", err)
 	}
 	
-	return &Card{
-		ID:              int(newCardID),
-		UserID:          userID,
-		CardNumber:      newCardNumber,
-		ExpiryDate:      newExpiryDate,
-		RefreshSeed:     newRefreshSeed,
-		LastRefreshDate: &now,
-		IsActive:        true,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-	}, nil
+	return cs.GetUserCard(userID)
 }
 
 // canRefreshCard checks if a card can be refreshed (once per day limit)
@@ -170,69 +412,39 @@ func (cs *CardService) canRefreshCard(card *Card) bool {
 	return timeSinceRefresh >= 24*time.Hour
 }
 
-// generateCardNumber generates a card number using the same algorithm as frontend
-func (cs *CardService) generateCardNumber(accountNumber string, refreshSeed int) string {
-	// Extract numeric part from account number
-	accountSeed := cs.extractNumeric(accountNumber)
-	if accountSeed == 0 {
-		accountSeed = 1234
-	}
-	
-	// Add refresh seed to generate new numbers when card is refreshed
-	combinedSeed := accountSeed + refreshSeed
-	
-	// Viridian City Bank BIN (Bank Identification Number) - using 4532 (Visa format)
-	cardNumber := "4532"
-	
-	// Generate middle digits based on combined seed
-	middle8Digits := cs.generateMiddleDigits(combinedSeed)
-	cardNumber += middle8Digits
-	
-	// Add check digit using Luhn algorithm
-	checkDigit := cs.calculateLuhnCheckDigit(cardNumber)
-	cardNumber += strconv.Itoa(checkDigit)
-	
-	return cardNumber
-}
-
-// extractNumeric extracts numeric characters from a string and converts to int
-func (cs *CardService) extractNumeric(s string) int {
-	var numeric string
-	for _, char := range s {
-		if char >= '0' && char <= '9' {
-			numeric += string(char)
+// generateCardNumber generates a random, unused 16-digit card number
+func (cs *CardService) generateCardNumber() (string, error) {
+	for {
+		// Viridian City Bank BIN (Bank Identification Number) - using 4532 (Visa format)
+		cardNumber := "4532"
+		
+		// 11 random digits, then a Luhn check digit
+		for i := 0; i < 11; i++ {
+			digit, err := rand.Int(rand.Reader, big.NewInt(10))
+			if err != nil {
+				return "", err
+			}
+			cardNumber += digit.String()
+		}
+		cardNumber += strconv.Itoa(cs.calculateLuhnCheckDigit(cardNumber))
+		
+		var exists bool
+		err := cs.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM cards WHERE card_number = ?)`, cardNumber).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return cardNumber, nil
 		}
 	}
-	
-	if numeric == "" {
-		return 0
-	}
-	
-	result, err := strconv.Atoi(numeric)
-	if err != nil {
-		return 0
-	}
-	
-	return result
 }
 
-// generateMiddleDigits generates 8 middle digits using a pseudo-random generator
-func (cs *CardService) generateMiddleDigits(seed int) string {
-	random := seed
-	result := ""
-	
-	for i := 0; i < 8; i++ {
-		random = (random*9301 + 49297) % 233280
-		digit := (random * 10) / 233280
-		result += strconv.Itoa(digit)
-	}
-	
-	// Ensure it's exactly 8 digits
-	for len(result) < 8 {
-		result = "0" + result
+// cardLast4 returns the last four digits of a card number, safe to show in notifications
+func cardLast4(cardNumber string) string {
+	if len(cardNumber) <= 4 {
+		return ""
 	}
-	
-	return result[:8]
+	return cardNumber[len(cardNumber)-4:]
 }
 
 // calculateLuhnCheckDigit calculates the Luhn check digit for a card number
@@ -258,13 +470,17 @@ func (cs *CardService) calculateLuhnCheckDigit(cardNumber string) int {
 	return (10 - (sum % 10)) % 10
 }
 
-// generateExpiryDate generates an expiry date 3 years from now
-func (cs *CardService) generateExpiryDate() string {
+// generateExpiryDate generates an MM/YY expiry date 3 years from now,
+// along with the moment the card stops working
+func (cs *CardService) generateExpiryDate() (string, time.Time) {
 	now := time.Now()
 	expiryYear := now.Year() + 3
 	expiryMonth := now.Month()
 	
-	return fmt.Sprintf("%02d/%02d", int(expiryMonth), expiryYear%100)
+	expiryDate := fmt.Sprintf("%02d/%02d", int(expiryMonth), expiryYear%100)
+	expiresAt, _ := parseCardExpiry(expiryDate)
+	
+	return expiryDate, expiresAt
 }
 
 // GetTimeUntilNextRefresh returns the time remaining until next refresh is allowed
@@ -283,3 +499,172 @@ func (cs *CardService) GetTimeUntilNextRefresh(card *Card) *time.Duration {
 	duration := nextRefreshTime.Sub(now)
 	return &duration
 }
+
+// cardSecretKey returns the key used to derive card verification values.
+// CARD_SECRET_KEY takes precedence; otherwise a key is generated once and kept in the database.
+func (cs *CardService) cardSecretKey() ([]byte, error) {
+	cs.secretOnce.Do(func() {
+		if key := getEnv("CARD_SECRET_KEY", ""); key != "" {
+			cs.secret = []byte(key)
+			return
+		}
+		
+		key, err := getOrCreateServerSecret(cs.db, "card_secret_key")
+		cs.secret, cs.secretErr = []byte(key), err
+	})
+	
+	return cs.secret, cs.secretErr
+}
+
+// cardCVV derives a card's 3-digit verification value from its number and expiry
+func (cs *CardService) cardCVV(cardNumber, expiryDate string) (string, error) {
+	key, err := cs.cardSecretKey()
+	if err != nil {
+		return "", err
+	}
+	
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(cardNumber + "|" + expiryDate))
+	sum := mac.Sum(nil)
+	
+	return fmt.Sprintf("%03d", binary.BigEndian.Uint32(sum[:4])%1000), nil
+}
+
+// verifyCardCVV checks a card-not-present CVV against the card's derived value in constant time,
+// locking card-not-present payments after too many consecutive failures. A locked card is declined like any
+// other mismatch; only the cardholder sees the lock, as the card's cvv_locked.
+func (cs *CardService) verifyCardCVV(card *Card, cvv string, failedAttempts int) error {
+	if failedAttempts >= maxCVVAttempts {
+		return errCardDeclined
+	}
+	
+	expected, err := cs.cardCVV(card.CardNumber, card.ExpiryDate)
+	if err != nil {
+		return err
+	}
+	
+	if !hmac.Equal([]byte(expected), []byte(cvv)) {
+		cs.db.Exec(`UPDATE cards SET cvv_failed_attempts = cvv_failed_attempts + 1 WHERE id = ?`, card.ID)
+		return errCardDeclined
+	}
+	
+	if failedAttempts > 0 {
+		cs.db.Exec(`UPDATE cards SET cvv_failed_attempts = 0 WHERE id = ?`, card.ID)
+	}
+	
+	return nil
+}
+
+// parseCardExpiry converts an MM/YY expiry date into the moment the card stops working.
+// Cards are valid through the last day of their expiry month (UTC).
+func parseCardExpiry(expiryDate string) (time.Time, error) {
+	expiry, err := time.Parse("01/06", expiryDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry date %q: %v", expiryDate, err)
+	}
+	
+	return expiry.AddDate(0, 1, 0).UTC(), nil
+}
+
+// SetPIN sets the 4-digit PIN on one of the user's active cards and clears any PIN lockout
+func (cs *CardService) SetPIN(userID, cardID int, pin string) error {
+	if len(pin) != 4 || strings.Trim(pin, "0123456789") != "" {
+		return fmt.Errorf("PIN must be exactly 4 digits")
+	}
+	
+	hashedPIN, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	
+	result, err := cs.db.Exec(`
+		UPDATE cards SET pin_hash = ?, pin_failed_attempts = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND is_active = TRUE
+	`, string(hashedPIN), cardID, userID)
+	if err != nil {
+		return err
+	}
+	
+	return requireCardUpdated(result)
+}
+
+// VerifyCard looks up an active, unexpired card and checks the details presented for a payment:
+// the CVV for card-not-present payments, or the PIN for card-present payments.
+// Every mismatch returns the same error so callers can't probe which detail was wrong.
+func (cs *CardService) VerifyCard(cardNumber, expiryDate, cvv, pin string) (*Card, error) {
+	card := &Card{}
+	var pinHash sql.NullString
+	var validUntil, expiresAt sql.NullTime
+	var pinFailedAttempts, cvvFailedAttempts int
+	err := cs.db.QueryRow(`
+		SELECT id, user_id, card_type, card_number, expiry_date, expires_at, pin_hash, pin_failed_attempts,
+		       cvv_failed_attempts, valid_until
+		FROM cards
+		WHERE card_number = ? AND is_active = TRUE
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, cardNumber).Scan(
+		&card.ID, &card.UserID, &card.CardType, &card.CardNumber, &card.ExpiryDate, &expiresAt, &pinHash, &pinFailedAttempts,
+		&cvvFailedAttempts, &validUntil,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errCardDeclined
+		}
+		return nil, err
+	}
+	card.PINHash = pinHash.String
+	card.PINSet = pinHash.String != ""
+	
+	if expiryDate != card.ExpiryDate {
+		return nil, errCardDeclined
+	}
+	// Cards issued before expiry dates were stored get theirs from the MM/YY date
+	if !expiresAt.Valid {
+		parsed, err := parseCardExpiry(card.ExpiryDate)
+		if err != nil {
+			return nil, errCardDeclined
+		}
+		expiresAt = sql.NullTime{Time: parsed, Valid: true}
+	}
+	if !time.Now().Before(expiresAt.Time) {
+		return nil, errCardDeclined
+	}
+	if validUntil.Valid && !time.Now().Before(validUntil.Time) {
+		return nil, errCardDeclined
+	}
+	
+	switch {
+	case pin != "":
+		if err := cs.verifyCardPIN(card, pin, pinFailedAttempts); err != nil {
+			return nil, err
+		}
+	case cvv != "":
+		if err := cs.verifyCardCVV(card, cvv, cvvFailedAttempts); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errCardDeclined
+	}
+	
+	return card, nil
+}
+
+// verifyCardPIN checks a card-present PIN, locking the PIN after too many consecutive failures. Cards without a
+// PIN or with a locked one are declined like any other mismatch; the cardholder sees pin_set and pin_locked.
+func (cs *CardService) verifyCardPIN(card *Card, pin string, failedAttempts int) error {
+	if !card.PINSet || failedAttempts >= maxPINAttempts {
+		return errCardDeclined
+	}
+	
+	if bcrypt.CompareHashAndPassword([]byte(card.PINHash), []byte(pin)) != nil {
+		cs.db.Exec(`UPDATE cards SET pin_failed_attempts = pin_failed_attempts + 1 WHERE id = ?`, card.ID)
+		return errCardDeclined
+	}
+	
+	if failedAttempts > 0 {
+		cs.db.Exec(`UPDATE cards SET pin_failed_attempts = 0 WHERE id = ?`, card.ID)
+	}
+	
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EscrowHandler handles escrow transfers
+type EscrowHandler struct {
+	escrowService  *EscrowService
+	userService    *UserService
+	webhookService *WebhookService
+}
+
+// NewEscrowHandler creates a new EscrowHandler
+func NewEscrowHandler(escrowService *EscrowService, userService *UserService, webhookService *WebhookService) *EscrowHandler {
+	return &EscrowHandler{
+		escrowService:  escrowService,
+		userService:    userService,
+		webhookService: webhookService,
+	}
+}
+
+// CreateEscrowRequest represents the request body for opening an escrow
+type CreateEscrowRequest struct {
+	Seller        string  `json:"seller" binding:"required"` // Username or account number
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	Description   string  `json:"description" binding:"required"`
+	TimeoutHours  int     `json:"timeout_hours"`                                           // Omit for the default
+	TimeoutAction string  `json:"timeout_action" binding:"omitempty,oneof=release refund"` // Default release
+}
+
+// DisputeEscrowRequest represents the request body for disputing an escrow
+type DisputeEscrowRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ResolveEscrowRequest represents an admin's decision on an escrow
+type ResolveEscrowRequest struct {
+	Outcome string `json:"outcome" binding:"required,oneof=release refund"`
+	Note    string `json:"note"`
+}
+
+// CreateEscrowHandler handles POST /api/escrows
+func (h *EscrowHandler) CreateEscrowHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req CreateEscrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	seller, err := h.userService.GetUserByUsernameOrAccountNumber(req.Seller)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seller not found"})
+		return
+	}
+
+	timeoutAction := req.TimeoutAction
+	if timeoutAction == "" {
+		timeoutAction = EscrowRelease
+	}
+
+	escrow, err := h.escrowService.CreateEscrow(userID, seller.ID, req.Amount, req.Description, timeoutAction, req.TimeoutHours)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create escrow", "details": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendEscrowWebhook("escrow_created", escrow)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Funds held in escrow for " + escrow.SellerUsername,
+		"escrow":  escrow,
+	})
+}
+
+// GetEscrowsHandler handles GET /api/escrows; optional ?role=buyer|seller and ?status
+func (h *EscrowHandler) GetEscrowsHandler(c *gin.Context) {
+	escrows, err := h.escrowService.GetUserEscrows(c.GetInt("userID"), c.Query("role"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"escrows": escrows,
+	})
+}
+
+// GetEscrowHandler handles GET /api/escrows/:id
+func (h *EscrowHandler) GetEscrowHandler(c *gin.Context) {
+	escrowID, ok := parseEscrowID(c)
+	if !ok {
+		return
+	}
+
+	escrow, err := h.escrowService.GetEscrow(escrowID, c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Escrow not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"escrow":  escrow,
+	})
+}
+
+// ReleaseEscrowHandler handles POST /api/escrows/:id/release
+func (h *EscrowHandler) ReleaseEscrowHandler(c *gin.Context) {
+	escrowID, ok := parseEscrowID(c)
+	if !ok {
+		return
+	}
+
+	user := c.MustGet("user").(*User)
+	escrow, err := h.escrowService.ReleaseEscrow(escrowID, user.ID, "user:"+user.Username)
+	if err != nil {
+		respondEscrowError(c, "Failed to release escrow", err)
+		return
+	}
+
+	h.settled(c, escrow)
+}
+
+// RefundEscrowHandler handles POST /api/escrows/:id/refund
+func (h *EscrowHandler) RefundEscrowHandler(c *gin.Context) {
+	escrowID, ok := parseEscrowID(c)
+	if !ok {
+		return
+	}
+
+	user := c.MustGet("user").(*User)
+	escrow, err := h.escrowService.RefundEscrow(escrowID, user.ID, "user:"+user.Username)
+	if err != nil {
+		respondEscrowError(c, "Failed to refund escrow", err)
+		return
+	}
+
+	h.settled(c, escrow)
+}
+
+// DisputeEscrowHandler handles POST /api/escrows/:id/dispute
+func (h *EscrowHandler) DisputeEscrowHandler(c *gin.Context) {
+	escrowID, ok := parseEscrowID(c)
+	if !ok {
+		return
+	}
+
+	var req DisputeEscrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	escrow, err := h.escrowService.DisputeEscrow(escrowID, c.GetInt("userID"), req.Reason)
+	if err != nil {
+		respondEscrowError(c, "Failed to dispute escrow", err)
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendEscrowWebhook("escrow_disputed", escrow)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Escrow disputed; an admin will resolve it",
+		"escrow":  escrow,
+	})
+}
+
+// AdminGetEscrowsHandler handles GET /api/admin/escrows; optional ?status, e.g. ?status=disputed
+func (h *EscrowHandler) AdminGetEscrowsHandler(c *gin.Context) {
+	escrows, err := h.escrowService.GetEscrows(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get escrows", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"escrows": escrows,
+	})
+}
+
+// AdminGetEscrowHandler handles GET /api/admin/escrows/:id
+func (h *EscrowHandler) AdminGetEscrowHandler(c *gin.Context) {
+	escrowID, ok := parseEscrowID(c)
+	if !ok {
+		return
+	}
+
+	escrow, err := h.escrowService.GetEscrowByID(escrowID)
+	if err != nil {
+		respondEscrowError(c, "Failed to get escrow", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"escrow":  escrow,
+	})
+}
+
+// ResolveEscrowHandler handles POST /api/admin/escrows/:id/resolve
+func (h *EscrowHandler) ResolveEscrowHandler(c *gin.Context) {
+	escrowID, ok := parseEscrowID(c)
+	if !ok {
+		return
+	}
+
+	var req ResolveEscrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	escrow, err := h.escrowService.ResolveEscrow(escrowID, req.Outcome, req.Note, c.GetString("adminActor"))
+	if err != nil {
+		respondEscrowError(c, "Failed to resolve escrow", err)
+		return
+	}
+
+	h.settled(c, escrow)
+}
+
+// settled sends the webhook for a released or refunded escrow and responds with it
+func (h *EscrowHandler) settled(c *gin.Context, escrow *Escrow) {
+	// Send webhook notification
+	go h.webhookService.SendEscrowWebhook("escrow_"+escrow.Status, escrow)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Escrow " + escrow.Status,
+		"escrow":  escrow,
+	})
+}
+
+// parseEscrowID reads the :id parameter
+func parseEscrowID(c *gin.Context) (int, bool) {
+	escrowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid escrow ID"})
+		return 0, false
+	}
+	return escrowID, true
+}
+
+// respondEscrowError responds 404 for escrows the user can't see, otherwise 400
+func respondEscrowError(c *gin.Context, message string, err error) {
+	if err == errEscrowNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Escrow not found"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Escrow statuses
+const (
+	EscrowHeld     = "held"     // The buyer's funds are held, waiting to be released or refunded
+	EscrowDisputed = "disputed" // Buyer or seller raised a dispute; only an admin can settle it
+	EscrowReleased = "released" // Paid to the seller
+	EscrowRefunded = "refunded" // Returned to the buyer
+)
+
+// Escrow outcomes, taken by a party, an admin or the timeout
+const (
+	EscrowRelease = "release"
+	EscrowRefund  = "refund"
+)
+
+// maxEscrowTimeoutHours limits how long funds can be held before the timeout settles them
+const maxEscrowTimeoutHours = 24 * 90
+
+// errEscrowNotFound is returned when an escrow doesn't exist or the user isn't a party to it
+var errEscrowNotFound = fmt.Errorf("escrow not found")
+
+// EscrowService handles escrow transfers
+type EscrowService struct {
+	db      *sql.DB
+	banking *BankingService
+
+	defaultTimeout time.Duration // How long funds are held when the buyer doesn't choose
+}
+
+// NewEscrowService creates a new EscrowService
+func NewEscrowService(db *sql.DB, banking *BankingService) *EscrowService {
+	timeoutHours, err := strconv.Atoi(getEnv("ESCROW_TIMEOUT_HOURS", "72"))
+	if err != nil || timeoutHours <= 0 || timeoutHours > maxEscrowTimeoutHours {
+		timeoutHours = 72
+	}
+
+	return &EscrowService{
+		db:             db,
+		banking:        banking,
+		defaultTimeout: time.Duration(timeoutHours) * time.Hour,
+	}
+}
+
+// escrowSelect selects escrows with both parties' usernames
+const escrowSelect = `
+	SELECT e.id, e.buyer_user_id, e.seller_user_id, e.amount, e.description, e.status, e.timeout_action,
+	       e.expires_at, e.hold_transaction_id, e.settlement_transaction_id, e.settled_by, e.settled_at,
+	       e.disputed_by, e.dispute_reason, e.disputed_at, e.resolution_note, e.created_at,
+	       bu.username, su.username
+	FROM escrows e
+	JOIN users bu ON e.buyer_user_id = bu.id
+	JOIN users su ON e.seller_user_id = su.id
+`
+
+// CreateEscrow moves a buyer's funds into escrow for a seller. The funds leave the buyer's account at once and
+// are held by PokéBank until the buyer releases them to the seller, either party refunds them, or timeoutHours
+// (0 for the default) pass and timeoutAction is taken.
+func (s *EscrowService) CreateEscrow(buyerUserID, sellerUserID int, amount float64, description, timeoutAction string, timeoutHours int) (*Escrow, error) {
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be at least 0.01")
+	}
+	if buyerUserID == sellerUserID {
+		return nil, fmt.Errorf("cannot open an escrow with yourself")
+	}
+	if timeoutAction != EscrowRelease && timeoutAction != EscrowRefund {
+		return nil, fmt.Errorf("timeout action must be %s or %s", EscrowRelease, EscrowRefund)
+	}
+
+	timeout := s.defaultTimeout
+	if timeoutHours != 0 {
+		if timeoutHours < 1 || timeoutHours > maxEscrowTimeoutHours {
+			return nil, fmt.Errorf("timeout must be between 1 and %d hours", maxEscrowTimeoutHours)
+		}
+		timeout = time.Duration(timeoutHours) * time.Hour
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkAccountCanSend(tx, buyerUserID); err != nil {
+		return nil, err
+	}
+	if err = checkAccountCanReceive(tx, sellerUserID); err != nil {
+		return nil, err
+	}
+
+	// Check buyer has sufficient balance, excluding held funds
+	balance, err := availableBalance(tx, buyerUserID)
+	if err != nil {
+		return nil, err
+	}
+	if balance < amount {
+		return nil, fmt.Errorf("insufficient balance")
+	}
+
+	var pokeBankID int
+	err = tx.QueryRow(`SELECT id FROM users WHERE username = 'PokéBank'`).Scan(&pokeBankID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var escrowID int
+	err = tx.QueryRow(`
+		INSERT INTO escrows (buyer_user_id, seller_user_id, amount, description, status, timeout_action, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, buyerUserID, sellerUserID, amount, description, EscrowHeld, timeoutAction, now.Add(timeout), now).Scan(&escrowID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Move the funds out of the buyer's account into PokéBank's keeping
+	_, err = tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, buyerUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var holdID int
+	err = tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, escrow_id, created_at)
+		VALUES (?, ?, ?, 'escrow_hold', ?, 'completed', ?, ?)
+		RETURNING id
+	`, buyerUserID, pokeBankID, amount, fmt.Sprintf("Escrow #%d: %s", escrowID, description), escrowID, now).Scan(&holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE escrows SET hold_transaction_id = ? WHERE id = ?`, holdID, escrowID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reset PokéBank balance since it's involved in the transaction
+	if err = s.banking.resetPokeBankBalanceInTx(tx, buyerUserID, pokeBankID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetEscrowByID(escrowID)
+}
+
+// ReleaseEscrow pays a held escrow to the seller; only the buyer can release it
+func (s *EscrowService) ReleaseEscrow(escrowID, userID int, actor string) (*Escrow, error) {
+	escrow, err := s.GetEscrow(escrowID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if escrow.BuyerUserID != userID {
+		return nil, fmt.Errorf("only the buyer can release an escrow")
+	}
+
+	return s.settleEscrow(escrowID, EscrowRelease, actor, "", EscrowHeld)
+}
+
+// RefundEscrow returns a held escrow to the buyer; either party can refund it
+func (s *EscrowService) RefundEscrow(escrowID, userID int, actor string) (*Escrow, error) {
+	if _, err := s.GetEscrow(escrowID, userID); err != nil {
+		return nil, err
+	}
+
+	return s.settleEscrow(escrowID, EscrowRefund, actor, "", EscrowHeld)
+}
+
+// DisputeEscrow puts a held escrow into dispute. Disputed escrows don't time out and can only be settled by an admin.
+func (s *EscrowService) DisputeEscrow(escrowID, userID int, reason string) (*Escrow, error) {
+	if _, err := s.GetEscrow(escrowID, userID); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE escrows SET status = ?, disputed_by = ?, dispute_reason = ?, disputed_at = ?
+		WHERE id = ? AND status = ?
+	`, EscrowDisputed, userID, reason, time.Now().UTC(), escrowID, EscrowHeld)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("only held escrows can be disputed")
+	}
+
+	return s.GetEscrowByID(escrowID)
+}
+
+// ResolveEscrow settles a held or disputed escrow as an admin arbiter, releasing it to the seller or refunding
+// the buyer
+func (s *EscrowService) ResolveEscrow(escrowID int, outcome, note, actor string) (*Escrow, error) {
+	if outcome != EscrowRelease && outcome != EscrowRefund {
+		return nil, fmt.Errorf("outcome must be %s or %s", EscrowRelease, EscrowRefund)
+	}
+
+	return s.settleEscrow(escrowID, outcome, actor, note, EscrowHeld, EscrowDisputed)
+}
+
+// ProcessEscrowTimeouts takes the timeout action on held escrows that have timed out, returning them
+func (s *EscrowService) ProcessEscrowTimeouts() ([]Escrow, error) {
+	escrows, err := s.queryEscrows(`WHERE e.status = ? AND e.expires_at <= ?`, EscrowHeld, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	var settled []Escrow
+	for _, escrow := range escrows {
+		result, err := s.settleEscrow(escrow.ID, escrow.TimeoutAction, "system:timeout", "", EscrowHeld)
+		if err != nil {
+			// Released, refunded or disputed since it was listed, or the payee can't receive; leave it for
+			// the next run or an admin
+			log.Printf("Error settling timed out escrow %d: %v", escrow.ID, err)
+			continue
+		}
+		settled = append(settled, *result)
+	}
+
+	return settled, nil
+}
+
+// GetEscrow retrieves an escrow the user is the buyer or seller of, with its transactions
+func (s *EscrowService) GetEscrow(escrowID, userID int) (*Escrow, error) {
+	escrow, err := s.GetEscrowByID(escrowID)
+	if err != nil {
+		return nil, err
+	}
+	if escrow.BuyerUserID != userID && escrow.SellerUserID != userID {
+		return nil, errEscrowNotFound
+	}
+	return escrow, nil
+}
+
+// GetEscrowByID retrieves an escrow with its transactions
+func (s *EscrowService) GetEscrowByID(escrowID int) (*Escrow, error) {
+	escrows, err := s.queryEscrows(`WHERE e.id = ?`, escrowID)
+	if err != nil {
+		return nil, err
+	}
+	if len(escrows) == 0 {
+		return nil, errEscrowNotFound
+	}
+	escrow := &escrows[0]
+
+	escrow.Transactions, err = s.getEscrowTransactions(escrowID)
+	if err != nil {
+		return nil, err
+	}
+
+	return escrow, nil
+}
+
+// GetUserEscrows lists a user's escrows, newest first: role "buyer" or "seller" narrows them to one side, and
+// status to one status
+func (s *EscrowService) GetUserEscrows(userID int, role, status string) ([]Escrow, error) {
+	var where string
+	var args []interface{}
+	switch role {
+	case "":
+		where, args = `WHERE (e.buyer_user_id = ? OR e.seller_user_id = ?)`, []interface{}{userID, userID}
+	case "buyer":
+		where, args = `WHERE e.buyer_user_id = ?`, []interface{}{userID}
+	case "seller":
+		where, args = `WHERE e.seller_user_id = ?`, []interface{}{userID}
+	default:
+		return nil, fmt.Errorf("role must be buyer or seller")
+	}
+
+	if status != "" {
+		where += ` AND e.status = ?`
+		args = append(args, status)
+	}
+
+	return s.queryEscrows(where+` ORDER BY e.created_at DESC, e.id DESC`, args...)
+}
+
+// GetEscrows lists every escrow, optionally with one status, oldest first so disputes are worked in order
+func (s *EscrowService) GetEscrows(status string) ([]Escrow, error) {
+	if status != "" {
+		return s.queryEscrows(`WHERE e.status = ? ORDER BY e.created_at, e.id`, status)
+	}
+	return s.queryEscrows(`ORDER BY e.created_at, e.id`)
+}
+
+// settleEscrow releases or refunds an escrow in one of the given statuses, paying it out of PokéBank's keeping
+// in a transaction linked to the hold
+func (s *EscrowService) settleEscrow(escrowID int, outcome, actor, note string, fromStatuses ...string) (*Escrow, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var escrow Escrow
+	var currentStatus string
+	var holdID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT id, buyer_user_id, seller_user_id, amount, description, status, hold_transaction_id
+		FROM escrows WHERE id = ?
+	`, escrowID).Scan(&escrow.ID, &escrow.BuyerUserID, &escrow.SellerUserID, &escrow.Amount, &escrow.Description,
+		&currentStatus, &holdID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errEscrowNotFound
+		}
+		return nil, err
+	}
+
+	allowed := false
+	for _, status := range fromStatuses {
+		if currentStatus == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("escrow is %s", currentStatus)
+	}
+
+	newStatus, payeeID, transactionType := EscrowReleased, escrow.SellerUserID, "escrow_release"
+	if outcome == EscrowRefund {
+		newStatus, payeeID, transactionType = EscrowRefunded, escrow.BuyerUserID, "escrow_refund"
+	}
+
+	if err = checkAccountCanReceive(tx, payeeID); err != nil {
+		return nil, err
+	}
+
+	var pokeBankID int
+	err = tx.QueryRow(`SELECT id FROM users WHERE username = 'PokéBank'`).Scan(&pokeBankID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, escrow.Amount, payeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var settlementID int
+	err = tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status,
+		                          original_transaction_id, escrow_id, created_at)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?, ?, ?)
+		RETURNING id
+	`, pokeBankID, payeeID, escrow.Amount, transactionType, fmt.Sprintf("Escrow #%d %s: %s", escrowID, newStatus, escrow.Description),
+		holdID, escrowID, now).Scan(&settlementID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the status again as part of the update, so a settlement racing this one can't pay out twice
+	args := []interface{}{newStatus, settlementID, actor, now, note, escrowID}
+	for _, status := range fromStatuses {
+		args = append(args, status)
+	}
+	result, err := tx.Exec(`
+		UPDATE escrows SET status = ?, settlement_transaction_id = ?, settled_by = ?, settled_at = ?, resolution_note = ?
+		WHERE id = ? AND status IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(fromStatuses)), ", ")+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("escrow has already been settled")
+	}
+
+	// Reset PokéBank balance since it's involved in the transaction
+	if err = s.banking.resetPokeBankBalanceInTx(tx, pokeBankID, payeeID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetEscrowByID(escrowID)
+}
+
+// queryEscrows selects the escrows matching the WHERE clause
+func (s *EscrowService) queryEscrows(where string, args ...interface{}) ([]Escrow, error) {
+	rows, err := s.db.Query(escrowSelect+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	escrows := []Escrow{}
+	for rows.Next() {
+		escrow, err := scanEscrow(rows)
+		if err != nil {
+			return nil, err
+		}
+		escrows = append(escrows, *escrow)
+	}
+
+	return escrows, rows.Err()
+}
+
+// getEscrowTransactions retrieves the hold and settlement transactions of an escrow, oldest first
+func (s *EscrowService) getEscrowTransactions(escrowID int) ([]Transaction, error) {
+	query := transactionSelect + `
+		WHERE t.escrow_id = ?
+		ORDER BY t.created_at, t.id
+	`
+
+	rows, err := s.db.Query(query, escrowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTransactions(rows)
+}
+
+// scanEscrow scans one escrow selected with escrowSelect
+func scanEscrow(row rowScanner) (*Escrow, error) {
+	e := &Escrow{}
+	var holdID, settlementID, disputedBy sql.NullInt64
+	var settledBy, disputeReason, resolutionNote sql.NullString
+	var settledAt, disputedAt sql.NullTime
+	err := row.Scan(
+		&e.ID, &e.BuyerUserID, &e.SellerUserID, &e.Amount, &e.Description, &e.Status, &e.TimeoutAction,
+		&e.ExpiresAt, &holdID, &settlementID, &settledBy, &settledAt,
+		&disputedBy, &disputeReason, &disputedAt, &resolutionNote, &e.CreatedAt,
+		&e.BuyerUsername, &e.SellerUsername,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if holdID.Valid {
+		id := int(holdID.Int64)
+		e.HoldTransactionID = &id
+	}
+	if settlementID.Valid {
+		id := int(settlementID.Int64)
+		e.SettlementTransactionID = &id
+	}
+	if settledAt.Valid {
+		e.SettledAt = &settledAt.Time
+	}
+	if disputedBy.Valid {
+		id := int(disputedBy.Int64)
+		e.DisputedBy = &id
+	}
+	if disputedAt.Valid {
+		e.DisputedAt = &disputedAt.Time
+	}
+	e.SettledBy = settledBy.String
+	e.DisputeReason = disputeReason.String
+	e.ResolutionNote = resolutionNote.String
+
+	return e, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvoiceHandler handles invoices
+type InvoiceHandler struct {
+	invoiceService *InvoiceService
+	userService    *UserService
+	webhookService *WebhookService
+	mailer         Mailer
+}
+
+// NewInvoiceHandler creates a new InvoiceHandler
+func NewInvoiceHandler(invoiceService *InvoiceService, userService *UserService, webhookService *WebhookService, mailer Mailer) *InvoiceHandler {
+	return &InvoiceHandler{
+		invoiceService: invoiceService,
+		userService:    userService,
+		webhookService: webhookService,
+		mailer:         mailer,
+	}
+}
+
+// InvoiceRequest represents the contents of an invoice to create or change
+type InvoiceRequest struct {
+	Recipient string             `json:"recipient" binding:"required"` // Username or account number
+	DueDate   string             `json:"due_date" binding:"required"`  // YYYY-MM-DD
+	Notes     string             `json:"notes"`
+	LineItems []InvoiceItemInput `json:"line_items" binding:"required,min=1,dive"`
+	TaxLines  []InvoiceTaxInput  `json:"tax_lines" binding:"dive"`
+	Send      bool               `json:"send"` // Send the invoice straight away rather than keeping it as a draft
+}
+
+// PayInvoiceRequest represents a payment towards an invoice
+type PayInvoiceRequest struct {
+	Amount float64 `json:"amount" binding:"gte=0"` // Omit or 0 to pay everything still due
+}
+
+// CreateInvoiceHandler handles POST /api/invoices
+func (h *InvoiceHandler) CreateInvoiceHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	input, send, ok := h.bindInvoiceRequest(c)
+	if !ok {
+		return
+	}
+
+	invoice, err := h.invoiceService.CreateInvoice(userID, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create invoice", "details": err.Error()})
+		return
+	}
+
+	if send {
+		h.sendInvoice(c, invoice.ID, http.StatusCreated)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Draft invoice created",
+		"invoice": invoice,
+	})
+}
+
+// GetInvoicesHandler handles GET /api/invoices; ?role=issued|received (default received), optional ?status
+func (h *InvoiceHandler) GetInvoicesHandler(c *gin.Context) {
+	invoices, err := h.invoiceService.GetUserInvoices(c.GetInt("userID"), c.DefaultQuery("role", "received"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"invoices": invoices,
+	})
+}
+
+// GetInvoiceHandler handles GET /api/invoices/:id
+func (h *InvoiceHandler) GetInvoiceHandler(c *gin.Context) {
+	invoiceID, ok := parseInvoiceID(c)
+	if !ok {
+		return
+	}
+
+	invoice, err := h.invoiceService.GetInvoice(invoiceID, c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"invoice": invoice,
+	})
+}
+
+// UpdateInvoiceHandler handles PUT /api/invoices/:id, replacing a draft invoice's contents
+func (h *InvoiceHandler) UpdateInvoiceHandler(c *gin.Context) {
+	invoiceID, ok := parseInvoiceID(c)
+	if !ok {
+		return
+	}
+
+	input, send, ok := h.bindInvoiceRequest(c)
+	if !ok {
+		return
+	}
+
+	invoice, err := h.invoiceService.UpdateInvoice(invoiceID, c.GetInt("userID"), input)
+	if err != nil {
+		respondInvoiceError(c, "Failed to update invoice", err)
+		return
+	}
+
+	if send {
+		h.sendInvoice(c, invoice.ID, http.StatusOK)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invoice updated successfully",
+		"invoice": invoice,
+	})
+}
+
+// SendInvoiceHandler handles POST /api/invoices/:id/send
+func (h *InvoiceHandler) SendInvoiceHandler(c *gin.Context) {
+	invoiceID, ok := parseInvoiceID(c)
+	if !ok {
+		return
+	}
+
+	h.sendInvoice(c, invoiceID, http.StatusOK)
+}
+
+// VoidInvoiceHandler handles POST /api/invoices/:id/void
+func (h *InvoiceHandler) VoidInvoiceHandler(c *gin.Context) {
+	invoiceID, ok := parseInvoiceID(c)
+	if !ok {
+		return
+	}
+
+	invoice, err := h.invoiceService.VoidInvoice(invoiceID, c.GetInt("userID"))
+	if err != nil {
+		respondInvoiceError(c, "Failed to void invoice", err)
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendInvoiceWebhook("invoice_void", invoice, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invoice voided",
+		"invoice": invoice,
+	})
+}
+
+// RemindInvoiceHandler handles POST /api/invoices/:id/remind, reminding the recipient about an unpaid invoice
+func (h *InvoiceHandler) RemindInvoiceHandler(c *gin.Context) {
+	invoiceID, ok := parseInvoiceID(c)
+	if !ok {
+		return
+	}
+
+	invoice, err := h.invoiceService.RecordReminder(invoiceID, c.GetInt("userID"))
+	if err != nil {
+		respondInvoiceError(c, "Failed to send reminder", err)
+		return
+	}
+
+	h.NotifyInvoice("invoice_reminder", invoice)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Reminder sent",
+		"invoice": invoice,
+	})
+}
+
+// PayInvoiceHandler handles POST /api/invoices/:id/pay
+func (h *InvoiceHandler) PayInvoiceHandler(c *gin.Context) {
+	invoiceID, ok := parseInvoiceID(c)
+	if !ok {
+		return
+	}
+
+	var req PayInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	invoice, transaction, err := h.invoiceService.PayInvoice(invoiceID, c.GetInt("userID"), req.Amount)
+	if err != nil {
+		respondInvoiceError(c, "Payment failed", err)
+		return
+	}
+
+	// Send webhook notifications
+	go h.webhookService.SendTransferWebhook(transaction)
+	go h.webhookService.SendInvoiceWebhook("invoice_payment", invoice, transaction)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Invoice payment completed successfully",
+		"transaction": transaction,
+		"invoice":     invoice,
+	})
+}
+
+// NotifyInvoice tells an invoice's recipient about it by email and sends the matching webhook
+func (h *InvoiceHandler) NotifyInvoice(event string, invoice *Invoice) {
+	go h.webhookService.SendInvoiceWebhook(event, invoice, nil)
+
+	if invoice.RecipientEmail == "" {
+		return
+	}
+	subject, body := invoiceEmail(event, invoice)
+	go func() {
+		if err := h.mailer.SendMail(invoice.RecipientEmail, subject, body); err != nil {
+			fmt.Printf("Error sending invoice email: %v\n", err)
+		}
+	}()
+}
+
+// sendInvoice sends a draft invoice and responds with it
+func (h *InvoiceHandler) sendInvoice(c *gin.Context, invoiceID, status int) {
+	invoice, err := h.invoiceService.SendInvoice(invoiceID, c.GetInt("userID"))
+	if err != nil {
+		respondInvoiceError(c, "Failed to send invoice", err)
+		return
+	}
+
+	h.NotifyInvoice("invoice_sent", invoice)
+
+	c.JSON(status, gin.H{
+		"success": true,
+		"message": "Invoice sent to " + invoice.RecipientUsername,
+		"invoice": invoice,
+	})
+}
+
+// bindInvoiceRequest reads an invoice request, resolving its recipient
+func (h *InvoiceHandler) bindInvoiceRequest(c *gin.Context) (InvoiceInput, bool, bool) {
+	var req InvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return InvoiceInput{}, false, false
+	}
+
+	recipient, err := h.userService.GetUserByUsernameOrAccountNumber(req.Recipient)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+		return InvoiceInput{}, false, false
+	}
+
+	return InvoiceInput{
+		RecipientUserID: recipient.ID,
+		DueDate:         req.DueDate,
+		Notes:           req.Notes,
+		Items:           req.LineItems,
+		Taxes:           req.TaxLines,
+	}, req.Send, true
+}
+
+// parseInvoiceID reads the :id parameter
+func parseInvoiceID(c *gin.Context) (int, bool) {
+	invoiceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return 0, false
+	}
+	return invoiceID, true
+}
+
+// respondInvoiceError responds 404 for invoices the user can't see, otherwise 400
+func respondInvoiceError(c *gin.Context, message string, err error) {
+	if err == errInvoiceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// InvoiceEvent describes something the invoice reminder job did to an invoice
+type InvoiceEvent struct {
+	Event   string // "invoice_due_soon", "invoice_overdue" or "invoice_reminder"
+	Invoice Invoice
+}
+
+// ProcessInvoiceReminders runs one pass of the invoice reminder job: open invoices past their due date are
+// marked overdue, recipients are reminded once when an invoice is about to fall due, and reminded again
+// every so often while it stays overdue.
+func (s *InvoiceService) ProcessInvoiceReminders() ([]InvoiceEvent, error) {
+	now := time.Now().UTC()
+	var events []InvoiceEvent
+
+	overdue, err := s.markOverdueInvoices(now)
+	events = append(events, overdue...)
+	if err != nil {
+		return events, err
+	}
+
+	if s.reminderLeadTime > 0 {
+		dueSoon, err := s.remindInvoices("invoice_due_soon", `
+			WHERE i.status IN (?, ?) AND i.last_reminder_at IS NULL AND i.overdue_at <= ?
+		`, InvoiceSent, InvoicePartiallyPaid, now.Add(s.reminderLeadTime))
+		events = append(events, dueSoon...)
+		if err != nil {
+			return events, err
+		}
+	}
+
+	if s.overdueReminderEvery > 0 {
+		reminders, err := s.remindInvoices("invoice_reminder", `
+			WHERE i.status = ? AND i.last_reminder_at <= ?
+		`, InvoiceOverdue, now.Add(-s.overdueReminderEvery))
+		events = append(events, reminders...)
+		if err != nil {
+			return events, err
+		}
+	}
+
+	return events, nil
+}
+
+// markOverdueInvoices marks open invoices past their due date as overdue, reminding their recipients
+func (s *InvoiceService) markOverdueInvoices(now time.Time) ([]InvoiceEvent, error) {
+	invoices, err := s.queryInvoices(`WHERE i.status IN (?, ?) AND i.overdue_at <= ?`, InvoiceSent, InvoicePartiallyPaid, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []InvoiceEvent
+	for _, invoice := range invoices {
+		result, err := s.db.Exec(`
+			UPDATE invoices SET status = ?, last_reminder_at = ?, reminder_count = reminder_count + 1, updated_at = ?
+			WHERE id = ? AND status IN (?, ?)
+		`, InvoiceOverdue, now, now, invoice.ID, InvoiceSent, InvoicePartiallyPaid)
+		if err != nil {
+			return events, err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			continue // Paid or voided since it was listed
+		}
+
+		invoice.Status = InvoiceOverdue
+		invoice.LastReminderAt = &now
+		invoice.ReminderCount++
+		events = append(events, InvoiceEvent{Event: "invoice_overdue", Invoice: invoice})
+	}
+
+	return events, nil
+}
+
+// remindInvoices records a reminder for each invoice matching the WHERE clause
+func (s *InvoiceService) remindInvoices(event, where string, args ...interface{}) ([]InvoiceEvent, error) {
+	invoices, err := s.queryInvoices(where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []InvoiceEvent
+	for _, invoice := range invoices {
+		if err := s.recordReminder(invoice.ID); err != nil {
+			return events, err
+		}
+		invoice.ReminderCount++
+		events = append(events, InvoiceEvent{Event: event, Invoice: invoice})
+	}
+
+	return events, nil
+}
+
+// invoiceEmail builds the email telling an invoice's recipient about it
+func invoiceEmail(event string, invoice *Invoice) (string, string) {
+	var subject, intro string
+	switch {
+	case event == "invoice_sent":
+		subject = fmt.Sprintf("Invoice %s from %s", invoice.Number, invoice.IssuerUsername)
+		intro = fmt.Sprintf("%s has sent you invoice %s, due on %s.", invoice.IssuerUsername, invoice.Number, invoice.DueDate)
+	case invoice.Status == InvoiceOverdue:
+		subject = fmt.Sprintf("Invoice %s is overdue", invoice.Number)
+		intro = fmt.Sprintf("Invoice %s from %s was due on %s and hasn't been paid in full.", invoice.Number, invoice.IssuerUsername, invoice.DueDate)
+	default:
+		subject = fmt.Sprintf("Reminder: invoice %s is due on %s", invoice.Number, invoice.DueDate)
+		intro = fmt.Sprintf("This is a reminder that invoice %s from %s is due on %s.", invoice.Number, invoice.IssuerUsername, invoice.DueDate)
+	}
+
+	body := fmt.Sprintf(`Hi %s,
+
+%s
+
+Total: %.2f %s
+Paid so far: %.2f %s
+Amount due: %.2f %s
+
+Sign in to Viridian City Bank to view and pay it.
+`, invoice.RecipientUsername, intro, invoice.Total, invoice.Currency, invoice.AmountPaid, invoice.Currency,
+		invoice.AmountDue, invoice.Currency)
+
+	return subject, body
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Invoice statuses
+const (
+	InvoiceDraft         = "draft"          // Being prepared; only the issuer can see it
+	InvoiceSent          = "sent"           // Waiting for payment
+	InvoicePartiallyPaid = "partially_paid" // Some, but not all, of the total has been paid
+	InvoicePaid          = "paid"           // Paid in full
+	InvoiceOverdue       = "overdue"        // Past its due date and not paid in full
+	InvoiceVoid          = "void"           // Cancelled by the issuer
+)
+
+// errInvoiceNotFound is returned when an invoice doesn't exist or isn't visible to the user
+var errInvoiceNotFound = fmt.Errorf("invoice not found")
+
+// InvoiceService handles invoices
+type InvoiceService struct {
+	db      *sql.DB
+	banking *BankingService
+
+	reminderLeadTime     time.Duration // Remind recipients this long before the due date; 0 disables it
+	overdueReminderEvery time.Duration // Repeat reminders for overdue invoices this often; 0 disables it
+}
+
+// NewInvoiceService creates a new InvoiceService
+func NewInvoiceService(db *sql.DB, banking *BankingService) *InvoiceService {
+	reminderDays, err := strconv.Atoi(getEnv("INVOICE_REMINDER_DAYS_BEFORE_DUE", "3"))
+	if err != nil || reminderDays < 0 {
+		reminderDays = 3
+	}
+
+	overdueDays, err := strconv.Atoi(getEnv("INVOICE_OVERDUE_REMINDER_DAYS", "7"))
+	if err != nil || overdueDays < 0 {
+		overdueDays = 7
+	}
+
+	return &InvoiceService{
+		db:                   db,
+		banking:              banking,
+		reminderLeadTime:     time.Duration(reminderDays) * 24 * time.Hour,
+		overdueReminderEvery: time.Duration(overdueDays) * 24 * time.Hour,
+	}
+}
+
+// InvoiceInput describes the contents of an invoice
+type InvoiceInput struct {
+	RecipientUserID int
+	DueDate         string // YYYY-MM-DD
+	Notes           string
+	Items           []InvoiceItemInput
+	Taxes           []InvoiceTaxInput
+}
+
+// InvoiceItemInput describes an invoice line item
+type InvoiceItemInput struct {
+	Description string  `json:"description" binding:"required"`
+	Quantity    float64 `json:"quantity" binding:"required,gt=0"`
+	UnitPrice   float64 `json:"unit_price" binding:"gte=0"`
+}
+
+// InvoiceTaxInput describes a tax line: a percentage of the items' subtotal, or a fixed amount
+type InvoiceTaxInput struct {
+	Description string   `json:"description" binding:"required"`
+	Rate        *float64 `json:"rate" binding:"omitempty,gte=0,lte=100"`
+	Amount      *float64 `json:"amount" binding:"omitempty,gte=0"`
+}
+
+// invoiceSelect selects invoices with their issuer and recipient for display
+const invoiceSelect = `
+	SELECT i.id, i.number, i.issuer_user_id, i.recipient_user_id, i.status, i.currency, i.subtotal, i.tax_total,
+	       i.total, i.amount_paid, i.notes, i.due_date, i.overdue_at, i.sent_at, i.paid_at, i.voided_at,
+	       i.last_reminder_at, i.reminder_count, i.created_at, i.updated_at,
+	       iu.username, iu.account_number, ru.username, ru.email
+	FROM invoices i
+	JOIN users iu ON i.issuer_user_id = iu.id
+	JOIN users ru ON i.recipient_user_id = ru.id
+`
+
+// CreateInvoice creates a draft invoice
+func (s *InvoiceService) CreateInvoice(issuerUserID int, input InvoiceInput) (*Invoice, error) {
+	lines, subtotal, taxTotal, err := buildInvoiceLines(input)
+	if err != nil {
+		return nil, err
+	}
+	dueDate, overdueAt, err := parseInvoiceDueDate(input.DueDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkInvoiceRecipientInTx(tx, issuerUserID, input.RecipientUserID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var invoiceID int
+	err = tx.QueryRow(`
+		INSERT INTO invoices (issuer_user_id, recipient_user_id, status, currency, subtotal, tax_total, total,
+		                      notes, due_date, overdue_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, issuerUserID, input.RecipientUserID, InvoiceDraft, paymentLinkCurrency, subtotal, taxTotal,
+		roundCents(subtotal+taxTotal), strings.TrimSpace(input.Notes), dueDate, overdueAt, now, now).Scan(&invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invoice numbers follow the invoice ID, so they're unique and never reused
+	if _, err = tx.Exec(`UPDATE invoices SET number = ? WHERE id = ?`, fmt.Sprintf("INV-%06d", invoiceID), invoiceID); err != nil {
+		return nil, err
+	}
+	if err = insertInvoiceLinesInTx(tx, invoiceID, lines); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetInvoice(invoiceID, issuerUserID)
+}
+
+// UpdateInvoice replaces the contents of a draft invoice
+func (s *InvoiceService) UpdateInvoice(invoiceID, issuerUserID int, input InvoiceInput) (*Invoice, error) {
+	lines, subtotal, taxTotal, err := buildInvoiceLines(input)
+	if err != nil {
+		return nil, err
+	}
+	dueDate, overdueAt, err := parseInvoiceDueDate(input.DueDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM invoices WHERE id = ? AND issuer_user_id = ?`, invoiceID, issuerUserID).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvoiceNotFound
+		}
+		return nil, err
+	}
+	if status != InvoiceDraft {
+		return nil, fmt.Errorf("only draft invoices can be changed")
+	}
+
+	if err = checkInvoiceRecipientInTx(tx, issuerUserID, input.RecipientUserID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE invoices
+		SET recipient_user_id = ?, subtotal = ?, tax_total = ?, total = ?, notes = ?, due_date = ?, overdue_at = ?, updated_at = ?
+		WHERE id = ?
+	`, input.RecipientUserID, subtotal, taxTotal, roundCents(subtotal+taxTotal), strings.TrimSpace(input.Notes),
+		dueDate, overdueAt, time.Now().UTC(), invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM invoice_lines WHERE invoice_id = ?`, invoiceID); err != nil {
+		return nil, err
+	}
+	if err = insertInvoiceLinesInTx(tx, invoiceID, lines); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetInvoice(invoiceID, issuerUserID)
+}
+
+// SendInvoice issues a draft invoice to its recipient
+func (s *InvoiceService) SendInvoice(invoiceID, issuerUserID int) (*Invoice, error) {
+	invoice, err := s.getIssuedInvoice(invoiceID, issuerUserID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status != InvoiceDraft {
+		return nil, fmt.Errorf("invoice has already been sent")
+	}
+
+	now := time.Now().UTC()
+	if !invoice.OverdueAt.After(now) {
+		return nil, fmt.Errorf("due date has passed; change it before sending the invoice")
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE invoices SET status = ?, sent_at = ?, updated_at = ? WHERE id = ? AND status = ?
+	`, InvoiceSent, now, now, invoiceID, InvoiceDraft)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetInvoice(invoiceID, issuerUserID)
+}
+
+// VoidInvoice cancels an invoice that nothing has been paid towards
+func (s *InvoiceService) VoidInvoice(invoiceID, issuerUserID int) (*Invoice, error) {
+	invoice, err := s.getIssuedInvoice(invoiceID, issuerUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case invoice.Status == InvoiceVoid:
+		return nil, fmt.Errorf("invoice is already void")
+	case invoice.Status == InvoicePaid || invoice.AmountPaid > 0:
+		return nil, fmt.Errorf("invoices with payments can't be voided")
+	}
+
+	now := time.Now().UTC()
+	result, err := s.db.Exec(`
+		UPDATE invoices SET status = ?, voided_at = ?, updated_at = ? WHERE id = ? AND amount_paid = 0 AND status != ?
+	`, InvoiceVoid, now, now, invoiceID, InvoiceVoid)
+	if err != nil {
+		return nil, err
+	}
+	if voided, _ := result.RowsAffected(); voided == 0 {
+		return nil, fmt.Errorf("invoices with payments can't be voided")
+	}
+
+	return s.GetInvoice(invoiceID, issuerUserID)
+}
+
+// RecordReminder notes that the recipient has just been reminded about an open invoice
+func (s *InvoiceService) RecordReminder(invoiceID, issuerUserID int) (*Invoice, error) {
+	invoice, err := s.getIssuedInvoice(invoiceID, issuerUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !invoiceIsOpen(invoice.Status) {
+		return nil, fmt.Errorf("only unpaid invoices that have been sent can be reminded about")
+	}
+
+	if err = s.recordReminder(invoiceID); err != nil {
+		return nil, err
+	}
+
+	return s.GetInvoice(invoiceID, issuerUserID)
+}
+
+// PayInvoice pays all or part of an invoice with a normal transfer from the recipient to the issuer, and
+// links the transaction to the invoice in the same transaction. An amount of zero pays everything still due.
+func (s *InvoiceService) PayInvoice(invoiceID, payerUserID int, amount float64) (*Invoice, *Transaction, error) {
+	invoice, err := s.GetInvoice(invoiceID, payerUserID)
+	if err != nil || invoice.RecipientUserID != payerUserID {
+		return nil, nil, errInvoiceNotFound
+	}
+	if !invoiceIsOpen(invoice.Status) {
+		return nil, nil, fmt.Errorf("invoice is %s and can't be paid", invoice.Status)
+	}
+
+	if amount < 0 {
+		return nil, nil, fmt.Errorf("amount must be positive")
+	}
+	if amount == 0 {
+		amount = invoice.AmountDue
+	}
+	amount = roundCents(amount)
+	if amount > invoice.AmountDue {
+		return nil, nil, fmt.Errorf("amount is more than the %.2f still due", invoice.AmountDue)
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Claim the amount first, so concurrent payments can't pay more than the total
+	result, err := tx.Exec(`
+		UPDATE invoices SET amount_paid = ROUND(amount_paid + ?, 2)
+		WHERE id = ? AND status IN (?, ?, ?) AND ROUND(amount_paid + ?, 2) <= total
+	`, amount, invoiceID, InvoiceSent, InvoicePartiallyPaid, InvoiceOverdue, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return nil, nil, fmt.Errorf("invoice has changed; check the amount due and try again")
+	}
+
+	transactionID, err := s.banking.transferInTx(tx, payerUserID, invoice.IssuerAccountNumber, amount, "transfer", "Invoice "+invoice.Number)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	if _, err = tx.Exec(`UPDATE transactions SET invoice_id = ? WHERE id = ?`, invoiceID, transactionID); err != nil {
+		return nil, nil, err
+	}
+
+	// Overdue invoices stay overdue until they're paid in full
+	_, err = tx.Exec(`
+		UPDATE invoices
+		SET status = CASE WHEN amount_paid >= total THEN ? WHEN status = ? THEN ? ELSE ? END,
+		    paid_at = CASE WHEN amount_paid >= total THEN ? ELSE paid_at END,
+		    updated_at = ?
+		WHERE id = ?
+	`, InvoicePaid, InvoiceOverdue, InvoiceOverdue, InvoicePartiallyPaid, now, now, invoiceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	transaction, err := s.banking.GetTransactionByID(transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	invoice, err = s.GetInvoice(invoiceID, payerUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return invoice, transaction, nil
+}
+
+// GetInvoice retrieves an invoice with its lines and payments. Issuers see their invoices; recipients see
+// invoices sent to them, but not drafts.
+func (s *InvoiceService) GetInvoice(invoiceID, userID int) (*Invoice, error) {
+	invoice, err := scanInvoice(s.db.QueryRow(invoiceSelect+`
+		WHERE i.id = ? AND (i.issuer_user_id = ? OR (i.recipient_user_id = ? AND i.status != ?))
+	`, invoiceID, userID, userID, InvoiceDraft))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvoiceNotFound
+		}
+		return nil, err
+	}
+
+	if invoice.Lines, err = s.getInvoiceLines(invoiceID); err != nil {
+		return nil, err
+	}
+	if invoice.Payments, err = s.getInvoicePayments(invoiceID); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// GetUserInvoices lists invoices a user issued ("issued") or received ("received"), newest first,
+// optionally only those with the given status
+func (s *InvoiceService) GetUserInvoices(userID int, role, status string) ([]Invoice, error) {
+	var where string
+	args := []interface{}{userID}
+	switch role {
+	case "issued":
+		where = `WHERE i.issuer_user_id = ?`
+	case "received":
+		where = `WHERE i.recipient_user_id = ? AND i.status != ?`
+		args = append(args, InvoiceDraft)
+	default:
+		return nil, fmt.Errorf("role must be issued or received")
+	}
+	if status != "" {
+		where += ` AND i.status = ?`
+		args = append(args, status)
+	}
+
+	return s.queryInvoices(where+` ORDER BY i.created_at DESC, i.id DESC`, args...)
+}
+
+// getIssuedInvoice retrieves an invoice the user issued, without its lines
+func (s *InvoiceService) getIssuedInvoice(invoiceID, issuerUserID int) (*Invoice, error) {
+	invoice, err := scanInvoice(s.db.QueryRow(invoiceSelect+` WHERE i.id = ? AND i.issuer_user_id = ?`, invoiceID, issuerUserID))
+	if err == sql.ErrNoRows {
+		return nil, errInvoiceNotFound
+	}
+	return invoice, err
+}
+
+// recordReminder bumps an invoice's reminder count and time
+func (s *InvoiceService) recordReminder(invoiceID int) error {
+	_, err := s.db.Exec(`
+		UPDATE invoices SET last_reminder_at = ?, reminder_count = reminder_count + 1 WHERE id = ?
+	`, time.Now().UTC(), invoiceID)
+	return err
+}
+
+// queryInvoices retrieves the invoices matching the given WHERE clause, without their lines
+func (s *InvoiceService) queryInvoices(where string, args ...interface{}) ([]Invoice, error) {
+	rows, err := s.db.Query(invoiceSelect+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []Invoice{}
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, *invoice)
+	}
+
+	return invoices, rows.Err()
+}
+
+// getInvoiceLines retrieves an invoice's lines in order
+func (s *InvoiceService) getInvoiceLines(invoiceID int) ([]InvoiceLine, error) {
+	rows, err := s.db.Query(`
+		SELECT id, line_number, kind, description, quantity, unit_price, tax_rate, amount
+		FROM invoice_lines
+		WHERE invoice_id = ?
+		ORDER BY line_number
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []InvoiceLine{}
+	for rows.Next() {
+		var line InvoiceLine
+		var quantity, unitPrice, taxRate sql.NullFloat64
+		err := rows.Scan(&line.ID, &line.LineNumber, &line.Kind, &line.Description, &quantity, &unitPrice, &taxRate, &line.Amount)
+		if err != nil {
+			return nil, err
+		}
+		line.Quantity = quantity.Float64
+		line.UnitPrice = unitPrice.Float64
+		if taxRate.Valid {
+			line.TaxRate = &taxRate.Float64
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// getInvoicePayments retrieves the transactions that paid an invoice, oldest first
+func (s *InvoiceService) getInvoicePayments(invoiceID int) ([]Transaction, error) {
+	rows, err := s.db.Query(`SELECT id FROM transactions WHERE invoice_id = ? ORDER BY created_at, id`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	var payments []Transaction
+	for _, id := range ids {
+		payment, err := s.banking.GetTransactionByID(id)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, *payment)
+	}
+
+	return payments, nil
+}
+
+// buildInvoiceLines numbers an invoice's items and taxes, returning the lines with the subtotal of the
+// items and the total of the taxes
+func buildInvoiceLines(input InvoiceInput) ([]InvoiceLine, float64, float64, error) {
+	if len(input.Items) == 0 {
+		return nil, 0, 0, fmt.Errorf("an invoice needs at least one line item")
+	}
+
+	var lines []InvoiceLine
+	var subtotal, taxTotal float64
+	for _, item := range input.Items {
+		if strings.TrimSpace(item.Description) == "" {
+			return nil, 0, 0, fmt.Errorf("every line item needs a description")
+		}
+		if item.Quantity <= 0 || item.UnitPrice < 0 {
+			return nil, 0, 0, fmt.Errorf("line items need a positive quantity and a unit price of at least zero")
+		}
+
+		amount := roundCents(item.Quantity * item.UnitPrice)
+		subtotal += amount
+		lines = append(lines, InvoiceLine{
+			LineNumber:  len(lines) + 1,
+			Kind:        "item",
+			Description: strings.TrimSpace(item.Description),
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Amount:      amount,
+		})
+	}
+	subtotal = roundCents(subtotal)
+
+	for _, tax := range input.Taxes {
+		if strings.TrimSpace(tax.Description) == "" {
+			return nil, 0, 0, fmt.Errorf("every tax line needs a description")
+		}
+		if (tax.Rate == nil) == (tax.Amount == nil) {
+			return nil, 0, 0, fmt.Errorf("tax lines need either a rate or an amount")
+		}
+
+		line := InvoiceLine{
+			LineNumber:  len(lines) + 1,
+			Kind:        "tax",
+			Description: strings.TrimSpace(tax.Description),
+		}
+		if tax.Rate != nil {
+			if *tax.Rate < 0 || *tax.Rate > 100 {
+				return nil, 0, 0, fmt.Errorf("tax rates must be between 0 and 100 percent")
+			}
+			line.TaxRate = tax.Rate
+			line.Amount = roundCents(subtotal * *tax.Rate / 100)
+		} else {
+			if *tax.Amount < 0 {
+				return nil, 0, 0, fmt.Errorf("tax amounts can't be negative")
+			}
+			line.Amount = roundCents(*tax.Amount)
+		}
+		taxTotal += line.Amount
+		lines = append(lines, line)
+	}
+	taxTotal = roundCents(taxTotal)
+
+	if subtotal+taxTotal <= 0 {
+		return nil, 0, 0, fmt.Errorf("invoice total must be positive")
+	}
+
+	return lines, subtotal, taxTotal, nil
+}
+
+// insertInvoiceLinesInTx stores an invoice's lines
+func insertInvoiceLinesInTx(tx *sql.Tx, invoiceID int, lines []InvoiceLine) error {
+	for _, line := range lines {
+		var quantity, unitPrice interface{}
+		if line.Kind == "item" {
+			quantity, unitPrice = line.Quantity, line.UnitPrice
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO invoice_lines (invoice_id, line_number, kind, description, quantity, unit_price, tax_rate, amount)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, invoiceID, line.LineNumber, line.Kind, line.Description, quantity, unitPrice, line.TaxRate, line.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInvoiceRecipientInTx checks an invoice can be sent to the recipient
+func checkInvoiceRecipientInTx(tx *sql.Tx, issuerUserID, recipientUserID int) error {
+	if issuerUserID == recipientUserID {
+		return fmt.Errorf("cannot invoice yourself")
+	}
+
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM users WHERE id = ?`, recipientUserID).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("recipient not found")
+		}
+		return err
+	}
+	if status == AccountClosed {
+		return fmt.Errorf("recipient account is closed")
+	}
+
+	return nil
+}
+
+// parseInvoiceDueDate parses a YYYY-MM-DD due date, returning it with the moment the invoice becomes overdue:
+// the start of the following day, UTC
+func parseInvoiceDueDate(dueDate string) (string, time.Time, error) {
+	parsed, err := time.Parse("2006-01-02", strings.TrimSpace(dueDate))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("due date must be a date in YYYY-MM-DD format")
+	}
+
+	overdueAt := parsed.AddDate(0, 0, 1)
+	if !overdueAt.After(time.Now()) {
+		return "", time.Time{}, fmt.Errorf("due date can't be in the past")
+	}
+
+	return parsed.Format("2006-01-02"), overdueAt, nil
+}
+
+// invoiceIsOpen reports whether an invoice in the given status is waiting for payment
+func invoiceIsOpen(status string) bool {
+	return status == InvoiceSent || status == InvoicePartiallyPaid || status == InvoiceOverdue
+}
+
+// scanInvoice scans a row selected with invoiceSelect into an Invoice
+func scanInvoice(row rowScanner) (*Invoice, error) {
+	invoice := &Invoice{}
+	var number, notes sql.NullString
+	var sentAt, paidAt, voidedAt, lastReminderAt sql.NullTime
+
+	err := row.Scan(
+		&invoice.ID, &number, &invoice.IssuerUserID, &invoice.RecipientUserID, &invoice.Status, &invoice.Currency,
+		&invoice.Subtotal, &invoice.TaxTotal, &invoice.Total, &invoice.AmountPaid, &notes, &invoice.DueDate,
+		&invoice.OverdueAt, &sentAt, &paidAt, &voidedAt, &lastReminderAt, &invoice.ReminderCount,
+		&invoice.CreatedAt, &invoice.UpdatedAt, &invoice.IssuerUsername, &invoice.IssuerAccountNumber,
+		&invoice.RecipientUsername, &invoice.RecipientEmail,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice.Number = number.String
+	invoice.Notes = notes.String
+	if sentAt.Valid {
+		invoice.SentAt = &sentAt.Time
+	}
+	if paidAt.Valid {
+		invoice.PaidAt = &paidAt.Time
+	}
+	if voidedAt.Valid {
+		invoice.VoidedAt = &voidedAt.Time
+	}
+	if lastReminderAt.Valid {
+		invoice.LastReminderAt = &lastReminderAt.Time
+	}
+	if invoice.Status != InvoiceVoid {
+		invoice.AmountDue = roundCents(invoice.Total - invoice.AmountPaid)
+	}
+
+	return invoice, nil
+}
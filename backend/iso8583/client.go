@@ -0,0 +1,170 @@
+package iso8583
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds how long a Client waits for a response
+const DefaultTimeout = 10 * time.Second
+
+// Client is a terminal connection to the card network simulator.
+// Requests are sent one at a time; it is safe for concurrent use.
+type Client struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	stan    int
+	Timeout time.Duration
+}
+
+// Dial connects to a card network simulator
+func Dial(addr string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, Timeout: DefaultTimeout}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Send sends a request and waits for its response. The transmission date/time and STAN are
+// filled in when the request doesn't set them.
+func (c *Client) Send(req *Message) (*Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expectedMTI, err := ResponseMTI(req.MTI)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.Has(FieldTransmissionDateTime) {
+		req.Set(FieldTransmissionDateTime, time.Now().UTC().Format("0102150405"))
+	}
+	if !req.Has(FieldSTAN) {
+		c.stan = c.stan%999999 + 1
+		req.Set(FieldSTAN, fmt.Sprintf("%06d", c.stan))
+	}
+
+	if c.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.Timeout))
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	if err := WriteMessage(c.conn, req); err != nil {
+		return nil, err
+	}
+	resp, err := ReadMessage(c.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.MTI != expectedMTI {
+		return nil, fmt.Errorf("expected a %s response, got %s", expectedMTI, resp.MTI)
+	}
+	if resp.Get(FieldSTAN) != req.Get(FieldSTAN) {
+		return nil, fmt.Errorf("response STAN %s does not match request STAN %s", resp.Get(FieldSTAN), req.Get(FieldSTAN))
+	}
+
+	return resp, nil
+}
+
+// Payment describes a card-present payment at a terminal
+type Payment struct {
+	PAN              string
+	ExpiryDate       string // MM/YY, as printed on the card
+	PIN              string
+	Amount           int64 // Minor units
+	TerminalID       string
+	MerchantID       string // The merchant's account number or username
+	MerchantName     string
+	MerchantCategory string
+}
+
+// message builds a request carrying the payment's card and merchant details
+func (p Payment) message(mti string) (*Message, error) {
+	if len(p.ExpiryDate) != 5 || p.ExpiryDate[2] != '/' {
+		return nil, fmt.Errorf("expiry date must be MM/YY")
+	}
+
+	m := NewMessage(mti)
+	m.Set(FieldPAN, p.PAN)
+	m.Set(FieldProcessingCode, "000000") // Goods and services
+	m.Set(FieldAmount, strconv.FormatInt(p.Amount, 10))
+	m.Set(FieldExpiryDate, p.ExpiryDate[3:]+p.ExpiryDate[:2])
+	m.Set(FieldPOSEntryMode, "051") // Chip read, PIN entered
+	m.Set(FieldTerminalID, p.TerminalID)
+	m.Set(FieldCardAcceptorID, p.MerchantID)
+	if p.MerchantName != "" {
+		m.Set(FieldCardAcceptorName, p.MerchantName)
+	}
+	if p.MerchantCategory != "" {
+		m.Set(FieldAdditionalData, p.MerchantCategory)
+	}
+
+	if p.PIN != "" {
+		block, err := PINBlock(p.PIN, p.PAN)
+		if err != nil {
+			return nil, err
+		}
+		m.Set(FieldPINBlock, block)
+	}
+
+	return m, nil
+}
+
+// Authorize sends a 0100 authorization request, holding the amount for a later completion
+func (c *Client) Authorize(p Payment) (*Message, error) {
+	req, err := p.message(MTIAuthorizationRequest)
+	if err != nil {
+		return nil, err
+	}
+	return c.Send(req)
+}
+
+// Purchase sends a 0200 financial request, charging the card immediately
+func (c *Client) Purchase(p Payment) (*Message, error) {
+	req, err := p.message(MTIFinancialRequest)
+	if err != nil {
+		return nil, err
+	}
+	return c.Send(req)
+}
+
+// Complete sends a 0200 financial request that captures an earlier authorization.
+// An amount below the authorized amount releases the remainder.
+func (c *Client) Complete(p Payment, authorizationCode string) (*Message, error) {
+	req, err := p.message(MTIFinancialRequest)
+	if err != nil {
+		return nil, err
+	}
+	req.Set(FieldAuthorizationCode, authorizationCode)
+	return c.Send(req)
+}
+
+// Reverse sends a 0400 reversal request, releasing a hold or returning a completed payment
+func (c *Client) Reverse(merchantID, terminalID, authorizationCode string, amount int64) (*Message, error) {
+	req := NewMessage(MTIReversalRequest)
+	req.Set(FieldProcessingCode, "000000")
+	req.Set(FieldAmount, strconv.FormatInt(amount, 10))
+	req.Set(FieldAuthorizationCode, authorizationCode)
+	req.Set(FieldTerminalID, terminalID)
+	req.Set(FieldCardAcceptorID, merchantID)
+	return c.Send(req)
+}
+
+// NetworkManagement sends a 0800 request with the given information code,
+// e.g. NetworkSignOn or NetworkEchoTest
+func (c *Client) NetworkManagement(code string) (*Message, error) {
+	req := NewMessage(MTINetworkManagementRequest)
+	req.Set(FieldNetworkManagement, code)
+	return c.Send(req)
+}
@@ -0,0 +1,361 @@
+// Package iso8583 encodes and exchanges the subset of ISO 8583 messages spoken by the
+// Viridian City Bank card network simulator.
+//
+// Messages use ASCII MTIs and field values, binary bitmaps, and are framed on the wire by a
+// 2-byte big-endian length prefix.
+package iso8583
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Message type indicators
+const (
+	MTIAuthorizationRequest      = "0100"
+	MTIAuthorizationResponse     = "0110"
+	MTIFinancialRequest          = "0200"
+	MTIFinancialResponse         = "0210"
+	MTIReversalRequest           = "0400"
+	MTIReversalResponse          = "0410"
+	MTINetworkManagementRequest  = "0800"
+	MTINetworkManagementResponse = "0810"
+)
+
+// Data elements
+const (
+	FieldPAN                  = 2
+	FieldProcessingCode       = 3
+	FieldAmount               = 4  // Minor units
+	FieldTransmissionDateTime = 7  // MMDDhhmmss, UTC
+	FieldSTAN                 = 11 // System trace audit number
+	FieldLocalTime            = 12 // hhmmss
+	FieldLocalDate            = 13 // MMDD
+	FieldExpiryDate           = 14 // YYMM
+	FieldMerchantType         = 18
+	FieldPOSEntryMode         = 22
+	FieldRetrievalReference   = 37
+	FieldAuthorizationCode    = 38
+	FieldResponseCode         = 39
+	FieldTerminalID           = 41
+	FieldCardAcceptorID       = 42 // The merchant's account number or username
+	FieldCardAcceptorName     = 43
+	FieldAdditionalData       = 48 // The merchant category, e.g. "item_shop"
+	FieldCurrencyCode         = 49
+	FieldPINBlock             = 52
+	FieldNetworkManagement    = 70
+	FieldOriginalData         = 90
+)
+
+// Network management information codes (field 70)
+const (
+	NetworkSignOn   = "001"
+	NetworkSignOff  = "002"
+	NetworkEchoTest = "301"
+)
+
+// Response codes (field 39)
+const (
+	ResponseApproved           = "00"
+	ResponseInvalidMerchant    = "03"
+	ResponseDoNotHonor         = "05"
+	ResponseInvalidTransaction = "12"
+	ResponseInvalidAmount      = "13"
+	ResponseInvalidCard        = "14"
+	ResponseNoOriginal         = "25"
+	ResponseFormatError        = "30"
+	ResponseInsufficientFunds  = "51"
+	ResponseExpiredCard        = "54"
+	ResponseIncorrectPIN       = "55"
+	ResponseNotPermitted       = "57"
+	ResponseExceedsLimit       = "61"
+	ResponseRestrictedCard     = "62"
+	ResponsePINTriesExceeded   = "75"
+	ResponseSystemMalfunction  = "96"
+)
+
+// fieldKind describes how a field's value is encoded
+type fieldKind int
+
+const (
+	numeric      fieldKind = iota // Digits, left-padded with zeros
+	alphanumeric                  // Printable characters, right-padded with spaces
+	binaryData                    // Raw bytes
+)
+
+// fieldSpec describes the encoding of one data element
+type fieldSpec struct {
+	kind         fieldKind
+	length       int // Fixed length, or the maximum length for variable fields
+	lengthDigits int // 0 for fixed-length fields, 2 for LLVAR, 3 for LLLVAR
+}
+
+// fieldSpecs lists the data elements this package understands
+var fieldSpecs = map[int]fieldSpec{
+	FieldPAN:                  {numeric, 19, 2},
+	FieldProcessingCode:       {numeric, 6, 0},
+	FieldAmount:               {numeric, 12, 0},
+	FieldTransmissionDateTime: {numeric, 10, 0},
+	FieldSTAN:                 {numeric, 6, 0},
+	FieldLocalTime:            {numeric, 6, 0},
+	FieldLocalDate:            {numeric, 4, 0},
+	FieldExpiryDate:           {numeric, 4, 0},
+	FieldMerchantType:         {numeric, 4, 0},
+	FieldPOSEntryMode:         {numeric, 3, 0},
+	FieldRetrievalReference:   {alphanumeric, 12, 0},
+	FieldAuthorizationCode:    {alphanumeric, 6, 0},
+	FieldResponseCode:         {alphanumeric, 2, 0},
+	FieldTerminalID:           {alphanumeric, 8, 0},
+	FieldCardAcceptorID:       {alphanumeric, 15, 0},
+	FieldCardAcceptorName:     {alphanumeric, 40, 0},
+	FieldAdditionalData:       {alphanumeric, 999, 3},
+	FieldCurrencyCode:         {numeric, 3, 0},
+	FieldPINBlock:             {binaryData, 8, 0},
+	FieldNetworkManagement:    {numeric, 3, 0},
+	FieldOriginalData:         {numeric, 42, 0},
+}
+
+// maxMessageLength is the largest message that fits the 2-byte length prefix
+const maxMessageLength = 0xFFFF
+
+// Message is an ISO 8583 message: a message type indicator and a set of data elements
+type Message struct {
+	MTI    string
+	fields map[int]string
+}
+
+// NewMessage creates an empty message of the given type
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, fields: make(map[int]string)}
+}
+
+// Set sets a data element. Fixed-length values are padded when the message is packed.
+func (m *Message) Set(field int, value string) {
+	if m.fields == nil {
+		m.fields = make(map[int]string)
+	}
+	m.fields[field] = value
+}
+
+// Get returns a data element, with any fixed-length padding removed, or "" if it is absent
+func (m *Message) Get(field int) string {
+	value := m.fields[field]
+	if spec, ok := fieldSpecs[field]; ok && spec.kind == alphanumeric {
+		return strings.TrimRight(value, " ")
+	}
+	return value
+}
+
+// Has reports whether a data element is present
+func (m *Message) Has(field int) bool {
+	_, ok := m.fields[field]
+	return ok
+}
+
+// Fields lists the data elements present, in ascending order
+func (m *Message) Fields() []int {
+	fields := make([]int, 0, len(m.fields))
+	for field := range m.fields {
+		fields = append(fields, field)
+	}
+	sort.Ints(fields)
+	return fields
+}
+
+// ResponseCode returns field 39
+func (m *Message) ResponseCode() string {
+	return m.Get(FieldResponseCode)
+}
+
+// Approved reports whether a response carries the approved response code
+func (m *Message) Approved() bool {
+	return m.ResponseCode() == ResponseApproved
+}
+
+// Pack encodes the message: MTI, bitmap(s), then each data element in order
+func (m *Message) Pack() ([]byte, error) {
+	if !isDigits(m.MTI) || len(m.MTI) != 4 {
+		return nil, fmt.Errorf("invalid MTI %q", m.MTI)
+	}
+
+	fields := m.Fields()
+	bitmap := make([]byte, 8)
+	for _, field := range fields {
+		if field < 2 || field > 128 {
+			return nil, fmt.Errorf("field %d is out of range", field)
+		}
+		if field > 64 && len(bitmap) == 8 {
+			bitmap = append(bitmap, make([]byte, 8)...)
+			bitmap[0] |= 0x80 // Secondary bitmap present
+		}
+	}
+	for _, field := range fields {
+		bitmap[(field-1)/8] |= 0x80 >> uint((field-1)%8)
+	}
+
+	out := []byte(m.MTI)
+	out = append(out, bitmap...)
+	for _, field := range fields {
+		encoded, err := encodeField(field, m.fields[field])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, encoded...)
+	}
+
+	return out, nil
+}
+
+// Unpack decodes a packed message
+func Unpack(data []byte) (*Message, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("message too short")
+	}
+
+	m := NewMessage(string(data[:4]))
+	if !isDigits(m.MTI) {
+		return nil, fmt.Errorf("invalid MTI %q", m.MTI)
+	}
+
+	bitmap := data[4:12]
+	pos := 12
+	if bitmap[0]&0x80 != 0 {
+		if len(data) < 20 {
+			return nil, fmt.Errorf("message too short for secondary bitmap")
+		}
+		bitmap = data[4:20]
+		pos = 20
+	}
+
+	for field := 2; field <= len(bitmap)*8; field++ {
+		if bitmap[(field-1)/8]&(0x80>>uint((field-1)%8)) == 0 {
+			continue
+		}
+
+		value, n, err := decodeField(field, data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		m.fields[field] = value
+		pos += n
+	}
+
+	if pos != len(data) {
+		return nil, fmt.Errorf("%d unexpected trailing bytes", len(data)-pos)
+	}
+
+	return m, nil
+}
+
+// encodeField encodes one data element according to its spec
+func encodeField(field int, value string) ([]byte, error) {
+	spec, ok := fieldSpecs[field]
+	if !ok {
+		return nil, fmt.Errorf("field %d is not supported", field)
+	}
+	if spec.kind == numeric && !isDigits(value) {
+		return nil, fmt.Errorf("field %d must be numeric", field)
+	}
+	if len(value) > spec.length {
+		return nil, fmt.Errorf("field %d is longer than %d", field, spec.length)
+	}
+
+	if spec.lengthDigits > 0 {
+		return []byte(fmt.Sprintf("%0*d%s", spec.lengthDigits, len(value), value)), nil
+	}
+
+	switch spec.kind {
+	case numeric:
+		value = strings.Repeat("0", spec.length-len(value)) + value
+	case alphanumeric:
+		value += strings.Repeat(" ", spec.length-len(value))
+	case binaryData:
+		if len(value) != spec.length {
+			return nil, fmt.Errorf("field %d must be exactly %d bytes", field, spec.length)
+		}
+	}
+
+	return []byte(value), nil
+}
+
+// decodeField decodes one data element and returns how many bytes it used
+func decodeField(field int, data []byte) (string, int, error) {
+	spec, ok := fieldSpecs[field]
+	if !ok {
+		return "", 0, fmt.Errorf("field %d is not supported", field)
+	}
+
+	length, header := spec.length, 0
+	if spec.lengthDigits > 0 {
+		header = spec.lengthDigits
+		if len(data) < header || !isDigits(string(data[:header])) {
+			return "", 0, fmt.Errorf("field %d has an invalid length prefix", field)
+		}
+		fmt.Sscanf(string(data[:header]), "%d", &length)
+		if length > spec.length {
+			return "", 0, fmt.Errorf("field %d is longer than %d", field, spec.length)
+		}
+	}
+
+	if len(data) < header+length {
+		return "", 0, fmt.Errorf("field %d is truncated", field)
+	}
+	value := string(data[header : header+length])
+	if spec.kind == numeric && !isDigits(value) {
+		return "", 0, fmt.Errorf("field %d must be numeric", field)
+	}
+
+	return value, header + length, nil
+}
+
+// WriteMessage packs a message and writes it with its length prefix
+func WriteMessage(w io.Writer, m *Message) error {
+	packed, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	if len(packed) > maxMessageLength {
+		return fmt.Errorf("message too long")
+	}
+
+	frame := make([]byte, 2, 2+len(packed))
+	binary.BigEndian.PutUint16(frame, uint16(len(packed)))
+	_, err = w.Write(append(frame, packed...))
+	return err
+}
+
+// ReadMessage reads one length-prefixed message
+func ReadMessage(r io.Reader) (*Message, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return Unpack(data)
+}
+
+// ResponseMTI returns the response type for a request type, e.g. 0110 for 0100
+func ResponseMTI(mti string) (string, error) {
+	if len(mti) != 4 || !isDigits(mti) || mti[2] != '0' {
+		return "", fmt.Errorf("%q is not a request MTI", mti)
+	}
+	return mti[:2] + "1" + mti[3:], nil
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	block, err := PINBlock("1234", "4532015112830366")
+	if err != nil {
+		t.Fatalf("PINBlock: %v", err)
+	}
+
+	m := NewMessage(MTIFinancialRequest)
+	m.Set(FieldPAN, "4532015112830366")
+	m.Set(FieldProcessingCode, "000000")
+	m.Set(FieldAmount, "1250")
+	m.Set(FieldSTAN, "42")
+	m.Set(FieldExpiryDate, "2910")
+	m.Set(FieldTerminalID, "TERM01")
+	m.Set(FieldCardAcceptorID, "ash")
+	m.Set(FieldAdditionalData, "item_shop")
+	m.Set(FieldPINBlock, block)
+
+	packed, err := m.Pack()
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	if packed[4]&0x80 != 0 {
+		t.Errorf("secondary bitmap flagged without any field above 64")
+	}
+
+	got, err := Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+
+	if got.MTI != MTIFinancialRequest {
+		t.Errorf("MTI = %q, want %q", got.MTI, MTIFinancialRequest)
+	}
+	want := map[int]string{
+		FieldPAN:            "4532015112830366",
+		FieldProcessingCode: "000000",
+		FieldAmount:         "000000001250",
+		FieldSTAN:           "000042",
+		FieldExpiryDate:     "2910",
+		FieldTerminalID:     "TERM01",
+		FieldCardAcceptorID: "ash",
+		FieldAdditionalData: "item_shop",
+		FieldPINBlock:       block,
+	}
+	for field, value := range want {
+		if got.Get(field) != value {
+			t.Errorf("field %d = %q, want %q", field, got.Get(field), value)
+		}
+	}
+	if len(got.Fields()) != len(want) {
+		t.Errorf("got fields %v, want %d fields", got.Fields(), len(want))
+	}
+}
+
+func TestSecondaryBitmap(t *testing.T) {
+	m := NewMessage(MTINetworkManagementRequest)
+	m.Set(FieldSTAN, "1")
+	m.Set(FieldNetworkManagement, NetworkEchoTest)
+
+	packed, err := m.Pack()
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	if packed[4]&0x80 == 0 {
+		t.Fatalf("secondary bitmap not flagged for field 70")
+	}
+
+	got, err := Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if got.Get(FieldNetworkManagement) != NetworkEchoTest {
+		t.Errorf("field 70 = %q, want %q", got.Get(FieldNetworkManagement), NetworkEchoTest)
+	}
+}
+
+func TestPackRejectsInvalidFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		field int
+		value string
+	}{
+		{"non-numeric amount", FieldAmount, "12.50"},
+		{"amount too long", FieldAmount, "1234567890123"},
+		{"PAN too long", FieldPAN, "12345678901234567890"},
+		{"short PIN block", FieldPINBlock, "1234"},
+		{"unsupported field", 5, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMessage(MTIFinancialRequest)
+			m.Set(tt.field, tt.value)
+			if _, err := m.Pack(); err == nil {
+				t.Errorf("Pack accepted field %d = %q", tt.field, tt.value)
+			}
+		})
+	}
+}
+
+func TestUnpackRejectsMalformedMessages(t *testing.T) {
+	m := NewMessage(MTIAuthorizationRequest)
+	m.Set(FieldPAN, "4532015112830366")
+	m.Set(FieldAmount, "100")
+	packed, err := m.Pack()
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+
+	tests := map[string][]byte{
+		"too short":      packed[:10],
+		"truncated":      packed[:len(packed)-1],
+		"trailing bytes": append(append([]byte{}, packed...), '0'),
+		"bad MTI":        append([]byte("01X0"), packed[4:]...),
+	}
+	for name, data := range tests {
+		if _, err := Unpack(data); err == nil {
+			t.Errorf("%s: Unpack accepted malformed message", name)
+		}
+	}
+}
+
+func TestFraming(t *testing.T) {
+	var buf bytes.Buffer
+	for _, stan := range []string{"000001", "000002"} {
+		m := NewMessage(MTINetworkManagementRequest)
+		m.Set(FieldSTAN, stan)
+		m.Set(FieldNetworkManagement, NetworkSignOn)
+		if err := WriteMessage(&buf, m); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+	}
+
+	for _, stan := range []string{"000001", "000002"} {
+		m, err := ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if m.Get(FieldSTAN) != stan {
+			t.Errorf("STAN = %q, want %q", m.Get(FieldSTAN), stan)
+		}
+	}
+}
+
+func TestResponseMTI(t *testing.T) {
+	tests := map[string]string{
+		MTIAuthorizationRequest:     MTIAuthorizationResponse,
+		MTIFinancialRequest:         MTIFinancialResponse,
+		MTIReversalRequest:          MTIReversalResponse,
+		MTINetworkManagementRequest: MTINetworkManagementResponse,
+	}
+	for request, response := range tests {
+		got, err := ResponseMTI(request)
+		if err != nil || got != response {
+			t.Errorf("ResponseMTI(%s) = %q, %v; want %q", request, got, err, response)
+		}
+	}
+
+	if _, err := ResponseMTI(MTIFinancialResponse); err == nil {
+		t.Errorf("ResponseMTI accepted a response MTI")
+	}
+}
+
+func TestPINBlockRoundTrip(t *testing.T) {
+	pan := "4532015112830366"
+	for _, pin := range []string{"0000", "1234", "987654321012"} {
+		block, err := PINBlock(pin, pan)
+		if err != nil {
+			t.Fatalf("PINBlock(%s): %v", pin, err)
+		}
+		if len(block) != 8 {
+			t.Fatalf("PIN block is %d bytes, want 8", len(block))
+		}
+
+		got, err := DecodePINBlock(block, pan)
+		if err != nil || got != pin {
+			t.Errorf("DecodePINBlock = %q, %v; want %q", got, err, pin)
+		}
+	}
+
+	// A block built for another card doesn't decode to the same PIN
+	block, _ := PINBlock("1234", pan)
+	if got, err := DecodePINBlock(block, "4532015112830374"); err == nil && got == "1234" {
+		t.Errorf("PIN block decoded with the wrong PAN")
+	}
+
+	if _, err := PINBlock("12a4", pan); err == nil {
+		t.Errorf("PINBlock accepted a non-numeric PIN")
+	}
+}
@@ -0,0 +1,69 @@
+package iso8583
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PINBlock builds an ISO 9564 format 0 PIN block for field 52.
+// The simulator exchanges PIN blocks in the clear; real networks encrypt them under a zone PIN key.
+func PINBlock(pin, pan string) (string, error) {
+	if len(pin) < 4 || len(pin) > 12 || !isDigits(pin) {
+		return "", fmt.Errorf("PIN must be 4 to 12 digits")
+	}
+
+	pinField, err := hex.DecodeString(fmt.Sprintf("0%X%s", len(pin), pin) + strings.Repeat("F", 14-len(pin)))
+	if err != nil {
+		return "", err
+	}
+	panField, err := pinBlockPANField(pan)
+	if err != nil {
+		return "", err
+	}
+
+	block := make([]byte, 8)
+	for i := range block {
+		block[i] = pinField[i] ^ panField[i]
+	}
+
+	return string(block), nil
+}
+
+// DecodePINBlock recovers the PIN from an ISO 9564 format 0 PIN block
+func DecodePINBlock(block, pan string) (string, error) {
+	if len(block) != 8 {
+		return "", fmt.Errorf("PIN block must be 8 bytes")
+	}
+	panField, err := pinBlockPANField(pan)
+	if err != nil {
+		return "", err
+	}
+
+	pinField := make([]byte, 8)
+	for i := range pinField {
+		pinField[i] = block[i] ^ panField[i]
+	}
+	digits := strings.ToUpper(hex.EncodeToString(pinField))
+
+	length := int(pinField[0] & 0x0F)
+	if digits[0] != '0' || length < 4 || length > 12 {
+		return "", fmt.Errorf("invalid PIN block")
+	}
+	pin := digits[2 : 2+length]
+	if !isDigits(pin) || strings.Trim(digits[2+length:], "F") != "" {
+		return "", fmt.Errorf("invalid PIN block")
+	}
+
+	return pin, nil
+}
+
+// pinBlockPANField returns the PAN half of a format 0 PIN block:
+// four zeros followed by the 12 rightmost PAN digits, excluding the check digit
+func pinBlockPANField(pan string) ([]byte, error) {
+	if len(pan) < 13 || !isDigits(pan) {
+		return nil, fmt.Errorf("PAN must be at least 13 digits")
+	}
+
+	return hex.DecodeString("0000" + pan[len(pan)-13:len(pan)-1])
+}
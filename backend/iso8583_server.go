@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"viridian-bank-backend/iso8583"
+)
+
+// iso8583IdleTimeout closes terminal connections that stay silent this long
+const iso8583IdleTimeout = 5 * time.Minute
+
+// iso8583EchoedFields are copied from each request into its response
+var iso8583EchoedFields = []int{
+	iso8583.FieldProcessingCode, iso8583.FieldAmount, iso8583.FieldTransmissionDateTime, iso8583.FieldSTAN,
+	iso8583.FieldLocalTime, iso8583.FieldLocalDate, iso8583.FieldRetrievalReference, iso8583.FieldTerminalID,
+	iso8583.FieldCardAcceptorID, iso8583.FieldCurrencyCode, iso8583.FieldNetworkManagement,
+}
+
+// ISO8583Server is a card network simulator: point-of-sale terminals send it ISO 8583 messages over TCP
+// and it maps them onto card payments. Only configured terminals are served, each on behalf of one merchant.
+type ISO8583Server struct {
+	cardPayments   *CardPaymentService
+	userService    *UserService
+	webhookService *WebhookService
+	terminals      map[string]string // Terminal ID -> merchant account number or username
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+// NewISO8583Server creates a new ISO8583Server serving the given terminals
+func NewISO8583Server(cardPayments *CardPaymentService, userService *UserService, webhookService *WebhookService, terminals map[string]string) *ISO8583Server {
+	return &ISO8583Server{
+		cardPayments:   cardPayments,
+		userService:    userService,
+		webhookService: webhookService,
+		terminals:      terminals,
+		conns:          make(map[net.Conn]bool),
+	}
+}
+
+// ParseISO8583Terminals parses a comma-separated list of TERMINAL_ID=merchant pairs, where the merchant is
+// an account number or username
+func ParseISO8583Terminals(value string) (map[string]string, error) {
+	terminals := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		terminalID, merchant, ok := strings.Cut(entry, "=")
+		terminalID, merchant = strings.TrimSpace(terminalID), strings.TrimSpace(merchant)
+		if !ok || terminalID == "" || merchant == "" {
+			return nil, fmt.Errorf("invalid terminal %q, expected TERMINAL_ID=merchant", entry)
+		}
+		terminals[terminalID] = merchant
+	}
+	return terminals, nil
+}
+
+// ListenAndServe listens on addr and serves terminals until Close is called.
+// An address without a host, e.g. ":8583", listens on loopback only.
+func (s *ISO8583Server) ListenAndServe(addr string) error {
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts terminal connections until Close is called
+func (s *ISO8583Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops accepting terminals and closes open connections
+func (s *ISO8583Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// isClosed reports whether Close has been called
+func (s *ISO8583Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// handleConn answers one terminal's requests in order until it disconnects
+func (s *ISO8583Server) handleConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(iso8583IdleTimeout))
+		req, err := iso8583.ReadMessage(conn)
+		if err != nil {
+			if err != io.EOF && !s.isClosed() {
+				log.Printf("ISO 8583: closing connection from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		resp := s.handleMessage(req)
+		if resp == nil {
+			log.Printf("ISO 8583: closing connection from %s: unexpected message type %s", conn.RemoteAddr(), req.MTI)
+			return
+		}
+
+		if err := iso8583.WriteMessage(conn, resp); err != nil {
+			log.Printf("ISO 8583: failed to respond to %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handleMessage builds the response to a request, or returns nil if the message isn't a request
+func (s *ISO8583Server) handleMessage(req *iso8583.Message) *iso8583.Message {
+	responseMTI, err := iso8583.ResponseMTI(req.MTI)
+	if err != nil {
+		return nil
+	}
+
+	resp := iso8583.NewMessage(responseMTI)
+	for _, field := range iso8583EchoedFields {
+		if req.Has(field) {
+			resp.Set(field, req.Get(field))
+		}
+	}
+
+	var code string
+	var authorization *CardAuthorization
+	switch req.MTI {
+	case iso8583.MTIAuthorizationRequest:
+		code, authorization = s.authorize(req, true)
+	case iso8583.MTIFinancialRequest:
+		// A financial request quoting an approval code completes that authorization
+		if req.Has(iso8583.FieldAuthorizationCode) {
+			code, authorization = s.complete(req)
+		} else {
+			code, authorization = s.authorize(req, false)
+		}
+	case iso8583.MTIReversalRequest:
+		code, authorization = s.reverse(req)
+	case iso8583.MTINetworkManagementRequest:
+		code = s.networkManagement(req)
+	default:
+		code = iso8583.ResponseInvalidTransaction
+	}
+
+	resp.Set(iso8583.FieldResponseCode, code)
+	if authorization != nil {
+		resp.Set(iso8583.FieldAuthorizationCode, authorization.AuthorizationCode)
+	}
+
+	return resp
+}
+
+// authorize handles purchases (0200) and authorizations that only hold funds (0100).
+// Terminal payments are card-present, so they are verified with the PIN block.
+func (s *ISO8583Server) authorize(req *iso8583.Message, holdOnly bool) (string, *CardAuthorization) {
+	for _, field := range []int{iso8583.FieldPAN, iso8583.FieldAmount, iso8583.FieldExpiryDate, iso8583.FieldCardAcceptorID} {
+		if !req.Has(field) {
+			return iso8583.ResponseFormatError, nil
+		}
+	}
+	if code, ok := checkProcessingCode(req); !ok {
+		return code, nil
+	}
+
+	amount, ok := iso8583Amount(req)
+	if !ok {
+		return iso8583.ResponseInvalidAmount, nil
+	}
+
+	merchant, ok := s.terminalMerchant(req)
+	if !ok {
+		return iso8583.ResponseInvalidMerchant, nil
+	}
+
+	// Field 14 is YYMM; cards print MM/YY
+	expiry := req.Get(iso8583.FieldExpiryDate)
+	expiryDate := expiry[2:] + "/" + expiry[:2]
+	expiresAt, err := parseCardExpiry(expiryDate)
+	if err != nil {
+		return iso8583.ResponseFormatError, nil
+	}
+	if !time.Now().Before(expiresAt) {
+		return iso8583.ResponseExpiredCard, nil
+	}
+
+	if !req.Has(iso8583.FieldPINBlock) {
+		return iso8583.ResponseIncorrectPIN, nil
+	}
+	pin, err := iso8583.DecodePINBlock(req.Get(iso8583.FieldPINBlock), req.Get(iso8583.FieldPAN))
+	if err != nil {
+		return iso8583.ResponseIncorrectPIN, nil
+	}
+
+	description := req.Get(iso8583.FieldCardAcceptorName)
+	if description == "" {
+		description = "Card payment at terminal " + req.Get(iso8583.FieldTerminalID)
+	}
+
+	authorization, err := s.cardPayments.Authorize(CardPaymentDetails{
+		CardNumber:            req.Get(iso8583.FieldPAN),
+		ExpiryDate:            expiryDate,
+		PIN:                   pin,
+		Amount:                amount,
+		MerchantAccountNumber: merchant.AccountNumber,
+		Description:           description,
+		HoldOnly:              holdOnly,
+	})
+	if err != nil {
+		return iso8583ResponseCode(err), nil
+	}
+
+	if holdOnly {
+		go s.webhookService.SendCardAuthorizationWebhook("card_hold_created", authorization)
+	} else {
+		go s.webhookService.SendCardAuthorizationWebhook("card_payment", authorization)
+	}
+
+	return iso8583.ResponseApproved, authorization
+}
+
+// complete captures an earlier authorization (0200 with field 38); field 4 may capture less than was held
+func (s *ISO8583Server) complete(req *iso8583.Message) (string, *CardAuthorization) {
+	if !req.Has(iso8583.FieldCardAcceptorID) {
+		return iso8583.ResponseFormatError, nil
+	}
+	if code, ok := checkProcessingCode(req); !ok {
+		return code, nil
+	}
+
+	var amount float64
+	if req.Has(iso8583.FieldAmount) {
+		var ok bool
+		if amount, ok = iso8583Amount(req); !ok {
+			return iso8583.ResponseInvalidAmount, nil
+		}
+	}
+
+	merchant, ok := s.terminalMerchant(req)
+	if !ok {
+		return iso8583.ResponseInvalidMerchant, nil
+	}
+
+	authorization, err := s.cardPayments.Capture(req.Get(iso8583.FieldAuthorizationCode), merchant.AccountNumber, amount)
+	if err != nil {
+		return iso8583ResponseCode(err), nil
+	}
+
+	go s.webhookService.SendCardAuthorizationWebhook("card_hold_captured", authorization)
+
+	return iso8583.ResponseApproved, authorization
+}
+
+// reverse undoes an authorization (0400): holds are released and completed payments are returned in full
+func (s *ISO8583Server) reverse(req *iso8583.Message) (string, *CardAuthorization) {
+	if !req.Has(iso8583.FieldAuthorizationCode) || !req.Has(iso8583.FieldCardAcceptorID) {
+		return iso8583.ResponseFormatError, nil
+	}
+
+	merchant, ok := s.terminalMerchant(req)
+	if !ok {
+		return iso8583.ResponseInvalidMerchant, nil
+	}
+
+	authorization, err := s.cardPayments.Reverse(req.Get(iso8583.FieldAuthorizationCode), merchant.AccountNumber)
+	if err != nil {
+		return iso8583ResponseCode(err), nil
+	}
+
+	if authorization.Status == "voided" {
+		go s.webhookService.SendCardAuthorizationWebhook("card_hold_voided", authorization)
+	} else {
+		go s.webhookService.SendCardAuthorizationWebhook("card_payment_reversed", authorization)
+	}
+
+	return iso8583.ResponseApproved, authorization
+}
+
+// terminalMerchant returns the merchant the requesting terminal (field 41) is configured for. Field 42 must name
+// that same merchant, so a terminal can't act for anyone else.
+func (s *ISO8583Server) terminalMerchant(req *iso8583.Message) (*User, bool) {
+	configured, ok := s.terminals[req.Get(iso8583.FieldTerminalID)]
+	if !ok {
+		return nil, false
+	}
+
+	merchant, err := s.userService.GetUserByUsernameOrAccountNumber(configured)
+	if err != nil {
+		return nil, false
+	}
+
+	cardAcceptorID := req.Get(iso8583.FieldCardAcceptorID)
+	if cardAcceptorID != merchant.Username && cardAcceptorID != merchant.AccountNumber {
+		return nil, false
+	}
+
+	return merchant, true
+}
+
+// networkManagement answers sign-on, sign-off and echo tests (0800)
+func (s *ISO8583Server) networkManagement(req *iso8583.Message) string {
+	switch req.Get(iso8583.FieldNetworkManagement) {
+	case iso8583.NetworkSignOn, iso8583.NetworkSignOff, iso8583.NetworkEchoTest:
+		return iso8583.ResponseApproved
+	case "":
+		return iso8583.ResponseFormatError
+	default:
+		return iso8583.ResponseInvalidTransaction
+	}
+}
+
+// checkProcessingCode accepts goods and services transactions; field 3 is optional
+func checkProcessingCode(req *iso8583.Message) (string, bool) {
+	if req.Has(iso8583.FieldProcessingCode) && !strings.HasPrefix(req.Get(iso8583.FieldProcessingCode), "00") {
+		return iso8583.ResponseInvalidTransaction, false
+	}
+	return "", true
+}
+
+// iso8583Amount converts field 4 from minor units
+func iso8583Amount(req *iso8583.Message) (float64, bool) {
+	minorUnits, err := strconv.ParseInt(req.Get(iso8583.FieldAmount), 10, 64)
+	if err != nil || minorUnits <= 0 {
+		return 0, false
+	}
+	return float64(minorUnits) / 100, true
+}
+
+// iso8583ResponseCode maps a card payment error onto a response code
+func iso8583ResponseCode(err error) string {
+	switch err {
+	case errCardDeclined:
+		return iso8583.ResponseDoNotHonor
+	case errInsufficientBalance:
+		return iso8583.ResponseInsufficientFunds
+	case errCardFrozen:
+		return iso8583.ResponseRestrictedCard
+	case errTransactionLimitExceeded, errDailyLimitExceeded:
+		return iso8583.ResponseExceedsLimit
+	case errHoldNotFound, errHoldExpired, errAuthorizationNotFound:
+		return iso8583.ResponseNoOriginal
+	default:
+		return iso8583.ResponseDoNotHonor
+	}
+}
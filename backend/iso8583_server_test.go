@@ -0,0 +1,373 @@
+package main
+
+import (
+	"database/sql"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"viridian-bank-backend/iso8583"
+)
+
+// iso8583TestEnv is a card network simulator on loopback with a cardholder, a merchant and a terminal client
+type iso8583TestEnv struct {
+	db         *sql.DB
+	users      *UserService
+	cards      *CardService
+	client     *iso8583.Client
+	cardholder *User
+	merchant   *User
+	card       *Card
+}
+
+const testPIN = "1234"
+
+func newISO8583TestEnv(t *testing.T) *iso8583TestEnv {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "bank.db"))
+	t.Setenv("WEBHOOK_URL", "")
+
+	db, err := InitDB()
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	users := NewUserService(db)
+	cards := NewCardService(db)
+	banking := NewBankingService(db)
+	terminals := map[string]string{"MART0001": "pokemart"}
+	server := NewISO8583Server(NewCardPaymentService(db, cards, banking), users, NewWebhookService(), terminals)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	client, err := iso8583.Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	cardholder, err := users.CreateUser("ash", "ash@example.com", "pikachu123")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	merchant, err := users.CreateUser("pokemart", "mart@example.com", "pikachu123")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := NewMerchantService(db).CreateMerchant("Poke Mart Viridian", "item_shop", "", merchant.ID, nil); err != nil {
+		t.Fatalf("CreateMerchant: %v", err)
+	}
+
+	card, err := cards.GetUserCard(cardholder.ID)
+	if err != nil {
+		t.Fatalf("GetUserCard: %v", err)
+	}
+	if err := cards.SetPIN(cardholder.ID, card.ID, testPIN); err != nil {
+		t.Fatalf("SetPIN: %v", err)
+	}
+
+	return &iso8583TestEnv{
+		db:         db,
+		users:      users,
+		cards:      cards,
+		client:     client,
+		cardholder: cardholder,
+		merchant:   merchant,
+		card:       card,
+	}
+}
+
+// payment returns a terminal payment with the test card's correct details
+func (env *iso8583TestEnv) payment(amount int64) iso8583.Payment {
+	return iso8583.Payment{
+		PAN:              env.card.CardNumber,
+		ExpiryDate:       env.card.ExpiryDate,
+		PIN:              testPIN,
+		Amount:           amount,
+		TerminalID:       "MART0001",
+		MerchantID:       env.merchant.AccountNumber,
+		MerchantName:     "Poke Mart Viridian",
+		MerchantCategory: "item_shop",
+	}
+}
+
+// balance returns a user's ledger balance
+func (env *iso8583TestEnv) balance(t *testing.T, userID int) float64 {
+	t.Helper()
+	user, err := env.users.GetUserByID(userID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	return user.Balance
+}
+
+// expectBalances checks the cardholder's and merchant's ledger balances
+func (env *iso8583TestEnv) expectBalances(t *testing.T, cardholder, merchant float64) {
+	t.Helper()
+	if got := env.balance(t, env.cardholder.ID); got != cardholder {
+		t.Errorf("cardholder balance = %.2f, want %.2f", got, cardholder)
+	}
+	if got := env.balance(t, env.merchant.ID); got != merchant {
+		t.Errorf("merchant balance = %.2f, want %.2f", got, merchant)
+	}
+}
+
+// expectResponse checks a response's error and response code
+func expectResponse(t *testing.T, resp *iso8583.Message, err error, code string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.ResponseCode() != code {
+		t.Fatalf("response code = %q, want %q", resp.ResponseCode(), code)
+	}
+}
+
+func TestISO8583NetworkManagement(t *testing.T) {
+	env := newISO8583TestEnv(t)
+
+	for _, code := range []string{iso8583.NetworkSignOn, iso8583.NetworkEchoTest, iso8583.NetworkSignOff} {
+		resp, err := env.client.NetworkManagement(code)
+		expectResponse(t, resp, err, iso8583.ResponseApproved)
+		if resp.Get(iso8583.FieldNetworkManagement) != code {
+			t.Errorf("field 70 = %q, want %q", resp.Get(iso8583.FieldNetworkManagement), code)
+		}
+	}
+
+	resp, err := env.client.NetworkManagement("999")
+	expectResponse(t, resp, err, iso8583.ResponseInvalidTransaction)
+}
+
+func TestISO8583Purchase(t *testing.T) {
+	env := newISO8583TestEnv(t)
+
+	// The statement name and category come from the merchant's registration, not the terminal
+	payment := env.payment(1250)
+	payment.MerchantName, payment.MerchantCategory = "Somewhere Else", "inn"
+
+	resp, err := env.client.Purchase(payment)
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	if len(resp.Get(iso8583.FieldAuthorizationCode)) != 6 {
+		t.Errorf("authorization code = %q, want 6 characters", resp.Get(iso8583.FieldAuthorizationCode))
+	}
+	if resp.Get(iso8583.FieldAmount) != "000000001250" {
+		t.Errorf("field 4 = %q, want the request amount echoed", resp.Get(iso8583.FieldAmount))
+	}
+
+	env.expectBalances(t, 987.50, 1012.50)
+
+	// The card's statement shows where it was used
+	transactions, total, err := NewBankingService(env.db).GetCardTransactions(env.cardholder.ID, env.card.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("GetCardTransactions: %v", err)
+	}
+	if total != 1 || len(transactions) != 1 {
+		t.Fatalf("got %d card transactions (total %d), want 1", len(transactions), total)
+	}
+	if tx := transactions[0]; tx.Amount != -12.50 || tx.MerchantName != "Poke Mart Viridian" || tx.MerchantCategory != "item_shop" {
+		t.Errorf("card transaction = %+v, want -12.50 at Poke Mart Viridian (item_shop)", tx)
+	}
+}
+
+func TestISO8583Declines(t *testing.T) {
+	env := newISO8583TestEnv(t)
+
+	tests := []struct {
+		name   string
+		modify func(*iso8583.Payment)
+		code   string
+	}{
+		{"wrong PIN", func(p *iso8583.Payment) { p.PIN = "9999" }, iso8583.ResponseDoNotHonor},
+		{"missing PIN", func(p *iso8583.Payment) { p.PIN = "" }, iso8583.ResponseIncorrectPIN},
+		{"wrong expiry date", func(p *iso8583.Payment) { p.ExpiryDate = "12/49" }, iso8583.ResponseDoNotHonor},
+		{"expired card", func(p *iso8583.Payment) { p.ExpiryDate = "01/20" }, iso8583.ResponseExpiredCard},
+		{"unknown card", func(p *iso8583.Payment) { p.PAN = "4532000000000000" }, iso8583.ResponseDoNotHonor},
+		{"unknown merchant", func(p *iso8583.Payment) { p.MerchantID = "nobody" }, iso8583.ResponseInvalidMerchant},
+		{"unconfigured terminal", func(p *iso8583.Payment) { p.TerminalID = "ROGUE001" }, iso8583.ResponseInvalidMerchant},
+		{"another merchant", func(p *iso8583.Payment) { p.MerchantID = "ash" }, iso8583.ResponseInvalidMerchant},
+		{"insufficient funds", func(p *iso8583.Payment) { p.Amount = 500000 }, iso8583.ResponseInsufficientFunds},
+		{"zero amount", func(p *iso8583.Payment) { p.Amount = 0 }, iso8583.ResponseInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := env.payment(1000)
+			tt.modify(&payment)
+
+			resp, err := env.client.Purchase(payment)
+			expectResponse(t, resp, err, tt.code)
+			if resp.Has(iso8583.FieldAuthorizationCode) {
+				t.Errorf("declined response carries authorization code %q", resp.Get(iso8583.FieldAuthorizationCode))
+			}
+		})
+	}
+
+	env.expectBalances(t, 1000, 1000)
+}
+
+func TestISO8583UnsupportedRequests(t *testing.T) {
+	env := newISO8583TestEnv(t)
+
+	// Only goods and services purchases are supported
+	req := iso8583.NewMessage(iso8583.MTIFinancialRequest)
+	req.Set(iso8583.FieldPAN, env.card.CardNumber)
+	req.Set(iso8583.FieldProcessingCode, "010000") // Cash withdrawal
+	req.Set(iso8583.FieldAmount, "1000")
+	req.Set(iso8583.FieldExpiryDate, "2901")
+	req.Set(iso8583.FieldCardAcceptorID, env.merchant.AccountNumber)
+	resp, err := env.client.Send(req)
+	expectResponse(t, resp, err, iso8583.ResponseInvalidTransaction)
+
+	// Mandatory fields are checked before anything else
+	req = iso8583.NewMessage(iso8583.MTIAuthorizationRequest)
+	req.Set(iso8583.FieldAmount, "1000")
+	resp, err = env.client.Send(req)
+	expectResponse(t, resp, err, iso8583.ResponseFormatError)
+
+	// Unsupported message classes are answered rather than dropped
+	resp, err = env.client.Send(iso8583.NewMessage("0300"))
+	expectResponse(t, resp, err, iso8583.ResponseInvalidTransaction)
+}
+
+func TestISO8583AuthorizationAndCompletion(t *testing.T) {
+	env := newISO8583TestEnv(t)
+
+	resp, err := env.client.Authorize(env.payment(10000))
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	code := resp.Get(iso8583.FieldAuthorizationCode)
+
+	// The hold reduces the available balance but moves no money
+	env.expectBalances(t, 1000, 1000)
+	available, err := availableBalance(env.db, env.cardholder.ID)
+	if err != nil {
+		t.Fatalf("availableBalance: %v", err)
+	}
+	if available != 900 {
+		t.Errorf("available balance = %.2f, want 900.00", available)
+	}
+
+	// Completing for less than the hold releases the rest
+	resp, err = env.client.Complete(env.payment(6000), code)
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	if resp.Get(iso8583.FieldAuthorizationCode) != code {
+		t.Errorf("completion authorization code = %q, want %q", resp.Get(iso8583.FieldAuthorizationCode), code)
+	}
+	env.expectBalances(t, 940, 1060)
+
+	available, err = availableBalance(env.db, env.cardholder.ID)
+	if err != nil {
+		t.Fatalf("availableBalance: %v", err)
+	}
+	if available != 940 {
+		t.Errorf("available balance = %.2f, want 940.00", available)
+	}
+
+	// A hold can only be completed once
+	resp, err = env.client.Complete(env.payment(6000), code)
+	expectResponse(t, resp, err, iso8583.ResponseNoOriginal)
+	env.expectBalances(t, 940, 1060)
+}
+
+func TestISO8583Reversal(t *testing.T) {
+	env := newISO8583TestEnv(t)
+	terminal := env.payment(0).TerminalID
+
+	// Reversing a purchase returns the money
+	resp, err := env.client.Purchase(env.payment(3000))
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	code := resp.Get(iso8583.FieldAuthorizationCode)
+	env.expectBalances(t, 970, 1030)
+
+	// Only the merchant's own terminals can reverse its payments
+	resp, err = env.client.Reverse(env.merchant.AccountNumber, "ROGUE001", code, 3000)
+	expectResponse(t, resp, err, iso8583.ResponseInvalidMerchant)
+	env.expectBalances(t, 970, 1030)
+
+	resp, err = env.client.Reverse(env.merchant.AccountNumber, terminal, code, 3000)
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	env.expectBalances(t, 1000, 1000)
+
+	// A payment can't be reversed twice
+	resp, err = env.client.Reverse(env.merchant.AccountNumber, terminal, code, 3000)
+	expectResponse(t, resp, err, iso8583.ResponseDoNotHonor)
+	env.expectBalances(t, 1000, 1000)
+
+	// Reversing an authorization releases the hold
+	resp, err = env.client.Authorize(env.payment(5000))
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	code = resp.Get(iso8583.FieldAuthorizationCode)
+
+	resp, err = env.client.Reverse(env.merchant.AccountNumber, terminal, code, 5000)
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	available, err := availableBalance(env.db, env.cardholder.ID)
+	if err != nil {
+		t.Fatalf("availableBalance: %v", err)
+	}
+	if available != 1000 {
+		t.Errorf("available balance = %.2f, want 1000.00", available)
+	}
+
+	// Only the merchant that took the payment can reverse it, and only known codes
+	resp, err = env.client.Purchase(env.payment(1000))
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+	code = resp.Get(iso8583.FieldAuthorizationCode)
+
+	resp, err = env.client.Reverse(env.cardholder.AccountNumber, terminal, code, 1000)
+	expectResponse(t, resp, err, iso8583.ResponseInvalidMerchant)
+	resp, err = env.client.Reverse(env.merchant.AccountNumber, terminal, "ZZZZZZ", 1000)
+	expectResponse(t, resp, err, iso8583.ResponseNoOriginal)
+	env.expectBalances(t, 990, 1010)
+}
+
+func TestISO8583CardControls(t *testing.T) {
+	env := newISO8583TestEnv(t)
+
+	if _, err := env.cards.SetCardFrozen(env.cardholder.ID, env.card.ID, true); err != nil {
+		t.Fatalf("SetCardFrozen: %v", err)
+	}
+	resp, err := env.client.Purchase(env.payment(1000))
+	expectResponse(t, resp, err, iso8583.ResponseRestrictedCard)
+
+	if _, err := env.cards.SetCardFrozen(env.cardholder.ID, env.card.ID, false); err != nil {
+		t.Fatalf("SetCardFrozen: %v", err)
+	}
+	limit := 20.0
+	if _, err := env.cards.UpdateCardControls(env.cardholder.ID, env.card.ID, CardControls{TransactionLimit: &limit}); err != nil {
+		t.Fatalf("UpdateCardControls: %v", err)
+	}
+	resp, err = env.client.Purchase(env.payment(2500))
+	expectResponse(t, resp, err, iso8583.ResponseExceedsLimit)
+
+	env.expectBalances(t, 1000, 1000)
+}
+
+func TestISO8583PINLockout(t *testing.T) {
+	env := newISO8583TestEnv(t)
+
+	wrongPIN := env.payment(1000)
+	wrongPIN.PIN = "0000"
+	for i := 0; i < maxPINAttempts; i++ {
+		resp, err := env.client.Purchase(wrongPIN)
+		expectResponse(t, resp, err, iso8583.ResponseDoNotHonor)
+	}
+
+	// Even the right PIN is refused until a new one is set, with the same code as a wrong PIN so terminals can't
+	// tell a locked card from a mistyped one; only the cardholder sees the lock
+	resp, err := env.client.Purchase(env.payment(1000))
+	expectResponse(t, resp, err, iso8583.ResponseDoNotHonor)
+	if card, err := env.cards.GetCard(env.cardholder.ID, env.card.ID); err != nil || !card.PINLocked {
+		t.Fatalf("GetCard = %+v, %v; want pin_locked", card, err)
+	}
+
+	if err := env.cards.SetPIN(env.cardholder.ID, env.card.ID, testPIN); err != nil {
+		t.Fatalf("SetPIN: %v", err)
+	}
+	resp, err = env.client.Purchase(env.payment(1000))
+	expectResponse(t, resp, err, iso8583.ResponseApproved)
+}
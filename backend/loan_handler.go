@@ -0,0 +1,359 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoanHandler handles loan products, applications and repayments
+type LoanHandler struct {
+	loanService    *LoanService
+	bankingService *BankingService
+	webhookService *WebhookService
+}
+
+// NewLoanHandler creates a new LoanHandler
+func NewLoanHandler(loanService *LoanService, bankingService *BankingService, webhookService *WebhookService) *LoanHandler {
+	return &LoanHandler{
+		loanService:    loanService,
+		bankingService: bankingService,
+		webhookService: webhookService,
+	}
+}
+
+// ApplyForLoanRequest represents the request body for a loan application
+type ApplyForLoanRequest struct {
+	ProductID int     `json:"product_id" binding:"required"`
+	Amount    float64 `json:"amount" binding:"required,gt=0"`
+	Purpose   string  `json:"purpose"`
+}
+
+// LoanProductRequest represents an admin's new or changed loan product
+type LoanProductRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	AnnualRate *float64 `json:"annual_rate" binding:"required"` // Percent per year
+	TermMonths int      `json:"term_months" binding:"required,gt=0"`
+	MinAmount  float64  `json:"min_amount" binding:"required,gt=0"`
+	MaxAmount  float64  `json:"max_amount" binding:"required,gt=0"`
+	IsActive   *bool    `json:"is_active"` // Default true
+}
+
+// LoanDecisionRequest represents an admin's approval or rejection of a loan application
+type LoanDecisionRequest struct {
+	Note string `json:"note"`
+}
+
+// GetLoanProductsHandler handles GET /api/loans/products, listing the products taking applications
+func (h *LoanHandler) GetLoanProductsHandler(c *gin.Context) {
+	products, err := h.loanService.GetProducts(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get loan products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"products": products,
+	})
+}
+
+// ApplyForLoanHandler handles POST /api/loans
+func (h *LoanHandler) ApplyForLoanHandler(c *gin.Context) {
+	var req ApplyForLoanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	loan, err := h.loanService.Apply(c.GetInt("userID"), req.ProductID, req.Amount, req.Purpose)
+	if err != nil {
+		respondLoanError(c, "Failed to apply for loan", err)
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendLoanWebhook("loan_applied", loan)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Loan application submitted for approval",
+		"loan":    loan,
+	})
+}
+
+// GetLoansHandler handles GET /api/loans
+func (h *LoanHandler) GetLoansHandler(c *gin.Context) {
+	loans, err := h.loanService.GetUserLoans(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get loans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"loans":   loans,
+	})
+}
+
+// GetLoanHandler handles GET /api/loans/:id, including the amortisation schedule
+func (h *LoanHandler) GetLoanHandler(c *gin.Context) {
+	loanID, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	loan, err := h.loanService.GetLoan(loanID, c.GetInt("userID"))
+	if err != nil {
+		respondLoanError(c, "Failed to get loan", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"loan":    loan,
+	})
+}
+
+// CancelLoanHandler handles POST /api/loans/:id/cancel
+func (h *LoanHandler) CancelLoanHandler(c *gin.Context) {
+	loanID, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	user := c.MustGet("user").(*User)
+	loan, err := h.loanService.CancelLoan(loanID, user.ID, "user:"+user.Username)
+	if err != nil {
+		respondLoanError(c, "Failed to cancel loan application", err)
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendLoanWebhook("loan_cancelled", loan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Loan application withdrawn",
+		"loan":    loan,
+	})
+}
+
+// PayOffLoanHandler handles POST /api/loans/:id/payoff
+func (h *LoanHandler) PayOffLoanHandler(c *gin.Context) {
+	loanID, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	loan, transaction, err := h.loanService.PayOffLoan(loanID, c.GetInt("userID"))
+	if err != nil {
+		respondLoanError(c, "Failed to pay off loan", err)
+		return
+	}
+
+	// Send webhook notifications
+	go h.webhookService.SendTransferWebhook(transaction)
+	go h.webhookService.SendLoanWebhook("loan_paid_off", loan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Loan paid off",
+		"loan":        loan,
+		"transaction": transaction,
+	})
+}
+
+// AdminGetLoanProductsHandler handles GET /api/admin/loan-products, including products no longer offered
+func (h *LoanHandler) AdminGetLoanProductsHandler(c *gin.Context) {
+	products, err := h.loanService.GetProducts(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get loan products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"products": products,
+	})
+}
+
+// CreateLoanProductHandler handles POST /api/admin/loan-products
+func (h *LoanHandler) CreateLoanProductHandler(c *gin.Context) {
+	var req LoanProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	isActive := req.IsActive == nil || *req.IsActive
+	product, err := h.loanService.CreateProduct(req.Name, *req.AnnualRate, req.TermMonths, req.MinAmount, req.MaxAmount, isActive, c.GetString("adminActor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create loan product", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Loan product created",
+		"product": product,
+	})
+}
+
+// UpdateLoanProductHandler handles PUT /api/admin/loan-products/:id
+func (h *LoanHandler) UpdateLoanProductHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan product ID"})
+		return
+	}
+
+	var req LoanProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	isActive := req.IsActive == nil || *req.IsActive
+	product, err := h.loanService.UpdateProduct(productID, req.Name, *req.AnnualRate, req.TermMonths, req.MinAmount, req.MaxAmount, isActive)
+	if err != nil {
+		respondLoanError(c, "Failed to update loan product", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Loan product updated",
+		"product": product,
+	})
+}
+
+// AdminGetLoansHandler handles GET /api/admin/loans; optional ?status, e.g. ?status=pending
+func (h *LoanHandler) AdminGetLoansHandler(c *gin.Context) {
+	loans, err := h.loanService.GetLoans(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get loans", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"loans":   loans,
+	})
+}
+
+// AdminGetLoanHandler handles GET /api/admin/loans/:id
+func (h *LoanHandler) AdminGetLoanHandler(c *gin.Context) {
+	loanID, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	loan, err := h.loanService.GetLoanByID(loanID)
+	if err != nil {
+		respondLoanError(c, "Failed to get loan", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"loan":    loan,
+	})
+}
+
+// ApproveLoanHandler handles POST /api/admin/loans/:id/approve, paying the loan out
+func (h *LoanHandler) ApproveLoanHandler(c *gin.Context) {
+	loanID, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	// The note is optional, so the body can be empty
+	var req LoanDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	pending, err := h.loanService.GetLoanByID(loanID)
+	if err != nil {
+		respondLoanError(c, "Failed to approve loan", err)
+		return
+	}
+	balanceBefore, _ := h.bankingService.GetUserBalance(pending.UserID)
+
+	loan, transaction, err := h.loanService.ApproveLoan(loanID, req.Note, c.GetString("adminActor"))
+	if err != nil {
+		respondLoanError(c, "Failed to approve loan", err)
+		return
+	}
+
+	if balanceAfter, err := h.bankingService.GetUserBalance(loan.UserID); err == nil {
+		setAuditBalances(c, loan.UserID, balanceBefore, balanceAfter)
+	}
+
+	// Send webhook notifications
+	go h.webhookService.SendTransferWebhook(transaction)
+	go h.webhookService.SendLoanWebhook("loan_approved", loan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Loan approved and paid out",
+		"loan":        loan,
+		"transaction": transaction,
+	})
+}
+
+// RejectLoanHandler handles POST /api/admin/loans/:id/reject
+func (h *LoanHandler) RejectLoanHandler(c *gin.Context) {
+	loanID, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	// The note is optional, so the body can be empty
+	var req LoanDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	loan, err := h.loanService.RejectLoan(loanID, req.Note, c.GetString("adminActor"))
+	if err != nil {
+		respondLoanError(c, "Failed to reject loan", err)
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendLoanWebhook("loan_rejected", loan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Loan application rejected",
+		"loan":    loan,
+	})
+}
+
+// parseLoanID reads the :id parameter
+func parseLoanID(c *gin.Context) (int, bool) {
+	loanID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return 0, false
+	}
+	return loanID, true
+}
+
+// respondLoanError responds 404 for loans and products the user can't see, otherwise 400
+func respondLoanError(c *gin.Context, message string, err error) {
+	switch err {
+	case errLoanNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+	case errLoanProductNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan product not found"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+	}
+}
@@ -0,0 +1,774 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Loan statuses
+const (
+	LoanPending   = "pending"
+	LoanActive    = "active"
+	LoanPaidOff   = "paid_off"
+	LoanRejected  = "rejected"
+	LoanCancelled = "cancelled"
+)
+
+// Loan installment statuses
+const (
+	InstallmentScheduled = "scheduled"
+	InstallmentPaid      = "paid"
+	InstallmentMissed    = "missed"   // Overdue; the repayment job keeps trying to collect it
+	InstallmentPaidOff   = "paid_off" // Not yet due when the loan was paid off early, so no interest was charged
+)
+
+// maxOpenLoans limits how many loans a user can have pending or active at once
+const maxOpenLoans = 3
+
+// maxLoanTermMonths is the longest term a loan product can have
+const maxLoanTermMonths = 360
+
+// loanDateLayout is the format of installment due dates
+const loanDateLayout = "2006-01-02"
+
+// Loan errors that callers can tell apart
+var (
+	errLoanNotFound        = fmt.Errorf("loan not found")
+	errLoanProductNotFound = fmt.Errorf("loan product not found")
+)
+
+// LoanService handles loan products, applications and repayments
+type LoanService struct {
+	db      *sql.DB
+	banking *BankingService
+}
+
+// NewLoanService creates a new LoanService
+func NewLoanService(db *sql.DB, banking *BankingService) *LoanService {
+	return &LoanService{db: db, banking: banking}
+}
+
+// LoanRepayment is the repayment job's outcome for one installment
+type LoanRepayment struct {
+	Loan        *Loan
+	Installment int          // The installment's number
+	Transaction *Transaction // nil if the installment was missed
+}
+
+// CreateProduct adds a loan product; inactive products don't take applications
+func (s *LoanService) CreateProduct(name string, annualRate float64, termMonths int, minAmount, maxAmount float64, isActive bool, actor string) (*LoanProduct, error) {
+	name = strings.TrimSpace(name)
+	if err := validateLoanProduct(name, annualRate, termMonths, minAmount, maxAmount); err != nil {
+		return nil, err
+	}
+
+	var productID int
+	err := s.db.QueryRow(`
+		INSERT INTO loan_products (name, annual_rate, term_months, min_amount, max_amount, is_active, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, name, annualRate, termMonths, roundCents(minAmount), roundCents(maxAmount), isActive, actor, time.Now()).Scan(&productID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetProduct(productID)
+}
+
+// UpdateProduct changes a loan product. Loans already applied for keep the rate and term they were offered.
+func (s *LoanService) UpdateProduct(productID int, name string, annualRate float64, termMonths int, minAmount, maxAmount float64, isActive bool) (*LoanProduct, error) {
+	name = strings.TrimSpace(name)
+	if err := validateLoanProduct(name, annualRate, termMonths, minAmount, maxAmount); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE loan_products SET name = ?, annual_rate = ?, term_months = ?, min_amount = ?, max_amount = ?, is_active = ?
+		WHERE id = ?
+	`, name, annualRate, termMonths, roundCents(minAmount), roundCents(maxAmount), isActive, productID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errLoanProductNotFound
+	}
+
+	return s.GetProduct(productID)
+}
+
+// GetProduct returns a loan product
+func (s *LoanService) GetProduct(productID int) (*LoanProduct, error) {
+	products, err := s.queryProducts(`WHERE id = ?`, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, errLoanProductNotFound
+	}
+	return &products[0], nil
+}
+
+// GetProducts returns the loan products, only those taking applications if activeOnly is set
+func (s *LoanService) GetProducts(activeOnly bool) ([]LoanProduct, error) {
+	if activeOnly {
+		return s.queryProducts(`WHERE is_active = TRUE`)
+	}
+	return s.queryProducts(``)
+}
+
+// Apply records a user's application for a loan of amount under a product, for an admin to approve. The monthly
+// payment is worked out from the product's current rate and term, which the loan keeps.
+func (s *LoanService) Apply(userID, productID int, amount float64, purpose string) (*Loan, error) {
+	amount = roundCents(amount)
+	product, err := s.GetProduct(productID)
+	if err != nil {
+		return nil, err
+	}
+	if !product.IsActive {
+		return nil, fmt.Errorf("%s is not taking applications", product.Name)
+	}
+	if amount < product.MinAmount || amount > product.MaxAmount {
+		return nil, fmt.Errorf("amount must be between %.2f and %.2f", product.MinAmount, product.MaxAmount)
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkAccountCanSend(tx, userID); err != nil {
+		return nil, err
+	}
+
+	var open int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM loans WHERE user_id = ? AND status IN (?, ?)`,
+		userID, LoanPending, LoanActive).Scan(&open)
+	if err != nil {
+		return nil, err
+	}
+	if open >= maxOpenLoans {
+		return nil, fmt.Errorf("you can have at most %d loans pending or active", maxOpenLoans)
+	}
+
+	monthlyPayment, _ := amortise(amount, product.AnnualRate, product.TermMonths)
+
+	var loanID int
+	err = tx.QueryRow(`
+		INSERT INTO loans (user_id, product_id, principal, annual_rate, term_months, monthly_payment, purpose, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, productID, amount, product.AnnualRate, product.TermMonths, monthlyPayment, strings.TrimSpace(purpose),
+		LoanPending, time.Now()).Scan(&loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetLoan(loanID, userID)
+}
+
+// CancelLoan withdraws a user's pending application
+func (s *LoanService) CancelLoan(loanID, userID int, actor string) (*Loan, error) {
+	if _, err := s.GetLoan(loanID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.decide(loanID, LoanCancelled, "Withdrawn by applicant", actor); err != nil {
+		return nil, err
+	}
+	return s.GetLoan(loanID, userID)
+}
+
+// RejectLoan turns down a pending application
+func (s *LoanService) RejectLoan(loanID int, note, actor string) (*Loan, error) {
+	if err := s.decide(loanID, LoanRejected, note, actor); err != nil {
+		return nil, err
+	}
+	return s.GetLoanByID(loanID)
+}
+
+// ApproveLoan pays out a pending loan from PokéBank as a loan_disbursement, and draws up its amortisation schedule
+// with the first installment due a month from today, all in one transaction. Returns the disbursement transaction.
+func (s *LoanService) ApproveLoan(loanID int, note, actor string) (*Loan, *Transaction, error) {
+	loan, err := s.GetLoanByID(loanID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Claim the loan so it can't be paid out twice
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE loans SET status = ?, decided_by = ?, decision_note = ?, decided_at = ?
+		WHERE id = ? AND status = ?
+	`, LoanActive, actor, note, now, loanID, LoanPending)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		var status string
+		if err = tx.QueryRow(`SELECT status FROM loans WHERE id = ?`, loanID).Scan(&status); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("loan is %s", status)
+	}
+
+	var pokeBankID int
+	if err = tx.QueryRow(`SELECT id FROM users WHERE username = 'PokéBank'`).Scan(&pokeBankID); err != nil {
+		return nil, nil, err
+	}
+	var accountNumber string
+	if err = tx.QueryRow(`SELECT account_number FROM users WHERE id = ?`, loan.UserID).Scan(&accountNumber); err != nil {
+		return nil, nil, err
+	}
+
+	transactionID, err := s.banking.transferInTx(tx, pokeBankID, accountNumber, loan.Principal, "loan_disbursement", "Loan: "+loan.ProductName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = tx.Exec(`UPDATE transactions SET loan_id = ? WHERE id = ?`, loanID, transactionID); err != nil {
+		return nil, nil, err
+	}
+
+	_, installments := amortise(loan.Principal, loan.AnnualRate, loan.TermMonths)
+	for _, installment := range installments {
+		_, err = tx.Exec(`
+			INSERT INTO loan_installments (loan_id, number, due_date, principal, interest, amount, status)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, loanID, installment.Number, loanDueDate(now.UTC(), installment.Number), installment.Principal,
+			installment.Interest, installment.Amount, InstallmentScheduled)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if _, err = tx.Exec(`UPDATE loans SET disbursement_transaction_id = ? WHERE id = ?`, transactionID, loanID); err != nil {
+		return nil, nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	transaction, err := s.banking.GetTransactionByID(transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	loan, err = s.GetLoanByID(loanID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loan, transaction, nil
+}
+
+// PayOffLoan repays the rest of an active loan early: its outstanding principal, plus the interest on installments
+// already due. Installments not yet due are settled without interest.
+func (s *LoanService) PayOffLoan(loanID, userID int) (*Loan, *Transaction, error) {
+	if _, err := s.GetLoan(loanID, userID); err != nil {
+		return nil, nil, err
+	}
+	today := time.Now().UTC().Format(loanDateLayout)
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var status, productName string
+	err = tx.QueryRow(`SELECT l.status, p.name FROM loans l JOIN loan_products p ON p.id = l.product_id WHERE l.id = ?`,
+		loanID).Scan(&status, &productName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != LoanActive {
+		return nil, nil, fmt.Errorf("only active loans can be paid off")
+	}
+
+	if err = checkAccountCanSend(tx, userID); err != nil {
+		return nil, nil, err
+	}
+
+	var amount float64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(principal + CASE WHEN due_date <= ? THEN interest ELSE 0 END), 0)
+		FROM loan_installments WHERE loan_id = ? AND status IN (?, ?)
+	`, today, loanID, InstallmentScheduled, InstallmentMissed).Scan(&amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	amount = roundCents(amount)
+
+	// Check available balance, excluding held funds
+	available, err := availableBalance(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if available < amount {
+		return nil, nil, fmt.Errorf("insufficient balance to pay off the loan (%.2f needed)", amount)
+	}
+
+	transactionID, err := s.repayInTx(tx, userID, loanID, amount, "Loan payoff: "+productName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE loan_installments SET status = CASE WHEN due_date <= ? THEN ? ELSE ? END, transaction_id = ?, paid_at = ?
+		WHERE loan_id = ? AND status IN (?, ?)
+	`, today, InstallmentPaid, InstallmentPaidOff, transactionID, now, loanID, InstallmentScheduled, InstallmentMissed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = tx.Exec(`UPDATE loans SET status = ?, paid_off_at = ? WHERE id = ?`, LoanPaidOff, now, loanID); err != nil {
+		return nil, nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	transaction, err := s.banking.GetTransactionByID(transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	loan, err := s.GetLoan(loanID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loan, transaction, nil
+}
+
+// CollectRepayments runs one pass of the repayment job, debiting each installment that has fallen due from its
+// borrower's available balance. Installments the borrower can't cover, or whose account isn't active, are marked
+// missed and retried on later passes. Returns the installments collected or newly missed.
+func (s *LoanService) CollectRepayments() ([]LoanRepayment, error) {
+	today := time.Now().UTC().Format(loanDateLayout)
+	rows, err := s.db.Query(`
+		SELECT i.id
+		FROM loan_installments i
+		JOIN loans l ON l.id = i.loan_id
+		WHERE l.status = ? AND i.status IN (?, ?) AND i.due_date <= ?
+		ORDER BY i.loan_id, i.number
+	`, LoanActive, InstallmentScheduled, InstallmentMissed, today)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var installmentIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		installmentIDs = append(installmentIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	var repayments []LoanRepayment
+	for _, id := range installmentIDs {
+		repayment, err := s.collectInstallment(id)
+		if err != nil {
+			return repayments, fmt.Errorf("installment %d: %v", id, err)
+		}
+		if repayment != nil {
+			repayments = append(repayments, *repayment)
+		}
+	}
+
+	return repayments, nil
+}
+
+// collectInstallment collects one due installment, or marks it missed. Returns nil if nothing changed.
+func (s *LoanService) collectInstallment(installmentID int) (*LoanRepayment, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var loanID, userID, number, termMonths int
+	var amount float64
+	var status, productName string
+	err = tx.QueryRow(`
+		SELECT i.loan_id, l.user_id, i.number, l.term_months, i.amount, i.status, p.name
+		FROM loan_installments i
+		JOIN loans l ON l.id = i.loan_id
+		JOIN loan_products p ON p.id = l.product_id
+		WHERE i.id = ?
+	`, installmentID).Scan(&loanID, &userID, &number, &termMonths, &amount, &status, &productName)
+	if err != nil {
+		return nil, err
+	}
+
+	canPay := checkAccountCanSend(tx, userID) == nil
+	if canPay {
+		available, err := availableBalance(tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		canPay = available >= amount
+	}
+
+	var transactionID int
+	now := time.Now()
+	if canPay {
+		description := fmt.Sprintf("Loan repayment %d/%d: %s", number, termMonths, productName)
+		if transactionID, err = s.repayInTx(tx, userID, loanID, amount, description); err != nil {
+			return nil, err
+		}
+
+		// An early payoff since the installment was read settles it instead
+		result, err := tx.Exec(`UPDATE loan_installments SET status = ?, transaction_id = ?, paid_at = ? WHERE id = ? AND status = ?`,
+			InstallmentPaid, transactionID, now, installmentID, status)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, nil
+		}
+
+		// The last installment finishes the loan
+		var unpaid int
+		err = tx.QueryRow(`SELECT COUNT(*) FROM loan_installments WHERE loan_id = ? AND status IN (?, ?)`,
+			loanID, InstallmentScheduled, InstallmentMissed).Scan(&unpaid)
+		if err != nil {
+			return nil, err
+		}
+		if unpaid == 0 {
+			if _, err = tx.Exec(`UPDATE loans SET status = ?, paid_off_at = ? WHERE id = ?`, LoanPaidOff, now, loanID); err != nil {
+				return nil, err
+			}
+		}
+	} else if status == InstallmentScheduled {
+		_, err = tx.Exec(`UPDATE loan_installments SET status = ?, missed_at = ? WHERE id = ?`, InstallmentMissed, now, installmentID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Still missed
+		return nil, nil
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	repayment := &LoanRepayment{Installment: number}
+	if repayment.Loan, err = s.GetLoanByID(loanID); err != nil {
+		return nil, err
+	}
+	if transactionID != 0 {
+		if repayment.Transaction, err = s.banking.GetTransactionByID(transactionID); err != nil {
+			return nil, err
+		}
+	}
+	return repayment, nil
+}
+
+// repayInTx moves a repayment from the borrower to PokéBank and records it against the loan
+func (s *LoanService) repayInTx(tx *sql.Tx, userID, loanID int, amount float64, description string) (int, error) {
+	var pokeBankID int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE username = 'PokéBank'`).Scan(&pokeBankID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, pokeBankID); err != nil {
+		return 0, err
+	}
+
+	var transactionID int
+	err := tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, loan_id, created_at)
+		VALUES (?, ?, ?, 'loan_repayment', ?, 'completed', ?, ?)
+		RETURNING id
+	`, userID, pokeBankID, amount, description, loanID, time.Now()).Scan(&transactionID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Reset PokéBank balance since it receives the repayment
+	if err = s.banking.resetPokeBankBalanceInTx(tx, userID, pokeBankID); err != nil {
+		return 0, err
+	}
+
+	return transactionID, nil
+}
+
+// decide moves a pending application to a final status without paying it out
+func (s *LoanService) decide(loanID int, status, note, actor string) error {
+	result, err := s.db.Exec(`
+		UPDATE loans SET status = ?, decided_by = ?, decision_note = ?, decided_at = ? WHERE id = ? AND status = ?
+	`, status, actor, note, time.Now(), loanID, LoanPending)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		loan, err := s.GetLoanByID(loanID)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("loan is %s", loan.Status)
+	}
+	return nil
+}
+
+// GetLoan returns one of the user's loans with its schedule
+func (s *LoanService) GetLoan(loanID, userID int) (*Loan, error) {
+	loan, err := s.GetLoanByID(loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.UserID != userID {
+		return nil, errLoanNotFound
+	}
+	return loan, nil
+}
+
+// GetLoanByID returns any loan with its schedule
+func (s *LoanService) GetLoanByID(loanID int) (*Loan, error) {
+	loans, err := s.queryLoans(`WHERE l.id = ?`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if len(loans) == 0 {
+		return nil, errLoanNotFound
+	}
+	loan := &loans[0]
+
+	rows, err := s.db.Query(`
+		SELECT id, loan_id, number, due_date, principal, interest, amount, status, transaction_id, missed_at, paid_at
+		FROM loan_installments WHERE loan_id = ? ORDER BY number
+	`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var installment LoanInstallment
+		var transactionID sql.NullInt64
+		var missedAt, paidAt sql.NullTime
+		err := rows.Scan(&installment.ID, &installment.LoanID, &installment.Number, &installment.DueDate,
+			&installment.Principal, &installment.Interest, &installment.Amount, &installment.Status, &transactionID,
+			&missedAt, &paidAt)
+		if err != nil {
+			return nil, err
+		}
+		if transactionID.Valid {
+			id := int(transactionID.Int64)
+			installment.TransactionID = &id
+		}
+		if missedAt.Valid {
+			installment.MissedAt = &missedAt.Time
+		}
+		if paidAt.Valid {
+			installment.PaidAt = &paidAt.Time
+		}
+		loan.Schedule = append(loan.Schedule, installment)
+	}
+
+	return loan, rows.Err()
+}
+
+// GetUserLoans returns the user's loans, newest first, without their schedules
+func (s *LoanService) GetUserLoans(userID int) ([]Loan, error) {
+	return s.queryLoans(`WHERE l.user_id = ?`, userID)
+}
+
+// GetLoans returns all loans, newest first, optionally filtered by status
+func (s *LoanService) GetLoans(status string) ([]Loan, error) {
+	if status != "" {
+		return s.queryLoans(`WHERE l.status = ?`, status)
+	}
+	return s.queryLoans(``)
+}
+
+// loanSelect selects loans with their borrower, product and repayment totals; its first parameter is today's date
+const loanSelect = `
+	SELECT l.id, l.user_id, l.product_id, l.principal, l.annual_rate, l.term_months, l.monthly_payment,
+	       COALESCE(l.purpose, ''), l.status, COALESCE(l.decided_by, ''), COALESCE(l.decision_note, ''),
+	       l.disbursement_transaction_id, l.created_at, l.decided_at, l.paid_off_at, u.username, p.name,
+	       COALESCE(SUM(CASE WHEN i.status IN ('scheduled', 'missed') THEN i.principal END), 0),
+	       COALESCE(SUM(CASE WHEN i.status IN ('scheduled', 'missed') AND i.due_date <= ? THEN i.interest END), 0),
+	       COUNT(CASE WHEN i.status = 'missed' THEN 1 END)
+	FROM loans l
+	JOIN users u ON u.id = l.user_id
+	JOIN loan_products p ON p.id = l.product_id
+	LEFT JOIN loan_installments i ON i.loan_id = l.id
+`
+
+// queryLoans selects the loans matching the WHERE clause, newest first
+func (s *LoanService) queryLoans(where string, args ...interface{}) ([]Loan, error) {
+	args = append([]interface{}{time.Now().UTC().Format(loanDateLayout)}, args...)
+	rows, err := s.db.Query(loanSelect+where+` GROUP BY l.id ORDER BY l.created_at DESC, l.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loans := []Loan{}
+	for rows.Next() {
+		var loan Loan
+		var disbursementID sql.NullInt64
+		var decidedAt, paidOffAt sql.NullTime
+		var dueInterest float64
+		err := rows.Scan(&loan.ID, &loan.UserID, &loan.ProductID, &loan.Principal, &loan.AnnualRate, &loan.TermMonths,
+			&loan.MonthlyPayment, &loan.Purpose, &loan.Status, &loan.DecidedBy, &loan.DecisionNote, &disbursementID,
+			&loan.CreatedAt, &decidedAt, &paidOffAt, &loan.Username, &loan.ProductName, &loan.OutstandingPrincipal,
+			&dueInterest, &loan.MissedPayments)
+		if err != nil {
+			return nil, err
+		}
+
+		if disbursementID.Valid {
+			id := int(disbursementID.Int64)
+			loan.DisbursementTransactionID = &id
+		}
+		if decidedAt.Valid {
+			loan.DecidedAt = &decidedAt.Time
+		}
+		if paidOffAt.Valid {
+			loan.PaidOffAt = &paidOffAt.Time
+		}
+		switch loan.Status {
+		case LoanPending:
+			loan.OutstandingPrincipal = loan.Principal
+		case LoanActive:
+			loan.OutstandingPrincipal = roundCents(loan.OutstandingPrincipal)
+			loan.PayoffAmount = roundCents(loan.OutstandingPrincipal + dueInterest)
+		}
+		loans = append(loans, loan)
+	}
+
+	return loans, rows.Err()
+}
+
+// queryProducts selects the loan products matching the WHERE clause
+func (s *LoanService) queryProducts(where string, args ...interface{}) ([]LoanProduct, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, annual_rate, term_months, min_amount, max_amount, is_active, created_by, created_at
+		FROM loan_products `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []LoanProduct{}
+	for rows.Next() {
+		var product LoanProduct
+		err := rows.Scan(&product.ID, &product.Name, &product.AnnualRate, &product.TermMonths, &product.MinAmount,
+			&product.MaxAmount, &product.IsActive, &product.CreatedBy, &product.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+// closeUserLoansInTx withdraws a closing account's pending applications. Accounts with a loan still being repaid
+// can't be closed.
+func closeUserLoansInTx(tx *sql.Tx, userID int) error {
+	var active int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM loans WHERE user_id = ? AND status = ?`, userID, LoanActive).Scan(&active)
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return fmt.Errorf("accounts with an outstanding loan cannot be closed until it is paid off")
+	}
+
+	_, err = tx.Exec(`UPDATE loans SET status = ?, decision_note = 'Account closed', decided_at = ? WHERE user_id = ? AND status = ?`,
+		LoanCancelled, time.Now(), userID, LoanPending)
+	return err
+}
+
+// amortise splits a loan into equal monthly payments, each paying the month's interest on the principal still
+// owed and repaying some of the principal. The last installment repays whatever rounding left over. Returns the
+// monthly payment and the installments, without due dates.
+func amortise(principal, annualRate float64, termMonths int) (float64, []LoanInstallment) {
+	monthlyRate := annualRate / 100 / 12
+	payment := principal / float64(termMonths)
+	if monthlyRate > 0 {
+		payment = principal * monthlyRate / (1 - math.Pow(1+monthlyRate, -float64(termMonths)))
+	}
+	payment = roundCents(payment)
+
+	installments := make([]LoanInstallment, termMonths)
+	owed := principal
+	for i := range installments {
+		interest := roundCents(owed * monthlyRate)
+		repaid := roundCents(payment - interest)
+		if i == termMonths-1 || repaid > owed {
+			repaid = owed
+		}
+		owed = roundCents(owed - repaid)
+
+		installments[i] = LoanInstallment{
+			Number:    i + 1,
+			Principal: repaid,
+			Interest:  interest,
+			Amount:    roundCents(repaid + interest),
+			Status:    InstallmentScheduled,
+		}
+	}
+
+	return payment, installments
+}
+
+// loanDueDate returns the date months after start, on the same day of the month or the month's last day if it is
+// shorter
+func loanDueDate(start time.Time, months int) string {
+	month := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	day := start.Day()
+	if lastDay := month.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, time.UTC).Format(loanDateLayout)
+}
+
+// validateLoanProduct checks a loan product's terms
+func validateLoanProduct(name string, annualRate float64, termMonths int, minAmount, maxAmount float64) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if annualRate < 0 || annualRate > maxInterestRate {
+		return fmt.Errorf("annual rate must be between 0 and %d percent", maxInterestRate)
+	}
+	if termMonths < 1 || termMonths > maxLoanTermMonths {
+		return fmt.Errorf("term must be between 1 and %d months", maxLoanTermMonths)
+	}
+	if minAmount <= 0 || maxAmount < minAmount {
+		return fmt.Errorf("amounts must be positive, with max_amount at least min_amount")
+	}
+	return nil
+}
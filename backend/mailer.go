@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain-text emails to users
+type Mailer interface {
+	SendMail(to, subject, body string) error
+}
+
+// NewMailer creates the mailer configured by the environment.
+// SMTP is used when SMTP_HOST is set, otherwise emails are written to MAIL_LOG_PATH (or the log).
+func NewMailer() Mailer {
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		return &SMTPMailer{
+			host:     host,
+			port:     getEnv("SMTP_PORT", "587"),
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+			from:     getEnv("MAIL_FROM", "no-reply@viridiancitybank.local"),
+		}
+	}
+
+	return &LogMailer{path: os.Getenv("MAIL_LOG_PATH")}
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// SendMail sends an email through the configured SMTP server
+func (m *SMTPMailer) SendMail(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(m.host+":"+m.port, auth, m.from, []string{to}, []byte(message))
+}
+
+// LogMailer writes emails to a file, or to the log if no path is set. Useful for development and tests.
+type LogMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+// SendMail appends the email to the mail log
+func (m *LogMailer) SendMail(to, subject, body string) error {
+	entry := fmt.Sprintf("To: %s\nSubject: %s\nDate: %s\n\n%s\n\n", to, subject, time.Now().Format(time.RFC1123Z), body)
+
+	if m.path == "" {
+		log.Printf("Email (not sent):\n%s", entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(entry)
+	return err
+}
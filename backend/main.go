@@ -1,8 +1,11 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -27,27 +30,151 @@ func main() {
 	}
 	defer db.Close()
 
+	// Command-line tools
+	if len(os.Args) > 1 {
+		runCommand(db, os.Args[1])
+		return
+	}
+
 	// Initialize services
 	userService := NewUserService(db)
 	bankingService := NewBankingService(db)
 	cardService := NewCardService(db)
 	webhookService := NewWebhookService()
+	oauthService := NewOAuthService(db, userService)
+	mailer := NewMailer()
+	credentialService := NewAdminCredentialService(db)
+	auditService := NewAuditService(db)
+	merchantService := NewMerchantService(db)
+	cardPaymentService := NewCardPaymentService(db, cardService, bankingService)
+	paymentLinkService := NewPaymentLinkService(db, bankingService)
+	invoiceService := NewInvoiceService(db, bankingService)
+	escrowService := NewEscrowService(db, bankingService)
+	savingsService := NewSavingsService(db, bankingService)
+	sharedAccountService := NewSharedAccountService(db, bankingService)
+	loanService := NewLoanService(db, bankingService)
 
 	// Initialize handlers
-	authHandler := NewAuthHandler(userService, webhookService)
-	bankingHandler := NewBankingHandler(bankingService, userService, webhookService, cardService)
-	adminHandler := NewAdminHandler(bankingService, userService, webhookService)
+	authHandler := NewAuthHandler(userService, webhookService, mailer)
+	bankingHandler := NewBankingHandler(bankingService, userService, webhookService, cardService, sharedAccountService)
+	adminHandler := NewAdminHandler(bankingService, userService, webhookService, credentialService, auditService, merchantService)
+	merchantHandler := NewMerchantHandler(merchantService, userService)
+	merchantAPIHandler := NewMerchantAPIHandler(merchantService, bankingService, cardPaymentService, userService, webhookService)
+	oauthHandler := NewOAuthHandler(oauthService, userService, webhookService)
+	cardHandler := NewCardHandler(cardService, bankingService, userService, webhookService)
+	cardPaymentHandler := NewCardPaymentHandler(cardPaymentService, bankingService, webhookService)
+	paymentLinkHandler := NewPaymentLinkHandler(paymentLinkService, webhookService)
+	qrHandler := NewQRHandler(bankingService, userService)
+	paymentRequestGroupHandler := NewPaymentRequestGroupHandler(bankingService, userService, webhookService)
+	invoiceHandler := NewInvoiceHandler(invoiceService, userService, webhookService, mailer)
+	escrowHandler := NewEscrowHandler(escrowService, userService, webhookService)
+	savingsHandler := NewSavingsHandler(savingsService, webhookService)
+	sharedAccountHandler := NewSharedAccountHandler(sharedAccountService, userService, webhookService)
+	loanHandler := NewLoanHandler(loanService, bankingService, webhookService)
 
 	// Ensure PokéBank has fixed balance on startup
 	bankingService.EnsurePokeBankBalance()
 
+	// PokéBank login uses its own password, independent of admin credentials. Without POKEBANK_PASSWORD,
+	// a password set through the admin API is kept.
+	if password := getEnv("POKEBANK_PASSWORD", ""); password != "" {
+		err = userService.ConfigurePokeBankLogin(password)
+	} else {
+		err = userService.DisableLegacyPokeBankLogin()
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to configure PokéBank login: %v", err)
+	}
+
+	// Release card holds that were never captured
+	runPeriodically("expire card holds", time.Minute, func() error {
+		expired, err := cardPaymentService.ExpireHolds()
+		for i := range expired {
+			go webhookService.SendCardAuthorizationWebhook("card_hold_expired", &expired[i])
+		}
+		return err
+	})
+
+	// Deactivate expired cards and reissue cards that are about to expire
+	runPeriodically("card expiry", time.Hour, func() error {
+		events, err := cardService.ProcessCardExpiry()
+		for _, event := range events {
+			go webhookService.SendCardLifecycleWebhook(event)
+		}
+		return err
+	})
+
+	// Expire stale payment requests
+	runPeriodically("payment request expiry", time.Minute, func() error {
+		expired, err := bankingService.ExpirePaymentRequests()
+		for i := range expired {
+			go webhookService.SendPaymentRequestEventWebhook("payment_request_expired", &expired[i], nil)
+		}
+		return err
+	})
+
+	// Remind payers about payment requests they haven't dealt with
+	runPeriodically("payment request reminders", time.Hour, func() error {
+		reminded, err := bankingService.RemindPaymentRequests()
+		for i := range reminded {
+			go webhookService.SendPaymentRequestEventWebhook("payment_request_reminder", &reminded[i], nil)
+			go sendPaymentRequestReminder(mailer, &reminded[i])
+		}
+		return err
+	})
+
+	// Mark unpaid invoices overdue and remind their recipients
+	runPeriodically("invoice reminders", time.Hour, func() error {
+		events, err := invoiceService.ProcessInvoiceReminders()
+		for i := range events {
+			invoiceHandler.NotifyInvoice(events[i].Event, &events[i].Invoice)
+		}
+		return err
+	})
+
+	// Settle escrows that were neither released nor refunded in time
+	runPeriodically("escrow timeouts", time.Minute, func() error {
+		settled, err := escrowService.ProcessEscrowTimeouts()
+		for i := range settled {
+			go webhookService.SendEscrowWebhook("escrow_"+settled[i].Status, &settled[i])
+		}
+		return err
+	})
+
+	// Pay interest on savings pots; each day is only accrued once, so running hourly catches up after downtime
+	runPeriodically("savings interest", time.Hour, func() error {
+		payments, err := savingsService.AccrueInterest()
+		for i := range payments {
+			go webhookService.SendTransferWebhook(&payments[i])
+		}
+		return err
+	})
+
+	// Collect loan repayments as they fall due, retrying missed ones until the borrower can cover them
+	runPeriodically("loan repayments", time.Hour, func() error {
+		repayments, err := loanService.CollectRepayments()
+		for i := range repayments {
+			repayment := repayments[i]
+			switch {
+			case repayment.Transaction == nil:
+				go webhookService.SendLoanWebhook("loan_payment_missed", repayment.Loan)
+			case repayment.Loan.Status == LoanPaidOff:
+				go webhookService.SendTransferWebhook(repayment.Transaction)
+				go webhookService.SendLoanWebhook("loan_paid_off", repayment.Loan)
+			default:
+				go webhookService.SendTransferWebhook(repayment.Transaction)
+			}
+		}
+		return err
+	})
+
 	// Initialize Gin router
 	r := gin.Default()
 
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if c.Request.Method == "OPTIONS" {
@@ -68,6 +195,14 @@ func main() {
 	r.StaticFile("/", "./index.html")
 	r.StaticFile("/debug_test.html", "./debug_test.html")
 
+	// OAuth2 consent page
+	r.StaticFile("/oauth/authorize", "./oauth_consent.html")
+
+	// Payment link checkout page
+	r.GET("/pay/:code", func(c *gin.Context) {
+		c.File("./pay.html")
+	})
+
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -79,33 +214,190 @@ func main() {
 		// Authentication routes
 		api.POST("/register", authHandler.Register)
 		api.POST("/login", authHandler.Login)
-		api.POST("/change-password", authMiddleware(), authHandler.ChangePassword)
+		api.POST("/change-password", authMiddleware(), requireSession(), authHandler.ChangePassword)
+		api.POST("/password-reset/request", authHandler.RequestPasswordReset)
+		api.POST("/password-reset/confirm", authHandler.ConfirmPasswordReset)
+		api.GET("/verify-email", authHandler.VerifyEmail)
+		api.POST("/verify-email", authHandler.VerifyEmail)
+		api.POST("/verify-email/resend", authMiddleware(), requireSession(), authHandler.ResendVerificationEmail)
+
+		// OAuth2 authorization server routes
+		api.POST("/oauth/token", oauthHandler.TokenHandler)
+		api.POST("/oauth/revoke", oauthHandler.RevokeHandler)
+		api.POST("/oauth/introspect", oauthHandler.IntrospectHandler)
+		api.GET("/oauth/authorize", authMiddleware(), requireSession(), oauthHandler.GetAuthorizationHandler)
+		api.POST("/oauth/authorize", authMiddleware(), requireSession(), oauthHandler.AuthorizeHandler)
+
+		// Merchant-facing card payment routes (require a merchant API key; the card details authorize the charge)
+		cardPayments := api.Group("/card-payments")
+		cardPayments.Use(merchantAuthMiddleware())
+		{
+			cardPayments.POST("/authorize", cardPaymentHandler.AuthorizeHandler)
+			cardPayments.POST("/:code/capture", cardPaymentHandler.CaptureHandler)
+			cardPayments.POST("/:code/void", cardPaymentHandler.VoidHandler)
+		}
 
-		// Protected banking routes
+		// Payment link routes used by the checkout page
+		api.GET("/pay/:code", paymentLinkHandler.GetPublicPaymentLinkHandler)
+		api.POST("/pay/:code", authMiddleware(), requireSession(), paymentLinkHandler.PayPaymentLinkHandler)
+
+		// Merchant API routes (require a merchant API key)
+		merchantAPI := api.Group("/merchant")
+		merchantAPI.Use(merchantAuthMiddleware())
+		{
+			merchantAPI.GET("", merchantAPIHandler.GetMerchantHandler)
+			merchantAPI.POST("/charges", merchantAPIHandler.CreateChargeHandler)
+			merchantAPI.GET("/payment-requests", merchantAPIHandler.GetPaymentRequestsHandler)
+			merchantAPI.GET("/transactions", merchantAPIHandler.GetTransactionsHandler)
+			merchantAPI.POST("/transactions/:id/refund", merchantAPIHandler.RefundHandler)
+			merchantAPI.POST("/payment-links", paymentLinkHandler.CreatePaymentLinkHandler)
+			merchantAPI.GET("/payment-links", paymentLinkHandler.GetPaymentLinksHandler)
+			merchantAPI.GET("/payment-links/callback-secret", paymentLinkHandler.GetCallbackSecretHandler)
+			merchantAPI.DELETE("/payment-links/:code", paymentLinkHandler.DeactivatePaymentLinkHandler)
+		}
+
+		// Protected banking routes (OAuth access tokens need the matching scope)
 		protected := api.Group("/")
-		protected.Use(authMiddleware())
+		protected.Use(authMiddleware(), sharedAccountMiddleware(sharedAccountService, userService))
 		{
-			protected.GET("/account", bankingHandler.GetAccountInfoHandler)
-			protected.GET("/balance", bankingHandler.GetBalanceHandler)
-			protected.POST("/transfer", bankingHandler.TransferHandler)
-			protected.GET("/transactions", bankingHandler.GetTransactionsHandler)
-			protected.POST("/payment-requests", bankingHandler.CreatePaymentRequestHandler)
-			protected.GET("/payment-requests", bankingHandler.GetPaymentRequestsHandler)
-			protected.PUT("/payment-requests/:id", bankingHandler.HandlePaymentRequestHandler)
-			protected.GET("/card", bankingHandler.GetCardHandler)
-			protected.POST("/card/refresh", bankingHandler.RefreshCardHandler)
+			protected.GET("/account", requireScope(ScopeAccountRead), bankingHandler.GetAccountInfoHandler)
+			protected.GET("/balance", requireScope(ScopeAccountRead), bankingHandler.GetBalanceHandler)
+			protected.POST("/account/close", requireSession(), bankingHandler.CloseAccountHandler)
+			protected.POST("/transfer", requireScope(ScopeTransfer), bankingHandler.TransferHandler)
+			protected.GET("/transactions", requireScope(ScopeTransactionsRead), bankingHandler.GetTransactionsHandler)
+			protected.POST("/transactions/:id/refund", requireScope(ScopeTransfer), bankingHandler.RefundTransactionHandler)
+			protected.POST("/payment-requests", requireScope(ScopePaymentRequests), bankingHandler.CreatePaymentRequestHandler)
+			protected.GET("/payment-requests", requireScope(ScopePaymentRequests), bankingHandler.GetPaymentRequestsHandler)
+			protected.GET("/payment-requests/:id", requireScope(ScopePaymentRequests), bankingHandler.GetPaymentRequestHandler)
+			protected.PUT("/payment-requests/:id", requireScope(ScopePaymentRequests), bankingHandler.HandlePaymentRequestHandler)
+			protected.POST("/payment-request-groups", requireScope(ScopePaymentRequests), paymentRequestGroupHandler.CreatePaymentRequestGroupHandler)
+			protected.GET("/payment-request-groups", requireScope(ScopePaymentRequests), paymentRequestGroupHandler.GetPaymentRequestGroupsHandler)
+			protected.GET("/payment-request-groups/:id", requireScope(ScopePaymentRequests), paymentRequestGroupHandler.GetPaymentRequestGroupHandler)
+			protected.POST("/payment-request-groups/:id/cancel", requireScope(ScopePaymentRequests), paymentRequestGroupHandler.CancelPaymentRequestGroupHandler)
+			protected.GET("/payment-requests/:id/qr", requireScope(ScopePaymentRequests), qrHandler.GetPaymentRequestQRHandler)
+			protected.GET("/qr/account", requireScope(ScopeAccountRead), qrHandler.GetAccountQRHandler)
+			protected.POST("/qr/parse", requireScope(ScopeTransfer), qrHandler.ParsePaymentURIHandler)
+			protected.POST("/payment-links", requireScope(ScopePaymentRequests), paymentLinkHandler.CreatePaymentLinkHandler)
+			protected.GET("/payment-links", requireScope(ScopePaymentRequests), paymentLinkHandler.GetPaymentLinksHandler)
+			protected.GET("/payment-links/callback-secret", requireScope(ScopePaymentRequests), paymentLinkHandler.GetCallbackSecretHandler)
+			protected.DELETE("/payment-links/:code", requireScope(ScopePaymentRequests), paymentLinkHandler.DeactivatePaymentLinkHandler)
+			protected.POST("/invoices", requireScope(ScopePaymentRequests), invoiceHandler.CreateInvoiceHandler)
+			protected.GET("/invoices", requireScope(ScopePaymentRequests), invoiceHandler.GetInvoicesHandler)
+			protected.GET("/invoices/:id", requireScope(ScopePaymentRequests), invoiceHandler.GetInvoiceHandler)
+			protected.PUT("/invoices/:id", requireScope(ScopePaymentRequests), invoiceHandler.UpdateInvoiceHandler)
+			protected.POST("/invoices/:id/send", requireScope(ScopePaymentRequests), invoiceHandler.SendInvoiceHandler)
+			protected.POST("/invoices/:id/void", requireScope(ScopePaymentRequests), invoiceHandler.VoidInvoiceHandler)
+			protected.POST("/invoices/:id/remind", requireScope(ScopePaymentRequests), invoiceHandler.RemindInvoiceHandler)
+			protected.POST("/invoices/:id/pay", requireScope(ScopeTransfer), invoiceHandler.PayInvoiceHandler)
+			protected.POST("/escrows", requireScope(ScopeTransfer), escrowHandler.CreateEscrowHandler)
+			protected.GET("/escrows", requireScope(ScopeTransactionsRead), escrowHandler.GetEscrowsHandler)
+			protected.GET("/escrows/:id", requireScope(ScopeTransactionsRead), escrowHandler.GetEscrowHandler)
+			protected.POST("/escrows/:id/release", requireScope(ScopeTransfer), escrowHandler.ReleaseEscrowHandler)
+			protected.POST("/escrows/:id/refund", requireScope(ScopeTransfer), escrowHandler.RefundEscrowHandler)
+			protected.POST("/escrows/:id/dispute", requireScope(ScopeTransfer), escrowHandler.DisputeEscrowHandler)
+			protected.GET("/pots", requireScope(ScopeAccountRead), savingsHandler.GetPotsHandler)
+			protected.POST("/pots", requireScope(ScopeTransfer), savingsHandler.CreatePotHandler)
+			protected.POST("/pots/move", requireScope(ScopeTransfer), savingsHandler.MovePotFundsHandler)
+			protected.GET("/pots/:id", requireScope(ScopeAccountRead), savingsHandler.GetPotHandler)
+			protected.PATCH("/pots/:id", requireScope(ScopeTransfer), savingsHandler.UpdatePotHandler)
+			protected.DELETE("/pots/:id", requireScope(ScopeTransfer), savingsHandler.ClosePotHandler)
+			protected.POST("/shared-accounts", requireSession(), sharedAccountHandler.CreateSharedAccountHandler)
+			protected.GET("/shared-accounts", requireScope(ScopeAccountRead), sharedAccountHandler.GetSharedAccountsHandler)
+			protected.GET("/shared-accounts/:id", requireScope(ScopeAccountRead), sharedAccountHandler.GetSharedAccountHandler)
+			protected.PATCH("/shared-accounts/:id", requireSession(), sharedAccountHandler.UpdateSharedAccountHandler)
+			protected.POST("/shared-accounts/:id/members", requireSession(), sharedAccountHandler.AddMemberHandler)
+			protected.PUT("/shared-accounts/:id/members/:user_id", requireSession(), sharedAccountHandler.UpdateMemberHandler)
+			protected.DELETE("/shared-accounts/:id/members/:user_id", requireSession(), sharedAccountHandler.RemoveMemberHandler)
+			protected.GET("/shared-accounts/:id/transfers", requireScope(ScopeTransactionsRead), sharedAccountHandler.GetSharedTransfersHandler)
+			protected.POST("/shared-accounts/:id/transfers/:transfer_id/approve", requireScope(ScopeTransfer), sharedAccountHandler.ApproveSharedTransferHandler)
+			protected.POST("/shared-accounts/:id/transfers/:transfer_id/reject", requireScope(ScopeTransfer), sharedAccountHandler.RejectSharedTransferHandler)
+			protected.POST("/shared-accounts/:id/transfers/:transfer_id/cancel", requireScope(ScopeTransfer), sharedAccountHandler.CancelSharedTransferHandler)
+			protected.GET("/loans/products", requireScope(ScopeAccountRead), loanHandler.GetLoanProductsHandler)
+			protected.POST("/loans", requireSession(), loanHandler.ApplyForLoanHandler)
+			protected.GET("/loans", requireScope(ScopeAccountRead), loanHandler.GetLoansHandler)
+			protected.GET("/loans/:id", requireScope(ScopeAccountRead), loanHandler.GetLoanHandler)
+			protected.POST("/loans/:id/cancel", requireScope(ScopeTransfer), loanHandler.CancelLoanHandler)
+			protected.POST("/loans/:id/payoff", requireScope(ScopeTransfer), loanHandler.PayOffLoanHandler)
+			protected.GET("/card", requireScope(ScopeCard), bankingHandler.GetCardHandler)
+			protected.POST("/card/refresh", requireScope(ScopeCard), bankingHandler.RefreshCardHandler)
+			protected.POST("/card/pin", requireSession(), cardHandler.SetCardPINHandler)
+			protected.POST("/card/freeze", requireScope(ScopeCard), cardHandler.FreezeCardHandler)
+			protected.POST("/card/unfreeze", requireSession(), cardHandler.UnfreezeCardHandler)
+			protected.PUT("/card/controls", requireSession(), cardHandler.UpdateCardControlsHandler)
+			protected.GET("/cards", requireScope(ScopeCard), cardHandler.GetCardsHandler)
+			protected.POST("/cards", requireScope(ScopeCard), cardHandler.CreateCardHandler)
+			protected.GET("/cards/:id", requireScope(ScopeCard), cardHandler.GetCardByIDHandler)
+			protected.PATCH("/cards/:id", requireScope(ScopeCard), cardHandler.RenameCardHandler)
+			protected.GET("/cards/:id/transactions", requireScope(ScopeTransactionsRead), cardHandler.GetCardTransactionsHandler)
+			protected.DELETE("/cards/:id", requireScope(ScopeCard), cardHandler.DeleteCardHandler)
+			protected.POST("/cards/:id/pin", requireSession(), cardHandler.SetCardPINHandler)
+			protected.POST("/cards/:id/freeze", requireScope(ScopeCard), cardHandler.FreezeCardHandler)
+			protected.POST("/cards/:id/unfreeze", requireSession(), cardHandler.UnfreezeCardHandler)
+			protected.PUT("/cards/:id/controls", requireSession(), cardHandler.UpdateCardControlsHandler)
+			protected.GET("/merchants", requireSession(), merchantHandler.GetOwnedMerchantsHandler)
+			protected.POST("/merchants/:id/keys", requireSession(), merchantHandler.CreateAPIKeyHandler)
+			protected.GET("/merchants/:id/keys", requireSession(), merchantHandler.GetAPIKeysHandler)
+			protected.DELETE("/merchants/:id/keys/:key_id", requireSession(), merchantHandler.RevokeAPIKeyHandler)
 		}
 
-		// Admin routes (require admin authentication)
+		// Admin routes (require an admin credential or staff session, plus a per-route permission)
 		admin := api.Group("/admin")
-		admin.Use(adminAuthMiddleware())
+		admin.Use(adminAuthMiddleware(), auditMiddleware(auditService))
 		{
-			admin.POST("/adjust-balance", adminHandler.AdjustBalanceHandler)
-			admin.POST("/merchant-transaction", adminHandler.CreateMerchantTransactionHandler)
-			admin.POST("/bank-transfer", adminHandler.BankTransferHandler)
-			admin.GET("/users", adminHandler.GetAllUsersHandler)
-			admin.GET("/user/:account", adminHandler.GetUserByAccountHandler)
+			admin.POST("/adjust-balance", requirePermission(PermAdjustBalance), adminHandler.AdjustBalanceHandler)
+			admin.POST("/merchant-transaction", requirePermission(PermMerchantTransaction), adminHandler.CreateMerchantTransactionHandler)
+			admin.POST("/bank-transfer", requirePermission(PermBankTransfer), adminHandler.BankTransferHandler)
+			admin.POST("/transactions/:id/reverse", requirePermission(PermReverseTransactions), adminHandler.ReverseTransactionHandler)
+			admin.GET("/users", requirePermission(PermViewUsers), adminHandler.GetAllUsersHandler)
+			admin.GET("/user/:account", requirePermission(PermViewUsers), adminHandler.GetUserByAccountHandler)
+			admin.GET("/audit-log", requirePermission(PermViewAuditLog), adminHandler.GetAuditLogHandler)
+			admin.PUT("/users/:id/role", requirePermission(PermManageRoles), adminHandler.UpdateUserRoleHandler)
+			admin.PUT("/users/:id/status", requirePermission(PermManageAccounts), adminHandler.UpdateAccountStatusHandler)
+			admin.GET("/users/:id/status-history", requirePermission(PermViewUsers), adminHandler.GetAccountStatusHistoryHandler)
+			admin.POST("/users/:id/close", requirePermission(PermCloseAccounts), adminHandler.CloseAccountHandler)
+			admin.POST("/credentials", requirePermission(PermManageCredentials), adminHandler.CreateCredentialHandler)
+			admin.GET("/credentials", requirePermission(PermManageCredentials), adminHandler.GetCredentialsHandler)
+			admin.DELETE("/credentials/:id", requirePermission(PermManageCredentials), adminHandler.RevokeCredentialHandler)
+			admin.POST("/pokebank/password", requirePermission(PermManageCredentials), adminHandler.SetPokeBankPasswordHandler)
+			admin.POST("/merchants", requirePermission(PermManageMerchants), merchantHandler.CreateMerchantHandler)
+			admin.GET("/merchants", requirePermission(PermManageMerchants), merchantHandler.GetMerchantsHandler)
+			admin.GET("/merchants/:id", requirePermission(PermManageMerchants), merchantHandler.GetMerchantHandler)
+			admin.PUT("/merchants/:id", requirePermission(PermManageMerchants), merchantHandler.UpdateMerchantHandler)
+			admin.DELETE("/merchants/:id", requirePermission(PermManageMerchants), merchantHandler.DeactivateMerchantHandler)
+			admin.POST("/merchants/:id/keys", requirePermission(PermManageMerchants), merchantHandler.CreateAPIKeyHandler)
+			admin.GET("/merchants/:id/keys", requirePermission(PermManageMerchants), merchantHandler.GetAPIKeysHandler)
+			admin.DELETE("/merchants/:id/keys/:key_id", requirePermission(PermManageMerchants), merchantHandler.RevokeAPIKeyHandler)
+			admin.GET("/escrows", requirePermission(PermResolveEscrows), escrowHandler.AdminGetEscrowsHandler)
+			admin.GET("/escrows/:id", requirePermission(PermResolveEscrows), escrowHandler.AdminGetEscrowHandler)
+			admin.POST("/escrows/:id/resolve", requirePermission(PermResolveEscrows), escrowHandler.ResolveEscrowHandler)
+			admin.GET("/savings-rates", requirePermission(PermManageSavingsRates), savingsHandler.GetSavingsRatesHandler)
+			admin.PUT("/savings-rates/:pot_type", requirePermission(PermManageSavingsRates), savingsHandler.SetSavingsRateHandler)
+			admin.GET("/loan-products", requirePermission(PermManageLoans), loanHandler.AdminGetLoanProductsHandler)
+			admin.POST("/loan-products", requirePermission(PermManageLoans), loanHandler.CreateLoanProductHandler)
+			admin.PUT("/loan-products/:id", requirePermission(PermManageLoans), loanHandler.UpdateLoanProductHandler)
+			admin.GET("/loans", requirePermission(PermManageLoans), loanHandler.AdminGetLoansHandler)
+			admin.GET("/loans/:id", requirePermission(PermManageLoans), loanHandler.AdminGetLoanHandler)
+			admin.POST("/loans/:id/approve", requirePermission(PermManageLoans), loanHandler.ApproveLoanHandler)
+			admin.POST("/loans/:id/reject", requirePermission(PermManageLoans), loanHandler.RejectLoanHandler)
+			admin.POST("/oauth/clients", requirePermission(PermManageOAuthClients), oauthHandler.CreateClientHandler)
+			admin.GET("/oauth/clients", requirePermission(PermManageOAuthClients), oauthHandler.GetClientsHandler)
+			admin.DELETE("/oauth/clients/:client_id", requirePermission(PermManageOAuthClients), oauthHandler.DeleteClientHandler)
+		}
+	}
+
+	// Card network simulator for point-of-sale terminals (optional)
+	if addr := getEnv("ISO8583_LISTEN_ADDR", ""); addr != "" {
+		terminals, err := ParseISO8583Terminals(getEnv("ISO8583_TERMINALS", ""))
+		if err != nil {
+			log.Fatalf("Invalid ISO8583_TERMINALS: %v", err)
 		}
+		isoServer := NewISO8583Server(cardPaymentService, userService, webhookService, terminals)
+		go func() {
+			log.Printf("ISO 8583 card network simulator listening on %s", addr)
+			if err := isoServer.ListenAndServe(addr); err != nil {
+				log.Printf("ISO 8583 card network simulator stopped: %v", err)
+			}
+		}()
 	}
 
 	// Start server
@@ -113,3 +405,21 @@ func main() {
 	log.Printf("Server starting on port %s", port)
 	log.Fatal(r.Run(":" + port))
 }
+
+// runCommand runs a command-line tool instead of the server
+func runCommand(db *sql.DB, command string) {
+	switch command {
+	case "verify-audit-log":
+		checked, err := NewAuditService(db).Verify()
+		if err != nil {
+			fmt.Printf("Audit log verification FAILED after %d valid entries: %v\n", checked, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Audit log OK: %d entries verified\n", checked)
+
+	default:
+		fmt.Printf("Unknown command: %s\n", command)
+		fmt.Println("Available commands: verify-audit-log")
+		os.Exit(2)
+	}
+}
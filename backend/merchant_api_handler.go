@@ -0,0 +1,240 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MerchantAPIHandler handles the merchant-facing API, authenticated with merchant API keys
+type MerchantAPIHandler struct {
+	merchantService    *MerchantService
+	bankingService     *BankingService
+	cardPaymentService *CardPaymentService
+	userService        *UserService
+	webhookService     *WebhookService
+}
+
+// NewMerchantAPIHandler creates a new MerchantAPIHandler
+func NewMerchantAPIHandler(merchantService *MerchantService, bankingService *BankingService, cardPaymentService *CardPaymentService, userService *UserService, webhookService *WebhookService) *MerchantAPIHandler {
+	return &MerchantAPIHandler{
+		merchantService:    merchantService,
+		bankingService:     bankingService,
+		cardPaymentService: cardPaymentService,
+		userService:        userService,
+		webhookService:     webhookService,
+	}
+}
+
+// MerchantChargeRequest represents a merchant's charge against a player. Either card details are given,
+// charging the card immediately, or a payer, who is sent a payment request to approve.
+type MerchantChargeRequest struct {
+	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	Description string  `json:"description" binding:"required"`
+
+	// Card payments
+	CardNumber string `json:"card_number"`
+	ExpiryDate string `json:"expiry_date"` // MM/YY
+	CVV        string `json:"cvv"`
+	PIN        string `json:"pin"`
+
+	// Payment requests
+	Payer     string     `json:"payer"` // Username or account number
+	Message   string     `json:"message"`
+	ExpiresAt *time.Time `json:"expires_at"` // Optional; the request expires if it isn't paid by then
+}
+
+// MerchantRefundRequest represents a merchant's refund of a payment
+type MerchantRefundRequest struct {
+	Amount float64 `json:"amount" binding:"gte=0"` // Omit or 0 to refund everything not yet refunded
+	Reason string  `json:"reason"`
+}
+
+// GetMerchantHandler handles GET /api/merchant, returning the merchant the key belongs to
+func (h *MerchantAPIHandler) GetMerchantHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"merchant": c.MustGet("merchant").(*Merchant),
+	})
+}
+
+// CreateChargeHandler handles POST /api/merchant/charges
+func (h *MerchantAPIHandler) CreateChargeHandler(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*Merchant)
+
+	var req MerchantChargeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	switch {
+	case req.CardNumber != "" && req.Payer != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give either card details or a payer, not both"})
+	case req.CardNumber != "":
+		h.chargeCard(c, merchant, req)
+	case req.Payer != "":
+		h.requestPayment(c, merchant, req)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Card details or a payer are required"})
+	}
+}
+
+// chargeCard charges a card immediately, paying the merchant's settlement account
+func (h *MerchantAPIHandler) chargeCard(c *gin.Context, merchant *Merchant, req MerchantChargeRequest) {
+	if req.ExpiryDate == "" || (req.CVV == "" && req.PIN == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Card charges need expiry_date and either cvv or pin"})
+		return
+	}
+
+	authorization, err := h.cardPaymentService.Authorize(CardPaymentDetails{
+		CardNumber:            req.CardNumber,
+		ExpiryDate:            req.ExpiryDate,
+		CVV:                   req.CVV,
+		PIN:                   req.PIN,
+		Amount:                req.Amount,
+		MerchantAccountNumber: merchant.SettlementAccountNumber,
+		MerchantID:            &merchant.ID,
+		Description:           req.Description,
+	})
+	if err != nil {
+		c.JSON(http.StatusPaymentRequired, gin.H{"approved": false, "error": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendCardAuthorizationWebhook("card_payment", authorization)
+
+	response := gin.H{
+		"success":            true,
+		"approved":           true,
+		"charge_type":        "card",
+		"authorization_code": authorization.AuthorizationCode,
+		"authorization":      authorization,
+	}
+	if transaction, err := h.bankingService.GetTransactionByID(*authorization.TransactionID); err == nil {
+		response["transaction"] = transaction
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// requestPayment sends the payer a payment request; the charge completes when they approve it
+func (h *MerchantAPIHandler) requestPayment(c *gin.Context, merchant *Merchant, req MerchantChargeRequest) {
+	payer, err := h.userService.GetUserByUsernameOrAccountNumber(req.Payer)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payer not found"})
+		return
+	}
+
+	paymentRequest, err := h.bankingService.CreateMerchantPaymentRequest(merchant, payer.AccountNumber, req.Amount, req.Description, req.Message, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendPaymentRequestWebhook(paymentRequest)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":         true,
+		"charge_type":     "payment_request",
+		"message":         "Payment request sent; the charge completes once the payer approves it",
+		"payment_request": paymentRequest,
+	})
+}
+
+// GetPaymentRequestsHandler handles GET /api/merchant/payment-requests
+func (h *MerchantAPIHandler) GetPaymentRequestsHandler(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*Merchant)
+	limit, offset := parsePagination(c)
+
+	requests, total, err := h.bankingService.GetMerchantPaymentRequests(merchant.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"payment_requests": requests,
+		"total":            total,
+		"limit":            limit,
+		"offset":           offset,
+	})
+}
+
+// RefundHandler handles POST /api/merchant/transactions/:id/refund
+func (h *MerchantAPIHandler) RefundHandler(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*Merchant)
+
+	transactionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	var req MerchantRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	refund, err := h.bankingService.RefundMerchantTransaction(merchant, transactionID, req.Amount, req.Reason)
+	if err != nil {
+		switch err {
+		case errTransactionNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		case errAlreadyRefunded, errRefundExceedsPayment:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Refund failed", "details": err.Error()})
+		}
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendMerchantRefundWebhook(merchant, refund)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Refund issued successfully",
+		"transaction": refund,
+	})
+}
+
+// GetTransactionsHandler handles GET /api/merchant/transactions, the merchant's settlement history
+func (h *MerchantAPIHandler) GetTransactionsHandler(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*Merchant)
+	limit, offset := parsePagination(c)
+
+	transactions, total, err := h.bankingService.GetMerchantTransactions(merchant.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": transactions,
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// parsePagination reads the limit (default 50, max 100) and offset query parameters
+func parsePagination(c *gin.Context) (int, int) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// merchantAPIKeyPrefix marks merchant API keys
+const merchantAPIKeyPrefix = "pbmch_"
+
+// CreateAPIKey issues a new named API key for a merchant and returns it with its plaintext key
+func (s *MerchantService) CreateAPIKey(merchantID int, name, createdBy string) (*MerchantAPIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("key name is required")
+	}
+
+	merchant, err := s.GetMerchantByID(merchantID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !merchant.IsActive {
+		return nil, "", fmt.Errorf("merchant is inactive")
+	}
+
+	random, err := generateSessionToken()
+	if err != nil {
+		return nil, "", err
+	}
+	key := merchantAPIKeyPrefix + random
+
+	query := `INSERT INTO merchant_api_keys (merchant_id, name, key_hash, created_by, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := s.db.Exec(query, merchantID, name, hashToken(key), createdBy, time.Now())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	apiKey, err := s.getAPIKey(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// AuthenticateAPIKey resolves a merchant API key to its active merchant
+func (s *MerchantService) AuthenticateAPIKey(key string) (*Merchant, *MerchantAPIKey, error) {
+	// Keys are looked up by their SHA-256 hash, so timing reveals nothing about the key itself
+	apiKey, err := s.getAPIKey(`WHERE key_hash = ? AND revoked_at IS NULL`, hashToken(key))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid merchant API key")
+	}
+
+	merchant, err := s.GetMerchantByID(apiKey.MerchantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !merchant.IsActive {
+		return nil, nil, fmt.Errorf("merchant is inactive")
+	}
+
+	s.db.Exec(`UPDATE merchant_api_keys SET last_used_at = ? WHERE id = ?`, time.Now(), apiKey.ID)
+
+	return merchant, apiKey, nil
+}
+
+// GetAPIKeys returns a merchant's API keys, including revoked ones
+func (s *MerchantService) GetAPIKeys(merchantID int) ([]MerchantAPIKey, error) {
+	query := `
+		SELECT id, merchant_id, name, created_by, last_used_at, revoked_at, created_at
+		FROM merchant_api_keys
+		WHERE merchant_id = ?
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := s.db.Query(query, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apiKeys := []MerchantAPIKey{}
+	for rows.Next() {
+		apiKey, err := scanMerchantAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, *apiKey)
+	}
+
+	return apiKeys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of a merchant's API keys so it can no longer be used
+func (s *MerchantService) RevokeAPIKey(merchantID, keyID int) error {
+	result, err := s.db.Exec(`
+		UPDATE merchant_api_keys SET revoked_at = ?
+		WHERE id = ? AND merchant_id = ? AND revoked_at IS NULL
+	`, time.Now(), keyID, merchantID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found or already revoked")
+	}
+
+	return nil
+}
+
+// getAPIKey retrieves a single API key matching the given WHERE clause
+func (s *MerchantService) getAPIKey(where string, args ...interface{}) (*MerchantAPIKey, error) {
+	query := `
+		SELECT id, merchant_id, name, created_by, last_used_at, revoked_at, created_at
+		FROM merchant_api_keys ` + where
+
+	return scanMerchantAPIKey(s.db.QueryRow(query, args...))
+}
+
+// scanMerchantAPIKey scans an API key row into a MerchantAPIKey
+func scanMerchantAPIKey(row rowScanner) (*MerchantAPIKey, error) {
+	apiKey := &MerchantAPIKey{}
+	var createdBy sql.NullString
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&apiKey.ID, &apiKey.MerchantID, &apiKey.Name, &createdBy,
+		&lastUsedAt, &revokedAt, &apiKey.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey.CreatedBy = createdBy.String
+	if lastUsedAt.Valid {
+		apiKey.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		apiKey.RevokedAt = &revokedAt.Time
+	}
+
+	return apiKey, nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MerchantHandler handles the admin merchant registry
+type MerchantHandler struct {
+	merchantService *MerchantService
+	userService     *UserService
+}
+
+// NewMerchantHandler creates a new MerchantHandler
+func NewMerchantHandler(merchantService *MerchantService, userService *UserService) *MerchantHandler {
+	return &MerchantHandler{
+		merchantService: merchantService,
+		userService:     userService,
+	}
+}
+
+// CreateMerchantRequest represents a merchant registration request
+type CreateMerchantRequest struct {
+	Name              string `json:"name" binding:"required"`
+	CategoryCode      string `json:"category_code" binding:"required"`
+	LogoURL           string `json:"logo_url"`
+	SettlementAccount string `json:"settlement_account"` // Username or account number; defaults to the owner's account
+	OwnerAccount      string `json:"owner_account"`      // Username or account number of the player who runs the merchant
+}
+
+// UpdateMerchantRequest represents a change to a merchant; omitted fields are left as they are
+type UpdateMerchantRequest struct {
+	Name              *string `json:"name"`
+	CategoryCode      *string `json:"category_code"`
+	LogoURL           *string `json:"logo_url"`
+	SettlementAccount *string `json:"settlement_account"`
+	OwnerAccount      *string `json:"owner_account"`
+	IsActive          *bool   `json:"is_active"`
+}
+
+// CreateAPIKeyRequest represents a request to issue a merchant API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateMerchantHandler handles POST /api/admin/merchants
+func (h *MerchantHandler) CreateMerchantHandler(c *gin.Context) {
+	var req CreateMerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	var ownerUserID *int
+	if req.OwnerAccount != "" {
+		owner, err := h.userService.GetUserByUsernameOrAccountNumber(req.OwnerAccount)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Owner account not found"})
+			return
+		}
+		ownerUserID = &owner.ID
+	}
+
+	if req.SettlementAccount == "" {
+		if ownerUserID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A settlement account or owner account is required"})
+			return
+		}
+		req.SettlementAccount = req.OwnerAccount
+	}
+	settlement, err := h.userService.GetUserByUsernameOrAccountNumber(req.SettlementAccount)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Settlement account not found"})
+		return
+	}
+
+	merchant, err := h.merchantService.CreateMerchant(req.Name, req.CategoryCode, req.LogoURL, settlement.ID, ownerUserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create merchant", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":  true,
+		"message":  "Merchant created successfully",
+		"merchant": merchant,
+	})
+}
+
+// GetMerchantsHandler handles GET /api/admin/merchants; ?include_inactive=true lists deactivated merchants too
+func (h *MerchantHandler) GetMerchantsHandler(c *gin.Context) {
+	merchants, err := h.merchantService.GetAllMerchants(c.Query("include_inactive") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get merchants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"merchants": merchants,
+	})
+}
+
+// GetMerchantHandler handles GET /api/admin/merchants/:id
+func (h *MerchantHandler) GetMerchantHandler(c *gin.Context) {
+	merchantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	merchant, err := h.merchantService.GetMerchantByID(merchantID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"merchant": merchant,
+	})
+}
+
+// UpdateMerchantHandler handles PUT /api/admin/merchants/:id
+func (h *MerchantHandler) UpdateMerchantHandler(c *gin.Context) {
+	merchantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	var req UpdateMerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	update := MerchantUpdate{
+		Name:         req.Name,
+		CategoryCode: req.CategoryCode,
+		LogoURL:      req.LogoURL,
+		IsActive:     req.IsActive,
+	}
+	if req.SettlementAccount != nil {
+		settlement, err := h.userService.GetUserByUsernameOrAccountNumber(*req.SettlementAccount)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Settlement account not found"})
+			return
+		}
+		update.SettlementUserID = &settlement.ID
+	}
+	if req.OwnerAccount != nil {
+		owner, err := h.userService.GetUserByUsernameOrAccountNumber(*req.OwnerAccount)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Owner account not found"})
+			return
+		}
+		update.OwnerUserID = &owner.ID
+	}
+
+	merchant, err := h.merchantService.UpdateMerchant(merchantID, update)
+	if err != nil {
+		if err == errMerchantNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update merchant", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Merchant updated successfully",
+		"merchant": merchant,
+	})
+}
+
+// DeactivateMerchantHandler handles DELETE /api/admin/merchants/:id. The merchant is kept for its
+// transaction history but can no longer take payments.
+func (h *MerchantHandler) DeactivateMerchantHandler(c *gin.Context) {
+	merchantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	merchant, err := h.merchantService.DeactivateMerchant(merchantID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Merchant deactivated",
+		"merchant": merchant,
+	})
+}
+
+// GetOwnedMerchantsHandler handles GET /api/merchants, listing the merchants the user owns
+func (h *MerchantHandler) GetOwnedMerchantsHandler(c *gin.Context) {
+	merchants, err := h.merchantService.GetMerchantsByOwner(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get merchants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"merchants": merchants,
+	})
+}
+
+// CreateAPIKeyHandler handles POST /api/admin/merchants/:id/keys and POST /api/merchants/:id/keys
+func (h *MerchantHandler) CreateAPIKeyHandler(c *gin.Context) {
+	merchant, ok := h.managedMerchant(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	createdBy := c.GetString("adminActor")
+	if createdBy == "" {
+		createdBy = "user:" + c.MustGet("user").(*User).Username
+	}
+
+	apiKey, key, err := h.merchantService.CreateAPIKey(merchant.ID, req.Name, createdBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "API key created; store it now, it won't be shown again",
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// GetAPIKeysHandler handles GET /api/admin/merchants/:id/keys and GET /api/merchants/:id/keys
+func (h *MerchantHandler) GetAPIKeysHandler(c *gin.Context) {
+	merchant, ok := h.managedMerchant(c)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := h.merchantService.GetAPIKeys(merchant.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"api_keys": apiKeys,
+	})
+}
+
+// RevokeAPIKeyHandler handles DELETE /api/admin/merchants/:id/keys/:key_id and DELETE /api/merchants/:id/keys/:key_id
+func (h *MerchantHandler) RevokeAPIKeyHandler(c *gin.Context) {
+	merchant, ok := h.managedMerchant(c)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := h.merchantService.RevokeAPIKey(merchant.ID, keyID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API key revoked",
+	})
+}
+
+// managedMerchant loads the merchant named by the :id parameter. Staff can manage any merchant;
+// players only the merchants they own.
+func (h *MerchantHandler) managedMerchant(c *gin.Context) (*Merchant, bool) {
+	merchantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return nil, false
+	}
+
+	merchant, err := h.merchantService.GetMerchantByID(merchantID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return nil, false
+	}
+
+	if c.GetString("adminRole") == "" {
+		if merchant.OwnerUserID == nil || *merchant.OwnerUserID != c.GetInt("userID") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+			return nil, false
+		}
+	}
+
+	return merchant, true
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Merchant payment errors that callers can tell apart
+var (
+	errAlreadyRefunded      = fmt.Errorf("payment has already been fully refunded")
+	errTransactionNotFound  = fmt.Errorf("transaction not found")
+	errRefundExceedsPayment = fmt.Errorf("refund exceeds the amount left to refund")
+)
+
+// CreateMerchantPaymentRequest asks a player to pay a registered merchant. The money only moves once the
+// player approves the request.
+func (s *BankingService) CreateMerchantPaymentRequest(merchant *Merchant, payerAccountNumber string, amount float64, reason, message string, expiresAt *time.Time) (*PaymentRequest, error) {
+	if !merchant.IsActive {
+		return nil, fmt.Errorf("merchant is inactive")
+	}
+
+	request, err := s.createPaymentRequest(merchant.SettlementUserID, payerAccountNumber, amount, reason, message, expiresAt, &merchant.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	request.MerchantName = merchant.Name
+	return request, nil
+}
+
+// GetMerchantPaymentRequests retrieves a page of the payment requests a merchant has sent, newest first,
+// along with the total number of them
+func (s *BankingService) GetMerchantPaymentRequests(merchantID, limit, offset int) ([]PaymentRequest, int, error) {
+	var total int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM payment_requests WHERE merchant_id = ?`, merchantID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT pr.id, pr.from_user_id, pr.to_user_id, pr.amount, pr.reason,
+		       pr.message, pr.status, pr.created_at, u1.username, u2.username, pr.merchant_id, m.name,
+		       pr.amount_paid, pr.expires_at, pr.last_reminder_at, pr.reminder_count, pr.group_id
+		FROM payment_requests pr
+		JOIN users u1 ON pr.from_user_id = u1.id
+		JOIN users u2 ON pr.to_user_id = u2.id
+		LEFT JOIN merchants m ON pr.merchant_id = m.id
+		WHERE pr.merchant_id = ?
+		ORDER BY pr.created_at DESC, pr.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.db.Query(query, merchantID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	requests := []PaymentRequest{}
+	for rows.Next() {
+		var pr PaymentRequest
+		var message, merchantName sql.NullString
+		var requestMerchantID sql.NullInt64
+		var expiresAt, lastReminderAt sql.NullTime
+		var groupID sql.NullInt64
+		err := rows.Scan(
+			&pr.ID, &pr.FromUserID, &pr.ToUserID, &pr.Amount, &pr.Reason,
+			&message, &pr.Status, &pr.CreatedAt, &pr.FromUsername, &pr.ToUsername, &requestMerchantID, &merchantName,
+			&pr.AmountPaid, &expiresAt, &lastReminderAt, &pr.ReminderCount, &groupID,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		pr.Message = message.String
+		pr.setMerchant(requestMerchantID, merchantName)
+		pr.setProgress(expiresAt, lastReminderAt, groupID)
+		requests = append(requests, pr)
+	}
+
+	return requests, total, rows.Err()
+}
+
+// RefundMerchantTransaction returns all or part of a payment made to a merchant, paid from the merchant's
+// settlement account. An amount of zero refunds whatever hasn't been refunded yet.
+func (s *BankingService) RefundMerchantTransaction(merchant *Merchant, transactionID int, amount float64, reason string) (*Transaction, error) {
+	if amount < 0 {
+		return nil, fmt.Errorf("refund amount must be positive")
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Only payments made to this merchant can be refunded
+	var payerUserID int
+	var description string
+	var cardID sql.NullInt64
+	var merchantName, merchantCategory sql.NullString
+	err = tx.QueryRow(`
+		SELECT from_user_id, COALESCE(description, ''), card_id, merchant_name, merchant_category
+		FROM transactions
+		WHERE id = ? AND merchant_id = ? AND transaction_type IN ('merchant_payment', 'card_payment') AND status = 'completed'
+	`, transactionID, merchant.ID).Scan(&payerUserID, &description, &cardID, &merchantName, &merchantCategory)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errTransactionNotFound
+		}
+		return nil, err
+	}
+
+	refundable, err := refundableAmountInTx(tx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if refundable <= 0 {
+		return nil, errAlreadyRefunded
+	}
+	if amount == 0 {
+		amount = refundable
+	}
+	if amount > refundable {
+		return nil, errRefundExceedsPayment
+	}
+
+	// Check both accounts can take part
+	if err = checkAccountCanSend(tx, merchant.SettlementUserID); err != nil {
+		return nil, err
+	}
+	if err = checkAccountCanReceive(tx, payerUserID); err != nil {
+		return nil, err
+	}
+
+	available, err := availableBalance(tx, merchant.SettlementUserID)
+	if err != nil {
+		return nil, err
+	}
+	if available < amount {
+		return nil, fmt.Errorf("merchant has insufficient balance to refund this payment")
+	}
+
+	if _, err = tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, merchant.SettlementUserID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, payerUserID); err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		reason = description
+	}
+
+	// Create transaction record, linked to the payment it refunds
+	var refundID int
+	err = tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, card_id,
+		                          merchant_id, merchant_name, merchant_category, original_transaction_id, created_at)
+		VALUES (?, ?, ?, 'merchant_refund', ?, 'completed', ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, merchant.SettlementUserID, payerUserID, amount, "Refund: "+reason, cardID, merchant.ID, merchantName, merchantCategory,
+		transactionID, time.Now()).Scan(&refundID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reset PokéBank balance in case it settles for the merchant
+	if err = s.resetPokeBankBalanceInTx(tx, merchant.SettlementUserID, payerUserID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetTransactionByID(refundID)
+}
+
+// GetMerchantTransactions retrieves a page of a merchant's settlement history, newest first, along with the
+// total number of transactions. Amounts are from the merchant's side: payments in are positive, refunds
+// and reversals are negative.
+func (s *BankingService) GetMerchantTransactions(merchantID, limit, offset int) ([]Transaction, int, error) {
+	var total int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM transactions WHERE merchant_id = ?`, merchantID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT t.id, t.from_user_id, t.to_user_id,
+		       CASE
+		           WHEN t.transaction_type IN ('merchant_refund', 'card_reversal', 'reversal') THEN -t.amount
+		           ELSE t.amount
+		       END as amount,` + transactionColumns + `
+		WHERE t.merchant_id = ?
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.db.Query(query, merchantID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	transactions, err := scanTransactions(rows)
+	return transactions, total, err
+}
+
+// refundableAmountInTx returns how much of a payment hasn't yet been returned by refunds or reversals
+func refundableAmountInTx(tx *sql.Tx, transactionID int) (float64, error) {
+	var refundable float64
+	err := tx.QueryRow(`
+		SELECT t.amount - COALESCE((SELECT SUM(r.amount) FROM transactions r WHERE r.original_transaction_id = t.id), 0)
+		FROM transactions t WHERE t.id = ?
+	`, transactionID).Scan(&refundable)
+
+	// Round to cents so repeated partial refunds can add up to the full payment
+	return roundCents(refundable), err
+}
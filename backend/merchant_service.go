@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// errMerchantNotFound is returned when no merchant has the given ID or name
+var errMerchantNotFound = fmt.Errorf("merchant not found")
+
+// MerchantService handles the merchant registry
+type MerchantService struct {
+	db *sql.DB
+}
+
+// NewMerchantService creates a new MerchantService
+func NewMerchantService(db *sql.DB) *MerchantService {
+	return &MerchantService{db: db}
+}
+
+// MerchantUpdate lists the merchant fields to change; nil fields are left as they are
+type MerchantUpdate struct {
+	Name             *string
+	CategoryCode     *string
+	LogoURL          *string
+	SettlementUserID *int
+	OwnerUserID      *int
+	IsActive         *bool
+}
+
+// merchantSelect selects merchants with their settlement and owner accounts for display
+const merchantSelect = `
+	SELECT m.id, m.name, m.category_code, m.logo_url, m.settlement_user_id, m.owner_user_id, m.is_active,
+	       m.created_at, m.updated_at, s.account_number, s.username, o.username
+	FROM merchants m
+	JOIN users s ON m.settlement_user_id = s.id
+	LEFT JOIN users o ON m.owner_user_id = o.id
+`
+
+// CreateMerchant registers a merchant that settles into the given account
+func (s *MerchantService) CreateMerchant(name, categoryCode, logoURL string, settlementUserID int, ownerUserID *int) (*Merchant, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("merchant name is required")
+	}
+	if err := validateLogoURL(logoURL); err != nil {
+		return nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkAccountCanReceive(tx, settlementUserID); err != nil {
+		return nil, fmt.Errorf("settlement account: %v", err)
+	}
+	if err = checkMerchantNameFreeInTx(tx, name, 0); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var merchantID int
+	err = tx.QueryRow(`
+		INSERT INTO merchants (name, category_code, logo_url, settlement_user_id, owner_user_id, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, TRUE, ?, ?)
+		RETURNING id
+	`, name, normalizeCategory(categoryCode), logoURL, settlementUserID, ownerUserID, now, now).Scan(&merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetMerchantByID(merchantID)
+}
+
+// GetMerchantByID retrieves a merchant
+func (s *MerchantService) GetMerchantByID(id int) (*Merchant, error) {
+	merchant, err := scanMerchant(s.db.QueryRow(merchantSelect+` WHERE m.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, errMerchantNotFound
+	}
+	return merchant, err
+}
+
+// GetMerchantByName retrieves a merchant by its name, ignoring case
+func (s *MerchantService) GetMerchantByName(name string) (*Merchant, error) {
+	merchant, err := scanMerchant(s.db.QueryRow(merchantSelect+` WHERE m.name = ? COLLATE NOCASE`, strings.TrimSpace(name)))
+	if err == sql.ErrNoRows {
+		return nil, errMerchantNotFound
+	}
+	return merchant, err
+}
+
+// GetAllMerchants returns every registered merchant, optionally including deactivated ones
+func (s *MerchantService) GetAllMerchants(includeInactive bool) ([]Merchant, error) {
+	query := merchantSelect
+	if !includeInactive {
+		query += ` WHERE m.is_active = TRUE`
+	}
+	query += ` ORDER BY m.name`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merchants := []Merchant{}
+	for rows.Next() {
+		merchant, err := scanMerchant(rows)
+		if err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, *merchant)
+	}
+
+	return merchants, rows.Err()
+}
+
+// GetMerchantsByOwner returns the merchants a user owns, including deactivated ones
+func (s *MerchantService) GetMerchantsByOwner(ownerUserID int) ([]Merchant, error) {
+	rows, err := s.db.Query(merchantSelect+` WHERE m.owner_user_id = ? ORDER BY m.name`, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merchants := []Merchant{}
+	for rows.Next() {
+		merchant, err := scanMerchant(rows)
+		if err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, *merchant)
+	}
+
+	return merchants, rows.Err()
+}
+
+// UpdateMerchant changes a merchant's details. Past transactions keep the name and category they were made under.
+func (s *MerchantService) UpdateMerchant(id int, update MerchantUpdate) (*Merchant, error) {
+	merchant, err := s.GetMerchantByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if update.Name != nil {
+		merchant.Name = strings.TrimSpace(*update.Name)
+		if merchant.Name == "" {
+			return nil, fmt.Errorf("merchant name is required")
+		}
+		if err = checkMerchantNameFreeInTx(tx, merchant.Name, id); err != nil {
+			return nil, err
+		}
+	}
+	if update.CategoryCode != nil {
+		merchant.CategoryCode = normalizeCategory(*update.CategoryCode)
+	}
+	if update.LogoURL != nil {
+		if err = validateLogoURL(*update.LogoURL); err != nil {
+			return nil, err
+		}
+		merchant.LogoURL = *update.LogoURL
+	}
+	if update.SettlementUserID != nil {
+		if err = checkAccountCanReceive(tx, *update.SettlementUserID); err != nil {
+			return nil, fmt.Errorf("settlement account: %v", err)
+		}
+		merchant.SettlementUserID = *update.SettlementUserID
+	}
+	if update.OwnerUserID != nil {
+		merchant.OwnerUserID = update.OwnerUserID
+	}
+	if update.IsActive != nil {
+		merchant.IsActive = *update.IsActive
+	}
+
+	_, err = tx.Exec(`
+		UPDATE merchants
+		SET name = ?, category_code = ?, logo_url = ?, settlement_user_id = ?, owner_user_id = ?, is_active = ?, updated_at = ?
+		WHERE id = ?
+	`, merchant.Name, merchant.CategoryCode, merchant.LogoURL, merchant.SettlementUserID, merchant.OwnerUserID,
+		merchant.IsActive, time.Now().UTC(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetMerchantByID(id)
+}
+
+// DeactivateMerchant stops a merchant from taking payments. Merchants are never deleted, since
+// transactions refer to them.
+func (s *MerchantService) DeactivateMerchant(id int) (*Merchant, error) {
+	isActive := false
+	return s.UpdateMerchant(id, MerchantUpdate{IsActive: &isActive})
+}
+
+// checkMerchantNameFreeInTx returns an error if another merchant already uses the name
+func checkMerchantNameFreeInTx(tx *sql.Tx, name string, merchantID int) error {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM merchants WHERE name = ? COLLATE NOCASE AND id != ?`, name, merchantID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("a merchant named %s already exists", name)
+	}
+	return nil
+}
+
+// validateLogoURL accepts an empty logo or an absolute http(s) URL
+func validateLogoURL(logoURL string) error {
+	return validateHTTPURL("logo URL", logoURL)
+}
+
+// validateHTTPURL accepts an empty URL or an absolute http(s) URL; name describes the URL in the error
+func validateHTTPURL(name, rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL", name)
+	}
+	return nil
+}
+
+// scanMerchant scans a row selected with merchantSelect into a Merchant
+func scanMerchant(row rowScanner) (*Merchant, error) {
+	merchant := &Merchant{}
+	var logoURL, ownerUsername sql.NullString
+	var ownerUserID sql.NullInt64
+
+	err := row.Scan(
+		&merchant.ID, &merchant.Name, &merchant.CategoryCode, &logoURL, &merchant.SettlementUserID, &ownerUserID,
+		&merchant.IsActive, &merchant.CreatedAt, &merchant.UpdatedAt, &merchant.SettlementAccountNumber,
+		&merchant.SettlementUsername, &ownerUsername,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	merchant.LogoURL = logoURL.String
+	merchant.OwnerUsername = ownerUsername.String
+	if ownerUserID.Valid {
+		id := int(ownerUserID.Int64)
+		merchant.OwnerUserID = &id
+	}
+
+	return merchant, nil
+}
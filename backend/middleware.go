@@ -2,6 +2,8 @@ package main
 
 import (
 	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,22 +31,44 @@ func authMiddleware() gin.HandlerFunc {
 
 		userService := NewUserService(db)
 
-		// Validate session
-		session, err := userService.GetSessionByToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
-			c.Abort()
-			return
+		// OAuth access tokens carry their own user and scopes
+		var userID int
+		if strings.HasPrefix(token, oauthAccessTokenPrefix) {
+			accessToken, err := NewOAuthService(db, userService).GetAccessToken(token)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired access token"})
+				c.Abort()
+				return
+			}
+			userID = accessToken.UserID
+			c.Set("oauthClientID", accessToken.ClientID)
+			c.Set("oauthScopes", accessToken.Scopes)
+		} else {
+			// Validate session
+			session, err := userService.GetSessionByToken(token)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+				c.Abort()
+				return
+			}
+			userID = session.UserID
 		}
 
 		// Get user details
-		user, err := userService.GetUserByID(session.UserID)
+		user, err := userService.GetUserByID(userID)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
+		// Suspended and closed accounts can't use the API
+		if !accountCanSignIn(user.Status) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is " + user.Status})
+			c.Abort()
+			return
+		}
+
 		// Set user context
 		c.Set("userID", user.ID)
 		c.Set("user", user)
@@ -54,26 +78,139 @@ func authMiddleware() gin.HandlerFunc {
 	}
 }
 
-// adminAuthMiddleware validates admin authentication
+// adminAuthMiddleware authenticates admin requests, either with a named admin credential
+// in X-Admin-Key or with the session of a user holding a staff role
 func adminAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Initialize services (in a real app, these would be injected)
+		db, err := InitDB()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection failed"})
+			c.Abort()
+			return
+		}
+		defer db.Close()
+
 		adminKey := c.GetHeader("X-Admin-Key")
-		if adminKey == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Admin key required"})
+		if adminKey != "" {
+			credential, err := NewAdminCredentialService(db).Authenticate(adminKey)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin key"})
+				c.Abort()
+				return
+			}
+
+			c.Set("adminActor", "credential:"+credential.Name)
+			c.Set("adminRole", credential.Role)
+			c.Next()
+			return
+		}
+
+		// Fall back to a staff member's own session
+		token := extractTokenFromHeader(c.GetHeader("Authorization"))
+		if token == "" || strings.HasPrefix(token, oauthAccessTokenPrefix) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Admin key or staff session required"})
+			c.Abort()
+			return
+		}
+
+		userService := NewUserService(db)
+
+		session, err := userService.GetSessionByToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+			c.Abort()
+			return
+		}
+
+		user, err := userService.GetUserByID(session.UserID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		if user.Role == RolePlayer || !accountCanSignIn(user.Status) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Staff role required"})
 			c.Abort()
 			return
 		}
 
-		// Get admin key from environment
-		expectedAdminKey := getEnv("ADMIN_KEY", "")
-		if expectedAdminKey == "" {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Admin functionality not configured"})
+		c.Set("adminActor", "user:"+user.Username)
+		c.Set("adminRole", user.Role)
+		c.Set("adminUserID", user.ID)
+
+		c.Next()
+	}
+}
+
+// merchantAuthMiddleware authenticates merchant API requests with a merchant API key in X-Merchant-Key
+func merchantAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-Merchant-Key")
+		if key == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Merchant API key required"})
+			c.Abort()
+			return
+		}
+
+		// Initialize merchant service (in a real app, this would be injected)
+		db, err := InitDB()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection failed"})
 			c.Abort()
 			return
 		}
+		defer db.Close()
 
-		if adminKey != expectedAdminKey {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin key"})
+		merchant, apiKey, err := NewMerchantService(db).AuthenticateAPIKey(key)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid merchant API key"})
+			c.Abort()
+			return
+		}
+
+		// Set merchant context
+		c.Set("merchant", merchant)
+		c.Set("merchantKeyName", apiKey.Name)
+
+		c.Next()
+	}
+}
+
+// requirePermission rejects admin requests whose role lacks the given permission
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !roleHasPermission(c.GetString("adminRole"), permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "permission": permission})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireScope rejects OAuth-authenticated requests whose token lacks the given scope.
+// Requests authenticated with a regular session are always allowed through.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, isOAuth := c.Get("oauthScopes")
+		if isOAuth && !containsScope(scopes.([]string), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access token is missing required scope", "scope": scope})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireSession rejects requests authenticated with an OAuth access token
+func requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isOAuth := c.Get("oauthScopes"); isOAuth {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires a user session"})
 			c.Abort()
 			return
 		}
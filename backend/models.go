@@ -17,6 +17,9 @@ type User struct {
 	PasswordHash string    `json:"-"`
 	AccountNumber string   `json:"account_number"`
 	Balance      float64   `json:"balance"`
+	EmailVerified bool     `json:"email_verified"`
+	Role         string    `json:"role"` // "player", "support", "treasurer", "admin"
+	Status       string    `json:"status"` // "active", "frozen", "suspended", "closed"
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -31,6 +34,35 @@ type Transaction struct {
 	Status        string    `json:"status"` // "pending", "completed", "failed"
 	CreatedAt     time.Time `json:"created_at"`
 	
+	// Card and merchant payments record the card and where it was used
+	CardID           *int   `json:"card_id,omitempty"`
+	MerchantID       *int   `json:"merchant_id,omitempty"` // Set for registered merchants
+	MerchantName     string `json:"merchant_name,omitempty"`
+	MerchantCategory string `json:"merchant_category,omitempty"`
+	MerchantLogoURL  string `json:"merchant_logo_url,omitempty"`
+	
+	// Refunds and reversals point at the transaction they return money from
+	OriginalTransactionID *int `json:"original_transaction_id,omitempty"`
+	
+	// Payments made through a payment link point at the link
+	PaymentLinkID *int `json:"payment_link_id,omitempty"`
+	
+	// Invoice payments point at the invoice they pay
+	InvoiceID *int `json:"invoice_id,omitempty"`
+	
+	// Payments approving all or part of a payment request point at the request
+	PaymentRequestID *int `json:"payment_request_id,omitempty"`
+	
+	// Escrow holds, releases and refunds point at their escrow
+	EscrowID *int `json:"escrow_id,omitempty"`
+	
+	// Moves between a user's savings pots and interest name the pots; nil is the main balance
+	FromPotID *int `json:"from_pot_id,omitempty"`
+	ToPotID   *int `json:"to_pot_id,omitempty"`
+	
+	// Loan disbursements and repayments point at their loan
+	LoanID *int `json:"loan_id,omitempty"`
+	
 	// Additional fields for display
 	FromUsername  string    `json:"from_username,omitempty"`
 	ToUsername    string    `json:"to_username,omitempty"`
@@ -44,12 +76,24 @@ type PaymentRequest struct {
 	Amount      float64   `json:"amount"`
 	Reason      string    `json:"reason"`
 	Message     string    `json:"message"`
-	Status      string    `json:"status"` // "pending", "approved", "rejected"
+	Status      string    `json:"status"` // "pending", "approved", "rejected", "cancelled", "expired"
+	MerchantID  *int      `json:"merchant_id,omitempty"` // Set when a registered merchant is charging the payer
 	CreatedAt   time.Time `json:"created_at"`
 	
+	// Requests can be paid in parts; they stay pending until the whole amount is paid
+	AmountPaid     float64       `json:"amount_paid"`
+	ExpiresAt      *time.Time    `json:"expires_at,omitempty"` // Pending requests expire at this time
+	LastReminderAt *time.Time    `json:"last_reminder_at,omitempty"`
+	ReminderCount  int           `json:"reminder_count"`
+	Payments       []Transaction `json:"payments,omitempty"`
+	GroupID        *int          `json:"group_id,omitempty"` // Set for a payer's share of a split bill
+	
 	// Additional fields for display
+	AmountDue    float64   `json:"amount_due"`
 	FromUsername string    `json:"from_username,omitempty"`
 	ToUsername   string    `json:"to_username,omitempty"`
+	MerchantName string    `json:"merchant_name,omitempty"`
+	ToEmail      string    `json:"-"` // For reminding the payer
 }
 
 // UserSession represents an active user session
@@ -65,6 +109,9 @@ type UserSession struct {
 type Card struct {
 	ID                int       `json:"id"`
 	UserID            int       `json:"user_id"`
+	Name              string    `json:"name"`
+	CardType          string    `json:"card_type"`  // "standard", "single_use"
+	IsPrimary         bool      `json:"is_primary"` // The card behind /api/card; replaced by refreshes
 	CardNumber        string    `json:"card_number"`
 	ExpiryDate        string    `json:"expiry_date"`
 	RefreshSeed       int       `json:"refresh_seed"`
@@ -72,6 +119,407 @@ type Card struct {
 	IsActive          bool      `json:"is_active"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
+	CVV               string    `json:"cvv,omitempty"` // Derived on demand, never stored
+	PINHash           string    `json:"-"`
+	PINSet            bool      `json:"pin_set"`
+	PINLocked         bool      `json:"pin_locked"` // Too many wrong PINs; card-present payments fail until a new PIN is set
+	CVVLocked         bool      `json:"cvv_locked"` // Too many wrong CVVs; card-not-present payments fail until the card is replaced
+	IsFrozen          bool      `json:"is_frozen"`
+	DailyLimit        *float64  `json:"daily_limit"`       // nil means no limit
+	TransactionLimit  *float64  `json:"transaction_limit"` // nil means no limit
+	AllowedCategories []string  `json:"allowed_categories"` // Empty allows every category not blocked
+	BlockedCategories []string  `json:"blocked_categories"`
+	ValidUntil        *time.Time `json:"valid_until,omitempty"`    // Fixed-lifetime cards stop working after this
+	DeactivatedAt     *time.Time `json:"deactivated_at,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at"`                    // First moment the card no longer works
+	ReplacedByCardID  *int       `json:"replaced_by_card_id,omitempty"` // Set once a replacement has been issued
+}
+
+// Merchant represents a registered business that players pay and that refunds them
+type Merchant struct {
+	ID               int       `json:"id"`
+	Name             string    `json:"name"`
+	CategoryCode     string    `json:"category_code"` // A merchant category as used by card controls, e.g. "item_shop"
+	LogoURL          string    `json:"logo_url,omitempty"`
+	SettlementUserID int       `json:"settlement_user_id"` // Account the merchant's takings are paid into
+	OwnerUserID      *int      `json:"owner_user_id,omitempty"`
+	IsActive         bool      `json:"is_active"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	// Additional fields for display
+	SettlementAccountNumber string `json:"settlement_account_number,omitempty"`
+	SettlementUsername      string `json:"settlement_username,omitempty"`
+	OwnerUsername           string `json:"owner_username,omitempty"`
+}
+
+// MerchantAPIKey represents an API credential scoped to one merchant
+type MerchantAPIKey struct {
+	ID         int        `json:"id"`
+	MerchantID int        `json:"merchant_id"`
+	Name       string     `json:"name"`
+	CreatedBy  string     `json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// PaymentLink represents a shareable link that players open to pay a user or merchant a fixed amount
+type PaymentLink struct {
+	ID          int        `json:"id"`
+	Code        string     `json:"code"`
+	PayeeUserID int        `json:"payee_user_id"`         // Account payments are made to
+	MerchantID  *int       `json:"merchant_id,omitempty"` // Set when the link was created by a registered merchant
+	Amount      float64    `json:"amount"`
+	Currency    string     `json:"currency"`
+	Description string     `json:"description"`
+	SingleUse   bool       `json:"single_use"`
+	UseCount    int        `json:"use_count"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RedirectURL string     `json:"redirect_url,omitempty"` // Where the payer is sent after paying
+	CallbackURL string     `json:"callback_url,omitempty"` // Receives a payment_link_paid webhook for each payment
+	IsActive    bool       `json:"is_active"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// Additional fields for display
+	Status             string `json:"status"` // "active", "used", "expired" or "deactivated"
+	URL                string `json:"url,omitempty"`
+	PayeeUsername      string `json:"payee_username,omitempty"`
+	PayeeAccountNumber string `json:"payee_account_number,omitempty"`
+	MerchantName       string `json:"merchant_name,omitempty"`
+	MerchantLogoURL    string `json:"merchant_logo_url,omitempty"`
+}
+
+// Invoice represents a bill from one player to another, made up of numbered line items and tax lines
+type Invoice struct {
+	ID              int        `json:"id"`
+	Number          string     `json:"number"` // e.g. "INV-000042"
+	IssuerUserID    int        `json:"issuer_user_id"`
+	RecipientUserID int        `json:"recipient_user_id"`
+	Status          string     `json:"status"` // "draft", "sent", "partially_paid", "paid", "overdue" or "void"
+	Currency        string     `json:"currency"`
+	Subtotal        float64    `json:"subtotal"`
+	TaxTotal        float64    `json:"tax_total"`
+	Total           float64    `json:"total"`
+	AmountPaid      float64    `json:"amount_paid"`
+	Notes           string     `json:"notes,omitempty"`
+	DueDate         string     `json:"due_date"`   // YYYY-MM-DD
+	OverdueAt       time.Time  `json:"overdue_at"` // First moment the invoice is overdue, the day after its due date (UTC)
+	SentAt          *time.Time `json:"sent_at,omitempty"`
+	PaidAt          *time.Time `json:"paid_at,omitempty"`
+	VoidedAt        *time.Time `json:"voided_at,omitempty"`
+	LastReminderAt  *time.Time `json:"last_reminder_at,omitempty"`
+	ReminderCount   int        `json:"reminder_count"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Lines    []InvoiceLine `json:"lines,omitempty"`
+	Payments []Transaction `json:"payments,omitempty"`
+
+	// Additional fields for display
+	AmountDue           float64 `json:"amount_due"`
+	IssuerUsername      string  `json:"issuer_username,omitempty"`
+	IssuerAccountNumber string  `json:"issuer_account_number,omitempty"`
+	RecipientUsername   string  `json:"recipient_username,omitempty"`
+	RecipientEmail      string  `json:"-"`
+}
+
+// InvoiceLine represents a numbered line on an invoice: an item, or a tax on the items' subtotal
+type InvoiceLine struct {
+	ID          int      `json:"id"`
+	LineNumber  int      `json:"line_number"`
+	Kind        string   `json:"kind"` // "item" or "tax"
+	Description string   `json:"description"`
+	Quantity    float64  `json:"quantity,omitempty"`   // Items only
+	UnitPrice   float64  `json:"unit_price,omitempty"` // Items only
+	TaxRate     *float64 `json:"tax_rate,omitempty"`   // Percentage, for taxes charged as a rate
+	Amount      float64  `json:"amount"`
+}
+
+// PaymentRequestGroup represents a split bill: a payment request from its creator to each of several payers
+// for their share of a total
+type PaymentRequestGroup struct {
+	ID            int              `json:"id"`
+	CreatorUserID int              `json:"creator_user_id"`
+	Reason        string           `json:"reason"`
+	Message       string           `json:"message,omitempty"`
+	SplitType     string           `json:"split_type"`   // "equal" or "custom"
+	TotalAmount   float64          `json:"total_amount"` // The whole bill, including the creator's own share if they have one
+	CreatorShare  float64          `json:"creator_share"`
+	ExpiresAt     *time.Time       `json:"expires_at,omitempty"`
+	SettledAt     *time.Time       `json:"settled_at,omitempty"`
+	CancelledAt   *time.Time       `json:"cancelled_at,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Shares        []PaymentRequest `json:"shares,omitempty"`
+
+	// Progress across the shares, for display
+	Status          string  `json:"status"` // "open", "settled", "cancelled" or "incomplete"
+	AmountRequested float64 `json:"amount_requested"`
+	AmountPaid      float64 `json:"amount_paid"`
+	AmountDue       float64 `json:"amount_due"` // Still due on pending shares
+	ShareCount      int     `json:"share_count"`
+	SharesPaid      int     `json:"shares_paid"`
+	CreatorUsername string  `json:"creator_username,omitempty"`
+}
+
+// Escrow represents a buyer's payment held by the bank until it is released to the seller or refunded
+type Escrow struct {
+	ID                      int        `json:"id"`
+	BuyerUserID             int        `json:"buyer_user_id"`
+	SellerUserID            int        `json:"seller_user_id"`
+	Amount                  float64    `json:"amount"`
+	Description             string     `json:"description"`
+	Status                  string     `json:"status"`         // "held", "disputed", "released" or "refunded"
+	TimeoutAction           string     `json:"timeout_action"` // "release" or "refund", taken automatically at expires_at
+	ExpiresAt               time.Time  `json:"expires_at"`
+	HoldTransactionID       *int       `json:"hold_transaction_id,omitempty"`
+	SettlementTransactionID *int       `json:"settlement_transaction_id,omitempty"`
+	SettledBy               string     `json:"settled_by,omitempty"` // e.g. "user:ash", "system:timeout" or the resolving admin
+	SettledAt               *time.Time `json:"settled_at,omitempty"`
+	DisputedBy              *int       `json:"disputed_by,omitempty"`
+	DisputeReason           string     `json:"dispute_reason,omitempty"`
+	DisputedAt              *time.Time `json:"disputed_at,omitempty"`
+	ResolutionNote          string     `json:"resolution_note,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+
+	// Additional fields for display
+	BuyerUsername  string        `json:"buyer_username,omitempty"`
+	SellerUsername string        `json:"seller_username,omitempty"`
+	Transactions   []Transaction `json:"transactions,omitempty"`
+}
+
+// SavingsPot represents a named sub-account holding part of a user's money, earning interest
+type SavingsPot struct {
+	ID                int        `json:"id"`
+	UserID            int        `json:"user_id"`
+	Name              string     `json:"name"`
+	Type              string     `json:"type"` // "savings" or "goal"
+	Balance           float64    `json:"balance"`
+	TargetAmount      *float64   `json:"target_amount,omitempty"` // Goal pots only
+	AccruedInterest   float64    `json:"accrued_interest"`        // Interest earned but not yet paid, below a cent or waiting to compound
+	InterestAccruedOn string     `json:"interest_accrued_on"`     // YYYY-MM-DD, the last day interest was accrued for
+	ClosedAt          *time.Time `json:"closed_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+
+	// Additional fields for display
+	InterestRate float64       `json:"interest_rate"` // Annual percentage for the pot's type
+	Compounding  string        `json:"compounding"`
+	GoalProgress *float64      `json:"goal_progress,omitempty"` // Percentage of the target saved
+	GoalReached  bool          `json:"goal_reached,omitempty"`
+	Transactions []Transaction `json:"transactions,omitempty"`
+}
+
+// SavingsRate is the admin-configured interest rate for one type of savings pot
+type SavingsRate struct {
+	PotType     string    `json:"pot_type"`
+	AnnualRate  float64   `json:"annual_rate"` // Percent per year
+	Compounding string    `json:"compounding"` // "daily" or "monthly"
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SharedAccount is an account several users hold together, such as a guild treasury. It is a users row that
+// can't sign in, used by its members through the account_id selector.
+type SharedAccount struct {
+	ID                int       `json:"id"` // The account's user ID
+	Name              string    `json:"name"`
+	AccountNumber     string    `json:"account_number"`
+	Balance           float64   `json:"balance"`
+	Status            string    `json:"status"`
+	RequiredApprovals int       `json:"required_approvals"` // Signers who must approve each transfer
+	CreatedBy         int       `json:"created_by"`
+	CreatedAt         time.Time `json:"created_at"`
+
+	// Additional fields for display
+	Role    string          `json:"role,omitempty"` // The requesting member's role
+	Members []AccountMember `json:"members,omitempty"`
+}
+
+// AccountMember is a user's membership of a shared account
+type AccountMember struct {
+	AccountID  int       `json:"account_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	Role       string    `json:"role"`                  // "owner", "spender" or "viewer"
+	SpendLimit *float64  `json:"spend_limit,omitempty"` // Spenders: most they can send per day (UTC); nil for no limit
+	AddedBy    int       `json:"added_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SharedTransfer is a transfer out of a shared account, waiting for or carried out after its approvals
+type SharedTransfer struct {
+	ID                int        `json:"id"`
+	AccountID         int        `json:"account_id"`
+	InitiatedBy       int        `json:"initiated_by"`
+	ToUserID          int        `json:"to_user_id"`
+	Amount            float64    `json:"amount"`
+	Description       string     `json:"description"`
+	Status            string     `json:"status"` // "pending", "executed", "rejected" or "cancelled"
+	ApprovalsRequired int        `json:"approvals_required"`
+	TransactionID     *int       `json:"transaction_id,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+
+	// Additional fields for display
+	InitiatorUsername string   `json:"initiator_username,omitempty"`
+	ToUsername        string   `json:"to_username,omitempty"`
+	ApprovedBy        []string `json:"approved_by"`
+	RejectedBy        []string `json:"rejected_by,omitempty"`
+}
+
+// LoanProduct is a kind of loan PokéBank offers, with a fixed interest rate and term
+type LoanProduct struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	AnnualRate float64   `json:"annual_rate"` // Percent per year
+	TermMonths int       `json:"term_months"`
+	MinAmount  float64   `json:"min_amount"`
+	MaxAmount  float64   `json:"max_amount"`
+	IsActive   bool      `json:"is_active"` // Only active products take applications
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Loan is a user's loan from PokéBank, from application until it is paid off
+type Loan struct {
+	ID                        int        `json:"id"`
+	UserID                    int        `json:"user_id"`
+	ProductID                 int        `json:"product_id"`
+	Principal                 float64    `json:"principal"`
+	AnnualRate                float64    `json:"annual_rate"` // The product's rate when applying
+	TermMonths                int        `json:"term_months"`
+	MonthlyPayment            float64    `json:"monthly_payment"`
+	Purpose                   string     `json:"purpose,omitempty"`
+	Status                    string     `json:"status"` // "pending", "active", "paid_off", "rejected" or "cancelled"
+	DecidedBy                 string     `json:"decided_by,omitempty"`
+	DecisionNote              string     `json:"decision_note,omitempty"`
+	DisbursementTransactionID *int       `json:"disbursement_transaction_id,omitempty"`
+	CreatedAt                 time.Time  `json:"created_at"`
+	DecidedAt                 *time.Time `json:"decided_at,omitempty"`
+	PaidOffAt                 *time.Time `json:"paid_off_at,omitempty"`
+
+	// Additional fields for display
+	Username             string            `json:"username,omitempty"`
+	ProductName          string            `json:"product_name,omitempty"`
+	OutstandingPrincipal float64           `json:"outstanding_principal"`
+	PayoffAmount         float64           `json:"payoff_amount,omitempty"` // Active loans: what paying off early costs today
+	MissedPayments       int               `json:"missed_payments"`         // Installments currently overdue
+	Schedule             []LoanInstallment `json:"schedule,omitempty"`
+}
+
+// LoanInstallment is one monthly repayment in a loan's amortisation schedule
+type LoanInstallment struct {
+	ID            int        `json:"id"`
+	LoanID        int        `json:"loan_id"`
+	Number        int        `json:"number"`
+	DueDate       string     `json:"due_date"` // YYYY-MM-DD (UTC)
+	Principal     float64    `json:"principal"`
+	Interest      float64    `json:"interest"`
+	Amount        float64    `json:"amount"`
+	Status        string     `json:"status"` // "scheduled", "paid", "missed" or "paid_off"
+	TransactionID *int       `json:"transaction_id,omitempty"`
+	MissedAt      *time.Time `json:"missed_at,omitempty"` // Kept once a missed installment is paid
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+}
+
+// CardAuthorization represents a merchant's charge or hold against a card
+type CardAuthorization struct {
+	ID                int        `json:"id"`
+	CardID            int        `json:"card_id"`
+	CardholderUserID  int        `json:"cardholder_user_id"`
+	MerchantUserID    int        `json:"merchant_user_id"`
+	TransactionID     *int       `json:"transaction_id,omitempty"` // Set once money has moved
+	Amount            float64    `json:"amount"`                   // Amount authorized
+	CapturedAmount    float64    `json:"captured_amount"`
+	MerchantID        *int       `json:"merchant_id,omitempty"` // Set for registered merchants
+	MerchantCategory  string     `json:"merchant_category,omitempty"`
+	MerchantName      string     `json:"merchant_name,omitempty"` // As shown on the cardholder's statement
+	AuthorizationCode string     `json:"authorization_code"`
+	Description       string     `json:"description"`
+	Status            string     `json:"status"` // "approved" (immediate sale), "held", "captured", "voided", "expired", "reversed"
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"` // When an uncaptured hold lapses
+	CreatedAt         time.Time  `json:"created_at"`
+
+	// Additional fields for display
+	CardLast4          string `json:"card_last4,omitempty"`
+	CardholderUsername string `json:"cardholder_username,omitempty"`
+	MerchantUsername   string `json:"merchant_username,omitempty"`
+}
+
+// AccountStatusChange represents one change of a user's account status
+type AccountStatusChange struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserToken represents a one-time token emailed to a user (email verification, password reset)
+type UserToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Purpose   string     `json:"purpose"` // "email_verification", "password_reset"
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AdminCredential represents a named API key for the admin API
+type AdminCredential struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	CreatedBy  string     `json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// AuditLogEntry represents one hash-chained record of an admin action
+type AuditLogEntry struct {
+	ID            int      `json:"id"`
+	Actor         string   `json:"actor"`
+	Role          string   `json:"role"`
+	Method        string   `json:"method"`
+	Route         string   `json:"route"`
+	Path          string   `json:"path"`
+	RequestBody   string   `json:"request_body"`
+	StatusCode    int      `json:"status_code"`
+	TargetUserID  *int     `json:"target_user_id,omitempty"`
+	BalanceBefore *float64 `json:"balance_before,omitempty"`
+	BalanceAfter  *float64 `json:"balance_after,omitempty"`
+	IPAddress     string   `json:"ip_address"`
+	CreatedAt     string   `json:"created_at"` // Stored as text so it hashes identically on verification
+	PrevHash      string   `json:"prev_hash"`
+	Hash          string   `json:"hash"`
+}
+
+// OAuthClient represents a third-party application registered for OAuth2 access
+type OAuthClient struct {
+	ID               int       `json:"id"`
+	ClientID         string    `json:"client_id"`
+	ClientSecretHash string    `json:"-"`
+	Name             string    `json:"name"`
+	RedirectURIs     []string  `json:"redirect_uris"`
+	Scopes           []string  `json:"scopes"`
+	OwnerUserID      *int      `json:"owner_user_id,omitempty"` // Account used by the client_credentials grant
+	IsConfidential   bool      `json:"is_confidential"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// OAuthAccessToken represents an issued OAuth2 access token
+type OAuthAccessToken struct {
+	ID        int       `json:"id"`
+	ClientID  string    `json:"client_id"`
+	UserID    int       `json:"user_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantType string    `json:"grant_type"` // "authorization_code", "client_credentials"
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // InitDB initializes the database connection and creates tables
@@ -153,6 +601,340 @@ func createTables(db *sql.DB) error {
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 		
+		`CREATE TABLE IF NOT EXISTS card_authorizations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			card_id INTEGER NOT NULL REFERENCES cards(id),
+			cardholder_user_id INTEGER NOT NULL REFERENCES users(id),
+			merchant_user_id INTEGER NOT NULL REFERENCES users(id),
+			transaction_id INTEGER REFERENCES transactions(id),
+			amount REAL NOT NULL,
+			authorization_code TEXT UNIQUE NOT NULL,
+			description TEXT,
+			status TEXT NOT NULL DEFAULT 'approved',
+			captured_amount REAL NOT NULL DEFAULT 0,
+			merchant_id INTEGER REFERENCES merchants(id),
+			merchant_category TEXT,
+			merchant_name TEXT,
+			expires_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS merchants (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL COLLATE NOCASE,
+			category_code TEXT NOT NULL,
+			logo_url TEXT,
+			settlement_user_id INTEGER NOT NULL REFERENCES users(id),
+			owner_user_id INTEGER REFERENCES users(id),
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS merchant_api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			merchant_id INTEGER NOT NULL REFERENCES merchants(id),
+			name TEXT NOT NULL,
+			key_hash TEXT UNIQUE NOT NULL,
+			created_by TEXT,
+			last_used_at DATETIME,
+			revoked_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS payment_links (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT UNIQUE NOT NULL,
+			payee_user_id INTEGER NOT NULL REFERENCES users(id),
+			merchant_id INTEGER REFERENCES merchants(id),
+			amount REAL NOT NULL,
+			currency TEXT NOT NULL DEFAULT 'PKD',
+			description TEXT NOT NULL,
+			single_use BOOLEAN NOT NULL DEFAULT FALSE,
+			use_count INTEGER NOT NULL DEFAULT 0,
+			expires_at DATETIME,
+			redirect_url TEXT,
+			callback_url TEXT,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS invoices (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			number TEXT UNIQUE,
+			issuer_user_id INTEGER NOT NULL REFERENCES users(id),
+			recipient_user_id INTEGER NOT NULL REFERENCES users(id),
+			status TEXT NOT NULL DEFAULT 'draft',
+			currency TEXT NOT NULL DEFAULT 'PKD',
+			subtotal REAL NOT NULL DEFAULT 0,
+			tax_total REAL NOT NULL DEFAULT 0,
+			total REAL NOT NULL DEFAULT 0,
+			amount_paid REAL NOT NULL DEFAULT 0,
+			notes TEXT,
+			due_date TEXT NOT NULL,
+			overdue_at DATETIME NOT NULL,
+			sent_at DATETIME,
+			paid_at DATETIME,
+			voided_at DATETIME,
+			last_reminder_at DATETIME,
+			reminder_count INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS invoice_lines (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			invoice_id INTEGER NOT NULL REFERENCES invoices(id),
+			line_number INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			description TEXT NOT NULL,
+			quantity REAL,
+			unit_price REAL,
+			tax_rate REAL,
+			amount REAL NOT NULL
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS payment_request_groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			creator_user_id INTEGER NOT NULL REFERENCES users(id),
+			reason TEXT NOT NULL,
+			message TEXT,
+			split_type TEXT NOT NULL,
+			total_amount REAL NOT NULL,
+			creator_share REAL NOT NULL DEFAULT 0,
+			expires_at DATETIME,
+			settled_at DATETIME,
+			cancelled_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS escrows (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			buyer_user_id INTEGER NOT NULL REFERENCES users(id),
+			seller_user_id INTEGER NOT NULL REFERENCES users(id),
+			amount REAL NOT NULL,
+			description TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'held',
+			timeout_action TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			hold_transaction_id INTEGER REFERENCES transactions(id),
+			settlement_transaction_id INTEGER REFERENCES transactions(id),
+			settled_by TEXT,
+			settled_at DATETIME,
+			disputed_by INTEGER REFERENCES users(id),
+			dispute_reason TEXT,
+			disputed_at DATETIME,
+			resolution_note TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS savings_pots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			name TEXT NOT NULL,
+			pot_type TEXT NOT NULL DEFAULT 'savings',
+			balance REAL NOT NULL DEFAULT 0,
+			target_amount REAL,
+			accrued_interest REAL NOT NULL DEFAULT 0,
+			interest_accrued_on TEXT NOT NULL,
+			closed_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS savings_rates (
+			pot_type TEXT PRIMARY KEY,
+			annual_rate REAL NOT NULL,
+			compounding TEXT NOT NULL DEFAULT 'daily',
+			updated_by TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Starting interest rates; admins change them through /api/admin/savings-rates
+		`INSERT OR IGNORE INTO savings_rates (pot_type, annual_rate, compounding) VALUES ('savings', 2.0, 'daily'), ('goal', 1.0, 'daily')`,
+
+		`CREATE TABLE IF NOT EXISTS shared_accounts (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id),
+			required_approvals INTEGER NOT NULL DEFAULT 1,
+			created_by INTEGER NOT NULL REFERENCES users(id),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS account_members (
+			account_user_id INTEGER NOT NULL REFERENCES users(id),
+			member_user_id INTEGER NOT NULL REFERENCES users(id),
+			role TEXT NOT NULL,
+			spend_limit REAL,
+			added_by INTEGER NOT NULL REFERENCES users(id),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (account_user_id, member_user_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS shared_transfers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_user_id INTEGER NOT NULL REFERENCES users(id),
+			initiated_by INTEGER NOT NULL REFERENCES users(id),
+			to_user_id INTEGER NOT NULL REFERENCES users(id),
+			amount REAL NOT NULL,
+			description TEXT,
+			status TEXT NOT NULL DEFAULT 'pending',
+			approvals_required INTEGER NOT NULL,
+			transaction_id INTEGER REFERENCES transactions(id),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			resolved_at DATETIME
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS shared_transfer_decisions (
+			transfer_id INTEGER NOT NULL REFERENCES shared_transfers(id),
+			member_user_id INTEGER NOT NULL REFERENCES users(id),
+			decision TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (transfer_id, member_user_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS loan_products (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			annual_rate REAL NOT NULL,
+			term_months INTEGER NOT NULL,
+			min_amount REAL NOT NULL,
+			max_amount REAL NOT NULL,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_by TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS loans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			product_id INTEGER NOT NULL REFERENCES loan_products(id),
+			principal REAL NOT NULL,
+			annual_rate REAL NOT NULL,
+			term_months INTEGER NOT NULL,
+			monthly_payment REAL NOT NULL,
+			purpose TEXT,
+			status TEXT NOT NULL DEFAULT 'pending',
+			decided_by TEXT,
+			decision_note TEXT,
+			disbursement_transaction_id INTEGER REFERENCES transactions(id),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			decided_at DATETIME,
+			paid_off_at DATETIME
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS loan_installments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			loan_id INTEGER NOT NULL REFERENCES loans(id),
+			number INTEGER NOT NULL,
+			due_date TEXT NOT NULL,
+			principal REAL NOT NULL,
+			interest REAL NOT NULL,
+			amount REAL NOT NULL,
+			status TEXT NOT NULL DEFAULT 'scheduled',
+			transaction_id INTEGER REFERENCES transactions(id),
+			missed_at DATETIME,
+			paid_at DATETIME,
+			UNIQUE (loan_id, number)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS server_secrets (
+			name TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS oauth_clients (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			client_id TEXT UNIQUE NOT NULL,
+			client_secret_hash TEXT,
+			name TEXT NOT NULL,
+			redirect_uris TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			owner_user_id INTEGER REFERENCES users(id),
+			is_confidential BOOLEAN DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code_hash TEXT UNIQUE NOT NULL,
+			client_id TEXT NOT NULL REFERENCES oauth_clients(client_id),
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			redirect_uri TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			code_challenge TEXT,
+			code_challenge_method TEXT,
+			expires_at DATETIME NOT NULL,
+			used BOOLEAN DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS oauth_access_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_hash TEXT UNIQUE NOT NULL,
+			client_id TEXT NOT NULL REFERENCES oauth_clients(client_id),
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			scopes TEXT NOT NULL,
+			grant_type TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			revoked BOOLEAN DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS account_status_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			old_status TEXT NOT NULL,
+			new_status TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS user_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			token_hash TEXT UNIQUE NOT NULL,
+			purpose TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS admin_credentials (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			key_hash TEXT UNIQUE NOT NULL,
+			role TEXT NOT NULL,
+			created_by TEXT,
+			last_used_at DATETIME,
+			revoked_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS admin_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor TEXT NOT NULL,
+			role TEXT NOT NULL,
+			method TEXT NOT NULL,
+			route TEXT NOT NULL,
+			path TEXT NOT NULL,
+			request_body TEXT,
+			status_code INTEGER NOT NULL,
+			target_user_id INTEGER REFERENCES users(id),
+			balance_before REAL,
+			balance_after REAL,
+			ip_address TEXT,
+			created_at TEXT NOT NULL,
+			prev_hash TEXT NOT NULL,
+			hash TEXT UNIQUE NOT NULL
+		)`,
+		
+		// The audit log is append-only
+		`CREATE TRIGGER IF NOT EXISTS admin_audit_log_no_update BEFORE UPDATE ON admin_audit_log
+		BEGIN SELECT RAISE(ABORT, 'admin audit log is append-only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS admin_audit_log_no_delete BEFORE DELETE ON admin_audit_log
+		BEGIN SELECT RAISE(ABORT, 'admin audit log is append-only'); END`,
+		
 		// Create indexes for better performance
 		`CREATE INDEX IF NOT EXISTS idx_users_username ON users(username)`,
 		`CREATE INDEX IF NOT EXISTS idx_users_account_number ON users(account_number)`,
@@ -165,6 +947,37 @@ func createTables(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON user_sessions(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_cards_user ON cards(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_cards_active ON cards(is_active)`,
+		`CREATE INDEX IF NOT EXISTS idx_cards_number ON cards(card_number)`,
+		`CREATE INDEX IF NOT EXISTS idx_card_authorizations_card ON card_authorizations(card_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_card_authorizations_merchant ON card_authorizations(merchant_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_card_authorizations_status ON card_authorizations(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_merchants_settlement_user ON merchants(settlement_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_merchants_owner ON merchants(owner_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_merchant_api_keys_merchant ON merchant_api_keys(merchant_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_links_payee ON payment_links(payee_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_links_merchant ON payment_links(merchant_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_invoices_issuer ON invoices(issuer_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_invoices_recipient ON invoices(recipient_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_invoices_status ON invoices(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_request_groups_creator ON payment_request_groups(creator_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_escrows_buyer ON escrows(buyer_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_escrows_seller ON escrows(seller_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_escrows_status ON escrows(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_savings_pots_user ON savings_pots(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_account_members_member ON account_members(member_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_shared_transfers_account ON shared_transfers(account_user_id, status)`,
+		`CREATE INDEX IF NOT EXISTS idx_loans_user ON loans(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_loans_status ON loans(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_loan_installments_due ON loan_installments(status, due_date)`,
+		`CREATE INDEX IF NOT EXISTS idx_invoice_lines_invoice ON invoice_lines(invoice_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_account_status_history_user ON account_status_history(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens(user_id, purpose)`,
+		`CREATE INDEX IF NOT EXISTS idx_admin_credentials_hash ON admin_credentials(key_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON admin_audit_log(actor)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON admin_audit_log(target_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_oauth_codes_hash ON oauth_authorization_codes(code_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_oauth_tokens_hash ON oauth_access_tokens(token_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_oauth_tokens_client ON oauth_access_tokens(client_id)`,
 	}
 
 	for _, query := range queries {
@@ -173,5 +986,144 @@ func createTables(db *sql.DB) error {
 		}
 	}
 
+	// Add columns introduced after a table was first created
+	for _, m := range columnMigrations {
+		if err := addColumnIfMissing(db, m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("failed to migrate %s.%s: %v", m.table, m.column, err)
+		}
+	}
+	for _, query := range migratedIndexes {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %v", err)
+		}
+	}
+	for _, query := range dataMigrations {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %v", err)
+		}
+	}
+
 	return nil
 }
+
+// columnMigrations lists columns added to existing tables, applied in order on startup
+var columnMigrations = []struct {
+	table, column, definition string
+}{
+	{"users", "email_verified", "BOOLEAN DEFAULT FALSE"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'player'"},
+	{"users", "status", "TEXT NOT NULL DEFAULT 'active'"},
+	{"card_authorizations", "captured_amount", "REAL NOT NULL DEFAULT 0"},
+	{"card_authorizations", "expires_at", "DATETIME"},
+	{"cards", "pin_hash", "TEXT"},
+	{"cards", "pin_failed_attempts", "INTEGER NOT NULL DEFAULT 0"},
+	{"cards", "is_frozen", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"cards", "daily_limit", "REAL"},
+	{"cards", "transaction_limit", "REAL"},
+	{"cards", "allowed_categories", "TEXT"},
+	{"cards", "blocked_categories", "TEXT"},
+	{"card_authorizations", "merchant_category", "TEXT"},
+	{"cards", "name", "TEXT NOT NULL DEFAULT 'Main card'"},
+	{"cards", "card_type", "TEXT NOT NULL DEFAULT 'standard'"},
+	{"cards", "is_primary", "BOOLEAN NOT NULL DEFAULT TRUE"}, // Every card issued before multiple cards was primary
+	{"cards", "valid_until", "DATETIME"},
+	{"cards", "deactivated_at", "DATETIME"},
+	{"cards", "expires_at", "DATETIME"}, // Backfilled from expiry_date by the card expiry job
+	{"cards", "expiry_notified_at", "DATETIME"},
+	{"cards", "replaced_by_card_id", "INTEGER REFERENCES cards(id)"},
+	{"transactions", "card_id", "INTEGER REFERENCES cards(id)"},
+	{"transactions", "merchant_name", "TEXT"},
+	{"transactions", "merchant_category", "TEXT"},
+	{"card_authorizations", "merchant_name", "TEXT"},
+	{"transactions", "merchant_id", "INTEGER REFERENCES merchants(id)"},
+	{"transactions", "original_transaction_id", "INTEGER REFERENCES transactions(id)"},
+	{"payment_requests", "merchant_id", "INTEGER REFERENCES merchants(id)"},
+	{"card_authorizations", "merchant_id", "INTEGER REFERENCES merchants(id)"},
+	{"transactions", "payment_link_id", "INTEGER REFERENCES payment_links(id)"},
+	{"transactions", "invoice_id", "INTEGER REFERENCES invoices(id)"},
+	{"transactions", "payment_request_id", "INTEGER REFERENCES payment_requests(id)"},
+	{"payment_requests", "amount_paid", "REAL NOT NULL DEFAULT 0"},
+	{"payment_requests", "expires_at", "DATETIME"},
+	{"payment_requests", "last_reminder_at", "DATETIME"},
+	{"payment_requests", "reminder_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"payment_requests", "group_id", "INTEGER REFERENCES payment_request_groups(id)"},
+	{"transactions", "escrow_id", "INTEGER REFERENCES escrows(id)"},
+	{"transactions", "from_pot_id", "INTEGER REFERENCES savings_pots(id)"},
+	{"transactions", "to_pot_id", "INTEGER REFERENCES savings_pots(id)"},
+	{"transactions", "loan_id", "INTEGER REFERENCES loans(id)"},
+	{"cards", "cvv_failed_attempts", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migratedIndexes index columns added by columnMigrations, so they run after the migrations
+var migratedIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_transactions_card ON transactions(card_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_merchant ON transactions(merchant_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_original ON transactions(original_transaction_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_payment_link ON transactions(payment_link_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_invoice ON transactions(invoice_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_payment_request ON transactions(payment_request_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_payment_requests_status ON payment_requests(status)`,
+	`CREATE INDEX IF NOT EXISTS idx_payment_requests_group ON payment_requests(group_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_escrow ON transactions(escrow_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_from_pot ON transactions(from_pot_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_to_pot ON transactions(to_pot_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_transactions_loan ON transactions(loan_id)`,
+}
+
+// dataMigrations rewrite rows stored in an older format; each is safe to run on every startup
+var dataMigrations = []string{
+	// Debit adjustments used to store a negative amount; from/to already give the direction
+	`UPDATE transactions SET amount = ABS(amount) WHERE transaction_type = 'admin_adjustment' AND amount < 0`,
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// getOrCreateServerSecret returns a named random secret, generating and storing it on first use
+func getOrCreateServerSecret(db *sql.DB, name string) (string, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM server_secrets WHERE name = ?`, name).Scan(&value)
+	if err == nil {
+		return value, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	value, err = generateSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Another instance may have stored the secret first; keep whichever won
+	if _, err = db.Exec(`INSERT OR IGNORE INTO server_secrets (name, value) VALUES (?, ?)`, name, value); err != nil {
+		return "", err
+	}
+	err = db.QueryRow(`SELECT value FROM server_secrets WHERE name = ?`, name).Scan(&value)
+	return value, err
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthHandler handles OAuth2 authorization server HTTP requests
+type OAuthHandler struct {
+	oauthService   *OAuthService
+	userService    *UserService
+	webhookService *WebhookService
+}
+
+// NewOAuthHandler creates a new OAuthHandler
+func NewOAuthHandler(oauthService *OAuthService, userService *UserService, webhookService *WebhookService) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService:   oauthService,
+		userService:    userService,
+		webhookService: webhookService,
+	}
+}
+
+// CreateOAuthClientRequest represents a client registration request
+type CreateOAuthClientRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	RedirectURIs   []string `json:"redirect_uris"`
+	Scopes         []string `json:"scopes" binding:"required"`
+	OwnerAccount   string   `json:"owner_account"`   // Username or account number used by client_credentials
+	IsConfidential *bool    `json:"is_confidential"` // Defaults to true
+}
+
+// AuthorizeRequest represents a user's consent decision
+type AuthorizeRequest struct {
+	ClientID            string `json:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" binding:"required"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// CreateClientHandler handles POST /api/admin/oauth/clients
+func (h *OAuthHandler) CreateClientHandler(c *gin.Context) {
+	var req CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	for _, redirectURI := range req.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Fragment != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redirect URI", "details": redirectURI})
+			return
+		}
+	}
+
+	isConfidential := true
+	if req.IsConfidential != nil {
+		isConfidential = *req.IsConfidential
+	}
+
+	// Resolve the owner account for the client_credentials grant
+	var ownerUserID *int
+	if req.OwnerAccount != "" {
+		owner, err := h.userService.GetUserByUsernameOrAccountNumber(req.OwnerAccount)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Owner account not found"})
+			return
+		}
+		ownerUserID = &owner.ID
+	}
+
+	client, secret, err := h.oauthService.CreateClient(req.Name, req.RedirectURIs, req.Scopes, ownerUserID, isConfidential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"success": true,
+		"message": "OAuth client created successfully",
+		"client":  client,
+	}
+	if secret != "" {
+		// The secret is only ever shown once
+		response["client_secret"] = secret
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetClientsHandler handles GET /api/admin/oauth/clients
+func (h *OAuthHandler) GetClientsHandler(c *gin.Context) {
+	clients, err := h.oauthService.GetAllClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get OAuth clients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"clients": clients,
+	})
+}
+
+// DeleteClientHandler handles DELETE /api/admin/oauth/clients/:client_id
+func (h *OAuthHandler) DeleteClientHandler(c *gin.Context) {
+	if err := h.oauthService.DeleteClient(c.Param("client_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "OAuth client deleted and its tokens revoked",
+	})
+}
+
+// GetAuthorizationHandler handles GET /api/oauth/authorize, describing the client for the consent page
+func (h *OAuthHandler) GetAuthorizationHandler(c *gin.Context) {
+	client, scopes, err := h.oauthService.ValidateAuthorizationRequest(
+		c.Query("client_id"), c.Query("redirect_uri"), c.Query("scope"),
+		c.Query("code_challenge"), c.Query("code_challenge_method"),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("response_type") != "code" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "response_type must be code"})
+		return
+	}
+
+	user := c.MustGet("user").(*User)
+
+	c.JSON(http.StatusOK, gin.H{
+		"client_name": client.Name,
+		"client_id":   client.ClientID,
+		"scopes":      scopes,
+		"username":    user.Username,
+	})
+}
+
+// AuthorizeHandler handles POST /api/oauth/authorize, recording the user's consent decision
+func (h *OAuthHandler) AuthorizeHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req AuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	client, scopes, err := h.oauthService.ValidateAuthorizationRequest(req.ClientID, req.RedirectURI, req.Scope, req.CodeChallenge, req.CodeChallengeMethod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	redirectURL, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redirect URI"})
+		return
+	}
+
+	params := redirectURL.Query()
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !req.Approve {
+		params.Set("error", "access_denied")
+		redirectURL.RawQuery = params.Encode()
+		c.JSON(http.StatusOK, gin.H{"redirect_url": redirectURL.String()})
+		return
+	}
+
+	code, err := h.oauthService.CreateAuthorizationCode(client.ClientID, userID, req.RedirectURI, scopes, req.CodeChallenge, req.CodeChallengeMethod)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create authorization code"})
+		return
+	}
+
+	params.Set("code", code)
+	redirectURL.RawQuery = params.Encode()
+
+	// Send webhook notification
+	user := c.MustGet("user").(*User)
+	go h.webhookService.SendUserAuthWebhook(user.ID, user.Username, user.Email, "oauth_authorize")
+
+	c.JSON(http.StatusOK, gin.H{"redirect_url": redirectURL.String()})
+}
+
+// TokenHandler handles POST /api/oauth/token
+func (h *OAuthHandler) TokenHandler(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	var token string
+	var accessToken *OAuthAccessToken
+	var err error
+
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		token, accessToken, err = h.oauthService.ExchangeAuthorizationCode(client, c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+	case "client_credentials":
+		token, accessToken, err = h.oauthService.IssueClientCredentialsToken(client, c.PostForm("scope"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(time.Until(accessToken.ExpiresAt).Seconds()),
+		"scope":        strings.Join(accessToken.Scopes, " "),
+	})
+}
+
+// RevokeHandler handles POST /api/oauth/revoke
+func (h *OAuthHandler) RevokeHandler(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if err := h.oauthService.RevokeToken(client, c.PostForm("token")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// IntrospectHandler handles POST /api/oauth/introspect
+func (h *OAuthHandler) IntrospectHandler(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.oauthService.IntrospectToken(client, c.PostForm("token")))
+}
+
+// authenticateClient reads client credentials from HTTP Basic auth or the form body
+func (h *OAuthHandler) authenticateClient(c *gin.Context) (*OAuthClient, bool) {
+	clientID, clientSecret, hasBasic := c.Request.BasicAuth()
+	if !hasBasic {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+
+	client, err := h.oauthService.AuthenticateClient(clientID, clientSecret)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client", "error_description": err.Error()})
+		return nil, false
+	}
+
+	return client, true
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OAuth2 scopes that can be granted to third-party clients
+const (
+	ScopeAccountRead      = "account:read"
+	ScopeTransactionsRead = "transactions:read"
+	ScopeTransfer         = "transfer"
+	ScopePaymentRequests  = "payment_requests"
+	ScopeCard             = "card"
+)
+
+// validOAuthScopes lists every scope a client may be registered with
+var validOAuthScopes = map[string]bool{
+	ScopeAccountRead:      true,
+	ScopeTransactionsRead: true,
+	ScopeTransfer:         true,
+	ScopePaymentRequests:  true,
+	ScopeCard:             true,
+}
+
+// oauthAccessTokenPrefix distinguishes OAuth access tokens from session tokens
+const oauthAccessTokenPrefix = "pba_"
+
+// OAuthService handles OAuth2 clients, authorization codes and access tokens
+type OAuthService struct {
+	db          *sql.DB
+	userService *UserService
+}
+
+// NewOAuthService creates a new OAuthService
+func NewOAuthService(db *sql.DB, userService *UserService) *OAuthService {
+	return &OAuthService{db: db, userService: userService}
+}
+
+// CreateClient registers a new OAuth2 client and returns it along with its plaintext secret.
+// Public clients (isConfidential = false) get no secret and must use PKCE.
+func (s *OAuthService) CreateClient(name string, redirectURIs, scopes []string, ownerUserID *int, isConfidential bool) (*OAuthClient, string, error) {
+	if err := validateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	if len(redirectURIs) == 0 && ownerUserID == nil {
+		return nil, "", fmt.Errorf("a client needs at least one redirect URI or an owner account")
+	}
+
+	if ownerUserID != nil && !isConfidential {
+		return nil, "", fmt.Errorf("only confidential clients can use the client_credentials grant")
+	}
+
+	if ownerUserID != nil {
+		if _, err := s.userService.GetUserByID(*ownerUserID); err != nil {
+			return nil, "", fmt.Errorf("owner user not found")
+		}
+	}
+
+	clientID, err := generateOAuthToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var secret, secretHash string
+	if isConfidential {
+		secret, err = generateOAuthToken(32)
+		if err != nil {
+			return nil, "", err
+		}
+
+		hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		secretHash = string(hashed)
+	}
+
+	query := `
+		INSERT INTO oauth_clients (client_id, client_secret_hash, name, redirect_uris, scopes, owner_user_id, is_confidential)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = s.db.Exec(query, clientID, secretHash, name, strings.Join(redirectURIs, " "), strings.Join(scopes, " "), ownerUserID, isConfidential)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, secret, nil
+}
+
+// GetClient retrieves a registered client by its client ID
+func (s *OAuthService) GetClient(clientID string) (*OAuthClient, error) {
+	query := `
+		SELECT id, client_id, client_secret_hash, name, redirect_uris, scopes, owner_user_id, is_confidential, created_at
+		FROM oauth_clients WHERE client_id = ?
+	`
+
+	return scanOAuthClient(s.db.QueryRow(query, clientID))
+}
+
+// GetAllClients returns every registered client (admin function)
+func (s *OAuthService) GetAllClients() ([]OAuthClient, error) {
+	query := `
+		SELECT id, client_id, client_secret_hash, name, redirect_uris, scopes, owner_user_id, is_confidential, created_at
+		FROM oauth_clients
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+
+	return clients, nil
+}
+
+// DeleteClient removes a client and revokes every token issued to it
+func (s *OAuthService) DeleteClient(clientID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM oauth_clients WHERE client_id = ?`, clientID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("client not found")
+	}
+
+	if _, err = tx.Exec(`UPDATE oauth_access_tokens SET revoked = TRUE WHERE client_id = ?`, clientID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM oauth_authorization_codes WHERE client_id = ?`, clientID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AuthenticateClient verifies a client's credentials. Public clients authenticate with their ID alone.
+func (s *OAuthService) AuthenticateClient(clientID, clientSecret string) (*OAuthClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client")
+	}
+
+	if client.IsConfidential {
+		if clientSecret == "" {
+			return nil, fmt.Errorf("client authentication required")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(client.ClientSecretHash), []byte(clientSecret)) != nil {
+			return nil, fmt.Errorf("invalid client")
+		}
+	}
+
+	return client, nil
+}
+
+// ValidateAuthorizationRequest checks the parameters of an authorization request against the client registration
+func (s *OAuthService) ValidateAuthorizationRequest(clientID, redirectURI, scope, codeChallenge, codeChallengeMethod string) (*OAuthClient, []string, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown client")
+	}
+
+	if !client.hasRedirectURI(redirectURI) {
+		return nil, nil, fmt.Errorf("redirect_uri is not registered for this client")
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, requested := range scopes {
+		if !containsScope(client.Scopes, requested) {
+			return nil, nil, fmt.Errorf("scope %q is not allowed for this client", requested)
+		}
+	}
+
+	if codeChallenge == "" && !client.IsConfidential {
+		return nil, nil, fmt.Errorf("public clients must use PKCE")
+	}
+	if codeChallengeMethod != "" && codeChallengeMethod != "S256" && codeChallengeMethod != "plain" {
+		return nil, nil, fmt.Errorf("unsupported code_challenge_method")
+	}
+
+	return client, scopes, nil
+}
+
+// CreateAuthorizationCode issues a short-lived, single-use authorization code for a consenting user
+func (s *OAuthService) CreateAuthorizationCode(clientID string, userID int, redirectURI string, scopes []string, codeChallenge, codeChallengeMethod string) (string, error) {
+	code, err := generateOAuthToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if codeChallenge != "" && codeChallengeMethod == "" {
+		codeChallengeMethod = "plain"
+	}
+
+	// Authorization codes expire after 10 minutes
+	expiresAt := time.Now().Add(10 * time.Minute)
+
+	query := `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, code_challenge_method, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = s.db.Exec(query, hashToken(code), clientID, userID, redirectURI, strings.Join(scopes, " "), codeChallenge, codeChallengeMethod, expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode redeems an authorization code for an access token
+func (s *OAuthService) ExchangeAuthorizationCode(client *OAuthClient, code, redirectURI, codeVerifier string) (string, *OAuthAccessToken, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	var codeID, userID int
+	var storedClientID, storedRedirectURI, scopes string
+	var codeChallenge, codeChallengeMethod sql.NullString
+	var expiresAt time.Time
+	var used bool
+
+	err = tx.QueryRow(`
+		SELECT id, client_id, user_id, redirect_uri, scopes, code_challenge, code_challenge_method, expires_at, used
+		FROM oauth_authorization_codes WHERE code_hash = ?
+	`, hashToken(code)).Scan(
+		&codeID, &storedClientID, &userID, &storedRedirectURI, &scopes,
+		&codeChallenge, &codeChallengeMethod, &expiresAt, &used,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, fmt.Errorf("invalid authorization code")
+		}
+		return "", nil, err
+	}
+
+	if used {
+		// A replayed code suggests it leaked, so revoke everything issued from it
+		tx.Exec(`UPDATE oauth_access_tokens SET revoked = TRUE WHERE client_id = ? AND user_id = ? AND grant_type = 'authorization_code'`, storedClientID, userID)
+		tx.Commit()
+		return "", nil, fmt.Errorf("authorization code has already been used")
+	}
+
+	if storedClientID != client.ClientID || storedRedirectURI != redirectURI {
+		return "", nil, fmt.Errorf("invalid authorization code")
+	}
+
+	if time.Now().After(expiresAt) {
+		return "", nil, fmt.Errorf("authorization code has expired")
+	}
+
+	if codeChallenge.Valid && codeChallenge.String != "" {
+		if !verifyPKCE(codeVerifier, codeChallenge.String, codeChallengeMethod.String) {
+			return "", nil, fmt.Errorf("invalid code_verifier")
+		}
+	}
+
+	if _, err = tx.Exec(`UPDATE oauth_authorization_codes SET used = TRUE WHERE id = ?`, codeID); err != nil {
+		return "", nil, err
+	}
+
+	token, accessToken, err := s.issueAccessToken(tx, client.ClientID, userID, strings.Fields(scopes), "authorization_code")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", nil, err
+	}
+
+	return token, accessToken, nil
+}
+
+// IssueClientCredentialsToken issues a token acting as the client's owner account
+func (s *OAuthService) IssueClientCredentialsToken(client *OAuthClient, scope string) (string, *OAuthAccessToken, error) {
+	if client.OwnerUserID == nil || !client.IsConfidential {
+		return "", nil, fmt.Errorf("client is not allowed to use the client_credentials grant")
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, requested := range scopes {
+		if !containsScope(client.Scopes, requested) {
+			return "", nil, fmt.Errorf("scope %q is not allowed for this client", requested)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	token, accessToken, err := s.issueAccessToken(tx, client.ClientID, *client.OwnerUserID, scopes, "client_credentials")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", nil, err
+	}
+
+	return token, accessToken, nil
+}
+
+// GetAccessToken retrieves a valid (unexpired, unrevoked) access token
+func (s *OAuthService) GetAccessToken(token string) (*OAuthAccessToken, error) {
+	accessToken, err := s.lookupAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if accessToken.Revoked || time.Now().After(accessToken.ExpiresAt) {
+		return nil, fmt.Errorf("token is no longer active")
+	}
+
+	return accessToken, nil
+}
+
+// RevokeToken revokes a token issued to the given client. Unknown tokens are ignored as per RFC 7009.
+func (s *OAuthService) RevokeToken(client *OAuthClient, token string) error {
+	_, err := s.db.Exec(`UPDATE oauth_access_tokens SET revoked = TRUE WHERE token_hash = ? AND client_id = ?`, hashToken(token), client.ClientID)
+	return err
+}
+
+// IntrospectToken describes a token for the client it was issued to, following RFC 7662
+func (s *OAuthService) IntrospectToken(client *OAuthClient, token string) map[string]interface{} {
+	accessToken, err := s.GetAccessToken(token)
+	if err != nil || accessToken.ClientID != client.ClientID {
+		return map[string]interface{}{"active": false}
+	}
+
+	response := map[string]interface{}{
+		"active":     true,
+		"scope":      strings.Join(accessToken.Scopes, " "),
+		"client_id":  accessToken.ClientID,
+		"token_type": "Bearer",
+		"exp":        accessToken.ExpiresAt.Unix(),
+		"iat":        accessToken.CreatedAt.Unix(),
+		"sub":        strconv.Itoa(accessToken.UserID),
+	}
+
+	if user, err := s.userService.GetUserByID(accessToken.UserID); err == nil {
+		response["username"] = user.Username
+	}
+
+	return response
+}
+
+// issueAccessToken creates a new access token inside an existing transaction
+func (s *OAuthService) issueAccessToken(tx *sql.Tx, clientID string, userID int, scopes []string, grantType string) (string, *OAuthAccessToken, error) {
+	random, err := generateOAuthToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token := oauthAccessTokenPrefix + random
+
+	ttlMinutes, err := strconv.Atoi(getEnv("OAUTH_TOKEN_TTL_MINUTES", "60"))
+	if err != nil || ttlMinutes <= 0 {
+		ttlMinutes = 60
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(ttlMinutes) * time.Minute)
+
+	result, err := tx.Exec(`
+		INSERT INTO oauth_access_tokens (token_hash, client_id, user_id, scopes, grant_type, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, hashToken(token), clientID, userID, strings.Join(scopes, " "), grantType, expiresAt, now)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tokenID, err := result.LastInsertId()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &OAuthAccessToken{
+		ID:        int(tokenID),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		GrantType: grantType,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}, nil
+}
+
+// lookupAccessToken retrieves an access token regardless of its state
+func (s *OAuthService) lookupAccessToken(token string) (*OAuthAccessToken, error) {
+	query := `
+		SELECT id, client_id, user_id, scopes, grant_type, expires_at, revoked, created_at
+		FROM oauth_access_tokens WHERE token_hash = ?
+	`
+
+	accessToken := &OAuthAccessToken{}
+	var scopes string
+	err := s.db.QueryRow(query, hashToken(token)).Scan(
+		&accessToken.ID, &accessToken.ClientID, &accessToken.UserID, &scopes,
+		&accessToken.GrantType, &accessToken.ExpiresAt, &accessToken.Revoked, &accessToken.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken.Scopes = strings.Fields(scopes)
+	return accessToken, nil
+}
+
+// hasRedirectURI reports whether the URI exactly matches one of the client's registered redirect URIs
+func (c *OAuthClient) hasRedirectURI(redirectURI string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOAuthClient scans a client row into an OAuthClient
+func scanOAuthClient(row rowScanner) (*OAuthClient, error) {
+	client := &OAuthClient{}
+	var secretHash sql.NullString
+	var redirectURIs, scopes string
+	var ownerUserID sql.NullInt64
+
+	err := row.Scan(
+		&client.ID, &client.ClientID, &secretHash, &client.Name, &redirectURIs,
+		&scopes, &ownerUserID, &client.IsConfidential, &client.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client.ClientSecretHash = secretHash.String
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.Scopes = strings.Fields(scopes)
+	if ownerUserID.Valid {
+		id := int(ownerUserID.Int64)
+		client.OwnerUserID = &id
+	}
+
+	return client, nil
+}
+
+// validateScopes checks that every scope is known
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !validOAuthScopes[scope] {
+			return fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+	return nil
+}
+
+// containsScope reports whether scope is present in scopes
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPKCE checks a code verifier against the stored code challenge (RFC 7636)
+func verifyPKCE(codeVerifier, codeChallenge, method string) bool {
+	if codeVerifier == "" {
+		return false
+	}
+
+	expected := codeVerifier
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(codeVerifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+// generateOAuthToken generates a random hex-encoded token of n bytes
+func generateOAuthToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// hashToken hashes a token for storage so plaintext tokens never touch the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentLinkHandler handles payment links, for players, for merchants through the merchant API and for
+// the public payment page
+type PaymentLinkHandler struct {
+	paymentLinkService *PaymentLinkService
+	webhookService     *WebhookService
+}
+
+// NewPaymentLinkHandler creates a new PaymentLinkHandler
+func NewPaymentLinkHandler(paymentLinkService *PaymentLinkService, webhookService *WebhookService) *PaymentLinkHandler {
+	return &PaymentLinkHandler{
+		paymentLinkService: paymentLinkService,
+		webhookService:     webhookService,
+	}
+}
+
+// CreatePaymentLinkRequest represents a request to create a payment link
+type CreatePaymentLinkRequest struct {
+	Amount      float64    `json:"amount" binding:"required,gt=0"`
+	Currency    string     `json:"currency"` // Defaults to PKD, the only supported currency
+	Description string     `json:"description" binding:"required"`
+	SingleUse   bool       `json:"single_use"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RedirectURL string     `json:"redirect_url"`
+	CallbackURL string     `json:"callback_url"`
+}
+
+// CreatePaymentLinkHandler handles POST /api/payment-links and POST /api/merchant/payment-links
+func (h *PaymentLinkHandler) CreatePaymentLinkHandler(c *gin.Context) {
+	var req CreatePaymentLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	payeeUserID, merchantID := linkPayee(c)
+	link, err := h.paymentLinkService.CreatePaymentLink(payeeUserID, merchantID, PaymentLinkOptions{
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Description: req.Description,
+		SingleUse:   req.SingleUse,
+		ExpiresAt:   req.ExpiresAt,
+		RedirectURL: req.RedirectURL,
+		CallbackURL: req.CallbackURL,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create payment link", "details": err.Error()})
+		return
+	}
+	link.URL = paymentLinkURL(link.Code)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":      true,
+		"message":      "Payment link created successfully",
+		"payment_link": link,
+	})
+}
+
+// GetPaymentLinksHandler handles GET /api/payment-links and GET /api/merchant/payment-links
+func (h *PaymentLinkHandler) GetPaymentLinksHandler(c *gin.Context) {
+	var links []PaymentLink
+	var err error
+	if payeeUserID, merchantID := linkPayee(c); merchantID != nil {
+		links, err = h.paymentLinkService.GetMerchantPaymentLinks(*merchantID)
+	} else {
+		links, err = h.paymentLinkService.GetUserPaymentLinks(payeeUserID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment links"})
+		return
+	}
+
+	for i := range links {
+		links[i].URL = paymentLinkURL(links[i].Code)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"payment_links": links,
+	})
+}
+
+// DeactivatePaymentLinkHandler handles DELETE /api/payment-links/:code and DELETE /api/merchant/payment-links/:code
+func (h *PaymentLinkHandler) DeactivatePaymentLinkHandler(c *gin.Context) {
+	link, err := h.paymentLinkService.GetPaymentLinkByCode(c.Param("code"))
+	if err != nil || !ownsPaymentLink(c, link) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment link not found"})
+		return
+	}
+
+	link, err = h.paymentLinkService.DeactivatePaymentLink(link.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate payment link"})
+		return
+	}
+	link.URL = paymentLinkURL(link.Code)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"message":      "Payment link deactivated",
+		"payment_link": link,
+	})
+}
+
+// GetCallbackSecretHandler handles GET /api/payment-links/callback-secret and
+// GET /api/merchant/payment-links/callback-secret, returning the secret that signs the payee's callbacks
+func (h *PaymentLinkHandler) GetCallbackSecretHandler(c *gin.Context) {
+	payeeUserID, _ := linkPayee(c)
+	secret, err := h.paymentLinkService.CallbackSecret(payeeUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get callback secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":          true,
+		"callback_secret":  secret,
+		"signature_header": webhookSignatureHeader,
+	})
+}
+
+// GetPublicPaymentLinkHandler handles GET /api/pay/:code, describing a payment link for the payment page
+func (h *PaymentLinkHandler) GetPublicPaymentLinkHandler(c *gin.Context) {
+	link, err := h.paymentLinkService.GetPaymentLinkByCode(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment link not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"payment_link": publicPaymentLink(link),
+	})
+}
+
+// PayPaymentLinkHandler handles POST /api/pay/:code, paying a payment link from the signed-in player's account
+func (h *PaymentLinkHandler) PayPaymentLinkHandler(c *gin.Context) {
+	link, transaction, err := h.paymentLinkService.PayPaymentLink(c.Param("code"), c.GetInt("userID"))
+	if err != nil {
+		if err == errPaymentLinkNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment link not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment failed", "details": err.Error()})
+		return
+	}
+
+	// Callbacks are signed with the payee's secret, and skipped if it can't be read
+	var callbackSecret string
+	if link.CallbackURL != "" {
+		if callbackSecret, err = h.paymentLinkService.CallbackSecret(link.PayeeUserID); err != nil {
+			fmt.Printf("Error getting payment link callback secret: %v\n", err)
+		}
+	}
+
+	// Send webhook notifications
+	go h.webhookService.SendTransferWebhook(transaction)
+	go h.webhookService.SendPaymentLinkPaidWebhook(link, transaction, callbackSecret)
+
+	response := gin.H{
+		"success":      true,
+		"message":      "Payment completed successfully",
+		"transaction":  transaction,
+		"payment_link": publicPaymentLink(link),
+	}
+
+	// Send the payer back to the payee's site, telling it which payment was made
+	if link.RedirectURL != "" {
+		if redirectURL, err := url.Parse(link.RedirectURL); err == nil {
+			params := redirectURL.Query()
+			params.Set("payment_link", link.Code)
+			params.Set("transaction_id", strconv.Itoa(transaction.ID))
+			redirectURL.RawQuery = params.Encode()
+			response["redirect_url"] = redirectURL.String()
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// linkPayee returns who payment links made by this request pay: the merchant when authenticated with a
+// merchant API key, otherwise the signed-in player
+func linkPayee(c *gin.Context) (int, *int) {
+	if value, ok := c.Get("merchant"); ok {
+		merchant := value.(*Merchant)
+		return merchant.SettlementUserID, &merchant.ID
+	}
+	return c.GetInt("userID"), nil
+}
+
+// ownsPaymentLink reports whether the request's merchant or player created the payment link
+func ownsPaymentLink(c *gin.Context, link *PaymentLink) bool {
+	payeeUserID, merchantID := linkPayee(c)
+	if merchantID != nil {
+		return link.MerchantID != nil && *link.MerchantID == *merchantID
+	}
+	return link.MerchantID == nil && link.PayeeUserID == payeeUserID
+}
+
+// paymentLinkURL returns the public payment page for a payment link
+func paymentLinkURL(code string) string {
+	return strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/") + "/pay/" + code
+}
+
+// publicPaymentLink describes a payment link to payers, leaving out the payee's callback settings
+func publicPaymentLink(link *PaymentLink) gin.H {
+	return gin.H{
+		"code":              link.Code,
+		"amount":            link.Amount,
+		"currency":          link.Currency,
+		"description":       link.Description,
+		"single_use":        link.SingleUse,
+		"expires_at":        link.ExpiresAt,
+		"status":            link.Status,
+		"payee_username":    link.PayeeUsername,
+		"merchant_name":     link.MerchantName,
+		"merchant_logo_url": link.MerchantLogoURL,
+	}
+}
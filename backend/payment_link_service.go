@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// paymentLinkCurrency is the only currency PokéBank accounts hold
+const paymentLinkCurrency = "PKD"
+
+// errPaymentLinkNotFound is returned when no payment link has the given code
+var errPaymentLinkNotFound = fmt.Errorf("payment link not found")
+
+// PaymentLinkService handles payment links
+type PaymentLinkService struct {
+	db      *sql.DB
+	banking *BankingService
+}
+
+// NewPaymentLinkService creates a new PaymentLinkService
+func NewPaymentLinkService(db *sql.DB, banking *BankingService) *PaymentLinkService {
+	return &PaymentLinkService{db: db, banking: banking}
+}
+
+// PaymentLinkOptions describes a payment link to create
+type PaymentLinkOptions struct {
+	Amount      float64
+	Currency    string
+	Description string
+	SingleUse   bool
+	ExpiresAt   *time.Time
+	RedirectURL string
+	CallbackURL string
+}
+
+// paymentLinkSelect selects payment links with their payee and merchant for display
+const paymentLinkSelect = `
+	SELECT l.id, l.code, l.payee_user_id, l.merchant_id, l.amount, l.currency, l.description, l.single_use,
+	       l.use_count, l.expires_at, l.redirect_url, l.callback_url, l.is_active, l.created_at,
+	       p.username, p.account_number, m.name, m.logo_url, m.is_active
+	FROM payment_links l
+	JOIN users p ON l.payee_user_id = p.id
+	LEFT JOIN merchants m ON l.merchant_id = m.id
+`
+
+// CreatePaymentLink creates a payment link paying the given account, optionally on behalf of a registered merchant
+func (s *PaymentLinkService) CreatePaymentLink(payeeUserID int, merchantID *int, opts PaymentLinkOptions) (*PaymentLink, error) {
+	if opts.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(opts.Currency))
+	if currency == "" {
+		currency = paymentLinkCurrency
+	}
+	if currency != paymentLinkCurrency {
+		return nil, fmt.Errorf("unsupported currency %s; only %s is supported", currency, paymentLinkCurrency)
+	}
+
+	description := strings.TrimSpace(opts.Description)
+	if description == "" {
+		return nil, fmt.Errorf("description is required")
+	}
+
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expiry must be in the future")
+	}
+	if err := validateHTTPURL("redirect URL", opts.RedirectURL); err != nil {
+		return nil, err
+	}
+	if err := validateCallbackURL(opts.CallbackURL); err != nil {
+		return nil, err
+	}
+
+	random, err := generateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	code := random[:16]
+
+	var linkID int
+	err = s.db.QueryRow(`
+		INSERT INTO payment_links (code, payee_user_id, merchant_id, amount, currency, description, single_use,
+		                           expires_at, redirect_url, callback_url, is_active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE, ?)
+		RETURNING id
+	`, code, payeeUserID, merchantID, opts.Amount, currency, description, opts.SingleUse,
+		opts.ExpiresAt, opts.RedirectURL, opts.CallbackURL, time.Now().UTC()).Scan(&linkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment link: %v", err)
+	}
+
+	return s.getPaymentLink(`WHERE l.id = ?`, linkID)
+}
+
+// GetPaymentLinkByCode retrieves a payment link by its code
+func (s *PaymentLinkService) GetPaymentLinkByCode(code string) (*PaymentLink, error) {
+	return s.getPaymentLink(`WHERE l.code = ?`, code)
+}
+
+// GetUserPaymentLinks returns the payment links a player created for themselves, newest first
+func (s *PaymentLinkService) GetUserPaymentLinks(userID int) ([]PaymentLink, error) {
+	return s.queryPaymentLinks(`WHERE l.payee_user_id = ? AND l.merchant_id IS NULL`, userID)
+}
+
+// GetMerchantPaymentLinks returns a merchant's payment links, newest first
+func (s *PaymentLinkService) GetMerchantPaymentLinks(merchantID int) ([]PaymentLink, error) {
+	return s.queryPaymentLinks(`WHERE l.merchant_id = ?`, merchantID)
+}
+
+// DeactivatePaymentLink stops a payment link from taking further payments
+func (s *PaymentLinkService) DeactivatePaymentLink(id int) (*PaymentLink, error) {
+	if _, err := s.db.Exec(`UPDATE payment_links SET is_active = FALSE WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return s.getPaymentLink(`WHERE l.id = ?`, id)
+}
+
+// PayPaymentLink pays a payment link from the player's account with a normal transfer to the payee, and
+// links the transaction to the payment link (and, for merchant links, to the merchant) in the same transaction
+func (s *PaymentLinkService) PayPaymentLink(code string, payerUserID int) (*PaymentLink, *Transaction, error) {
+	link, err := s.GetPaymentLinkByCode(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = checkPaymentLinkPayable(link); err != nil {
+		return nil, nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Claim a use first, so a single-use link can't be paid twice by concurrent payers
+	result, err := tx.Exec(`
+		UPDATE payment_links SET use_count = use_count + 1
+		WHERE id = ? AND is_active = TRUE AND (single_use = FALSE OR use_count = 0)
+		  AND (expires_at IS NULL OR expires_at > ?)
+	`, link.ID, time.Now().UTC())
+	if err != nil {
+		return nil, nil, err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return nil, nil, fmt.Errorf("payment link can no longer be paid")
+	}
+
+	transactionID, err := s.banking.transferInTx(tx, payerUserID, link.PayeeAccountNumber, link.Amount, "transfer", link.Description)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if link.MerchantID != nil {
+		_, err = tx.Exec(`
+			UPDATE transactions
+			SET payment_link_id = ?, transaction_type = 'merchant_payment', merchant_id = ?,
+			    merchant_name = (SELECT name FROM merchants WHERE id = ?),
+			    merchant_category = (SELECT category_code FROM merchants WHERE id = ?)
+			WHERE id = ?
+		`, link.ID, *link.MerchantID, *link.MerchantID, *link.MerchantID, transactionID)
+	} else {
+		_, err = tx.Exec(`UPDATE transactions SET payment_link_id = ? WHERE id = ?`, link.ID, transactionID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	transaction, err := s.banking.GetTransactionByID(transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	link, err = s.getPaymentLink(`WHERE l.id = ?`, link.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return link, transaction, nil
+}
+
+// CallbackSecret returns the secret that signs callbacks for a payee's payment links, creating it on first use
+func (s *PaymentLinkService) CallbackSecret(payeeUserID int) (string, error) {
+	return getOrCreateServerSecret(s.db, fmt.Sprintf("payment_link_callback_secret:%d", payeeUserID))
+}
+
+// validateCallbackURL checks a callback URL is http(s) and doesn't name a loopback, private or link-local host.
+// Hostnames are checked again when the callback is sent, once they resolve.
+func validateCallbackURL(rawURL string) error {
+	if err := validateHTTPURL("callback URL", rawURL); err != nil || rawURL == "" {
+		return err
+	}
+	parsed, _ := url.Parse(rawURL)
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errNonPublicAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return errNonPublicAddress
+	}
+	return nil
+}
+
+// checkPaymentLinkPayable explains why a payment link can't be paid, if it can't
+func checkPaymentLinkPayable(link *PaymentLink) error {
+	switch link.Status {
+	case "used":
+		return fmt.Errorf("payment link has already been used")
+	case "expired":
+		return fmt.Errorf("payment link has expired")
+	case "deactivated":
+		return fmt.Errorf("payment link has been deactivated")
+	}
+	return nil
+}
+
+// getPaymentLink retrieves a single payment link matching the given WHERE clause
+func (s *PaymentLinkService) getPaymentLink(where string, args ...interface{}) (*PaymentLink, error) {
+	link, err := scanPaymentLink(s.db.QueryRow(paymentLinkSelect+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, errPaymentLinkNotFound
+	}
+	return link, err
+}
+
+// queryPaymentLinks retrieves the payment links matching the given WHERE clause, newest first
+func (s *PaymentLinkService) queryPaymentLinks(where string, args ...interface{}) ([]PaymentLink, error) {
+	rows, err := s.db.Query(paymentLinkSelect+where+` ORDER BY l.created_at DESC, l.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []PaymentLink{}
+	for rows.Next() {
+		link, err := scanPaymentLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+
+	return links, rows.Err()
+}
+
+// scanPaymentLink scans a row selected with paymentLinkSelect into a PaymentLink
+func scanPaymentLink(row rowScanner) (*PaymentLink, error) {
+	link := &PaymentLink{}
+	var merchantID sql.NullInt64
+	var expiresAt sql.NullTime
+	var redirectURL, callbackURL, merchantName, merchantLogoURL sql.NullString
+	var merchantActive sql.NullBool
+
+	err := row.Scan(
+		&link.ID, &link.Code, &link.PayeeUserID, &merchantID, &link.Amount, &link.Currency, &link.Description,
+		&link.SingleUse, &link.UseCount, &expiresAt, &redirectURL, &callbackURL, &link.IsActive, &link.CreatedAt,
+		&link.PayeeUsername, &link.PayeeAccountNumber, &merchantName, &merchantLogoURL, &merchantActive,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if merchantID.Valid {
+		id := int(merchantID.Int64)
+		link.MerchantID = &id
+	}
+	if expiresAt.Valid {
+		link.ExpiresAt = &expiresAt.Time
+	}
+	link.RedirectURL = redirectURL.String
+	link.CallbackURL = callbackURL.String
+	link.MerchantName = merchantName.String
+	link.MerchantLogoURL = merchantLogoURL.String
+
+	switch {
+	case !link.IsActive || (merchantActive.Valid && !merchantActive.Bool):
+		link.Status = "deactivated"
+	case link.SingleUse && link.UseCount > 0:
+		link.Status = "used"
+	case link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()):
+		link.Status = "expired"
+	default:
+		link.Status = "active"
+	}
+
+	return link, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentRequestGroupHandler handles split bills
+type PaymentRequestGroupHandler struct {
+	bankingService *BankingService
+	userService    *UserService
+	webhookService *WebhookService
+}
+
+// NewPaymentRequestGroupHandler creates a new PaymentRequestGroupHandler
+func NewPaymentRequestGroupHandler(bankingService *BankingService, userService *UserService, webhookService *WebhookService) *PaymentRequestGroupHandler {
+	return &PaymentRequestGroupHandler{
+		bankingService: bankingService,
+		userService:    userService,
+		webhookService: webhookService,
+	}
+}
+
+// SplitBillRequest represents the request body for splitting a bill
+type SplitBillRequest struct {
+	Reason         string           `json:"reason" binding:"required"`
+	Message        string           `json:"message"`
+	Split          string           `json:"split" binding:"required,oneof=equal custom"`
+	TotalAmount    float64          `json:"total_amount" binding:"gte=0"`
+	IncludeCreator bool             `json:"include_creator"` // Equal splits: count yourself as one of the people sharing the bill
+	Payers         []SplitBillPayer `json:"payers" binding:"required,min=1,dive"`
+	ExpiresAt      *time.Time       `json:"expires_at"`
+}
+
+// SplitBillPayer names one payer of a split bill
+type SplitBillPayer struct {
+	Payer  string  `json:"payer" binding:"required"` // Username or account number
+	Amount float64 `json:"amount" binding:"gte=0"`   // Custom splits only
+}
+
+// CreatePaymentRequestGroupHandler handles POST /api/payment-request-groups
+func (h *PaymentRequestGroupHandler) CreatePaymentRequestGroupHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req SplitBillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	input := SplitBillInput{
+		Reason:         req.Reason,
+		Message:        req.Message,
+		SplitType:      req.Split,
+		TotalAmount:    req.TotalAmount,
+		IncludeCreator: req.IncludeCreator,
+		ExpiresAt:      req.ExpiresAt,
+	}
+	for _, payer := range req.Payers {
+		user, err := h.userService.GetUserByUsernameOrAccountNumber(payer.Payer)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payer not found", "details": payer.Payer})
+			return
+		}
+		input.Shares = append(input.Shares, SplitBillShareInput{UserID: user.ID, Amount: payer.Amount})
+	}
+
+	group, err := h.bankingService.CreatePaymentRequestGroup(userID, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to split bill", "details": err.Error()})
+		return
+	}
+
+	// Send webhook notifications, one per share as for any other payment request
+	go h.webhookService.SendPaymentRequestGroupWebhook("payment_request_group_created", group)
+	for i := range group.Shares {
+		go h.webhookService.SendPaymentRequestWebhook(&group.Shares[i])
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Bill split and payment requests sent",
+		"group":   group,
+	})
+}
+
+// GetPaymentRequestGroupsHandler handles GET /api/payment-request-groups, listing the split bills the user
+// created or has a share of
+func (h *PaymentRequestGroupHandler) GetPaymentRequestGroupsHandler(c *gin.Context) {
+	groups, err := h.bankingService.GetUserPaymentRequestGroups(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get split bills"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"groups":  groups,
+	})
+}
+
+// GetPaymentRequestGroupHandler handles GET /api/payment-request-groups/:id
+func (h *PaymentRequestGroupHandler) GetPaymentRequestGroupHandler(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid split bill ID"})
+		return
+	}
+
+	group, err := h.bankingService.GetUserPaymentRequestGroup(groupID, c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Split bill not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"group":   group,
+	})
+}
+
+// CancelPaymentRequestGroupHandler handles POST /api/payment-request-groups/:id/cancel
+func (h *PaymentRequestGroupHandler) CancelPaymentRequestGroupHandler(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid split bill ID"})
+		return
+	}
+
+	group, err := h.bankingService.CancelPaymentRequestGroup(groupID, c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendPaymentRequestGroupWebhook("payment_request_group_cancelled", group)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Split bill cancelled",
+		"group":   group,
+	})
+}
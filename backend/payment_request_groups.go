@@ -0,0 +1,368 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Split bill types
+const (
+	SplitEqual  = "equal"  // The total is divided evenly between the payers (and the creator, if included)
+	SplitCustom = "custom" // Each payer is given their own share
+)
+
+// Split bill statuses, worked out from the shares
+const (
+	SplitBillOpen       = "open"       // Some shares are still pending
+	SplitBillSettled    = "settled"    // Every share has been paid in full
+	SplitBillCancelled  = "cancelled"  // Cancelled by the creator before every share was paid
+	SplitBillIncomplete = "incomplete" // Nothing is pending, but some shares were rejected, cancelled or expired
+)
+
+// maxSplitBillPayers limits how many payers one bill can be split between
+const maxSplitBillPayers = 25
+
+// errPaymentRequestGroupNotFound is returned when a split bill doesn't exist or isn't visible to the user
+var errPaymentRequestGroupNotFound = fmt.Errorf("split bill not found")
+
+// SplitBillInput describes a bill to split
+type SplitBillInput struct {
+	Reason    string
+	Message   string
+	SplitType string
+	// TotalAmount is the whole bill. Equal splits divide it up; for custom splits it's optional, and anything
+	// not covered by the payers' shares is the creator's own share.
+	TotalAmount    float64
+	IncludeCreator bool // Equal splits only: the creator pays a share too, so isn't asked for it
+	Shares         []SplitBillShareInput
+	ExpiresAt      *time.Time
+}
+
+// SplitBillShareInput describes one payer's share of a bill
+type SplitBillShareInput struct {
+	UserID int
+	Amount float64 // Custom splits only
+}
+
+// paymentRequestGroupSelect selects split bills with their creator's username
+const paymentRequestGroupSelect = `
+	SELECT g.id, g.creator_user_id, g.reason, g.message, g.split_type, g.total_amount, g.creator_share,
+	       g.expires_at, g.settled_at, g.cancelled_at, g.created_at, u.username
+	FROM payment_request_groups g
+	JOIN users u ON g.creator_user_id = u.id
+`
+
+// CreatePaymentRequestGroup splits a bill, sending each payer a payment request for their share. Payers
+// approve their shares like any other payment request.
+func (s *BankingService) CreatePaymentRequestGroup(creatorUserID int, input SplitBillInput) (*PaymentRequestGroup, error) {
+	if len(input.Shares) > maxSplitBillPayers {
+		return nil, fmt.Errorf("a bill can be split between at most %d payers", maxSplitBillPayers)
+	}
+
+	seen := map[int]bool{}
+	for _, share := range input.Shares {
+		if share.UserID == creatorUserID {
+			return nil, fmt.Errorf("cannot request money from yourself")
+		}
+		if seen[share.UserID] {
+			return nil, fmt.Errorf("each payer can only be named once")
+		}
+		seen[share.UserID] = true
+	}
+
+	amounts, creatorShare, total, err := splitBillShares(input)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := input.ExpiresAt
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("expiry time must be in the future")
+		}
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkAccountCanReceive(tx, creatorUserID); err != nil {
+		return nil, err
+	}
+
+	var groupID int
+	err = tx.QueryRow(`
+		INSERT INTO payment_request_groups (creator_user_id, reason, message, split_type, total_amount, creator_share,
+		                                    expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, creatorUserID, input.Reason, input.Message, input.SplitType, total, creatorShare, expiresAt,
+		time.Now().UTC()).Scan(&groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, share := range input.Shares {
+		var username, status string
+		err = tx.QueryRow(`SELECT username, status FROM users WHERE id = ?`, share.UserID).Scan(&username, &status)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("user not found")
+			}
+			return nil, err
+		}
+		if status == AccountClosed {
+			return nil, fmt.Errorf("%s's account is closed", username)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO payment_requests (from_user_id, to_user_id, amount, reason, message, status, expires_at, group_id)
+			VALUES (?, ?, ?, ?, ?, 'pending', ?, ?)
+		`, creatorUserID, share.UserID, amounts[i], input.Reason, input.Message, expiresAt, groupID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetPaymentRequestGroup(groupID)
+}
+
+// GetPaymentRequestGroup retrieves a split bill with its shares and progress
+func (s *BankingService) GetPaymentRequestGroup(groupID int) (*PaymentRequestGroup, error) {
+	groups, err := s.queryPaymentRequestGroups(`WHERE g.id = ?`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, errPaymentRequestGroupNotFound
+	}
+	return &groups[0], nil
+}
+
+// GetUserPaymentRequestGroup retrieves a split bill the user created or has a share of
+func (s *BankingService) GetUserPaymentRequestGroup(groupID, userID int) (*PaymentRequestGroup, error) {
+	group, err := s.GetPaymentRequestGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group.CreatorUserID == userID {
+		return group, nil
+	}
+	for _, share := range group.Shares {
+		if share.ToUserID == userID {
+			return group, nil
+		}
+	}
+	return nil, errPaymentRequestGroupNotFound
+}
+
+// GetUserPaymentRequestGroups retrieves the split bills a user created or has a share of, newest first
+func (s *BankingService) GetUserPaymentRequestGroups(userID int) ([]PaymentRequestGroup, error) {
+	return s.queryPaymentRequestGroups(`
+		WHERE g.creator_user_id = ? OR g.id IN (SELECT group_id FROM payment_requests WHERE to_user_id = ?)
+		ORDER BY g.created_at DESC, g.id DESC
+	`, userID, userID)
+}
+
+// settlePaymentRequestGroupInTx records that a split bill has been settled once every share is paid. It reports
+// whether this call settled it, so the settlement is only announced once.
+func settlePaymentRequestGroupInTx(tx *sql.Tx, groupID int) (bool, error) {
+	result, err := tx.Exec(`
+		UPDATE payment_request_groups SET settled_at = ?
+		WHERE id = ? AND settled_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM payment_requests WHERE group_id = ? AND status != 'approved')
+	`, time.Now().UTC(), groupID, groupID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// CancelPaymentRequestGroup cancels a split bill's pending shares. Shares already paid, in full or in part,
+// stay paid.
+func (s *BankingService) CancelPaymentRequestGroup(groupID, creatorUserID int) (*PaymentRequestGroup, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE payment_request_groups SET cancelled_at = ?
+		WHERE id = ? AND creator_user_id = ? AND cancelled_at IS NULL AND settled_at IS NULL
+	`, time.Now().UTC(), groupID, creatorUserID)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("split bill not found, already settled or already cancelled")
+	}
+
+	result, err = tx.Exec(`UPDATE payment_requests SET status = 'cancelled' WHERE group_id = ? AND status = 'pending'`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("split bill has no pending shares")
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetPaymentRequestGroup(groupID)
+}
+
+// queryPaymentRequestGroups selects the split bills matching the WHERE clause, with their shares
+func (s *BankingService) queryPaymentRequestGroups(where string, args ...interface{}) ([]PaymentRequestGroup, error) {
+	rows, err := s.db.Query(paymentRequestGroupSelect+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []PaymentRequestGroup
+	for rows.Next() {
+		var g PaymentRequestGroup
+		var message sql.NullString
+		var expiresAt, settledAt, cancelledAt sql.NullTime
+		err := rows.Scan(
+			&g.ID, &g.CreatorUserID, &g.Reason, &message, &g.SplitType, &g.TotalAmount, &g.CreatorShare,
+			&expiresAt, &settledAt, &cancelledAt, &g.CreatedAt, &g.CreatorUsername,
+		)
+		if err != nil {
+			return nil, err
+		}
+		g.Message = message.String
+		if expiresAt.Valid {
+			g.ExpiresAt = &expiresAt.Time
+		}
+		if settledAt.Valid {
+			g.SettledAt = &settledAt.Time
+		}
+		if cancelledAt.Valid {
+			g.CancelledAt = &cancelledAt.Time
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range groups {
+		groups[i].Shares, err = s.queryPaymentRequests(`WHERE pr.group_id = ?`, groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].setProgress()
+	}
+
+	return groups, nil
+}
+
+// setProgress totals a split bill's shares and works out its status
+func (g *PaymentRequestGroup) setProgress() {
+	pending := 0
+	for _, share := range g.Shares {
+		g.AmountRequested += share.Amount
+		g.AmountPaid += share.AmountPaid
+		switch share.Status {
+		case "approved":
+			g.SharesPaid++
+		case "pending":
+			pending++
+			g.AmountDue += share.AmountDue
+		}
+	}
+	g.AmountRequested = roundCents(g.AmountRequested)
+	g.AmountPaid = roundCents(g.AmountPaid)
+	g.AmountDue = roundCents(g.AmountDue)
+	g.ShareCount = len(g.Shares)
+
+	switch {
+	case g.SettledAt != nil || g.SharesPaid == g.ShareCount:
+		g.Status = SplitBillSettled
+	case pending > 0:
+		g.Status = SplitBillOpen
+	case g.CancelledAt != nil:
+		g.Status = SplitBillCancelled
+	default:
+		g.Status = SplitBillIncomplete
+	}
+}
+
+// splitBillShares works out each payer's share of a bill, the creator's own share and the bill's total
+func splitBillShares(input SplitBillInput) ([]float64, float64, float64, error) {
+	amounts := make([]float64, len(input.Shares))
+
+	switch input.SplitType {
+	case SplitEqual:
+		total := roundCents(input.TotalAmount)
+		if total <= 0 {
+			return nil, 0, 0, fmt.Errorf("equal splits need a total amount")
+		}
+
+		// Divide the total in cents, giving the leftover cents to the first payers
+		parts := len(input.Shares)
+		if input.IncludeCreator {
+			parts++
+		}
+		cents := int64(math.Round(total * 100))
+		each, leftover := cents/int64(parts), cents%int64(parts)
+		if each == 0 {
+			return nil, 0, 0, fmt.Errorf("total is too small to split %d ways", parts)
+		}
+		for i := range amounts {
+			share := each
+			if int64(i) < leftover {
+				share++
+			}
+			amounts[i] = float64(share) / 100
+		}
+
+		creatorShare := 0.0
+		if input.IncludeCreator {
+			creatorShare = float64(each) / 100
+		}
+		return amounts, creatorShare, total, nil
+
+	case SplitCustom:
+		requested := 0.0
+		for i, share := range input.Shares {
+			amounts[i] = roundCents(share.Amount)
+			if amounts[i] <= 0 {
+				return nil, 0, 0, fmt.Errorf("every payer needs a share of at least 0.01")
+			}
+			requested += amounts[i]
+		}
+		requested = roundCents(requested)
+
+		total := roundCents(input.TotalAmount)
+		if total == 0 {
+			total = requested
+		}
+		if total < requested {
+			return nil, 0, 0, fmt.Errorf("shares add up to %.2f, more than the %.2f total", requested, total)
+		}
+		return amounts, roundCents(total - requested), total, nil
+	}
+
+	return nil, 0, 0, fmt.Errorf("split type must be %s or %s", SplitEqual, SplitCustom)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// paymentRequestSelect selects payment requests with both usernames, the merchant and the payer's email
+const paymentRequestSelect = `
+	SELECT pr.id, pr.from_user_id, pr.to_user_id, pr.amount, pr.reason,
+	       pr.message, pr.status, pr.created_at, u1.username, u2.username, u2.email, pr.merchant_id, m.name,
+	       pr.amount_paid, pr.expires_at, pr.last_reminder_at, pr.reminder_count, pr.group_id
+	FROM payment_requests pr
+	JOIN users u1 ON pr.from_user_id = u1.id
+	JOIN users u2 ON pr.to_user_id = u2.id
+	LEFT JOIN merchants m ON pr.merchant_id = m.id
+`
+
+// ExpirePaymentRequests moves pending payment requests past their expiry time to "expired", returning them.
+// Any partial payments already made stay with the requester.
+func (s *BankingService) ExpirePaymentRequests() ([]PaymentRequest, error) {
+	now := time.Now().UTC()
+
+	requests, err := s.queryPaymentRequests(`WHERE pr.status = 'pending' AND pr.expires_at <= ?`, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []PaymentRequest
+	for _, request := range requests {
+		result, err := s.db.Exec(`UPDATE payment_requests SET status = 'expired' WHERE id = ? AND status = 'pending'`, request.ID)
+		if err != nil {
+			return expired, err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			continue // Paid, rejected or cancelled since it was listed
+		}
+
+		request.Status = "expired"
+		expired = append(expired, request)
+	}
+
+	return expired, nil
+}
+
+// RemindPaymentRequests records a reminder for each pending payment request that has waited
+// PAYMENT_REQUEST_REMINDER_HOURS since it was created or last reminded about, up to
+// PAYMENT_REQUEST_MAX_REMINDERS times, returning the requests whose payers should be reminded
+func (s *BankingService) RemindPaymentRequests() ([]PaymentRequest, error) {
+	if s.paymentRequestReminderEvery == 0 || s.maxPaymentRequestReminders == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	requests, err := s.queryPaymentRequests(`
+		WHERE pr.status = 'pending' AND pr.reminder_count < ?
+		  AND COALESCE(pr.last_reminder_at, pr.created_at) <= ?
+		  AND (pr.expires_at IS NULL OR pr.expires_at > ?)
+	`, s.maxPaymentRequestReminders, now.Add(-s.paymentRequestReminderEvery), now)
+	if err != nil {
+		return nil, err
+	}
+
+	var reminded []PaymentRequest
+	for _, request := range requests {
+		_, err := s.db.Exec(`
+			UPDATE payment_requests SET last_reminder_at = ?, reminder_count = reminder_count + 1
+			WHERE id = ?
+		`, now, request.ID)
+		if err != nil {
+			return reminded, err
+		}
+
+		request.LastReminderAt = &now
+		request.ReminderCount++
+		reminded = append(reminded, request)
+	}
+
+	return reminded, nil
+}
+
+// queryPaymentRequests selects the payment requests matching the WHERE clause
+func (s *BankingService) queryPaymentRequests(where string, args ...interface{}) ([]PaymentRequest, error) {
+	rows, err := s.db.Query(paymentRequestSelect+where+` ORDER BY pr.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []PaymentRequest
+	for rows.Next() {
+		var pr PaymentRequest
+		var message, email, merchantName sql.NullString
+		var merchantID sql.NullInt64
+		var expiresAt, lastReminderAt sql.NullTime
+		var groupID sql.NullInt64
+		err := rows.Scan(
+			&pr.ID, &pr.FromUserID, &pr.ToUserID, &pr.Amount, &pr.Reason,
+			&message, &pr.Status, &pr.CreatedAt, &pr.FromUsername, &pr.ToUsername, &email, &merchantID, &merchantName,
+			&pr.AmountPaid, &expiresAt, &lastReminderAt, &pr.ReminderCount, &groupID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pr.Message = message.String
+		pr.ToEmail = email.String
+		pr.setMerchant(merchantID, merchantName)
+		pr.setProgress(expiresAt, lastReminderAt, groupID)
+		requests = append(requests, pr)
+	}
+
+	return requests, rows.Err()
+}
+
+// sendPaymentRequestReminder emails a payment request's payer a reminder to pay it
+func sendPaymentRequestReminder(mailer Mailer, request *PaymentRequest) {
+	if request.ToEmail == "" {
+		return
+	}
+
+	requester := request.FromUsername
+	if request.MerchantName != "" {
+		requester = request.MerchantName
+	}
+
+	subject := fmt.Sprintf("Reminder: %s asked you to pay %.2f", requester, request.AmountDue)
+	body := fmt.Sprintf(`Hi %s,
+
+%s is still waiting for your payment of %.2f for "%s".
+`, request.ToUsername, requester, request.AmountDue, request.Reason)
+	if request.AmountPaid > 0 {
+		body += fmt.Sprintf("You have already paid %.2f of the %.2f requested.\n", request.AmountPaid, request.Amount)
+	}
+	if request.ExpiresAt != nil {
+		body += fmt.Sprintf("The request expires at %s.\n", request.ExpiresAt.Format("2006-01-02 15:04 MST"))
+	}
+	body += "\nSign in to Viridian City Bank to pay or reject it.\n"
+
+	if err := mailer.SendMail(request.ToEmail, subject, body); err != nil {
+		fmt.Printf("Error sending payment request reminder: %v\n", err)
+	}
+}
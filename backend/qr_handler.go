@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QRHandler handles scan-to-pay QR codes
+type QRHandler struct {
+	bankingService *BankingService
+	userService    *UserService
+}
+
+// NewQRHandler creates a new QRHandler
+func NewQRHandler(bankingService *BankingService, userService *UserService) *QRHandler {
+	return &QRHandler{
+		bankingService: bankingService,
+		userService:    userService,
+	}
+}
+
+// ParsePaymentURIRequest represents a scanned payment QR code
+type ParsePaymentURIRequest struct {
+	URI string `json:"uri" binding:"required"`
+}
+
+// GetAccountQRHandler handles GET /api/qr/account, a QR code for paying the user's account. Optional
+// amount and reference query parameters are encoded too.
+func (h *QRHandler) GetAccountQRHandler(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+
+	payment := PaymentURI{
+		AccountNumber: user.AccountNumber,
+		Reference:     c.Query("reference"),
+	}
+	if raw := c.Query("amount"); raw != "" {
+		amount, err := strconv.ParseFloat(raw, 64)
+		if err != nil || amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be a positive number"})
+			return
+		}
+		payment.Amount = &amount
+	}
+
+	h.writeQRCode(c, payment)
+}
+
+// GetPaymentRequestQRHandler handles GET /api/payment-requests/:id/qr, a QR code for paying a payment request
+func (h *QRHandler) GetPaymentRequestQRHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	requestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	request, err := h.bankingService.GetPaymentRequestByID(requestID)
+	if err != nil || (request.FromUserID != userID && request.ToUserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment request not found"})
+		return
+	}
+	if request.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment request is no longer pending"})
+		return
+	}
+
+	requester, err := h.userService.GetUserByID(request.FromUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get requester"})
+		return
+	}
+
+	h.writeQRCode(c, PaymentURI{
+		AccountNumber:    requester.AccountNumber,
+		Amount:           &request.AmountDue,
+		Reference:        request.Reason,
+		PaymentRequestID: &request.ID,
+	})
+}
+
+// ParsePaymentURIHandler handles POST /api/qr/parse, turning a scanned payment URI into a pre-filled
+// confirmation of the transfer or payment request approval it asks for
+func (h *QRHandler) ParsePaymentURIHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req ParsePaymentURIRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	payment, err := parsePaymentURI(req.URI)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipient, err := h.userService.GetUserByAccountNumber(payment.AccountNumber)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient account not found"})
+		return
+	}
+	if recipient.ID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot pay yourself"})
+		return
+	}
+
+	availableBalance, err := h.bankingService.GetUserAvailableBalance(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	response := gin.H{
+		"success":            true,
+		"payment":            payment,
+		"recipient_username": recipient.Username,
+		"available_balance":  availableBalance,
+	}
+
+	// A payment request is settled by approving it, so the requester sees it paid
+	if payment.PaymentRequestID != nil {
+		request, err := h.bankingService.GetPaymentRequestByID(*payment.PaymentRequestID)
+		if err != nil || request.ToUserID != userID || request.FromUserID != recipient.ID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment request not found"})
+			return
+		}
+		if request.Status != "pending" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payment request is no longer pending"})
+			return
+		}
+
+		response["payment_request"] = request
+		response["confirmation"] = gin.H{
+			"action":   "approve_payment_request",
+			"method":   http.MethodPut,
+			"endpoint": "/api/payment-requests/" + strconv.Itoa(request.ID),
+			"body":     gin.H{"action": "approve"},
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	transfer := gin.H{
+		"to":          recipient.AccountNumber,
+		"description": payment.Reference,
+	}
+	if payment.Amount != nil {
+		transfer["amount"] = *payment.Amount
+	}
+	response["confirmation"] = gin.H{
+		"action":          "transfer",
+		"method":          http.MethodPost,
+		"endpoint":        "/api/transfer",
+		"body":            transfer,
+		"amount_required": payment.Amount == nil,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// writeQRCode responds with the payment's QR code, as ?format=png (default), svg, or json for just the URI.
+// ?size sets the image size in pixels (default 256, 64 to 1024).
+func (h *QRHandler) writeQRCode(c *gin.Context, payment PaymentURI) {
+	uri := payment.String()
+
+	format := c.DefaultQuery("format", "png")
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"uri":     uri,
+			"payment": payment,
+		})
+		return
+	}
+	if format != "png" && format != "svg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be png, svg or json"})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", "256"))
+	if err != nil || size < 64 || size > 1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Size must be between 64 and 1024 pixels"})
+		return
+	}
+
+	image, contentType, err := renderQRCode(uri, format, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+
+	c.Header("X-Payment-URI", uri)
+	c.Data(http.StatusOK, contentType, image)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// paymentURIScheme is the URI scheme of PokéBank payment QR codes, e.g.
+// pokebank:pay?account=1234567890&amount=25.00&reference=Potions&request=7
+const paymentURIScheme = "pokebank"
+
+// PaymentURI is the payment a QR code asks for: who to pay and, optionally, how much, what for and
+// which payment request it settles
+type PaymentURI struct {
+	AccountNumber    string   `json:"account_number"`
+	Amount           *float64 `json:"amount,omitempty"`
+	Reference        string   `json:"reference,omitempty"`
+	PaymentRequestID *int     `json:"payment_request_id,omitempty"`
+}
+
+// String encodes the payment as a pokebank:pay URI
+func (p PaymentURI) String() string {
+	params := url.Values{}
+	params.Set("account", p.AccountNumber)
+	if p.Amount != nil {
+		params.Set("amount", strconv.FormatFloat(*p.Amount, 'f', 2, 64))
+	}
+	if p.Reference != "" {
+		params.Set("reference", p.Reference)
+	}
+	if p.PaymentRequestID != nil {
+		params.Set("request", strconv.Itoa(*p.PaymentRequestID))
+	}
+
+	uri := url.URL{Scheme: paymentURIScheme, Opaque: "pay", RawQuery: params.Encode()}
+	return uri.String()
+}
+
+// parsePaymentURI decodes a pokebank:pay URI, also accepting the pokebank://pay form
+func parsePaymentURI(raw string) (*PaymentURI, error) {
+	uri, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || uri.Scheme != paymentURIScheme || (uri.Opaque != "pay" && uri.Host != "pay") {
+		return nil, fmt.Errorf("not a PokéBank payment URI")
+	}
+
+	params := uri.Query()
+	payment := &PaymentURI{
+		AccountNumber: params.Get("account"),
+		Reference:     params.Get("reference"),
+	}
+	if payment.AccountNumber == "" {
+		return nil, fmt.Errorf("payment URI has no account")
+	}
+
+	if raw := params.Get("amount"); raw != "" {
+		amount, err := strconv.ParseFloat(raw, 64)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("payment URI has an invalid amount")
+		}
+		payment.Amount = &amount
+	}
+
+	if raw := params.Get("request"); raw != "" {
+		requestID, err := strconv.Atoi(raw)
+		if err != nil || requestID <= 0 {
+			return nil, fmt.Errorf("payment URI has an invalid payment request")
+		}
+		payment.PaymentRequestID = &requestID
+	}
+
+	return payment, nil
+}
+
+// renderQRCode renders content as a QR code in the given format ("png" or "svg"), size pixels square,
+// returning the image and its content type
+func renderQRCode(content, format string, size int) ([]byte, string, error) {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case "png":
+		image, err := code.PNG(size)
+		return image, "image/png", err
+	case "svg":
+		return qrCodeSVG(code.Bitmap(), size), "image/svg+xml", nil
+	}
+
+	return nil, "", fmt.Errorf("unsupported QR code format %s", format)
+}
+
+// qrCodeSVG draws a QR code bitmap (quiet zone included) as an SVG with one square per dark module
+func qrCodeSVG(bitmap [][]bool, size int) []byte {
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, len(bitmap), len(bitmap))
+	svg.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&svg, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	svg.WriteString(`"/></svg>`)
+	return svg.Bytes()
+}
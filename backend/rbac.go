@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// User roles
+const (
+	RolePlayer    = "player"
+	RoleSupport   = "support"
+	RoleTreasurer = "treasurer"
+	RoleAdmin     = "admin"
+)
+
+// Admin permissions, each guarding one or more admin routes
+const (
+	PermViewUsers           = "users:read"
+	PermManageRoles         = "roles:manage"
+	PermAdjustBalance       = "balance:adjust"
+	PermMerchantTransaction = "merchant:transact"
+	PermBankTransfer        = "bank:transfer"
+	PermManageOAuthClients  = "oauth:manage"
+	PermManageCredentials   = "credentials:manage"
+	PermViewAuditLog        = "audit:read"
+	PermManageAccounts      = "accounts:manage"
+	PermCloseAccounts       = "accounts:close"
+	PermManageMerchants     = "merchants:manage"
+	PermResolveEscrows      = "escrows:resolve"
+	PermReverseTransactions = "transactions:reverse"
+	PermManageSavingsRates  = "savings:manage"
+	PermManageLoans         = "loans:manage"
+)
+
+// rolePermissions maps each role to the admin permissions it grants
+var rolePermissions = map[string][]string{
+	RolePlayer:  {},
+	RoleSupport: {PermViewUsers, PermManageAccounts, PermResolveEscrows},
+	RoleTreasurer: {
+		PermViewUsers, PermAdjustBalance, PermMerchantTransaction, PermBankTransfer,
+		PermManageAccounts, PermCloseAccounts, PermResolveEscrows, PermReverseTransactions,
+		PermManageSavingsRates, PermManageLoans,
+	},
+	RoleAdmin: {
+		PermViewUsers, PermManageRoles, PermAdjustBalance, PermMerchantTransaction,
+		PermBankTransfer, PermManageOAuthClients, PermManageCredentials, PermViewAuditLog,
+		PermManageAccounts, PermCloseAccounts, PermManageMerchants, PermResolveEscrows,
+		PermReverseTransactions, PermManageSavingsRates, PermManageLoans,
+	},
+}
+
+// adminCredentialPrefix marks named admin API keys
+const adminCredentialPrefix = "pbadm_"
+
+// isValidRole reports whether role is a known role
+func isValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// roleHasPermission reports whether role grants permission
+func roleHasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminCredentialService handles named admin API credentials
+type AdminCredentialService struct {
+	db *sql.DB
+}
+
+// NewAdminCredentialService creates a new AdminCredentialService
+func NewAdminCredentialService(db *sql.DB) *AdminCredentialService {
+	return &AdminCredentialService{db: db}
+}
+
+// CreateCredential issues a new named credential and returns it with its plaintext key
+func (s *AdminCredentialService) CreateCredential(name, role, createdBy string) (*AdminCredential, string, error) {
+	if !isValidRole(role) || role == RolePlayer {
+		return nil, "", fmt.Errorf("invalid role for an admin credential: %s", role)
+	}
+
+	random, err := generateSessionToken()
+	if err != nil {
+		return nil, "", err
+	}
+	key := adminCredentialPrefix + random
+
+	query := `INSERT INTO admin_credentials (name, key_hash, role, created_by, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := s.db.Exec(query, name, hashToken(key), role, createdBy, time.Now())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create credential: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	credential, err := s.getCredential(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return credential, key, nil
+}
+
+// Authenticate resolves an admin key to an active credential.
+// The bootstrap ADMIN_KEY, if configured, acts as an admin-role credential.
+func (s *AdminCredentialService) Authenticate(key string) (*AdminCredential, error) {
+	if bootstrapKey := getEnv("ADMIN_KEY", ""); bootstrapKey != "" {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(bootstrapKey)) == 1 {
+			return &AdminCredential{Name: "ADMIN_KEY", Role: RoleAdmin}, nil
+		}
+	}
+
+	// Keys are looked up by their SHA-256 hash, so timing reveals nothing about the key itself
+	credential, err := s.getCredential(`WHERE key_hash = ? AND revoked_at IS NULL`, hashToken(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin key")
+	}
+
+	s.db.Exec(`UPDATE admin_credentials SET last_used_at = ? WHERE id = ?`, time.Now(), credential.ID)
+
+	return credential, nil
+}
+
+// GetAllCredentials returns every credential, including revoked ones
+func (s *AdminCredentialService) GetAllCredentials() ([]AdminCredential, error) {
+	query := `
+		SELECT id, name, role, created_by, last_used_at, revoked_at, created_at
+		FROM admin_credentials
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []AdminCredential
+	for rows.Next() {
+		credential, err := scanAdminCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+
+	return credentials, nil
+}
+
+// RevokeCredential revokes a credential so it can no longer be used
+func (s *AdminCredentialService) RevokeCredential(id int) error {
+	result, err := s.db.Exec(`UPDATE admin_credentials SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("credential not found or already revoked")
+	}
+
+	return nil
+}
+
+// getCredential retrieves a single credential matching the given WHERE clause
+func (s *AdminCredentialService) getCredential(where string, args ...interface{}) (*AdminCredential, error) {
+	query := `
+		SELECT id, name, role, created_by, last_used_at, revoked_at, created_at
+		FROM admin_credentials ` + where
+
+	return scanAdminCredential(s.db.QueryRow(query, args...))
+}
+
+// scanAdminCredential scans a credential row into an AdminCredential
+func scanAdminCredential(row rowScanner) (*AdminCredential, error) {
+	credential := &AdminCredential{}
+	var createdBy sql.NullString
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&credential.ID, &credential.Name, &credential.Role, &createdBy,
+		&lastUsedAt, &revokedAt, &credential.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.CreatedBy = createdBy.String
+	if lastUsedAt.Valid {
+		credential.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		credential.RevokedAt = &revokedAt.Time
+	}
+
+	return credential, nil
+}
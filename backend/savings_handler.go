@@ -0,0 +1,244 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SavingsHandler handles savings pots
+type SavingsHandler struct {
+	savingsService *SavingsService
+	webhookService *WebhookService
+}
+
+// NewSavingsHandler creates a new SavingsHandler
+func NewSavingsHandler(savingsService *SavingsService, webhookService *WebhookService) *SavingsHandler {
+	return &SavingsHandler{
+		savingsService: savingsService,
+		webhookService: webhookService,
+	}
+}
+
+// CreatePotRequest represents the request body for opening a savings pot
+type CreatePotRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Type         string   `json:"type" binding:"omitempty,oneof=savings goal"` // Default savings
+	TargetAmount *float64 `json:"target_amount"`                               // Goal pots only
+}
+
+// UpdatePotRequest represents the request body for changing a savings pot; omitted fields are left alone
+type UpdatePotRequest struct {
+	Name         string   `json:"name"`
+	TargetAmount *float64 `json:"target_amount"`
+}
+
+// MovePotFundsRequest represents a move between the main balance and savings pots
+type MovePotFundsRequest struct {
+	FromPotID *int    `json:"from_pot_id"` // Omit for the main balance
+	ToPotID   *int    `json:"to_pot_id"`   // Omit for the main balance
+	Amount    float64 `json:"amount" binding:"required,gt=0"`
+}
+
+// SetSavingsRateRequest represents an admin's change to a pot type's interest rate
+type SetSavingsRateRequest struct {
+	AnnualRate  *float64 `json:"annual_rate" binding:"required"`                      // Percent per year
+	Compounding string   `json:"compounding" binding:"omitempty,oneof=daily monthly"` // Default daily
+}
+
+// CreatePotHandler handles POST /api/pots
+func (h *SavingsHandler) CreatePotHandler(c *gin.Context) {
+	var req CreatePotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	potType := req.Type
+	if potType == "" {
+		potType = PotSavings
+	}
+
+	pot, err := h.savingsService.CreatePot(c.GetInt("userID"), req.Name, potType, req.TargetAmount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create savings pot", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Savings pot created",
+		"pot":     pot,
+	})
+}
+
+// GetPotsHandler handles GET /api/pots, listing the user's pots and the current interest rates
+func (h *SavingsHandler) GetPotsHandler(c *gin.Context) {
+	pots, err := h.savingsService.GetUserPots(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get savings pots"})
+		return
+	}
+
+	rates, err := h.savingsService.GetRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get interest rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"pots":    pots,
+		"rates":   rates,
+	})
+}
+
+// GetPotHandler handles GET /api/pots/:id
+func (h *SavingsHandler) GetPotHandler(c *gin.Context) {
+	potID, ok := parsePotID(c)
+	if !ok {
+		return
+	}
+
+	pot, err := h.savingsService.GetPot(potID, c.GetInt("userID"))
+	if err != nil {
+		respondPotError(c, "Failed to get savings pot", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"pot":     pot,
+	})
+}
+
+// UpdatePotHandler handles PATCH /api/pots/:id
+func (h *SavingsHandler) UpdatePotHandler(c *gin.Context) {
+	potID, ok := parsePotID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdatePotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	pot, err := h.savingsService.UpdatePot(potID, c.GetInt("userID"), req.Name, req.TargetAmount)
+	if err != nil {
+		respondPotError(c, "Failed to update savings pot", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Savings pot updated",
+		"pot":     pot,
+	})
+}
+
+// ClosePotHandler handles DELETE /api/pots/:id, moving the pot's balance to the main balance
+func (h *SavingsHandler) ClosePotHandler(c *gin.Context) {
+	potID, ok := parsePotID(c)
+	if !ok {
+		return
+	}
+
+	pot, transaction, err := h.savingsService.ClosePot(potID, c.GetInt("userID"))
+	if err != nil {
+		respondPotError(c, "Failed to close savings pot", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Savings pot closed",
+		"pot":         pot,
+		"transaction": transaction,
+	})
+}
+
+// MovePotFundsHandler handles POST /api/pots/move
+func (h *SavingsHandler) MovePotFundsHandler(c *gin.Context) {
+	var req MovePotFundsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	transaction, err := h.savingsService.MoveFunds(c.GetInt("userID"), req.FromPotID, req.ToPotID, req.Amount)
+	if err != nil {
+		respondPotError(c, "Move failed", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Moved " + transaction.Description,
+		"transaction": transaction,
+	})
+}
+
+// GetSavingsRatesHandler handles GET /api/admin/savings-rates
+func (h *SavingsHandler) GetSavingsRatesHandler(c *gin.Context) {
+	rates, err := h.savingsService.GetRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get interest rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"rates":   rates,
+	})
+}
+
+// SetSavingsRateHandler handles PUT /api/admin/savings-rates/:pot_type
+func (h *SavingsHandler) SetSavingsRateHandler(c *gin.Context) {
+	var req SetSavingsRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	compounding := req.Compounding
+	if compounding == "" {
+		compounding = CompoundDaily
+	}
+
+	rate, err := h.savingsService.SetRate(c.Param("pot_type"), *req.AnnualRate, compounding, c.GetString("adminActor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to set interest rate", "details": err.Error()})
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendSavingsRateWebhook(rate)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Interest rate updated",
+		"rate":    rate,
+	})
+}
+
+// parsePotID reads the :id parameter
+func parsePotID(c *gin.Context) (int, bool) {
+	potID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid savings pot ID"})
+		return 0, false
+	}
+	return potID, true
+}
+
+// respondPotError responds 404 for pots the user can't see, otherwise 400
+func respondPotError(c *gin.Context, message string, err error) {
+	if err == errPotNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Savings pot not found"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Savings pot types
+const (
+	PotSavings = "savings" // Plain savings
+	PotGoal    = "goal"    // Saving towards a target amount
+)
+
+// Interest compounding, how often accrued interest is paid into a pot
+const (
+	CompoundDaily   = "daily"
+	CompoundMonthly = "monthly" // On the last day of each month
+)
+
+// maxSavingsPots limits how many open pots a user can have
+const maxSavingsPots = 20
+
+// maxInterestRate is the highest annual percentage an admin can set
+const maxInterestRate = 100
+
+// potDateLayout is the format of interest_accrued_on
+const potDateLayout = "2006-01-02"
+
+// errPotNotFound is returned when a pot doesn't exist, is closed, or belongs to someone else
+var errPotNotFound = fmt.Errorf("savings pot not found")
+
+// SavingsService handles savings pots and their interest
+type SavingsService struct {
+	db      *sql.DB
+	banking *BankingService
+}
+
+// NewSavingsService creates a new SavingsService
+func NewSavingsService(db *sql.DB, banking *BankingService) *SavingsService {
+	return &SavingsService{db: db, banking: banking}
+}
+
+// potSelect selects pots with their type's interest rate
+const potSelect = `
+	SELECT p.id, p.user_id, p.name, p.pot_type, p.balance, p.target_amount, p.accrued_interest, p.interest_accrued_on,
+	       p.closed_at, p.created_at, COALESCE(r.annual_rate, 0), COALESCE(r.compounding, 'daily')
+	FROM savings_pots p
+	LEFT JOIN savings_rates r ON r.pot_type = p.pot_type
+`
+
+// CreatePot opens a new, empty savings pot. Goal pots need a target amount; savings pots can't have one.
+func (s *SavingsService) CreatePot(userID int, name, potType string, targetAmount *float64) (*SavingsPot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := validatePotTarget(potType, targetAmount); err != nil {
+		return nil, err
+	}
+
+	var open int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM savings_pots WHERE user_id = ? AND closed_at IS NULL`, userID).Scan(&open)
+	if err != nil {
+		return nil, err
+	}
+	if open >= maxSavingsPots {
+		return nil, fmt.Errorf("you can have at most %d savings pots", maxSavingsPots)
+	}
+
+	var potID int
+	err = s.db.QueryRow(`
+		INSERT INTO savings_pots (user_id, name, pot_type, target_amount, interest_accrued_on, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, name, potType, targetAmount, time.Now().UTC().Format(potDateLayout), time.Now().UTC()).Scan(&potID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetPot(potID, userID)
+}
+
+// UpdatePot renames a pot and, for goal pots, changes its target
+func (s *SavingsService) UpdatePot(potID, userID int, name string, targetAmount *float64) (*SavingsPot, error) {
+	pot, err := s.GetPot(potID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = pot.Name
+	}
+	if targetAmount == nil {
+		targetAmount = pot.TargetAmount
+	}
+	if err := validatePotTarget(pot.Type, targetAmount); err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE savings_pots SET name = ?, target_amount = ? WHERE id = ?`, name, targetAmount, potID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetPot(potID, userID)
+}
+
+// GetPot retrieves one of the user's open pots with its transactions
+func (s *SavingsService) GetPot(potID, userID int) (*SavingsPot, error) {
+	pots, err := s.queryPots(`WHERE p.id = ? AND p.user_id = ? AND p.closed_at IS NULL`, potID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pots) == 0 {
+		return nil, errPotNotFound
+	}
+	pot := &pots[0]
+
+	pot.Transactions, err = s.getPotTransactions(potID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pot, nil
+}
+
+// GetUserPots lists the user's open pots, oldest first
+func (s *SavingsService) GetUserPots(userID int) ([]SavingsPot, error) {
+	return s.queryPots(`WHERE p.user_id = ? AND p.closed_at IS NULL ORDER BY p.created_at, p.id`, userID)
+}
+
+// GetUserPotsBalance returns the total held in the user's open savings pots
+func (s *BankingService) GetUserPotsBalance(userID int) (float64, error) {
+	var total float64
+	err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(balance), 0) FROM savings_pots WHERE user_id = ? AND closed_at IS NULL
+	`, userID).Scan(&total)
+	return roundCents(total), err
+}
+
+// MoveFunds moves money between the user's main balance and pots, or between two pots. A nil pot ID is the main
+// balance.
+func (s *SavingsService) MoveFunds(userID int, fromPotID, toPotID *int, amount float64) (*Transaction, error) {
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be at least 0.01")
+	}
+	if fromPotID == nil && toPotID == nil {
+		return nil, fmt.Errorf("choose a pot to move money into or out of")
+	}
+	if fromPotID != nil && toPotID != nil && *fromPotID == *toPotID {
+		return nil, fmt.Errorf("cannot move money to the same pot")
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Frozen and suspended accounts can't move money around
+	if err = checkAccountCanSend(tx, userID); err != nil {
+		return nil, err
+	}
+
+	fromName, toName := "Main balance", "Main balance"
+	if fromPotID != nil {
+		var balance float64
+		err = tx.QueryRow(`
+			SELECT name, balance FROM savings_pots WHERE id = ? AND user_id = ? AND closed_at IS NULL
+		`, *fromPotID, userID).Scan(&fromName, &balance)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, errPotNotFound
+			}
+			return nil, err
+		}
+		if balance < amount {
+			return nil, fmt.Errorf("insufficient balance in %s", fromName)
+		}
+	} else {
+		// Check sufficient balance, excluding held funds
+		available, err := availableBalance(tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if available < amount {
+			return nil, fmt.Errorf("insufficient balance")
+		}
+	}
+	if toPotID != nil {
+		err = tx.QueryRow(`
+			SELECT name FROM savings_pots WHERE id = ? AND user_id = ? AND closed_at IS NULL
+		`, *toPotID, userID).Scan(&toName)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, errPotNotFound
+			}
+			return nil, err
+		}
+	}
+
+	transactionID, err := movePotFundsInTx(tx, userID, fromPotID, toPotID, amount, fmt.Sprintf("%s to %s", fromName, toName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.banking.GetTransactionByID(transactionID)
+}
+
+// ClosePot closes a pot, moving its balance to the main balance; interest accrued but not yet paid is lost.
+// Returns the closed pot and the transaction moving its balance, or nil if it was empty.
+func (s *SavingsService) ClosePot(potID, userID int) (*SavingsPot, *Transaction, error) {
+	pot, err := s.GetPot(potID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	transactionID, err := closePotInTx(tx, pot.ID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	pot.ClosedAt = &now
+	if transactionID == 0 {
+		return pot, nil, nil
+	}
+	pot.Balance = 0
+	transaction, err := s.banking.GetTransactionByID(transactionID)
+	return pot, transaction, err
+}
+
+// closeUserPotsInTx closes all of a user's open pots, moving their balances to the main balance
+func closeUserPotsInTx(tx *sql.Tx, userID int) error {
+	rows, err := tx.Query(`SELECT id FROM savings_pots WHERE user_id = ? AND closed_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+	var potIDs []int
+	for rows.Next() {
+		var potID int
+		if err := rows.Scan(&potID); err != nil {
+			rows.Close()
+			return err
+		}
+		potIDs = append(potIDs, potID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, potID := range potIDs {
+		if _, err := closePotInTx(tx, potID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closePotInTx closes a pot, moving its balance to the main balance. Returns the move's transaction ID, or 0 if
+// the pot was empty.
+func closePotInTx(tx *sql.Tx, potID, userID int) (int, error) {
+	var name string
+	var balance float64
+	err := tx.QueryRow(`
+		SELECT name, balance FROM savings_pots WHERE id = ? AND user_id = ? AND closed_at IS NULL
+	`, potID, userID).Scan(&name, &balance)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errPotNotFound
+		}
+		return 0, err
+	}
+
+	transactionID := 0
+	if balance > 0 {
+		transactionID, err = movePotFundsInTx(tx, userID, &potID, nil, balance, fmt.Sprintf("%s closed", name))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE savings_pots SET closed_at = ? WHERE id = ?`, time.Now().UTC(), potID)
+	return transactionID, err
+}
+
+// movePotFundsInTx moves money between a user's main balance (nil) and pots, recording the move
+func movePotFundsInTx(tx *sql.Tx, userID int, fromPotID, toPotID *int, amount float64, description string) (int, error) {
+	if fromPotID != nil {
+		_, err := tx.Exec(`UPDATE savings_pots SET balance = balance - ? WHERE id = ?`, amount, *fromPotID)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		_, err := tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if toPotID != nil {
+		_, err := tx.Exec(`UPDATE savings_pots SET balance = balance + ? WHERE id = ?`, amount, *toPotID)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		_, err := tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var transactionID int
+	err := tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status,
+		                          from_pot_id, to_pot_id, created_at)
+		VALUES (?, ?, ?, 'pot_transfer', ?, 'completed', ?, ?, ?)
+		RETURNING id
+	`, userID, userID, amount, description, fromPotID, toPotID, time.Now()).Scan(&transactionID)
+	return transactionID, err
+}
+
+// GetRates lists the interest rate of each pot type
+func (s *SavingsService) GetRates() ([]SavingsRate, error) {
+	rows, err := s.db.Query(`
+		SELECT pot_type, annual_rate, compounding, updated_by, updated_at FROM savings_rates ORDER BY pot_type
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []SavingsRate{}
+	for rows.Next() {
+		var rate SavingsRate
+		var updatedBy sql.NullString
+		if err := rows.Scan(&rate.PotType, &rate.AnnualRate, &rate.Compounding, &updatedBy, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rate.UpdatedBy = updatedBy.String
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// SetRate changes the annual interest rate and compounding of a pot type, from the next accrual on
+func (s *SavingsService) SetRate(potType string, annualRate float64, compounding, actor string) (*SavingsRate, error) {
+	if potType != PotSavings && potType != PotGoal {
+		return nil, fmt.Errorf("pot type must be %s or %s", PotSavings, PotGoal)
+	}
+	if annualRate < 0 || annualRate > maxInterestRate {
+		return nil, fmt.Errorf("annual rate must be between 0 and %d percent", maxInterestRate)
+	}
+	if compounding != CompoundDaily && compounding != CompoundMonthly {
+		return nil, fmt.Errorf("compounding must be %s or %s", CompoundDaily, CompoundMonthly)
+	}
+
+	now := time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT INTO savings_rates (pot_type, annual_rate, compounding, updated_by, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(pot_type) DO UPDATE SET annual_rate = excluded.annual_rate, compounding = excluded.compounding,
+		                                     updated_by = excluded.updated_by, updated_at = excluded.updated_at
+	`, potType, annualRate, compounding, actor, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SavingsRate{PotType: potType, AnnualRate: annualRate, Compounding: compounding, UpdatedBy: actor, UpdatedAt: now}, nil
+}
+
+// AccrueInterest runs one pass of the interest job. Each open pot earns a day's interest on its balance for every
+// day since it last accrued, at its type's annual rate divided by 365. Interest builds up in accrued_interest and
+// is paid into the pot from PokéBank when it compounds, daily or at the end of each month, so later days earn
+// interest on it; fractions of a cent wait for the next payment. Returns the interest payments made.
+func (s *SavingsService) AccrueInterest() ([]Transaction, error) {
+	today := time.Now().UTC().Format(potDateLayout)
+	pots, err := s.queryPots(`WHERE p.closed_at IS NULL AND p.interest_accrued_on < ?`, today)
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []Transaction
+	for _, pot := range pots {
+		transactionID, err := s.accruePotInterest(pot, today)
+		if err != nil {
+			return payments, fmt.Errorf("pot %d: %v", pot.ID, err)
+		}
+		if transactionID == 0 {
+			continue
+		}
+
+		payment, err := s.banking.GetTransactionByID(transactionID)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, *payment)
+	}
+
+	return payments, nil
+}
+
+// accruePotInterest accrues a pot's interest up to the day before today, paying what has compounded. Returns the
+// interest transaction's ID, or 0 if nothing was paid.
+func (s *SavingsService) accruePotInterest(pot SavingsPot, today string) (int, error) {
+	day, err := time.Parse(potDateLayout, pot.InterestAccruedOn)
+	if err != nil {
+		return 0, err
+	}
+	end, err := time.Parse(potDateLayout, today)
+	if err != nil {
+		return 0, err
+	}
+
+	balance, accrued, paid := pot.Balance, pot.AccruedInterest, 0.0
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		accrued += balance * pot.InterestRate / 100 / 365
+
+		// Monthly interest is paid on the last day of the month
+		if pot.Compounding == CompoundMonthly && day.AddDate(0, 0, 1).Day() != 1 {
+			continue
+		}
+		payment := math.Floor(accrued*100+1e-9) / 100
+		if payment > 0 {
+			balance += payment
+			accrued -= payment
+			paid += payment
+		}
+	}
+	paid = roundCents(paid)
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Only the first run of the job accrues each day, and a move since the pot was read leaves it for the next run
+	result, err := tx.Exec(`
+		UPDATE savings_pots SET balance = balance + ?, accrued_interest = ?, interest_accrued_on = ?
+		WHERE id = ? AND closed_at IS NULL AND interest_accrued_on = ? AND balance = ?
+	`, paid, accrued, today, pot.ID, pot.InterestAccruedOn, pot.Balance)
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return 0, nil
+	}
+
+	transactionID := 0
+	if paid > 0 {
+		var pokeBankID int
+		err = tx.QueryRow(`SELECT id FROM users WHERE username = 'PokéBank'`).Scan(&pokeBankID)
+		if err != nil {
+			return 0, err
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, to_pot_id, created_at)
+			VALUES (?, ?, ?, 'interest', ?, 'completed', ?, ?)
+			RETURNING id
+		`, pokeBankID, pot.UserID, paid, fmt.Sprintf("Interest on %s at %.2f%%", pot.Name, pot.InterestRate), pot.ID,
+			time.Now()).Scan(&transactionID)
+		if err != nil {
+			return 0, err
+		}
+
+		// Reset PokéBank balance since it pays the interest
+		if err = s.banking.resetPokeBankBalanceInTx(tx, pokeBankID, pot.UserID); err != nil {
+			return 0, err
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return transactionID, nil
+}
+
+// queryPots selects the pots matching the WHERE clause
+func (s *SavingsService) queryPots(where string, args ...interface{}) ([]SavingsPot, error) {
+	rows, err := s.db.Query(potSelect+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pots := []SavingsPot{}
+	for rows.Next() {
+		var pot SavingsPot
+		var targetAmount sql.NullFloat64
+		var closedAt sql.NullTime
+		err := rows.Scan(&pot.ID, &pot.UserID, &pot.Name, &pot.Type, &pot.Balance, &targetAmount, &pot.AccruedInterest,
+			&pot.InterestAccruedOn, &closedAt, &pot.CreatedAt, &pot.InterestRate, &pot.Compounding)
+		if err != nil {
+			return nil, err
+		}
+
+		if targetAmount.Valid {
+			pot.TargetAmount = &targetAmount.Float64
+			progress := math.Round(pot.Balance/targetAmount.Float64*10000) / 100
+			pot.GoalProgress = &progress
+			pot.GoalReached = pot.Balance >= targetAmount.Float64
+		}
+		if closedAt.Valid {
+			pot.ClosedAt = &closedAt.Time
+		}
+		pots = append(pots, pot)
+	}
+
+	return pots, rows.Err()
+}
+
+// getPotTransactions retrieves the moves into and out of a pot and its interest, newest first
+func (s *SavingsService) getPotTransactions(potID int) ([]Transaction, error) {
+	query := transactionSelect + `
+		WHERE t.from_pot_id = ? OR t.to_pot_id = ?
+		ORDER BY t.created_at DESC, t.id DESC
+	`
+
+	rows, err := s.db.Query(query, potID, potID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTransactions(rows)
+}
+
+// validatePotTarget checks a pot's type and target amount go together
+func validatePotTarget(potType string, targetAmount *float64) error {
+	switch potType {
+	case PotSavings:
+		if targetAmount != nil {
+			return fmt.Errorf("only goal pots have a target amount")
+		}
+	case PotGoal:
+		if targetAmount == nil || *targetAmount <= 0 {
+			return fmt.Errorf("goal pots need a target amount")
+		}
+	default:
+		return fmt.Errorf("type must be %s or %s", PotSavings, PotGoal)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// runPeriodically runs job in the background once at startup and then every interval.
+// Errors are logged and the job keeps running on schedule.
+func runPeriodically(name string, interval time.Duration, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := job(); err != nil {
+				log.Printf("Background job %q failed: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SharedAccountHandler handles shared accounts, their members and their transfers' approvals
+type SharedAccountHandler struct {
+	sharedAccountService *SharedAccountService
+	userService          *UserService
+	webhookService       *WebhookService
+}
+
+// NewSharedAccountHandler creates a new SharedAccountHandler
+func NewSharedAccountHandler(sharedAccountService *SharedAccountService, userService *UserService, webhookService *WebhookService) *SharedAccountHandler {
+	return &SharedAccountHandler{
+		sharedAccountService: sharedAccountService,
+		userService:          userService,
+		webhookService:       webhookService,
+	}
+}
+
+// CreateSharedAccountRequest represents the request body for opening a shared account
+type CreateSharedAccountRequest struct {
+	Name string `json:"name" binding:"required"` // Shares the username namespace
+}
+
+// UpdateSharedAccountRequest represents an owner's change to a shared account
+type UpdateSharedAccountRequest struct {
+	RequiredApprovals int `json:"required_approvals" binding:"required,gt=0"`
+}
+
+// AddAccountMemberRequest represents the request body for adding a member to a shared account
+type AddAccountMemberRequest struct {
+	Member     string   `json:"member" binding:"required"` // Username or account number
+	Role       string   `json:"role" binding:"required,oneof=owner spender viewer"`
+	SpendLimit *float64 `json:"spend_limit"` // Spenders only; omit for no limit
+}
+
+// UpdateAccountMemberRequest represents the request body for changing a member's role
+type UpdateAccountMemberRequest struct {
+	Role       string   `json:"role" binding:"required,oneof=owner spender viewer"`
+	SpendLimit *float64 `json:"spend_limit"` // Spenders only; omit for no limit
+}
+
+// CreateSharedAccountHandler handles POST /api/shared-accounts
+func (h *SharedAccountHandler) CreateSharedAccountHandler(c *gin.Context) {
+	var req CreateSharedAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	account, err := h.sharedAccountService.CreateSharedAccount(c.GetInt("userID"), req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create shared account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Shared account created",
+		"account": account,
+	})
+}
+
+// GetSharedAccountsHandler handles GET /api/shared-accounts, listing the accounts the user is a member of
+func (h *SharedAccountHandler) GetSharedAccountsHandler(c *gin.Context) {
+	accounts, err := h.sharedAccountService.GetUserSharedAccounts(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get shared accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"accounts": accounts,
+	})
+}
+
+// GetSharedAccountHandler handles GET /api/shared-accounts/:id
+func (h *SharedAccountHandler) GetSharedAccountHandler(c *gin.Context) {
+	accountID, ok := parseSharedAccountID(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.sharedAccountService.GetSharedAccount(accountID, c.GetInt("userID"))
+	if err != nil {
+		respondSharedAccountError(c, "Failed to get shared account", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"account": account,
+	})
+}
+
+// UpdateSharedAccountHandler handles PATCH /api/shared-accounts/:id
+func (h *SharedAccountHandler) UpdateSharedAccountHandler(c *gin.Context) {
+	accountID, ok := parseSharedAccountID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateSharedAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	account, err := h.sharedAccountService.SetRequiredApprovals(accountID, c.GetInt("userID"), req.RequiredApprovals)
+	if err != nil {
+		respondSharedAccountError(c, "Failed to update shared account", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Shared account updated",
+		"account": account,
+	})
+}
+
+// AddMemberHandler handles POST /api/shared-accounts/:id/members
+func (h *SharedAccountHandler) AddMemberHandler(c *gin.Context) {
+	accountID, ok := parseSharedAccountID(c)
+	if !ok {
+		return
+	}
+
+	var req AddAccountMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	memberUser, err := h.userService.GetUserByUsernameOrAccountNumber(req.Member)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	account, err := h.sharedAccountService.AddMember(accountID, c.GetInt("userID"), memberUser.ID, req.Role, req.SpendLimit)
+	if err != nil {
+		respondSharedAccountError(c, "Failed to add member", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": memberUser.Username + " added as " + req.Role,
+		"account": account,
+	})
+}
+
+// UpdateMemberHandler handles PUT /api/shared-accounts/:id/members/:user_id
+func (h *SharedAccountHandler) UpdateMemberHandler(c *gin.Context) {
+	accountID, ok := parseSharedAccountID(c)
+	if !ok {
+		return
+	}
+	memberUserID, ok := parseMemberUserID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAccountMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	account, err := h.sharedAccountService.UpdateMember(accountID, c.GetInt("userID"), memberUserID, req.Role, req.SpendLimit)
+	if err != nil {
+		respondSharedAccountError(c, "Failed to update member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Member updated",
+		"account": account,
+	})
+}
+
+// RemoveMemberHandler handles DELETE /api/shared-accounts/:id/members/:user_id; members can remove themselves
+func (h *SharedAccountHandler) RemoveMemberHandler(c *gin.Context) {
+	accountID, ok := parseSharedAccountID(c)
+	if !ok {
+		return
+	}
+	memberUserID, ok := parseMemberUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sharedAccountService.RemoveMember(accountID, c.GetInt("userID"), memberUserID); err != nil {
+		respondSharedAccountError(c, "Failed to remove member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Member removed",
+	})
+}
+
+// GetSharedTransfersHandler handles GET /api/shared-accounts/:id/transfers; optional ?status, e.g. ?status=pending
+func (h *SharedAccountHandler) GetSharedTransfersHandler(c *gin.Context) {
+	accountID, ok := parseSharedAccountID(c)
+	if !ok {
+		return
+	}
+
+	transfers, err := h.sharedAccountService.GetTransfers(accountID, c.GetInt("userID"), c.Query("status"))
+	if err != nil {
+		respondSharedAccountError(c, "Failed to get transfers", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"transfers": transfers,
+	})
+}
+
+// ApproveSharedTransferHandler handles POST /api/shared-accounts/:id/transfers/:transfer_id/approve
+func (h *SharedAccountHandler) ApproveSharedTransferHandler(c *gin.Context) {
+	accountID, transferID, ok := parseSharedTransferID(c)
+	if !ok {
+		return
+	}
+
+	transfer, transaction, err := h.sharedAccountService.ApproveTransfer(accountID, transferID, c.GetInt("userID"))
+	if err != nil {
+		respondSharedAccountError(c, "Failed to approve transfer", err)
+		return
+	}
+
+	if transaction == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"message":  "Approval recorded",
+			"transfer": transfer,
+		})
+		return
+	}
+
+	// Send webhook notifications
+	go h.webhookService.SendSharedTransferWebhook("shared_transfer_executed", transfer)
+	go h.webhookService.SendTransferWebhook(transaction)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Transfer approved and completed",
+		"transfer":    transfer,
+		"transaction": transaction,
+	})
+}
+
+// RejectSharedTransferHandler handles POST /api/shared-accounts/:id/transfers/:transfer_id/reject
+func (h *SharedAccountHandler) RejectSharedTransferHandler(c *gin.Context) {
+	accountID, transferID, ok := parseSharedTransferID(c)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.sharedAccountService.RejectTransfer(accountID, transferID, c.GetInt("userID"))
+	if err != nil {
+		respondSharedAccountError(c, "Failed to reject transfer", err)
+		return
+	}
+
+	message := "Rejection recorded"
+	if transfer.Status == SharedTransferRejected {
+		message = "Transfer rejected"
+
+		// Send webhook notification
+		go h.webhookService.SendSharedTransferWebhook("shared_transfer_rejected", transfer)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  message,
+		"transfer": transfer,
+	})
+}
+
+// CancelSharedTransferHandler handles POST /api/shared-accounts/:id/transfers/:transfer_id/cancel
+func (h *SharedAccountHandler) CancelSharedTransferHandler(c *gin.Context) {
+	accountID, transferID, ok := parseSharedTransferID(c)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.sharedAccountService.CancelTransfer(accountID, transferID, c.GetInt("userID"))
+	if err != nil {
+		respondSharedAccountError(c, "Failed to cancel transfer", err)
+		return
+	}
+
+	// Send webhook notification
+	go h.webhookService.SendSharedTransferWebhook("shared_transfer_cancelled", transfer)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Transfer cancelled",
+		"transfer": transfer,
+	})
+}
+
+// parseSharedAccountID reads the :id parameter
+func parseSharedAccountID(c *gin.Context) (int, bool) {
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shared account ID"})
+		return 0, false
+	}
+	return accountID, true
+}
+
+// parseMemberUserID reads the :user_id parameter
+func parseMemberUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// parseSharedTransferID reads the :id and :transfer_id parameters
+func parseSharedTransferID(c *gin.Context) (int, int, bool) {
+	accountID, ok := parseSharedAccountID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	transferID, err := strconv.Atoi(c.Param("transfer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return 0, 0, false
+	}
+	return accountID, transferID, true
+}
+
+// respondSharedAccountError responds 404 for accounts and transfers the user can't see, 403 when their role
+// doesn't allow the action, otherwise 400
+func respondSharedAccountError(c *gin.Context, message string, err error) {
+	switch err {
+	case errSharedAccountNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shared account not found"})
+	case errSharedTransferNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+	case errNotAccountOwner, errNotAccountSigner:
+		c.JSON(http.StatusForbidden, gin.H{"error": message, "details": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+	}
+}
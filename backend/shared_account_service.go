@@ -0,0 +1,1042 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Shared account member roles
+const (
+	MemberOwner   = "owner"   // Sends money, approves transfers and manages members
+	MemberSpender = "spender" // Sends money, within their daily limit if one is set, and approves transfers
+	MemberViewer  = "viewer"  // Read only
+)
+
+// Shared transfer statuses
+const (
+	SharedTransferPending   = "pending"
+	SharedTransferExecuted  = "executed"
+	SharedTransferRejected  = "rejected"
+	SharedTransferCancelled = "cancelled"
+)
+
+// maxSharedAccounts limits how many shared accounts a user can open
+const maxSharedAccounts = 10
+
+// Shared account errors that callers can tell apart
+var (
+	errSharedAccountNotFound  = fmt.Errorf("shared account not found")
+	errSharedTransferNotFound = fmt.Errorf("shared transfer not found")
+	errNotAccountOwner        = fmt.Errorf("only owners can manage this account")
+	errNotAccountSigner       = fmt.Errorf("viewers cannot send or approve transfers from this account")
+)
+
+// sharedAccountNameRegex matches the names shared accounts can have; they share the username namespace
+var sharedAccountNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]{3,20}$`)
+
+// SharedAccountService handles shared accounts, their members and transfers needing several approvals
+type SharedAccountService struct {
+	db      *sql.DB
+	banking *BankingService
+}
+
+// NewSharedAccountService creates a new SharedAccountService
+func NewSharedAccountService(db *sql.DB, banking *BankingService) *SharedAccountService {
+	return &SharedAccountService{db: db, banking: banking}
+}
+
+// CreateSharedAccount opens an empty shared account with the user as its only owner. The account is a users row
+// with an unguessable password, so it can't sign in, and doesn't get the welcome bonus.
+func (s *SharedAccountService) CreateSharedAccount(ownerID int, name string) (*SharedAccount, error) {
+	name = strings.TrimSpace(name)
+	if !sharedAccountNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("name must be 3 to 20 letters, numbers or underscores")
+	}
+	if strings.EqualFold(name, "PokeBank") {
+		return nil, fmt.Errorf("this name is reserved and cannot be used")
+	}
+
+	password, err := generateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	accountNumber := NewUserService(s.db).generateAccountNumber()
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkAccountCanSend(tx, ownerID); err != nil {
+		return nil, err
+	}
+
+	var owned int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM shared_accounts WHERE created_by = ?
+		AND user_id IN (SELECT id FROM users WHERE status != ?)
+	`, ownerID, AccountClosed).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if owned >= maxSharedAccounts {
+		return nil, fmt.Errorf("you can open at most %d shared accounts", maxSharedAccounts)
+	}
+
+	var taken bool
+	if err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`, name).Scan(&taken); err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, fmt.Errorf("name is already taken")
+	}
+
+	var accountID int
+	err = tx.QueryRow(`
+		INSERT INTO users (username, email, password_hash, account_number, balance)
+		VALUES (?, ?, ?, ?, 0)
+		RETURNING id
+	`, name, "shared-"+accountNumber+"@pokebank.com", string(hashedPassword), accountNumber).Scan(&accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`INSERT INTO shared_accounts (user_id, required_approvals, created_by, created_at) VALUES (?, 1, ?, ?)`,
+		accountID, ownerID, now)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO account_members (account_user_id, member_user_id, role, added_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, accountID, ownerID, MemberOwner, ownerID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetSharedAccount(accountID, ownerID)
+}
+
+// GetSharedAccount returns a shared account with its members, if the user is one of them
+func (s *SharedAccountService) GetSharedAccount(accountID, userID int) (*SharedAccount, error) {
+	member, err := s.GetMember(accountID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := scanSharedAccount(s.db.QueryRow(sharedAccountSelect+`WHERE a.user_id = ?`, accountID))
+	if err != nil {
+		return nil, err
+	}
+	account.Role = member.Role
+
+	account.Members, err = s.getMembers(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// GetUserSharedAccounts returns the shared accounts the user is a member of, with their role in each
+func (s *SharedAccountService) GetUserSharedAccounts(userID int) ([]SharedAccount, error) {
+	rows, err := s.db.Query(sharedAccountSelect+`
+		JOIN account_members m ON m.account_user_id = a.user_id
+		WHERE m.member_user_id = ? AND u.status != ?
+		ORDER BY a.created_at
+	`, userID, AccountClosed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []SharedAccount{}
+	var accountIDs []int
+	for rows.Next() {
+		account, err := scanSharedAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+		accountIDs = append(accountIDs, account.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i, accountID := range accountIDs {
+		member, err := s.GetMember(accountID, userID)
+		if err != nil {
+			return nil, err
+		}
+		accounts[i].Role = member.Role
+	}
+
+	return accounts, nil
+}
+
+// SetRequiredApprovals changes how many signers must approve each new transfer. Pending transfers keep the
+// number they were created with.
+func (s *SharedAccountService) SetRequiredApprovals(accountID, ownerID, requiredApprovals int) (*SharedAccount, error) {
+	if requiredApprovals < 1 {
+		return nil, fmt.Errorf("required approvals must be at least 1")
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = requireOwnerInTx(tx, accountID, ownerID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`UPDATE shared_accounts SET required_approvals = ? WHERE user_id = ?`, requiredApprovals, accountID); err != nil {
+		return nil, err
+	}
+	if err = checkSignersInTx(tx, accountID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetSharedAccount(accountID, ownerID)
+}
+
+// AddMember adds a user to a shared account. Only spenders can have a spend limit.
+func (s *SharedAccountService) AddMember(accountID, ownerID, memberUserID int, role string, spendLimit *float64) (*SharedAccount, error) {
+	if err := validateMemberRole(role, spendLimit); err != nil {
+		return nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = requireOwnerInTx(tx, accountID, ownerID); err != nil {
+		return nil, err
+	}
+
+	// Members must be people: not PokéBank, and not this or another shared account
+	var username string
+	var isShared bool
+	err = tx.QueryRow(`
+		SELECT username, EXISTS(SELECT 1 FROM shared_accounts WHERE user_id = users.id) FROM users WHERE id = ?
+	`, memberUserID).Scan(&username, &isShared)
+	if err != nil {
+		return nil, err
+	}
+	if username == "PokéBank" || isShared {
+		return nil, fmt.Errorf("%s cannot be a member of a shared account", username)
+	}
+	if err = checkAccountCanReceive(tx, memberUserID); err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM account_members WHERE account_user_id = ? AND member_user_id = ?)`,
+		accountID, memberUserID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%s is already a member", username)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO account_members (account_user_id, member_user_id, role, spend_limit, added_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, accountID, memberUserID, role, spendLimit, ownerID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetSharedAccount(accountID, ownerID)
+}
+
+// UpdateMember changes a member's role and spend limit. The account must keep an owner and enough signers to
+// approve its transfers.
+func (s *SharedAccountService) UpdateMember(accountID, ownerID, memberUserID int, role string, spendLimit *float64) (*SharedAccount, error) {
+	if err := validateMemberRole(role, spendLimit); err != nil {
+		return nil, err
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = requireOwnerInTx(tx, accountID, ownerID); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`UPDATE account_members SET role = ?, spend_limit = ? WHERE account_user_id = ? AND member_user_id = ?`,
+		role, spendLimit, accountID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("user is not a member of this account")
+	}
+	if err = checkSignersInTx(tx, accountID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetSharedAccount(accountID, ownerID)
+}
+
+// RemoveMember removes a member from a shared account. Owners can remove anyone; other members can only leave.
+// The account must keep an owner and enough signers to approve its transfers.
+func (s *SharedAccountService) RemoveMember(accountID, actorID, memberUserID int) error {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if actorID != memberUserID {
+		if err = requireOwnerInTx(tx, accountID, actorID); err != nil {
+			return err
+		}
+	} else if _, err = getMemberInTx(tx, accountID, actorID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM account_members WHERE account_user_id = ? AND member_user_id = ?`, accountID, memberUserID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("user is not a member of this account")
+	}
+	if err = checkSignersInTx(tx, accountID); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetMember returns the user's membership of a shared account
+func (s *SharedAccountService) GetMember(accountID, userID int) (*AccountMember, error) {
+	return getMemberInTx(s.db, accountID, userID)
+}
+
+// InitiateTransfer sends money from a shared account on a member's behalf. If the account needs a single
+// approval the transfer happens straight away and its transaction is returned; otherwise it waits as pending,
+// with the initiator's approval counted. Spenders with a limit can initiate up to that much each day (UTC).
+func (s *SharedAccountService) InitiateTransfer(accountID, memberUserID, toUserID int, amount float64, description string) (*SharedTransfer, *Transaction, error) {
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return nil, nil, fmt.Errorf("amount must be positive")
+	}
+	if toUserID == accountID {
+		return nil, nil, fmt.Errorf("cannot transfer to the same account")
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	member, err := getMemberInTx(tx, accountID, memberUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isAccountSigner(member.Role) {
+		return nil, nil, errNotAccountSigner
+	}
+
+	if member.SpendLimit != nil {
+		spent, err := memberSpentToday(tx, accountID, memberUserID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if spent+amount > *member.SpendLimit {
+			return nil, nil, fmt.Errorf("amount exceeds your daily spend limit of %.2f on this account", *member.SpendLimit)
+		}
+	}
+
+	var requiredApprovals int
+	if err = tx.QueryRow(`SELECT required_approvals FROM shared_accounts WHERE user_id = ?`, accountID).Scan(&requiredApprovals); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	status := SharedTransferPending
+	var transactionID *int
+	var resolvedAt *time.Time
+	if requiredApprovals <= 1 {
+		var toAccountNumber string
+		if err = tx.QueryRow(`SELECT account_number FROM users WHERE id = ?`, toUserID).Scan(&toAccountNumber); err != nil {
+			return nil, nil, err
+		}
+		id, err := s.banking.transferInTx(tx, accountID, toAccountNumber, amount, "transfer", description)
+		if err != nil {
+			return nil, nil, err
+		}
+		status = SharedTransferExecuted
+		transactionID = &id
+		resolvedAt = &now
+	} else {
+		// Fail early rather than collect approvals for a transfer that can't go through
+		available, err := availableBalance(tx, accountID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if available < amount {
+			return nil, nil, fmt.Errorf("insufficient balance")
+		}
+	}
+
+	var transferID int
+	err = tx.QueryRow(`
+		INSERT INTO shared_transfers (account_user_id, initiated_by, to_user_id, amount, description, status,
+		                              approvals_required, transaction_id, created_at, resolved_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, accountID, memberUserID, toUserID, amount, description, status, requiredApprovals, transactionID, now,
+		resolvedAt).Scan(&transferID)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO shared_transfer_decisions (transfer_id, member_user_id, decision, created_at) VALUES (?, ?, 'approve', ?)`,
+		transferID, memberUserID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	transfer, err := s.getTransfer(accountID, transferID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if transactionID == nil {
+		return transfer, nil, nil
+	}
+
+	transaction, err := s.banking.GetTransactionByID(*transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transfer, transaction, nil
+}
+
+// ApproveTransfer records a signer's approval of a pending transfer. The approval that reaches the transfer's
+// required number carries it out and gets its transaction back; if the transfer then fails, for example for lack
+// of funds, the approval isn't recorded and the transfer stays pending.
+func (s *SharedAccountService) ApproveTransfer(accountID, transferID, memberUserID int) (*SharedTransfer, *Transaction, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := s.decideInTx(tx, accountID, transferID, memberUserID, "approve")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	approvals, err := countDecisions(tx, transfer, "approve")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var transactionID int
+	if approvals >= transfer.ApprovalsRequired {
+		// Claim the transfer so a simultaneous approval can't carry it out twice
+		result, err := tx.Exec(`UPDATE shared_transfers SET status = ?, resolved_at = ? WHERE id = ? AND status = ?`,
+			SharedTransferExecuted, time.Now(), transferID, SharedTransferPending)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, nil, fmt.Errorf("transfer is no longer pending")
+		}
+
+		var toAccountNumber string
+		err = tx.QueryRow(`SELECT account_number FROM users WHERE id = ?`, transfer.ToUserID).Scan(&toAccountNumber)
+		if err != nil {
+			return nil, nil, err
+		}
+		transactionID, err = s.banking.transferInTx(tx, accountID, toAccountNumber, transfer.Amount, "transfer", transfer.Description)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err = tx.Exec(`UPDATE shared_transfers SET transaction_id = ? WHERE id = ?`, transactionID, transferID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	transfer, err = s.getTransfer(accountID, transferID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if transactionID == 0 {
+		return transfer, nil, nil
+	}
+
+	transaction, err := s.banking.GetTransactionByID(transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transfer, transaction, nil
+}
+
+// RejectTransfer records a signer's rejection of a pending transfer. The transfer is rejected once too few
+// signers are left to approve it.
+func (s *SharedAccountService) RejectTransfer(accountID, transferID, memberUserID int) (*SharedTransfer, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := s.decideInTx(tx, accountID, transferID, memberUserID, "reject")
+	if err != nil {
+		return nil, err
+	}
+
+	rejections, err := countDecisions(tx, transfer, "reject")
+	if err != nil {
+		return nil, err
+	}
+	var signers int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM account_members WHERE account_user_id = ? AND role IN (?, ?)`,
+		accountID, MemberOwner, MemberSpender).Scan(&signers)
+	if err != nil {
+		return nil, err
+	}
+	if signers-rejections < transfer.ApprovalsRequired {
+		if err = resolveTransferInTx(tx, transferID, SharedTransferRejected); err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getTransfer(accountID, transferID)
+}
+
+// CancelTransfer withdraws a pending transfer. Its initiator or an owner can cancel it.
+func (s *SharedAccountService) CancelTransfer(accountID, transferID, memberUserID int) (*SharedTransfer, error) {
+	member, err := s.GetMember(accountID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	transfer, err := s.getTransfer(accountID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.InitiatedBy != memberUserID && member.Role != MemberOwner {
+		return nil, fmt.Errorf("only the initiator or an owner can cancel this transfer")
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = resolveTransferInTx(tx, transferID, SharedTransferCancelled); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getTransfer(accountID, transferID)
+}
+
+// GetTransfers returns a shared account's transfers, newest first, optionally filtered by status
+func (s *SharedAccountService) GetTransfers(accountID, userID int, status string) ([]SharedTransfer, error) {
+	if _, err := s.GetMember(accountID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id FROM shared_transfers WHERE account_user_id = ?`
+	args := []interface{}{accountID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transferIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		transferIDs = append(transferIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	transfers := []SharedTransfer{}
+	for _, id := range transferIDs {
+		transfer, err := s.getTransfer(accountID, id)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *transfer)
+	}
+	return transfers, nil
+}
+
+// decideInTx records a signer's approval or rejection of a pending transfer within tx and returns the transfer
+// as it was before the decision, without the names of those who decided it
+func (s *SharedAccountService) decideInTx(tx *sql.Tx, accountID, transferID, memberUserID int, decision string) (*SharedTransfer, error) {
+	member, err := getMemberInTx(tx, accountID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAccountSigner(member.Role) {
+		return nil, errNotAccountSigner
+	}
+
+	transfer := &SharedTransfer{}
+	var description sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, account_user_id, initiated_by, to_user_id, amount, description, status, approvals_required, created_at
+		FROM shared_transfers
+		WHERE id = ? AND account_user_id = ?
+	`, transferID, accountID).Scan(&transfer.ID, &transfer.AccountID, &transfer.InitiatedBy, &transfer.ToUserID,
+		&transfer.Amount, &description, &transfer.Status, &transfer.ApprovalsRequired, &transfer.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errSharedTransferNotFound
+		}
+		return nil, err
+	}
+	transfer.Description = description.String
+	if transfer.Status != SharedTransferPending {
+		return nil, fmt.Errorf("transfer is %s", transfer.Status)
+	}
+
+	var decided bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM shared_transfer_decisions WHERE transfer_id = ? AND member_user_id = ?)`,
+		transferID, memberUserID).Scan(&decided)
+	if err != nil {
+		return nil, err
+	}
+	if decided {
+		return nil, fmt.Errorf("you have already approved or rejected this transfer")
+	}
+
+	_, err = tx.Exec(`INSERT INTO shared_transfer_decisions (transfer_id, member_user_id, decision, created_at) VALUES (?, ?, ?, ?)`,
+		transferID, memberUserID, decision, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// resolveTransferInTx moves a pending transfer to a final status within tx without carrying it out
+func resolveTransferInTx(tx *sql.Tx, transferID int, status string) error {
+	result, err := tx.Exec(`UPDATE shared_transfers SET status = ?, resolved_at = ? WHERE id = ? AND status = ?`,
+		status, time.Now(), transferID, SharedTransferPending)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("transfer is no longer pending")
+	}
+	return nil
+}
+
+// getTransfer returns a shared account's transfer with the names of the members who approved and rejected it
+func (s *SharedAccountService) getTransfer(accountID, transferID int) (*SharedTransfer, error) {
+	transfer := &SharedTransfer{}
+	var description sql.NullString
+	var transactionID sql.NullInt64
+	var resolvedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT t.id, t.account_user_id, t.initiated_by, t.to_user_id, t.amount, t.description, t.status,
+		       t.approvals_required, t.transaction_id, t.created_at, t.resolved_at, i.username, r.username
+		FROM shared_transfers t
+		JOIN users i ON i.id = t.initiated_by
+		JOIN users r ON r.id = t.to_user_id
+		WHERE t.id = ? AND t.account_user_id = ?
+	`, transferID, accountID).Scan(&transfer.ID, &transfer.AccountID, &transfer.InitiatedBy, &transfer.ToUserID,
+		&transfer.Amount, &description, &transfer.Status, &transfer.ApprovalsRequired, &transactionID,
+		&transfer.CreatedAt, &resolvedAt, &transfer.InitiatorUsername, &transfer.ToUsername)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errSharedTransferNotFound
+		}
+		return nil, err
+	}
+	transfer.Description = description.String
+	if transactionID.Valid {
+		id := int(transactionID.Int64)
+		transfer.TransactionID = &id
+	}
+	if resolvedAt.Valid {
+		transfer.ResolvedAt = &resolvedAt.Time
+	}
+
+	rows, err := s.db.Query(`
+		SELECT d.decision, u.username
+		FROM shared_transfer_decisions d
+		JOIN users u ON u.id = d.member_user_id
+		WHERE d.transfer_id = ?
+		ORDER BY d.created_at
+	`, transferID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfer.ApprovedBy = []string{}
+	for rows.Next() {
+		var decision, username string
+		if err := rows.Scan(&decision, &username); err != nil {
+			return nil, err
+		}
+		if decision == "approve" {
+			transfer.ApprovedBy = append(transfer.ApprovedBy, username)
+		} else {
+			transfer.RejectedBy = append(transfer.RejectedBy, username)
+		}
+	}
+	return transfer, rows.Err()
+}
+
+// getMembers returns a shared account's members, owners first
+func (s *SharedAccountService) getMembers(accountID int) ([]AccountMember, error) {
+	rows, err := s.db.Query(memberSelect+`
+		WHERE m.account_user_id = ?
+		ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'spender' THEN 1 ELSE 2 END, m.created_at
+	`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []AccountMember{}
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *member)
+	}
+	return members, rows.Err()
+}
+
+// sharedAccountSelect selects shared accounts with their users row
+const sharedAccountSelect = `
+	SELECT a.user_id, u.username, u.account_number, u.balance, u.status, a.required_approvals, a.created_by, a.created_at
+	FROM shared_accounts a
+	JOIN users u ON u.id = a.user_id
+`
+
+// scanSharedAccount scans a row selected with sharedAccountSelect
+func scanSharedAccount(row rowScanner) (*SharedAccount, error) {
+	account := &SharedAccount{}
+	err := row.Scan(&account.ID, &account.Name, &account.AccountNumber, &account.Balance, &account.Status,
+		&account.RequiredApprovals, &account.CreatedBy, &account.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errSharedAccountNotFound
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// memberSelect selects account members with their usernames
+const memberSelect = `
+	SELECT m.account_user_id, m.member_user_id, u.username, m.role, m.spend_limit, m.added_by, m.created_at
+	FROM account_members m
+	JOIN users u ON u.id = m.member_user_id
+`
+
+// scanMember scans a row selected with memberSelect
+func scanMember(row rowScanner) (*AccountMember, error) {
+	member := &AccountMember{}
+	var spendLimit sql.NullFloat64
+	err := row.Scan(&member.AccountID, &member.UserID, &member.Username, &member.Role, &spendLimit, &member.AddedBy,
+		&member.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errSharedAccountNotFound
+		}
+		return nil, err
+	}
+	if spendLimit.Valid {
+		member.SpendLimit = &spendLimit.Float64
+	}
+	return member, nil
+}
+
+// getMemberInTx returns a user's membership of a shared account; errSharedAccountNotFound if they aren't a member
+func getMemberInTx(q queryRower, accountID, userID int) (*AccountMember, error) {
+	return scanMember(q.QueryRow(memberSelect+`WHERE m.account_user_id = ? AND m.member_user_id = ?`, accountID, userID))
+}
+
+// requireOwnerInTx returns an error unless the user owns the shared account
+func requireOwnerInTx(tx *sql.Tx, accountID, userID int) error {
+	member, err := getMemberInTx(tx, accountID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role != MemberOwner {
+		return errNotAccountOwner
+	}
+	return nil
+}
+
+// checkSignersInTx returns an error if a shared account has no owner left or fewer signers than it needs approvals
+func checkSignersInTx(tx *sql.Tx, accountID int) error {
+	var owners, signers, requiredApprovals int
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(m.role = ?), 0), COALESCE(SUM(m.role IN (?, ?)), 0), a.required_approvals
+		FROM shared_accounts a
+		LEFT JOIN account_members m ON m.account_user_id = a.user_id
+		WHERE a.user_id = ?
+		GROUP BY a.user_id
+	`, MemberOwner, MemberOwner, MemberSpender, accountID).Scan(&owners, &signers, &requiredApprovals)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return fmt.Errorf("a shared account must keep at least one owner")
+	}
+	if signers < requiredApprovals {
+		return fmt.Errorf("the account needs %d approvals per transfer but would only have %d owners and spenders",
+			requiredApprovals, signers)
+	}
+	return nil
+}
+
+// countDecisions counts a transfer's approvals or rejections by members who can still sign for the account
+func countDecisions(q queryRower, transfer *SharedTransfer, decision string) (int, error) {
+	var count int
+	err := q.QueryRow(`
+		SELECT COUNT(*)
+		FROM shared_transfer_decisions d
+		JOIN account_members m ON m.member_user_id = d.member_user_id AND m.account_user_id = ?
+		WHERE d.transfer_id = ? AND d.decision = ? AND m.role IN (?, ?)
+	`, transfer.AccountID, transfer.ID, decision, MemberOwner, MemberSpender).Scan(&count)
+	return count, err
+}
+
+// memberSpentToday sums the transfers a member has initiated from a shared account today (UTC), pending or sent
+func memberSpentToday(q queryRower, accountID, userID int) (float64, error) {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var spent float64
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0)
+		FROM shared_transfers
+		WHERE account_user_id = ? AND initiated_by = ? AND status IN ('pending', 'executed') AND created_at >= ?
+	`, accountID, userID, midnight).Scan(&spent)
+	return spent, err
+}
+
+// validateMemberRole checks a member's role and that only spenders have a spend limit
+func validateMemberRole(role string, spendLimit *float64) error {
+	switch role {
+	case MemberOwner, MemberSpender, MemberViewer:
+	default:
+		return fmt.Errorf("role must be owner, spender or viewer")
+	}
+	if spendLimit != nil {
+		if role != MemberSpender {
+			return fmt.Errorf("only spenders can have a spend limit")
+		}
+		if *spendLimit <= 0 {
+			return fmt.Errorf("spend limit must be positive")
+		}
+	}
+	return nil
+}
+
+// isAccountSigner reports whether members with this role can send and approve transfers
+func isAccountSigner(role string) bool {
+	return role == MemberOwner || role == MemberSpender
+}
+
+// sharedAccountReadRoutes are the GET endpoints every member, viewers included, can use as a shared account.
+// Other GETs, such as card details that could be spent without approval, are treated like changes.
+var sharedAccountReadRoutes = map[string]bool{
+	"/api/account":                    true,
+	"/api/balance":                    true,
+	"/api/transactions":               true,
+	"/api/payment-requests":           true,
+	"/api/payment-requests/:id":       true,
+	"/api/payment-requests/:id/qr":    true,
+	"/api/payment-request-groups":     true,
+	"/api/payment-request-groups/:id": true,
+	"/api/qr/account":                 true,
+	"/api/payment-links":              true,
+	"/api/invoices":                   true,
+	"/api/invoices/:id":               true,
+	"/api/escrows":                    true,
+	"/api/escrows/:id":                true,
+	"/api/pots":                       true,
+	"/api/pots/:id":                   true,
+	"/api/loans/products":             true,
+	"/api/loans":                      true,
+	"/api/loans/:id":                  true,
+}
+
+// sharedAccountMiddleware lets members use the banking endpoints as a shared account. The account is chosen
+// with the account_id query parameter or the X-Account-ID header. The request then runs with the shared account
+// as "userID" and "user", and with the member in "accountMember". Every member can use sharedAccountReadRoutes.
+// Transfers from the account go through SharedAccountService, so they can wait for approval. Anything else needs
+// an owner, on an account that only needs one approval.
+func sharedAccountMiddleware(sharedAccountService *SharedAccountService, userService *UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountIDStr := c.Query("account_id")
+		if accountIDStr == "" {
+			accountIDStr = c.GetHeader("X-Account-ID")
+		}
+		userID := c.GetInt("userID")
+		// The shared account endpoints take the account from the path and always act as the member
+		if accountIDStr == "" || accountIDStr == strconv.Itoa(userID) || strings.HasPrefix(c.FullPath(), "/api/shared-accounts") {
+			c.Next()
+			return
+		}
+
+		accountID, err := strconv.Atoi(accountIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+			c.Abort()
+			return
+		}
+
+		member, err := sharedAccountService.GetMember(accountID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shared account not found"})
+			c.Abort()
+			return
+		}
+
+		switch {
+		case c.Request.Method == http.MethodGet && sharedAccountReadRoutes[c.FullPath()]:
+		case c.FullPath() == "/api/transfer":
+			if !isAccountSigner(member.Role) {
+				c.JSON(http.StatusForbidden, gin.H{"error": errNotAccountSigner.Error()})
+				c.Abort()
+				return
+			}
+		case member.Role != MemberOwner:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can use this endpoint as a shared account; members can send money with POST /api/transfer"})
+			c.Abort()
+			return
+		default:
+			var requiredApprovals int
+			err = sharedAccountService.db.QueryRow(`SELECT required_approvals FROM shared_accounts WHERE user_id = ?`, accountID).Scan(&requiredApprovals)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get shared account"})
+				c.Abort()
+				return
+			}
+			if requiredApprovals > 1 {
+				c.JSON(http.StatusForbidden, gin.H{"error": "This shared account needs several approvals, so it can only send money with POST /api/transfer"})
+				c.Abort()
+				return
+			}
+		}
+
+		accountUser, err := userService.GetUserByID(accountID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shared account not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("accountMember", member)
+		c.Set("userID", accountUser.ID)
+		c.Set("user", accountUser)
+
+		c.Next()
+	}
+}
+
+// verifyRequestPassword checks the password of the user who signed in. When they act as a shared account, that is
+// the member's password rather than the account's.
+func verifyRequestPassword(c *gin.Context, userService *UserService, password string) bool {
+	user := c.MustGet("user").(*User)
+	if member, ok := c.Get("accountMember"); ok {
+		memberUser, err := userService.GetUserByID(member.(*AccountMember).UserID)
+		if err != nil {
+			return false
+		}
+		user = memberUser
+	}
+	return userService.VerifyPassword(user, password)
+}
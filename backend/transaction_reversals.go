@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// errNotRefundable is returned when a user asks to refund a transaction they didn't receive as a transfer
+var errNotRefundable = fmt.Errorf("only transfers you received can be refunded")
+
+// reversibleTransactionTypes are the transactions an admin can reverse. Refunds, reversals, loan disbursements and
+// escrow and account closure transactions have their own flows and can't be reversed.
+var reversibleTransactionTypes = []string{"transfer", "merchant_payment", "card_payment", "admin_adjustment"}
+
+// ReverseTransaction moves all or part of a completed transaction back from its recipient to its sender, as an
+// admin correction. An amount of zero reverses whatever hasn't been refunded or reversed yet. The recipient's
+// account may be frozen or suspended, but must have the funds available.
+func (s *BankingService) ReverseTransaction(transactionID int, amount float64, reason string) (*Transaction, error) {
+	return s.reverseTransaction(transactionID, 0, amount, reason)
+}
+
+// RefundTransaction returns all or part of a transfer the user received to its sender. An amount of zero refunds
+// whatever hasn't been refunded or reversed yet.
+func (s *BankingService) RefundTransaction(transactionID, userID int, amount float64, reason string) (*Transaction, error) {
+	return s.reverseTransaction(transactionID, userID, amount, reason)
+}
+
+// reverseTransaction records a transaction linked to the original that moves money back to its sender. With a
+// refundingUserID it is the recipient's own refund of a transfer, otherwise an admin reversal.
+func (s *BankingService) reverseTransaction(transactionID, refundingUserID int, amount float64, reason string) (*Transaction, error) {
+	amount = roundCents(amount)
+	if amount < 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var fromUserID, toUserID int
+	var transactionType, status, description string
+	var cardID, merchantID sql.NullInt64
+	var merchantName, merchantCategory sql.NullString
+	err = tx.QueryRow(`
+		SELECT from_user_id, to_user_id, transaction_type, status, COALESCE(description, ''), card_id, merchant_id,
+		       merchant_name, merchant_category
+		FROM transactions WHERE id = ?
+	`, transactionID).Scan(&fromUserID, &toUserID, &transactionType, &status, &description, &cardID, &merchantID,
+		&merchantName, &merchantCategory)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errTransactionNotFound
+		}
+		return nil, err
+	}
+
+	reversalType := "reversal"
+	if refundingUserID != 0 {
+		// Users only see their own transactions
+		if toUserID != refundingUserID && fromUserID != refundingUserID {
+			return nil, errTransactionNotFound
+		}
+		if toUserID != refundingUserID || transactionType != "transfer" {
+			return nil, errNotRefundable
+		}
+		reversalType = "refund"
+	} else if !isReversibleTransactionType(transactionType) {
+		return nil, fmt.Errorf("%s transactions cannot be reversed", transactionType)
+	}
+	if status != "completed" {
+		return nil, fmt.Errorf("only completed transactions can be reversed")
+	}
+
+	refundable, err := refundableAmountInTx(tx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if refundable <= 0 {
+		return nil, errAlreadyRefunded
+	}
+	if amount == 0 {
+		amount = refundable
+	}
+	if amount > refundable {
+		return nil, errRefundExceedsPayment
+	}
+
+	// Admins can take funds back from frozen or suspended accounts; a user refunding needs an active account
+	if refundingUserID != 0 {
+		if err = checkAccountCanSend(tx, toUserID); err != nil {
+			return nil, err
+		}
+	}
+	if err = checkAccountCanReceive(tx, fromUserID); err != nil {
+		return nil, err
+	}
+
+	// Check the recipient still has the funds, excluding held funds
+	available, err := availableBalance(tx, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	if available < amount {
+		return nil, fmt.Errorf("recipient has insufficient balance to return this payment")
+	}
+
+	if _, err = tx.Exec(`UPDATE users SET balance = balance - ? WHERE id = ?`, amount, toUserID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`UPDATE users SET balance = balance + ? WHERE id = ?`, amount, fromUserID); err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		reason = description
+	}
+	prefix := "Reversal: "
+	if reversalType == "refund" {
+		prefix = "Refund: "
+	}
+
+	// Create transaction record, linked to the transaction it reverses
+	var reversalID int
+	err = tx.QueryRow(`
+		INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, description, status, card_id,
+		                          merchant_id, merchant_name, merchant_category, original_transaction_id, created_at)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, toUserID, fromUserID, amount, reversalType, prefix+reason, cardID, merchantID, merchantName, merchantCategory,
+		transactionID, time.Now()).Scan(&reversalID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reset PokéBank balance if involved in transaction
+	if err = s.resetPokeBankBalanceInTx(tx, toUserID, fromUserID); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetTransactionByID(reversalID)
+}
+
+// isReversibleTransactionType reports whether an admin can reverse transactions of this type
+func isReversibleTransactionType(transactionType string) bool {
+	for _, t := range reversibleTransactionTypes {
+		if t == transactionType {
+			return true
+		}
+	}
+	return false
+}
@@ -68,9 +68,9 @@ func (s *UserService) CreateUser(username, email, password string) (*User, error
 
 	// Fetch the created user
 	user := &User{}
-	selectQuery := `SELECT id, username, email, account_number, balance, created_at FROM users WHERE id = ?`
+	selectQuery := `SELECT id, username, email, account_number, balance, email_verified, role, status, created_at FROM users WHERE id = ?`
 	err = s.db.QueryRow(selectQuery, userID).Scan(
-		&user.ID, &user.Username, &user.Email, &user.AccountNumber, &user.Balance, &user.CreatedAt,
+		&user.ID, &user.Username, &user.Email, &user.AccountNumber, &user.Balance, &user.EmailVerified, &user.Role, &user.Status, &user.CreatedAt,
 	)
 
 	if err != nil {
@@ -83,13 +83,13 @@ func (s *UserService) CreateUser(username, email, password string) (*User, error
 // GetUserByUsername retrieves a user by username
 func (s *UserService) GetUserByUsername(username string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, account_number, balance, created_at
+		SELECT id, username, email, password_hash, account_number, balance, email_verified, role, status, created_at
 		FROM users WHERE username = ?
 	`
 
 	user := &User{}
 	err := s.db.QueryRow(query, username).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.AccountNumber, &user.Balance, &user.CreatedAt,
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.AccountNumber, &user.Balance, &user.EmailVerified, &user.Role, &user.Status, &user.CreatedAt,
 	)
 
 	if err != nil {
@@ -102,13 +102,13 @@ func (s *UserService) GetUserByUsername(username string) (*User, error) {
 // GetUserByID retrieves a user by ID
 func (s *UserService) GetUserByID(id int) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, account_number, balance, created_at
+		SELECT id, username, email, password_hash, account_number, balance, email_verified, role, status, created_at
 		FROM users WHERE id = ?
 	`
 
 	user := &User{}
 	err := s.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.AccountNumber, &user.Balance, &user.CreatedAt,
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.AccountNumber, &user.Balance, &user.EmailVerified, &user.Role, &user.Status, &user.CreatedAt,
 	)
 
 	if err != nil {
@@ -121,13 +121,13 @@ func (s *UserService) GetUserByID(id int) (*User, error) {
 // GetUserByAccountNumber retrieves a user by account number
 func (s *UserService) GetUserByAccountNumber(accountNumber string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, account_number, balance, created_at
+		SELECT id, username, email, password_hash, account_number, balance, email_verified, role, status, created_at
 		FROM users WHERE account_number = ?
 	`
 
 	user := &User{}
 	err := s.db.QueryRow(query, accountNumber).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.AccountNumber, &user.Balance, &user.CreatedAt,
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.AccountNumber, &user.Balance, &user.EmailVerified, &user.Role, &user.Status, &user.CreatedAt,
 	)
 
 	if err != nil {
@@ -213,6 +213,123 @@ func (s *UserService) DeleteAllUserSessions(userID int) error {
 	return err
 }
 
+// RevokeAllUserAccess deletes all sessions for a user and revokes their OAuth access tokens
+func (s *UserService) RevokeAllUserAccess(userID int) error {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE oauth_access_tokens SET revoked = TRUE WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetUserByEmail retrieves a user by email address
+func (s *UserService) GetUserByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, username, email, password_hash, account_number, balance, email_verified, role, status, created_at
+		FROM users WHERE email = ?
+	`
+
+	user := &User{}
+	err := s.db.QueryRow(query, email).Scan(
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.AccountNumber, &user.Balance, &user.EmailVerified, &user.Role, &user.Status, &user.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// MarkEmailVerified marks a user's email address as verified
+func (s *UserService) MarkEmailVerified(userID int) error {
+	query := `UPDATE users SET email_verified = TRUE WHERE id = ?`
+	_, err := s.db.Exec(query, userID)
+	return err
+}
+
+// CreateUserToken creates a one-time token for the given purpose, invalidating any earlier unused ones.
+// Only a hash of the token is stored.
+func (s *UserService) CreateUserToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := generateSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// Invalidate previously issued tokens for the same purpose
+	_, err = tx.Exec(`DELETE FROM user_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO user_tokens (user_id, token_hash, purpose, expires_at) VALUES (?, ?, ?, ?)`
+	_, err = tx.Exec(query, userID, hashToken(token), purpose, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeUserToken validates a one-time token and marks it used, returning the user it belongs to
+func (s *UserService) ConsumeUserToken(token, purpose string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, user_id, expires_at, used_at FROM user_tokens
+		WHERE token_hash = ? AND purpose = ?
+	`, hashToken(token), purpose).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("invalid or expired token")
+		}
+		return 0, err
+	}
+
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		return 0, fmt.Errorf("invalid or expired token")
+	}
+
+	_, err = tx.Exec(`UPDATE user_tokens SET used_at = ? WHERE id = ?`, time.Now(), tokenID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
 // generateAccountNumber generates a unique account number
 func (s *UserService) generateAccountNumber() string {
 	// Generate a random 10-digit account number
@@ -277,8 +394,16 @@ func (s *UserService) getOrCreatePokeBankUser(tx *sql.Tx) (int, error) {
 		return 0, err
 	}
 
-	// Create PokéBank system user
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("system-user-no-login"), bcrypt.DefaultCost)
+	// Create PokéBank system user. Without POKEBANK_PASSWORD it gets an unguessable password, disabling login.
+	password := getEnv("POKEBANK_PASSWORD", "")
+	if password == "" {
+		password, err = generateSessionToken()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, err
 	}
@@ -301,10 +426,126 @@ func (s *UserService) getOrCreatePokeBankUser(tx *sql.Tx) (int, error) {
 	return int(id), nil
 }
 
+// ConfigurePokeBankLogin sets the PokéBank account password. With an empty password a random
+// one is set instead, which disables PokéBank login.
+func (s *UserService) ConfigurePokeBankLogin(password string) error {
+	pokeBank, err := s.GetUserByUsername("PokéBank")
+	if err != nil {
+		return err // PokéBank doesn't exist yet
+	}
+
+	if password == "" {
+		password, err = generateSessionToken()
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.UpdatePassword(pokeBank.ID, password)
+}
+
+// legacyPokeBankPassword is the fixed password PokéBank was created with before it could log in
+const legacyPokeBankPassword = "system-user-no-login"
+
+// DisableLegacyPokeBankLogin replaces a PokéBank password left over from older databases with a
+// random one. Passwords set through ConfigurePokeBankLogin are kept.
+func (s *UserService) DisableLegacyPokeBankLogin() error {
+	pokeBank, err := s.GetUserByUsername("PokéBank")
+	if err == sql.ErrNoRows {
+		return nil // Created with a random password on first registration
+	}
+	if err != nil {
+		return err
+	}
+
+	if !s.VerifyPassword(pokeBank, legacyPokeBankPassword) {
+		return nil
+	}
+	return s.ConfigurePokeBankLogin("")
+}
+
+// UpdateRole changes a user's role
+func (s *UserService) UpdateRole(userID int, role string) error {
+	if !isValidRole(role) {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+
+	result, err := s.db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// SetAccountStatus changes a user's account status, returning the previous status
+func (s *UserService) SetAccountStatus(userID int, status, reason, actor string) (string, error) {
+	if !isValidAccountStatus(status) || status == AccountClosed {
+		return "", fmt.Errorf("invalid account status: %s", status)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	oldStatus, err := setAccountStatusInTx(tx, userID, status, reason, actor)
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return oldStatus, nil
+}
+
+// GetAccountStatusHistory returns every status change for a user, newest first
+func (s *UserService) GetAccountStatusHistory(userID int) ([]AccountStatusChange, error) {
+	query := `
+		SELECT id, user_id, old_status, new_status, reason, actor, created_at
+		FROM account_status_history
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []AccountStatusChange
+	for rows.Next() {
+		var change AccountStatusChange
+		err := rows.Scan(
+			&change.ID, &change.UserID, &change.OldStatus, &change.NewStatus,
+			&change.Reason, &change.Actor, &change.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, nil
+}
+
 // GetAllUsers returns all users with their basic info (admin function)
 func (s *UserService) GetAllUsers() ([]User, error) {
 	query := `
-		SELECT id, username, email, account_number, balance, created_at 
+		SELECT id, username, email, account_number, balance, email_verified, role, status, created_at 
 		FROM users 
 		ORDER BY created_at DESC
 	`
@@ -320,7 +561,7 @@ func (s *UserService) GetAllUsers() ([]User, error) {
 		var user User
 		err := rows.Scan(
 			&user.ID, &user.Username, &user.Email, &user.AccountNumber, 
-			&user.Balance, &user.CreatedAt,
+			&user.Balance, &user.EmailVerified, &user.Role, &user.Status, &user.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
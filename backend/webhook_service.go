@@ -2,26 +2,57 @@ package main
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"syscall"
 	"time"
 )
 
+// webhookSignatureHeader carries the HMAC-SHA256 of a signed webhook's body, as "sha256=<hex>"
+const webhookSignatureHeader = "X-Webhook-Signature"
+
+// errNonPublicAddress is returned when a callback would connect to a loopback, private or link-local address
+var errNonPublicAddress = fmt.Errorf("callbacks can only be sent to public addresses")
+
 // WebhookService handles sending webhook notifications
 type WebhookService struct {
-	webhookURL string
-	client     *http.Client
+	webhookURL     string
+	client         *http.Client
+	callbackClient *http.Client // For player-supplied URLs; only connects to public addresses
 }
 
 // NewWebhookService creates a new WebhookService
 func NewWebhookService() *WebhookService {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		// Checked on every connection, after DNS resolution and for redirects too
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errNonPublicAddress
+			}
+			return nil
+		},
+	}
+
 	return &WebhookService{
 		webhookURL: os.Getenv("WEBHOOK_URL"),
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		callbackClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
 	}
 }
 
@@ -56,6 +87,13 @@ type PaymentRequestWebhookData struct {
 	Reason       string  `json:"reason"`
 	Message      string  `json:"message"`
 	Status       string  `json:"status"`
+
+	AmountPaid    float64    `json:"amountPaid"`
+	AmountDue     float64    `json:"amountDue"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	ReminderCount int        `json:"reminderCount"`
+	TransactionID *int       `json:"transactionId,omitempty"` // The payment, for "payment_request_partially_paid"
+	PaymentAmount float64    `json:"paymentAmount,omitempty"`
 }
 
 // UserAuthWebhookData represents user authentication webhook data
@@ -112,6 +150,13 @@ func (w *WebhookService) SendTransferWebhook(transaction *Transaction) {
 
 // SendPaymentRequestWebhook sends a webhook notification for payment requests
 func (w *WebhookService) SendPaymentRequestWebhook(paymentRequest *PaymentRequest) {
+	w.SendPaymentRequestEventWebhook("payment_request_created", paymentRequest, nil)
+}
+
+// SendPaymentRequestEventWebhook sends a webhook notification about a payment request: "payment_request_created",
+// "payment_request_partially_paid", "payment_request_expired" or "payment_request_reminder". payment is the
+// transaction for "payment_request_partially_paid".
+func (w *WebhookService) SendPaymentRequestEventWebhook(event string, paymentRequest *PaymentRequest, payment *Transaction) {
 	if w.webhookURL == "" {
 		return
 	}
@@ -126,10 +171,19 @@ func (w *WebhookService) SendPaymentRequestWebhook(paymentRequest *PaymentReques
 		Reason:       paymentRequest.Reason,
 		Message:      paymentRequest.Message,
 		Status:       paymentRequest.Status,
+
+		AmountPaid:    paymentRequest.AmountPaid,
+		AmountDue:     paymentRequest.AmountDue,
+		ExpiresAt:     paymentRequest.ExpiresAt,
+		ReminderCount: paymentRequest.ReminderCount,
+	}
+	if payment != nil {
+		data.TransactionID = &payment.ID
+		data.PaymentAmount = payment.Amount
 	}
 
 	payload := WebhookPayload{
-		Event:     "payment_request_created",
+		Event:     event,
 		Timestamp: time.Now(),
 		Data:      data,
 	}
@@ -201,6 +255,102 @@ func (w *WebhookService) SendPaymentRequestRejectionWebhook(requestID, actionUse
 	w.sendWebhook(payload)
 }
 
+// PaymentRequestGroupWebhookData represents split bill webhook data
+type PaymentRequestGroupWebhookData struct {
+	GroupID         int     `json:"groupId"`
+	CreatorUserID   int     `json:"creatorUserId"`
+	CreatorUsername string  `json:"creatorUsername"`
+	Reason          string  `json:"reason"`
+	SplitType       string  `json:"splitType"`
+	Status          string  `json:"status"`
+	TotalAmount     float64 `json:"totalAmount"`
+	AmountRequested float64 `json:"amountRequested"`
+	AmountPaid      float64 `json:"amountPaid"`
+	ShareCount      int     `json:"shareCount"`
+	SharesPaid      int     `json:"sharesPaid"`
+	RequestIDs      []int   `json:"requestIds"`
+}
+
+// SendPaymentRequestGroupWebhook sends a webhook notification about a split bill: "payment_request_group_created",
+// "payment_request_group_settled" or "payment_request_group_cancelled"
+func (w *WebhookService) SendPaymentRequestGroupWebhook(event string, group *PaymentRequestGroup) {
+	if w.webhookURL == "" {
+		return
+	}
+
+	data := PaymentRequestGroupWebhookData{
+		GroupID:         group.ID,
+		CreatorUserID:   group.CreatorUserID,
+		CreatorUsername: group.CreatorUsername,
+		Reason:          group.Reason,
+		SplitType:       group.SplitType,
+		Status:          group.Status,
+		TotalAmount:     group.TotalAmount,
+		AmountRequested: group.AmountRequested,
+		AmountPaid:      group.AmountPaid,
+		ShareCount:      group.ShareCount,
+		SharesPaid:      group.SharesPaid,
+	}
+	for _, share := range group.Shares {
+		data.RequestIDs = append(data.RequestIDs, share.ID)
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// EscrowWebhookData represents the data sent about an escrow
+type EscrowWebhookData struct {
+	EscrowID                int     `json:"escrowId"`
+	BuyerUserID             int     `json:"buyerUserId"`
+	BuyerUsername           string  `json:"buyerUsername"`
+	SellerUserID            int     `json:"sellerUserId"`
+	SellerUsername          string  `json:"sellerUsername"`
+	Amount                  float64 `json:"amount"`
+	Description             string  `json:"description"`
+	Status                  string  `json:"status"`
+	HoldTransactionID       *int    `json:"holdTransactionId,omitempty"`
+	SettlementTransactionID *int    `json:"settlementTransactionId,omitempty"`
+	SettledBy               string  `json:"settledBy,omitempty"`
+	DisputeReason           string  `json:"disputeReason,omitempty"`
+}
+
+// SendEscrowWebhook sends a webhook notification about an escrow: "escrow_created", "escrow_disputed",
+// "escrow_released" or "escrow_refunded"
+func (w *WebhookService) SendEscrowWebhook(event string, escrow *Escrow) {
+	if w.webhookURL == "" {
+		return
+	}
+
+	data := EscrowWebhookData{
+		EscrowID:                escrow.ID,
+		BuyerUserID:             escrow.BuyerUserID,
+		BuyerUsername:           escrow.BuyerUsername,
+		SellerUserID:            escrow.SellerUserID,
+		SellerUsername:          escrow.SellerUsername,
+		Amount:                  escrow.Amount,
+		Description:             escrow.Description,
+		Status:                  escrow.Status,
+		HoldTransactionID:       escrow.HoldTransactionID,
+		SettlementTransactionID: escrow.SettlementTransactionID,
+		SettledBy:               escrow.SettledBy,
+		DisputeReason:           escrow.DisputeReason,
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
 // SendCardRefreshNotification sends a webhook notification for card refresh
 func (w *WebhookService) SendCardRefreshNotification(username, cardNumber string) {
 	if w.webhookURL == "" {
@@ -230,13 +380,24 @@ func (w *WebhookService) sendWebhook(payload WebhookPayload) {
 		return
 	}
 
+	w.sendWebhookTo(w.client, w.webhookURL, "", payload)
+}
+
+// sendCallback sends a webhook payload to a URL a player supplied, such as a payment link's callback URL,
+// signed with the payee's callback secret
+func (w *WebhookService) sendCallback(url, secret string, payload WebhookPayload) {
+	w.sendWebhookTo(w.callbackClient, url, secret, payload)
+}
+
+// sendWebhookTo sends a webhook payload to a specific URL, signing it if a secret is given
+func (w *WebhookService) sendWebhookTo(client *http.Client, url, secret string, payload WebhookPayload) {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		fmt.Printf("Error marshaling webhook payload: %v\n", err)
 		return
 	}
 
-	req, err := http.NewRequest("POST", w.webhookURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		fmt.Printf("Error creating webhook request: %v\n", err)
 		return
@@ -244,8 +405,11 @@ func (w *WebhookService) sendWebhook(payload WebhookPayload) {
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Viridian-Bank-Webhook/1.0")
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhook(secret, jsonData))
+	}
 
-	resp, err := w.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Printf("Error sending webhook: %v\n", err)
 		return
@@ -257,6 +421,20 @@ func (w *WebhookService) sendWebhook(payload WebhookPayload) {
 	}
 }
 
+// signWebhook returns the signature header value for a webhook body
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isPublicIP reports whether an address is reachable on the public internet, rather than loopback, private,
+// link-local, multicast or unspecified
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
 // AdminTransactionWebhookData represents admin transaction webhook data
 type AdminTransactionWebhookData struct {
 	TransactionID int     `json:"transactionId"`
@@ -276,6 +454,7 @@ type MerchantTransactionWebhookData struct {
 	Amount        float64 `json:"amount"`
 	Description   string  `json:"description"`
 	MerchantName  string  `json:"merchantName"`
+	MerchantID    *int    `json:"merchantId,omitempty"` // Set for registered merchants
 }
 
 // SendAdminTransactionWebhook sends a webhook notification for admin transactions
@@ -309,7 +488,7 @@ func (w *WebhookService) SendAdminTransactionWebhook(transactionID, userID int,
 }
 
 // SendMerchantTransactionWebhook sends a webhook notification for merchant transactions
-func (w *WebhookService) SendMerchantTransactionWebhook(transactionID, userID int, username string, amount float64, description, merchantName string) {
+func (w *WebhookService) SendMerchantTransactionWebhook(transactionID, userID int, username string, amount float64, description, merchantName string, merchantID *int) {
 	if w.webhookURL == "" {
 		return // No webhook URL configured
 	}
@@ -321,6 +500,7 @@ func (w *WebhookService) SendMerchantTransactionWebhook(transactionID, userID in
 		Amount:        amount,
 		Description:   description,
 		MerchantName:  merchantName,
+		MerchantID:    merchantID,
 	}
 
 	payload := WebhookPayload{
@@ -331,3 +511,428 @@ func (w *WebhookService) SendMerchantTransactionWebhook(transactionID, userID in
 
 	w.sendWebhook(payload)
 }
+
+// MerchantRefundWebhookData represents merchant refund webhook data
+type MerchantRefundWebhookData struct {
+	TransactionID         int     `json:"transactionId"`
+	OriginalTransactionID int     `json:"originalTransactionId"`
+	MerchantID            int     `json:"merchantId"`
+	MerchantName          string  `json:"merchantName"`
+	UserID                int     `json:"userId"`
+	Username              string  `json:"username"`
+	Amount                float64 `json:"amount"`
+	Description           string  `json:"description"`
+}
+
+// SendMerchantRefundWebhook sends a webhook notification when a merchant refunds a payment
+func (w *WebhookService) SendMerchantRefundWebhook(merchant *Merchant, refund *Transaction) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := MerchantRefundWebhookData{
+		TransactionID:         refund.ID,
+		OriginalTransactionID: *refund.OriginalTransactionID,
+		MerchantID:            merchant.ID,
+		MerchantName:          merchant.Name,
+		UserID:                refund.ToUserID,
+		Username:              refund.ToUsername,
+		Amount:                refund.Amount,
+		Description:           refund.Description,
+	}
+
+	payload := WebhookPayload{
+		Event:     "merchant_refund",
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// TransactionReversedWebhookData represents transaction reversal and refund webhook data
+type TransactionReversedWebhookData struct {
+	TransactionID         int     `json:"transactionId"`
+	OriginalTransactionID int     `json:"originalTransactionId"`
+	TransactionType       string  `json:"transactionType"` // "reversal" by an admin or "refund" by the recipient
+	FromUserID            int     `json:"fromUserId"`
+	FromUsername          string  `json:"fromUsername"`
+	ToUserID              int     `json:"toUserId"`
+	ToUsername            string  `json:"toUsername"`
+	Amount                float64 `json:"amount"`
+	Description           string  `json:"description"`
+	ReversedBy            string  `json:"reversedBy"`
+}
+
+// SendTransactionReversedWebhook sends a webhook notification when a transaction is reversed or refunded
+func (w *WebhookService) SendTransactionReversedWebhook(reversal *Transaction, reversedBy string) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := TransactionReversedWebhookData{
+		TransactionID:         reversal.ID,
+		OriginalTransactionID: *reversal.OriginalTransactionID,
+		TransactionType:       reversal.TransactionType,
+		FromUserID:            reversal.FromUserID,
+		FromUsername:          reversal.FromUsername,
+		ToUserID:              reversal.ToUserID,
+		ToUsername:            reversal.ToUsername,
+		Amount:                reversal.Amount,
+		Description:           reversal.Description,
+		ReversedBy:            reversedBy,
+	}
+
+	payload := WebhookPayload{
+		Event:     "transaction_reversed",
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// SavingsRateWebhookData represents savings interest rate webhook data
+type SavingsRateWebhookData struct {
+	PotType     string  `json:"potType"`
+	AnnualRate  float64 `json:"annualRate"`
+	Compounding string  `json:"compounding"`
+	UpdatedBy   string  `json:"updatedBy"`
+}
+
+// SendSavingsRateWebhook sends a webhook notification when an admin changes a savings pot interest rate
+func (w *WebhookService) SendSavingsRateWebhook(rate *SavingsRate) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := SavingsRateWebhookData{
+		PotType:     rate.PotType,
+		AnnualRate:  rate.AnnualRate,
+		Compounding: rate.Compounding,
+		UpdatedBy:   rate.UpdatedBy,
+	}
+
+	payload := WebhookPayload{
+		Event:     "savings_rate_changed",
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// SharedTransferWebhookData represents shared account transfer webhook data
+type SharedTransferWebhookData struct {
+	SharedTransferID  int      `json:"sharedTransferId"`
+	AccountID         int      `json:"accountId"`
+	InitiatedBy       string   `json:"initiatedBy"`
+	ToUsername        string   `json:"toUsername"`
+	Amount            float64  `json:"amount"`
+	Description       string   `json:"description"`
+	Status            string   `json:"status"`
+	ApprovalsRequired int      `json:"approvalsRequired"`
+	ApprovedBy        []string `json:"approvedBy"`
+	TransactionID     *int     `json:"transactionId,omitempty"`
+}
+
+// SendSharedTransferWebhook sends a webhook notification when a shared account transfer is created or resolved
+func (w *WebhookService) SendSharedTransferWebhook(event string, transfer *SharedTransfer) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := SharedTransferWebhookData{
+		SharedTransferID:  transfer.ID,
+		AccountID:         transfer.AccountID,
+		InitiatedBy:       transfer.InitiatorUsername,
+		ToUsername:        transfer.ToUsername,
+		Amount:            transfer.Amount,
+		Description:       transfer.Description,
+		Status:            transfer.Status,
+		ApprovalsRequired: transfer.ApprovalsRequired,
+		ApprovedBy:        transfer.ApprovedBy,
+		TransactionID:     transfer.TransactionID,
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// LoanWebhookData represents loan webhook data
+type LoanWebhookData struct {
+	LoanID               int     `json:"loanId"`
+	UserID               int     `json:"userId"`
+	Username             string  `json:"username"`
+	ProductName          string  `json:"productName"`
+	Principal            float64 `json:"principal"`
+	AnnualRate           float64 `json:"annualRate"`
+	TermMonths           int     `json:"termMonths"`
+	MonthlyPayment       float64 `json:"monthlyPayment"`
+	Status               string  `json:"status"`
+	OutstandingPrincipal float64 `json:"outstandingPrincipal"`
+	MissedPayments       int     `json:"missedPayments"`
+	DecidedBy            string  `json:"decidedBy,omitempty"`
+}
+
+// SendLoanWebhook sends a webhook notification when a loan is applied for, decided, misses a payment or is paid off
+func (w *WebhookService) SendLoanWebhook(event string, loan *Loan) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := LoanWebhookData{
+		LoanID:               loan.ID,
+		UserID:               loan.UserID,
+		Username:             loan.Username,
+		ProductName:          loan.ProductName,
+		Principal:            loan.Principal,
+		AnnualRate:           loan.AnnualRate,
+		TermMonths:           loan.TermMonths,
+		MonthlyPayment:       loan.MonthlyPayment,
+		Status:               loan.Status,
+		OutstandingPrincipal: loan.OutstandingPrincipal,
+		MissedPayments:       loan.MissedPayments,
+		DecidedBy:            loan.DecidedBy,
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// PaymentLinkPaidWebhookData represents payment link payment webhook data
+type PaymentLinkPaidWebhookData struct {
+	TransactionID int     `json:"transactionId"`
+	PaymentLinkID int     `json:"paymentLinkId"`
+	Code          string  `json:"code"`
+	MerchantID    *int    `json:"merchantId,omitempty"`
+	PayerUserID   int     `json:"payerUserId"`
+	PayerUsername string  `json:"payerUsername"`
+	PayeeUserID   int     `json:"payeeUserId"`
+	PayeeUsername string  `json:"payeeUsername"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	Description   string  `json:"description"`
+	UseCount      int     `json:"useCount"`
+}
+
+// SendPaymentLinkPaidWebhook sends a webhook notification when a payment link is paid, to the configured URL
+// and to the link's own callback URL, signed with the payee's callback secret
+func (w *WebhookService) SendPaymentLinkPaidWebhook(link *PaymentLink, transaction *Transaction, callbackSecret string) {
+	if w.webhookURL == "" && link.CallbackURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := PaymentLinkPaidWebhookData{
+		TransactionID: transaction.ID,
+		PaymentLinkID: link.ID,
+		Code:          link.Code,
+		MerchantID:    link.MerchantID,
+		PayerUserID:   transaction.FromUserID,
+		PayerUsername: transaction.FromUsername,
+		PayeeUserID:   link.PayeeUserID,
+		PayeeUsername: link.PayeeUsername,
+		Amount:        transaction.Amount,
+		Currency:      link.Currency,
+		Description:   link.Description,
+		UseCount:      link.UseCount,
+	}
+
+	payload := WebhookPayload{
+		Event:     "payment_link_paid",
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+	if link.CallbackURL != "" && callbackSecret != "" {
+		w.sendCallback(link.CallbackURL, callbackSecret, payload)
+	}
+}
+
+// InvoiceWebhookData represents invoice webhook data
+type InvoiceWebhookData struct {
+	InvoiceID         int     `json:"invoiceId"`
+	Number            string  `json:"number"`
+	Status            string  `json:"status"`
+	IssuerUserID      int     `json:"issuerUserId"`
+	IssuerUsername    string  `json:"issuerUsername"`
+	RecipientUserID   int     `json:"recipientUserId"`
+	RecipientUsername string  `json:"recipientUsername"`
+	Total             float64 `json:"total"`
+	AmountPaid        float64 `json:"amountPaid"`
+	AmountDue         float64 `json:"amountDue"`
+	DueDate           string  `json:"dueDate"`
+	ReminderCount     int     `json:"reminderCount"`
+	TransactionID     *int    `json:"transactionId,omitempty"` // The payment, for "invoice_payment"
+	PaymentAmount     float64 `json:"paymentAmount,omitempty"`
+}
+
+// SendInvoiceWebhook sends a webhook notification about an invoice: "invoice_sent", "invoice_payment",
+// "invoice_void" or one of the reminder job's events. payment is the transaction for "invoice_payment".
+func (w *WebhookService) SendInvoiceWebhook(event string, invoice *Invoice, payment *Transaction) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := InvoiceWebhookData{
+		InvoiceID:         invoice.ID,
+		Number:            invoice.Number,
+		Status:            invoice.Status,
+		IssuerUserID:      invoice.IssuerUserID,
+		IssuerUsername:    invoice.IssuerUsername,
+		RecipientUserID:   invoice.RecipientUserID,
+		RecipientUsername: invoice.RecipientUsername,
+		Total:             invoice.Total,
+		AmountPaid:        invoice.AmountPaid,
+		AmountDue:         invoice.AmountDue,
+		DueDate:           invoice.DueDate,
+		ReminderCount:     invoice.ReminderCount,
+	}
+	if payment != nil {
+		data.TransactionID = &payment.ID
+		data.PaymentAmount = payment.Amount
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// AccountStatusWebhookData represents account status change webhook data
+type AccountStatusWebhookData struct {
+	UserID    int    `json:"userId"`
+	Username  string `json:"username"`
+	OldStatus string `json:"oldStatus"`
+	NewStatus string `json:"newStatus"`
+	Reason    string `json:"reason"`
+	Actor     string `json:"actor"`
+}
+
+// SendAccountStatusWebhook sends a webhook notification when an account's status changes
+func (w *WebhookService) SendAccountStatusWebhook(userID int, username, oldStatus, newStatus, reason, actor string) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := AccountStatusWebhookData{
+		UserID:    userID,
+		Username:  username,
+		OldStatus: oldStatus,
+		NewStatus: newStatus,
+		Reason:    reason,
+		Actor:     actor,
+	}
+
+	payload := WebhookPayload{
+		Event:     "account_status_changed",
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// CardAuthorizationWebhookData represents card payment and hold webhook data
+type CardAuthorizationWebhookData struct {
+	AuthorizationCode  string  `json:"authorizationCode"`
+	TransactionID      *int    `json:"transactionId,omitempty"`
+	CardLast4          string  `json:"cardLast4"`
+	CardholderUserID   int     `json:"cardholderUserId"`
+	CardholderUsername string  `json:"cardholderUsername"`
+	MerchantUserID     int     `json:"merchantUserId"`
+	MerchantUsername   string  `json:"merchantUsername"`
+	Amount             float64 `json:"amount"`
+	CapturedAmount     float64 `json:"capturedAmount"`
+	Description        string  `json:"description"`
+	Status             string  `json:"status"`
+}
+
+// SendCardAuthorizationWebhook sends a webhook notification for a card payment or hold event
+// ("card_payment", "card_hold_created", "card_hold_captured", "card_hold_voided", "card_hold_expired", "card_payment_reversed")
+func (w *WebhookService) SendCardAuthorizationWebhook(event string, authorization *CardAuthorization) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := CardAuthorizationWebhookData{
+		AuthorizationCode:  authorization.AuthorizationCode,
+		TransactionID:      authorization.TransactionID,
+		CardLast4:          authorization.CardLast4,
+		CardholderUserID:   authorization.CardholderUserID,
+		CardholderUsername: authorization.CardholderUsername,
+		MerchantUserID:     authorization.MerchantUserID,
+		MerchantUsername:   authorization.MerchantUsername,
+		Amount:             authorization.Amount,
+		CapturedAmount:     authorization.CapturedAmount,
+		Description:        authorization.Description,
+		Status:             authorization.Status,
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
+
+// CardLifecycleWebhookData represents card expiry and reissue webhook data
+type CardLifecycleWebhookData struct {
+	UserID            int        `json:"userId"`
+	Username          string     `json:"username"`
+	CardID            int        `json:"cardId"`
+	CardName          string     `json:"cardName"`
+	CardLast4         string     `json:"cardLast4"`
+	ExpiryDate        string     `json:"expiryDate"`
+	ExpiresAt         *time.Time `json:"expiresAt"`
+	ReplacementCardID int        `json:"replacementCardId,omitempty"`
+	ReplacementLast4  string     `json:"replacementLast4,omitempty"`
+	ReplacementExpiry string     `json:"replacementExpiryDate,omitempty"`
+}
+
+// SendCardLifecycleWebhook sends a webhook notification from the card expiry job
+// ("card_expiring", "card_reissued", "card_expired")
+func (w *WebhookService) SendCardLifecycleWebhook(event CardLifecycleEvent) {
+	if w.webhookURL == "" {
+		return // No webhook URL configured
+	}
+
+	data := CardLifecycleWebhookData{
+		UserID:     event.Card.UserID,
+		Username:   event.Username,
+		CardID:     event.Card.ID,
+		CardName:   event.Card.Name,
+		CardLast4:  cardLast4(event.Card.CardNumber),
+		ExpiryDate: event.Card.ExpiryDate,
+		ExpiresAt:  event.Card.ExpiresAt,
+	}
+	if event.Replacement != nil {
+		data.ReplacementCardID = event.Replacement.ID
+		data.ReplacementLast4 = cardLast4(event.Replacement.CardNumber)
+		data.ReplacementExpiry = event.Replacement.ExpiryDate
+	}
+
+	payload := WebhookPayload{
+		Event:     event.Event,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	w.sendWebhook(payload)
+}
@@ -655,6 +655,7 @@ class BankingApp {
                         <h4>${isIncoming ? 'Request from' : 'Request to'} ${otherAccount}</h4>
                         <p><strong>Reason:</strong> ${request.reason}</p>
                         <p><strong>Date:</strong> ${formattedDate}</p>
+                        ${request.amount_paid > 0 ? `<p><strong>Paid:</strong> ${CURRENCY_HTML}${request.amount_paid.toFixed(2)} (${CURRENCY_HTML}${request.amount_due.toFixed(2)} outstanding)</p>` : ''}
                     </div>
                     <div>
                         <div class="request-amount">${CURRENCY_HTML}${request.amount.toFixed(2)}</div>
@@ -800,6 +801,7 @@ class BankingApp {
                         <h4>${isIncoming ? 'Request from' : 'Request to'} ${otherParty}</h4>
                         <p>${request.reason}</p>
                         <p>Created: ${formattedDate}</p>
+                        ${request.amount_paid > 0 ? `<p>Paid: ${CURRENCY_HTML}${request.amount_paid.toFixed(2)} (${CURRENCY_HTML}${request.amount_due.toFixed(2)} outstanding)</p>` : ''}
                     </div>
                     <div style="text-align: right;">
                         <div class="request-amount">${CURRENCY_HTML}${request.amount.toFixed(2)}</div>
@@ -1307,6 +1309,7 @@ class BankingApp {
             // Get card data from backend
             const cardResponse = await this.api.getCard();
             const card = cardResponse.card;
+            this.currentCard = card;
             
             // Format card number for display
             const formattedCardNumber = this.formatCardNumber(card.card_number);
@@ -1460,8 +1463,9 @@ class BankingApp {
     }
 
     getCardData() {
-        const cardNumber = this.generateCardNumber(this.currentUser.accountNumber);
-        const expiryDate = this.generateExpiryDate();
+        // Card numbers are issued randomly by the backend; local generation is only an offline fallback
+        const cardNumber = this.currentCard ? this.currentCard.card_number : this.generateCardNumber(this.currentUser.accountNumber);
+        const expiryDate = this.currentCard ? this.currentCard.expiry_date : this.generateExpiryDate();
         
         return {
             cardNumber: cardNumber,